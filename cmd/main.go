@@ -1,17 +1,34 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"time"
 
+	"github.com/joeariasc/go-auth/internal/audit"
+	"github.com/joeariasc/go-auth/internal/auth/account"
+	"github.com/joeariasc/go-auth/internal/auth/authn"
+	"github.com/joeariasc/go-auth/internal/auth/federation"
 	"github.com/joeariasc/go-auth/internal/auth/fingerprint"
+	"github.com/joeariasc/go-auth/internal/auth/ldap"
+	"github.com/joeariasc/go-auth/internal/auth/oidc"
+	"github.com/joeariasc/go-auth/internal/auth/rbac"
+	"github.com/joeariasc/go-auth/internal/auth/risk"
+	"github.com/joeariasc/go-auth/internal/auth/saml"
+	"github.com/joeariasc/go-auth/internal/auth/scope"
+	"github.com/joeariasc/go-auth/internal/auth/session"
 	"github.com/joeariasc/go-auth/internal/auth/token"
 	"github.com/joeariasc/go-auth/internal/config"
 	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/geoip"
 	"github.com/joeariasc/go-auth/internal/handlers"
 	"github.com/joeariasc/go-auth/internal/middleware"
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/notify"
+	"github.com/joeariasc/go-auth/internal/webhook"
 )
 
 func main() {
@@ -32,24 +49,375 @@ func main() {
 		log.Fatalf("Error connecting to database: %v", err)
 	}
 
+	if err := rbac.Seed(conn, cfg.AdminUsernames); err != nil {
+		log.Fatalf("Error seeding roles: %v", err)
+	}
+
 	fingerprintManager := fingerprint.NewManager()
 
 	tokenConfig := token.ManagerConfig{
 		Conn:          conn,
 		TokenDuration: time.Duration(cfg.TokenDuration) * time.Second,
+		SecretKey:     []byte(cfg.SecretKey),
 	}
 
 	tokenManager := token.NewManager(tokenConfig)
 
+	webLimitAction, err := session.ParseLimitAction(cfg.WebSessionLimitAction)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mobileLimitAction, err := session.ParseLimitAction(cfg.MobileSessionLimitAction)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sessionConfig := session.ManagerConfig{
+		Conn:          conn,
+		TokenDuration: tokenConfig.TokenDuration,
+		Limits: map[models.ClientType]session.Limit{
+			models.WebClient:    {MaxSessions: cfg.WebSessionLimit, Action: webLimitAction},
+			models.MobileClient: {MaxSessions: cfg.MobileSessionLimit, Action: mobileLimitAction},
+		},
+	}
+
+	sessionManager := session.NewManager(sessionConfig)
+
+	var locator geoip.Locator
+	if cfg.GeoIPDbPath != "" {
+		geoReader, err := geoip.Open(cfg.GeoIPDbPath)
+		if err != nil {
+			log.Fatalf("Error loading GeoIP database: %v", err)
+		}
+		locator = geoReader
+	}
+
+	riskSignals := []risk.Signal{
+		risk.NewDevice{Weight: 30},
+		risk.Emulator{Weight: 40},
+		risk.UnusualHour{StartHour: cfg.UnusualHoursStart, EndHour: cfg.UnusualHoursEnd, Weight: 15},
+		risk.FailureVelocity{
+			Counter:   conn,
+			Window:    time.Duration(cfg.LoginFailureWindow) * time.Second,
+			Threshold: cfg.LoginFailureLimit,
+			Weight:    40,
+		},
+	}
+
+	if cfg.IPReputationList != "" {
+		ipList, err := risk.LoadIPList(cfg.IPReputationList)
+		if err != nil {
+			log.Fatalf("Error loading IP reputation list: %v", err)
+		}
+		riskSignals = append(riskSignals, risk.IPReputation{List: ipList, Weight: 60})
+	}
+
+	if locator != nil {
+		riskSignals = append(riskSignals, risk.ImpossibleTravel{
+			Locator:       locator,
+			History:       conn,
+			MaxSpeedKmh:   float64(cfg.TravelMaxSpeedKmh),
+			MinDistanceKm: float64(cfg.TravelMinDistanceKm),
+			Weight:        30,
+		})
+	}
+
+	riskEngine := risk.NewEngine(risk.EngineConfig{
+		Policy: risk.Policy{
+			MFAThreshold:  cfg.RiskMFAThreshold,
+			DenyThreshold: cfg.RiskDenyThreshold,
+		},
+		Signals:  riskSignals,
+		Recorder: conn,
+	})
+
+	notifierConfig := notify.NotifierConfig{
+		Mailer:  notify.LogMailer{},
+		Locator: locator,
+		BaseURL: cfg.PublicURL,
+	}
+
+	if cfg.SmtpAddr != "" {
+		mailer, err := notify.NewSMTPMailer(cfg.SmtpAddr, cfg.SmtpUsername, cfg.SmtpPassword, cfg.MailFrom)
+		if err != nil {
+			log.Fatal(err)
+		}
+		notifierConfig.Mailer = mailer
+	}
+
+	notifier := notify.NewNotifier(notifierConfig)
+
+	purger := account.NewPurger(account.PurgerConfig{
+		Store:    conn,
+		Interval: time.Duration(cfg.AccountPurgeInterval) * time.Second,
+	})
+	go purger.Run(context.Background())
+
+	auditLog := audit.NewLogger(conn)
+
+	if cfg.AuditSigningKey != "" {
+		signingKey, err := audit.ParseSigningKey(cfg.AuditSigningKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		checkpointer := audit.NewCheckpointer(audit.CheckpointerConfig{
+			Store:    conn,
+			Key:      signingKey,
+			Interval: time.Duration(cfg.AuditCheckpointInterval) * time.Second,
+		})
+		go checkpointer.Run(context.Background())
+	} else {
+		log.Printf("Warning: AUDIT_SIGNING_KEY is empty, audit checkpoints are disabled")
+	}
+
+	dispatcher := webhook.NewDispatcher(webhook.DispatcherConfig{
+		Store:       conn,
+		Interval:    time.Duration(cfg.WebhookDispatchInterval) * time.Second,
+		MaxAttempts: cfg.WebhookMaxAttempts,
+		BaseBackoff: time.Duration(cfg.WebhookBaseBackoff) * time.Second,
+		MaxBackoff:  time.Duration(cfg.WebhookMaxBackoff) * time.Second,
+	})
+	go dispatcher.Run(context.Background())
+
+	var oidcKey *oidc.SigningKey
+	if cfg.OIDCSigningKeyFile != "" {
+		pemBytes, err := os.ReadFile(cfg.OIDCSigningKeyFile)
+		if err != nil {
+			log.Fatalf("Error reading OIDC signing key: %v", err)
+		}
+		if oidcKey, err = oidc.ParseSigningKey(pemBytes); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		log.Printf("Warning: OIDC_SIGNING_KEY_FILE is empty, ID tokens are signed with a key generated on startup")
+		if oidcKey, err = oidc.GenerateSigningKey(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	scopes := scope.DefaultRegistry()
+	scopeNames := []string{}
+	for _, s := range scopes.All() {
+		scopeNames = append(scopeNames, s.Name)
+	}
+
+	oidcProvider := oidc.NewProvider(oidc.ProviderConfig{
+		Issuer:     cfg.PublicURL,
+		Key:        oidcKey,
+		IDTokenTTL: time.Duration(cfg.OIDCIDTokenTTL) * time.Second,
+		Scopes:     scopeNames,
+	})
+
+	var federatedProviders []*federation.Provider
+	for _, provider := range cfg.FederatedProviders {
+		federatedProviders = append(federatedProviders, federation.NewProvider(federation.ProviderConfig{
+			Name:         provider.Name,
+			DisplayName:  provider.DisplayName,
+			DiscoveryURL: provider.DiscoveryURL,
+			ClientID:     provider.ClientID,
+			ClientSecret: provider.ClientSecret,
+			Scopes:       provider.Scopes,
+			RedirectURL:  cfg.PublicURL + "/api/auth/federated/" + provider.Name + "/callback",
+			Provision:    provider.Provision,
+			HTTPClient:   &http.Client{Timeout: 10 * time.Second},
+		}))
+	}
+
+	var samlProviders []*saml.Provider
+	for _, provider := range cfg.SAMLProviders {
+		pemBytes, err := os.ReadFile(provider.IdPCertificateFile)
+		if err != nil {
+			log.Fatalf("Error reading SAML identity provider certificate: %v", err)
+		}
+		certificates, err := saml.ParseCertificates(pemBytes)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		samlProviders = append(samlProviders, saml.NewProvider(saml.ProviderConfig{
+			Name:              provider.Name,
+			DisplayName:       provider.DisplayName,
+			EntityID:          cfg.PublicURL + "/api/auth/saml/" + provider.Name + "/metadata",
+			ACSURL:            cfg.PublicURL + "/api/auth/saml/" + provider.Name + "/acs",
+			IdPEntityID:       provider.IdPEntityID,
+			IdPSSOURL:         provider.IdPSSOURL,
+			IdPCertificates:   certificates,
+			UsernameAttribute: provider.UsernameAttribute,
+			EmailAttribute:    provider.EmailAttribute,
+			Provision:         provider.Provision,
+		}))
+	}
+
+	authenticators := authn.Chain{}
+	if cfg.LDAPURL != "" {
+		authenticators = append(authenticators, ldap.NewAuthenticator(ldap.Config{
+			URL:             cfg.LDAPURL,
+			BindDN:          cfg.LDAPBindDN,
+			BindPassword:    cfg.LDAPBindPassword,
+			BaseDN:          cfg.LDAPBaseDN,
+			UserAttribute:   cfg.LDAPUserAttribute,
+			UserObjectClass: cfg.LDAPUserObjectClass,
+			EmailAttribute:  cfg.LDAPEmailAttribute,
+			GroupAttribute:  cfg.LDAPGroupAttribute,
+			GroupRoles:      cfg.LDAPGroupRoles,
+			Provision:       cfg.LDAPProvision,
+			Timeout:         time.Duration(cfg.LDAPTimeout) * time.Second,
+		}))
+	}
+	authenticators = append(authenticators, authn.Local{Store: conn})
+
 	// Initialize handlers & middlweware
-	authHandler := handlers.NewHandler(fingerprintManager, tokenManager, conn)
-	middleware := middleware.NewMiddleware(fingerprintManager, tokenManager)
+	authHandler := handlers.NewHandler(handlers.HandlerConfig{
+		FingerprintManager: fingerprintManager,
+		TokenManager:       tokenManager,
+		SessionManager:     sessionManager,
+		RiskEngine:         riskEngine,
+		Scopes:             scopes,
+		Notifier:           notifier,
+		Locator:            locator,
+		AuditLog:           auditLog,
+		OIDC:               oidcProvider,
+		Federation:         federation.NewRegistry(federatedProviders...),
+		SAML:               saml.NewRegistry(samlProviders...),
+		Authenticator:      authenticators,
+		Conn:               conn,
+
+		DeletionGracePeriod: time.Duration(cfg.AccountDeletionGraceDays) * 24 * time.Hour,
+		ReauthMaxAge:        time.Duration(cfg.ReauthMaxAge) * time.Second,
+
+		OAuthLoginURL:        cfg.OAuthLoginURL,
+		OAuthCodeTTL:         time.Duration(cfg.OAuthCodeTTL) * time.Second,
+		OAuthRefreshTokenTTL: time.Duration(cfg.OAuthRefreshTokenTTL) * time.Second,
+
+		OAuthDeviceURL:          cfg.OAuthDeviceURL,
+		OAuthDeviceCodeTTL:      time.Duration(cfg.OAuthDeviceCodeTTL) * time.Second,
+		OAuthDevicePollInterval: time.Duration(cfg.OAuthDevicePollInterval) * time.Second,
+
+		FederatedLoginURL: cfg.FederatedLoginURL,
+
+		SCIMBaseURL: cfg.PublicURL + "/scim/v2",
+	})
+	middleware := middleware.NewMiddleware(middleware.MiddlewareConfig{
+		FingerprintManager: fingerprintManager,
+		TokenManager:       tokenManager,
+		RiskEngine:         riskEngine,
+		AuditLog:           auditLog,
+		Conn:               conn,
+	})
 
 	// Setup routes with middleware
 	mux := http.NewServeMux()
 	mux.HandleFunc("POST /api/auth/register", authHandler.Register)
 	mux.HandleFunc("POST /api/auth/login", authHandler.Login)
+	mux.HandleFunc("GET /api/auth/sessions/revoke", authHandler.ConfirmSessionRevocation)
+	mux.HandleFunc("POST /api/auth/sessions/revoke", authHandler.RevokeSessionFromLink)
+	mux.HandleFunc("POST /api/auth/logout", middleware.AuthMiddleware(authHandler.Logout))
 	mux.HandleFunc("GET /api/auth/verify", middleware.AuthMiddleware(authHandler.Verify))
+	mux.HandleFunc("GET /api/auth/scopes", authHandler.ListScopes)
+
+	// Sign-in with upstream identity providers
+	mux.HandleFunc("GET /api/auth/federated", authHandler.ListFederatedProviders)
+	mux.HandleFunc("POST /api/auth/federated/{provider}/login", authHandler.StartFederatedLogin)
+	mux.HandleFunc("GET /api/auth/federated/{provider}/callback", authHandler.FederatedCallback)
+	mux.HandleFunc("POST /api/auth/federated/complete", authHandler.CompleteFederatedLogin)
+	mux.HandleFunc("GET /api/auth/saml/{provider}/metadata", authHandler.SAMLMetadata)
+	mux.HandleFunc("POST /api/auth/saml/{provider}/acs", authHandler.SAMLAssertionConsumer)
+
+	// OAuth authorization server
+	mux.HandleFunc("GET /oauth/authorize", authHandler.Authorize)
+	mux.HandleFunc("POST /oauth/token", authHandler.Token)
+	mux.HandleFunc("POST /oauth/introspect", authHandler.Introspect)
+	mux.HandleFunc("POST /oauth/revoke", authHandler.Revoke)
+	mux.HandleFunc("POST /api/oauth/authorize", middleware.AuthMiddleware(authHandler.ApproveAuthorization))
+	mux.HandleFunc("POST /oauth/device_authorization", authHandler.DeviceAuthorization)
+	mux.HandleFunc("GET /oauth/device", authHandler.DeviceVerification)
+	mux.HandleFunc("GET /api/oauth/device", middleware.AuthMiddleware(authHandler.GetDeviceGrant))
+	mux.HandleFunc("POST /api/oauth/device", middleware.AuthMiddleware(authHandler.DecideDeviceGrant))
+
+	// OpenID Connect provider
+	mux.HandleFunc("GET /.well-known/openid-configuration", oidcProvider.ServeDiscovery)
+	mux.HandleFunc("GET /oauth/jwks", oidcProvider.ServeJWKS)
+	mux.HandleFunc("GET /oauth/logout", authHandler.EndSession)
+
+	// Self-service routes, authenticated and limited by the token's scopes
+	withScope := func(name string, next http.HandlerFunc) http.HandlerFunc {
+		return middleware.AuthMiddleware(middleware.RequireScope(name)(next))
+	}
+
+	mux.HandleFunc("GET /oauth/userinfo", withScope(oidc.ScopeOpenID, authHandler.UserInfo))
+	mux.HandleFunc("POST /oauth/userinfo", withScope(oidc.ScopeOpenID, authHandler.UserInfo))
+
+	mux.HandleFunc("GET /api/me", withScope("account", authHandler.GetProfile))
+	mux.HandleFunc("PATCH /api/me", withScope("account", authHandler.UpdateProfile))
+	mux.HandleFunc("DELETE /api/me", withScope("account", authHandler.DeleteAccount))
+	mux.HandleFunc("GET /api/me/export", withScope("account", authHandler.ExportData))
+	mux.HandleFunc("GET /api/me/devices", withScope("devices", authHandler.ListDevices))
+	mux.HandleFunc("PATCH /api/me/devices/{id}", withScope("devices", authHandler.UpdateDevice))
+	mux.HandleFunc("DELETE /api/me/devices/{id}", withScope("devices", authHandler.DeleteDevice))
+	mux.HandleFunc("GET /api/me/identities", withScope("account", authHandler.ListIdentities))
+	mux.HandleFunc("POST /api/me/identities/{provider}", withScope("account", authHandler.LinkIdentity))
+	mux.HandleFunc("DELETE /api/me/identities/{provider}", withScope("account", authHandler.UnlinkIdentity))
+	mux.HandleFunc("GET /api/me/sessions", withScope("sessions", authHandler.ListSessions))
+	mux.HandleFunc("DELETE /api/me/sessions/{id}", withScope("sessions", authHandler.DeleteSession))
+	mux.HandleFunc("GET /api/me/tokens", withScope("tokens", authHandler.ListPersonalTokens))
+	mux.HandleFunc("POST /api/me/tokens", withScope("tokens", authHandler.CreatePersonalToken))
+	mux.HandleFunc("DELETE /api/me/tokens/{id}", withScope("tokens", authHandler.RevokePersonalToken))
+
+	// Administration, each route requires a permission and the matching scope
+	withPermission := func(permission string, next http.HandlerFunc) http.HandlerFunc {
+		return withScope(permission, middleware.RequirePermission(permission)(next))
+	}
+
+	mux.HandleFunc("GET /api/admin/permissions", withPermission(rbac.PermRolesRead, authHandler.ListPermissions))
+	mux.HandleFunc("POST /api/admin/permissions", withPermission(rbac.PermRolesWrite, authHandler.CreatePermission))
+	mux.HandleFunc("GET /api/admin/roles", withPermission(rbac.PermRolesRead, authHandler.ListRoles))
+	mux.HandleFunc("POST /api/admin/roles", withPermission(rbac.PermRolesWrite, authHandler.CreateRole))
+	mux.HandleFunc("PATCH /api/admin/roles/{name}", withPermission(rbac.PermRolesWrite, authHandler.UpdateRole))
+	mux.HandleFunc("DELETE /api/admin/roles/{name}", withPermission(rbac.PermRolesWrite, authHandler.DeleteRole))
+	mux.HandleFunc("GET /api/admin/users", withPermission(rbac.PermUsersRead, authHandler.ListUsers))
+	mux.HandleFunc("GET /api/admin/users/{id}", withPermission(rbac.PermUsersRead, authHandler.GetUser))
+	mux.HandleFunc("PATCH /api/admin/users/{id}", withPermission(rbac.PermUsersWrite, authHandler.UpdateUser))
+	mux.HandleFunc("DELETE /api/admin/users/{id}", withPermission(rbac.PermUsersWrite, authHandler.DeleteUser))
+	mux.HandleFunc("PUT /api/admin/users/{id}/status", withPermission(rbac.PermUsersWrite, authHandler.ChangeUserStatus))
+	mux.HandleFunc("GET /api/admin/users/{id}/status/history", withPermission(rbac.PermUsersRead, authHandler.ListUserStatusHistory))
+	mux.HandleFunc("GET /api/admin/users/{id}/sessions", withPermission(rbac.PermUsersRead, authHandler.ListUserSessions))
+	mux.HandleFunc("POST /api/admin/users/{id}/logout", withPermission(rbac.PermUsersWrite, authHandler.ForceLogout))
+	mux.HandleFunc("GET /api/admin/users/{id}/roles", withPermission(rbac.PermUsersRead, authHandler.GetUserRoles))
+	mux.HandleFunc("PUT /api/admin/users/{id}/roles/{role}", withPermission(rbac.PermUsersWrite, authHandler.AssignUserRole))
+	mux.HandleFunc("DELETE /api/admin/users/{id}/roles/{role}", withPermission(rbac.PermUsersWrite, authHandler.RemoveUserRole))
+
+	mux.HandleFunc("GET /api/admin/audit-events", withPermission(rbac.PermAuditRead, authHandler.ListAuditEvents))
+
+	mux.HandleFunc("GET /api/admin/webhooks", withPermission(rbac.PermWebhooksRead, authHandler.ListWebhooks))
+	mux.HandleFunc("POST /api/admin/webhooks", withPermission(rbac.PermWebhooksWrite, authHandler.CreateWebhook))
+	mux.HandleFunc("PATCH /api/admin/webhooks/{id}", withPermission(rbac.PermWebhooksWrite, authHandler.UpdateWebhook))
+	mux.HandleFunc("DELETE /api/admin/webhooks/{id}", withPermission(rbac.PermWebhooksWrite, authHandler.DeleteWebhook))
+	mux.HandleFunc("GET /api/admin/webhooks/deliveries", withPermission(rbac.PermWebhooksRead, authHandler.ListWebhookDeliveries))
+	mux.HandleFunc("POST /api/admin/webhooks/deliveries/{id}/retry", withPermission(rbac.PermWebhooksWrite, authHandler.RetryWebhookDelivery))
+
+	mux.HandleFunc("GET /api/admin/oauth/clients", withPermission(rbac.PermClientsRead, authHandler.ListClients))
+	mux.HandleFunc("POST /api/admin/oauth/clients", withPermission(rbac.PermClientsWrite, authHandler.CreateClient))
+	mux.HandleFunc("GET /api/admin/oauth/clients/{clientId}", withPermission(rbac.PermClientsRead, authHandler.GetClient))
+	mux.HandleFunc("PATCH /api/admin/oauth/clients/{clientId}", withPermission(rbac.PermClientsWrite, authHandler.UpdateClient))
+	mux.HandleFunc("DELETE /api/admin/oauth/clients/{clientId}", withPermission(rbac.PermClientsWrite, authHandler.DeleteClient))
+	mux.HandleFunc("POST /api/admin/oauth/clients/{clientId}/secret", withPermission(rbac.PermClientsWrite, authHandler.RotateClientSecret))
+
+	// SCIM provisioning, for identity providers holding the scim:provision
+	// permission, usually OAuth clients using the client credentials grant
+	mux.HandleFunc("GET /scim/v2/Users", withPermission(rbac.PermSCIMProvision, authHandler.SCIMListUsers))
+	mux.HandleFunc("POST /scim/v2/Users", withPermission(rbac.PermSCIMProvision, authHandler.SCIMCreateUser))
+	mux.HandleFunc("GET /scim/v2/Users/{id}", withPermission(rbac.PermSCIMProvision, authHandler.SCIMGetUser))
+	mux.HandleFunc("PUT /scim/v2/Users/{id}", withPermission(rbac.PermSCIMProvision, authHandler.SCIMReplaceUser))
+	mux.HandleFunc("PATCH /scim/v2/Users/{id}", withPermission(rbac.PermSCIMProvision, authHandler.SCIMPatchUser))
+	mux.HandleFunc("DELETE /scim/v2/Users/{id}", withPermission(rbac.PermSCIMProvision, authHandler.SCIMDeleteUser))
+	mux.HandleFunc("GET /scim/v2/Groups", withPermission(rbac.PermSCIMProvision, authHandler.SCIMListGroups))
+	mux.HandleFunc("POST /scim/v2/Groups", withPermission(rbac.PermSCIMProvision, authHandler.SCIMCreateGroup))
+	mux.HandleFunc("GET /scim/v2/Groups/{id}", withPermission(rbac.PermSCIMProvision, authHandler.SCIMGetGroup))
+	mux.HandleFunc("PUT /scim/v2/Groups/{id}", withPermission(rbac.PermSCIMProvision, authHandler.SCIMReplaceGroup))
+	mux.HandleFunc("PATCH /scim/v2/Groups/{id}", withPermission(rbac.PermSCIMProvision, authHandler.SCIMPatchGroup))
+	mux.HandleFunc("DELETE /scim/v2/Groups/{id}", withPermission(rbac.PermSCIMProvision, authHandler.SCIMDeleteGroup))
+
 	mux.HandleFunc("GET /api/test", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("Hello World!"))
 	})
@@ -0,0 +1,127 @@
+// Command verify-audit walks the audit log hash chain and checks the signed
+// checkpoints, reporting the first broken link.
+package main
+
+import (
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/joeariasc/go-auth/internal/audit"
+	"github.com/joeariasc/go-auth/internal/config"
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+)
+
+const batchSize = 1000
+
+func main() {
+	configFile := flag.String("env", "./.env", "environment file with the database settings")
+	publicKeyFlag := flag.String("public-key", "", "base64 Ed25519 public key of the checkpoints (default: derived from AUDIT_SIGNING_KEY)")
+	flag.Parse()
+
+	cfg, err := config.LoadEnvFile(*configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	publicKey, err := checkpointKey(*publicKeyFlag, cfg.AuditSigningKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Without the key, a rewritten log could come with checkpoints of its own
+	if publicKey == nil {
+		log.Fatal("A key is required to check the checkpoints: pass -public-key or set AUDIT_SIGNING_KEY")
+	}
+
+	// The check only reads, so the session refuses writes and the schema is
+	// left as it is
+	stringConnection := fmt.Sprintf(
+		"postgres://%s:%s@%s:%d/%s?sslmode=disable&default_transaction_read_only=on",
+		cfg.DbUser, cfg.DbPassword, cfg.DbHost, cfg.DbPort, cfg.DbName)
+
+	conn, err := db.Open(stringConnection)
+	if err != nil {
+		log.Fatalf("Error connecting to database: %v", err)
+	}
+
+	if err := verify(conn, publicKey); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func checkpointKey(publicKey string, signingKey string) (ed25519.PublicKey, error) {
+	if publicKey != "" {
+		return audit.ParsePublicKey(publicKey)
+	}
+	if signingKey != "" {
+		key, err := audit.ParseSigningKey(signingKey)
+		if err != nil {
+			return nil, err
+		}
+		return key.Public().(ed25519.PublicKey), nil
+	}
+	return nil, nil
+}
+
+func verify(conn *db.Connection, publicKey ed25519.PublicKey) error {
+	checkpoints, err := conn.ListAuditCheckpoints()
+	if err != nil {
+		return err
+	}
+
+	// Checkpoints by the event they vouch for
+	pending := map[int64][]*entity.AuditCheckpoint{}
+	for _, checkpoint := range checkpoints {
+		if err := audit.VerifyCheckpoint(publicKey, checkpoint); err != nil {
+			return fmt.Errorf("checkpoint %d: %w", checkpoint.Id, err)
+		}
+		pending[checkpoint.EventId] = append(pending[checkpoint.EventId], checkpoint)
+	}
+
+	verifier := &audit.ChainVerifier{}
+	var afterId int64
+	for {
+		events, err := conn.ListAuditChain(afterId, batchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			if err := verifier.Next(event); err != nil {
+				return err
+			}
+			for _, checkpoint := range pending[event.Id] {
+				if checkpoint.Hash != event.Hash {
+					return &audit.BrokenLinkError{
+						EventId: event.Id,
+						Reason:  fmt.Sprintf("hash differs from checkpoint %d", checkpoint.Id),
+					}
+				}
+			}
+			delete(pending, event.Id)
+			afterId = event.Id
+		}
+
+		if len(events) < batchSize {
+			break
+		}
+	}
+
+	// A checkpoint for an event that no longer exists means the log was cut
+	if len(pending) > 0 {
+		eventId := slices.Min(slices.Collect(maps.Keys(pending)))
+		return &audit.BrokenLinkError{
+			EventId: eventId,
+			Reason:  fmt.Sprintf("event of checkpoint %d is missing", pending[eventId][0].Id),
+		}
+	}
+
+	fmt.Printf("Audit log intact: %d events, %d checkpoints\n", verifier.Verified, len(checkpoints))
+	return nil
+}
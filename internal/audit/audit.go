@@ -0,0 +1,174 @@
+package audit
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+)
+
+// Event types
+const (
+	EventLoginSucceeded      = "login.succeeded"
+	EventLoginFailed         = "login.failed"
+	EventLogout              = "logout"
+	EventUserRegistered      = "user.registered"
+	EventTokenRejected       = "token.verification_failed"
+	EventProfileUpdated      = "profile.updated"
+	EventDataExported        = "account.exported"
+	EventDeletionRequested   = "account.deletion_requested"
+	EventDeletionCancelled   = "account.deletion_cancelled"
+	EventDeviceUpdated       = "device.updated"
+	EventDeviceRemoved       = "device.removed"
+	EventSessionRevoked      = "session.revoked"
+	EventUserUpdated         = "admin.user_updated"
+	EventUserStatusChanged   = "admin.user_status_changed"
+	EventUserSessionsRevoked = "admin.user_sessions_revoked"
+	EventRoleAssigned        = "admin.role_assigned"
+	EventRoleRemoved         = "admin.role_removed"
+	EventRoleCreated         = "admin.role_created"
+	EventRoleUpdated         = "admin.role_updated"
+	EventRoleDeleted         = "admin.role_deleted"
+	EventPermissionCreated   = "admin.permission_created"
+	EventWebhookCreated      = "admin.webhook_created"
+	EventWebhookUpdated      = "admin.webhook_updated"
+	EventWebhookDeleted      = "admin.webhook_deleted"
+	EventWebhookRetried      = "admin.webhook_delivery_retried"
+	EventClientCreated       = "admin.oauth_client_created"
+	EventClientUpdated       = "admin.oauth_client_updated"
+	EventClientDeleted       = "admin.oauth_client_deleted"
+	EventClientSecretRotated = "admin.oauth_client_secret_rotated"
+	EventOAuthAuthorized     = "oauth.authorized"
+	EventOAuthTokenIssued    = "oauth.token_issued"
+	EventOAuthTokenRevoked   = "oauth.token_revoked"
+	// EventOAuthReplay is a used authorization code or rotated refresh token
+	// presented again, which revokes everything issued from it
+	EventOAuthReplay = "oauth.replay_detected"
+	// EventOAuthClientAuthFailed is a confidential client presenting wrong
+	// credentials at the token endpoint
+	EventOAuthClientAuthFailed = "oauth.client_authentication_failed"
+	// EventOAuthUserCodeRejected is an unknown or expired user code entered
+	// on the device verification page
+	EventOAuthUserCodeRejected = "oauth.user_code_rejected"
+	EventIdentityLinked        = "identity.linked"
+	EventIdentityUnlinked      = "identity.unlinked"
+	EventPersonalTokenCreated  = "personal_token.created"
+	EventPersonalTokenRevoked  = "personal_token.revoked"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type Outcome string
+
+const (
+	Success Outcome = "success"
+	Failure Outcome = "failure"
+	// Denied is a request refused by policy, e.g. by the risk engine or
+	// because the account is suspended
+	Denied Outcome = "denied"
+)
+
+// Target types
+const (
+	TargetUser          = "user"
+	TargetRole          = "role"
+	TargetPermission    = "permission"
+	TargetDevice        = "device"
+	TargetSession       = "session"
+	TargetWebhook       = "webhook"
+	TargetClient        = "oauth_client"
+	TargetPersonalToken = "personal_token"
+)
+
+// Event describes something that happened. Actor is the user performing the
+// action, Target what it was performed on.
+type Event struct {
+	Type       string
+	Outcome    Outcome
+	ActorId    int64
+	Actor      string
+	TargetType string
+	TargetId   string
+	IP         string
+	ClientType string
+	Details    map[string]any
+}
+
+// Recorder persists audit events, implemented by db.Connection. It links the
+// event to the chain by setting PrevHash before calling seal.
+type Recorder interface {
+	InsertAuditEvent(event *entity.AuditEvent, seal func(event *entity.AuditEvent)) error
+}
+
+type Logger struct {
+	recorder Recorder
+	now      func() time.Time
+}
+
+func NewLogger(recorder Recorder) *Logger {
+	return &Logger{recorder: recorder, now: time.Now}
+}
+
+// Record appends an event to the audit log. Failing to do so must not fail
+// the request being audited, so errors are only logged. A nil Logger
+// discards events.
+func (l *Logger) Record(event Event) {
+	if l == nil {
+		return
+	}
+	if _, err := l.record(event); err != nil {
+		log.Printf("Failed to record audit event %s: %v", event.Type, err)
+	}
+}
+
+func (l *Logger) record(event Event) (*entity.AuditEvent, error) {
+	details := event.Details
+	if details == nil {
+		details = map[string]any{}
+	}
+
+	encoded, err := json.Marshal(details)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &entity.AuditEvent{
+		Type:       event.Type,
+		Outcome:    string(event.Outcome),
+		ActorId:    event.ActorId,
+		Actor:      event.Actor,
+		TargetType: event.TargetType,
+		TargetId:   event.TargetId,
+		IP:         event.IP,
+		ClientType: event.ClientType,
+		Details:    encoded,
+		// The database stores microseconds, hash what will be read back
+		CreatedAt: l.now().UTC().Truncate(time.Microsecond),
+	}
+
+	return entry, l.recorder.InsertAuditEvent(entry, Seal)
+}
+
+// EncodeCursor turns the id of the last event of a page into an opaque
+// pagination cursor
+func EncodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+// DecodeCursor returns the event id a cursor continues after
+func DecodeCursor(cursor string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, ErrInvalidCursor
+	}
+	return id, nil
+}
@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRecorder struct {
+	events []*entity.AuditEvent
+	err    error
+}
+
+func (r *fakeRecorder) InsertAuditEvent(event *entity.AuditEvent, seal func(event *entity.AuditEvent)) error {
+	if len(r.events) > 0 {
+		event.PrevHash = r.events[len(r.events)-1].Hash
+	}
+	seal(event)
+	event.Id = int64(len(r.events) + 1)
+	r.events = append(r.events, event)
+	return r.err
+}
+
+func TestRecord(t *testing.T) {
+	recorder := &fakeRecorder{}
+	logger := NewLogger(recorder)
+	now := time.Date(2025, 4, 2, 10, 0, 0, 0, time.UTC)
+	logger.now = func() time.Time { return now }
+
+	logger.Record(Event{
+		Type:       EventRoleAssigned,
+		Outcome:    Success,
+		ActorId:    1,
+		Actor:      "admin",
+		TargetType: TargetUser,
+		TargetId:   "7",
+		IP:         "203.0.113.9",
+		ClientType: "web",
+		Details:    map[string]any{"role": "support"},
+	})
+
+	require.Len(t, recorder.events, 1)
+	event := recorder.events[0]
+	assert.Equal(t, EventRoleAssigned, event.Type)
+	assert.Equal(t, "success", event.Outcome)
+	assert.Equal(t, int64(1), event.ActorId)
+	assert.Equal(t, "7", event.TargetId)
+	assert.JSONEq(t, `{"role":"support"}`, string(event.Details))
+	assert.Equal(t, now, event.CreatedAt)
+}
+
+func TestRecordWithoutDetails(t *testing.T) {
+	recorder := &fakeRecorder{err: errors.New("database is down")}
+
+	NewLogger(recorder).Record(Event{Type: EventLogout, Outcome: Success})
+
+	require.Len(t, recorder.events, 1)
+	assert.JSONEq(t, `{}`, string(recorder.events[0].Details))
+}
+
+func TestCursor(t *testing.T) {
+	id, err := DecodeCursor(EncodeCursor(4711))
+	require.NoError(t, err)
+	assert.Equal(t, int64(4711), id)
+
+	for _, cursor := range []string{"", "!!", EncodeCursor(0), "YWJj"} {
+		_, err := DecodeCursor(cursor)
+		assert.ErrorIs(t, err, ErrInvalidCursor, cursor)
+	}
+}
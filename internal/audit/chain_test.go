@@ -0,0 +1,142 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func buildChain(t *testing.T, n int) []*entity.AuditEvent {
+	recorder := &fakeRecorder{}
+	logger := NewLogger(recorder)
+	now := time.Date(2025, 5, 1, 8, 0, 0, 123456789, time.UTC)
+	logger.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	for i := 0; i < n; i++ {
+		logger.Record(Event{Type: EventLoginSucceeded, Outcome: Success, Actor: "joe", Details: map[string]any{"n": i}})
+	}
+	require.Len(t, recorder.events, n)
+	return recorder.events
+}
+
+func verifyAll(events []*entity.AuditEvent) (*ChainVerifier, error) {
+	verifier := &ChainVerifier{}
+	for _, event := range events {
+		if err := verifier.Next(event); err != nil {
+			return verifier, err
+		}
+	}
+	return verifier, nil
+}
+
+func TestChainVerifies(t *testing.T) {
+	events := buildChain(t, 5)
+
+	assert.Empty(t, events[0].PrevHash)
+	assert.Equal(t, events[0].Hash, events[1].PrevHash)
+
+	verifier, err := verifyAll(events)
+	require.NoError(t, err)
+	assert.Equal(t, 5, verifier.Verified)
+}
+
+func TestChainDetectsTampering(t *testing.T) {
+	events := buildChain(t, 5)
+	events[2].Details = []byte(`{"n":42}`)
+
+	_, err := verifyAll(events)
+	var broken *BrokenLinkError
+	require.ErrorAs(t, err, &broken)
+	assert.Equal(t, int64(3), broken.EventId)
+	assert.ErrorIs(t, err, ErrBrokenChain)
+}
+
+func TestChainDetectsRemoval(t *testing.T) {
+	events := buildChain(t, 5)
+	events = append(events[:1], events[2:]...)
+
+	_, err := verifyAll(events)
+	var broken *BrokenLinkError
+	require.ErrorAs(t, err, &broken)
+	assert.Equal(t, int64(3), broken.EventId)
+}
+
+func TestChainRejectsUnhashedEvents(t *testing.T) {
+	events := buildChain(t, 2)
+	events[0].Id, events[1].Id = 2, 3
+	unhashed := &entity.AuditEvent{Id: 1}
+
+	_, err := verifyAll(append([]*entity.AuditEvent{unhashed}, events...))
+	var broken *BrokenLinkError
+	require.ErrorAs(t, err, &broken)
+	assert.Equal(t, int64(1), broken.EventId)
+
+	events[1].Hash = ""
+	_, err = verifyAll(events)
+	assert.ErrorIs(t, err, ErrBrokenChain)
+}
+
+type fakeCheckpointStore struct {
+	latest      *entity.AuditEvent
+	checkpoints []*entity.AuditCheckpoint
+}
+
+func (s *fakeCheckpointStore) LatestAuditEvent() (*entity.AuditEvent, error) {
+	if s.latest == nil {
+		return nil, db.ErrAuditEventNotFound
+	}
+	return s.latest, nil
+}
+
+func (s *fakeCheckpointStore) LatestAuditCheckpoint() (*entity.AuditCheckpoint, error) {
+	if len(s.checkpoints) == 0 {
+		return nil, db.ErrCheckpointNotFound
+	}
+	return s.checkpoints[len(s.checkpoints)-1], nil
+}
+
+func (s *fakeCheckpointStore) InsertAuditCheckpoint(checkpoint *entity.AuditCheckpoint) error {
+	s.checkpoints = append(s.checkpoints, checkpoint)
+	return nil
+}
+
+func TestCheckpoint(t *testing.T) {
+	seed := make([]byte, ed25519.SeedSize)
+	key, err := ParseSigningKey(base64.StdEncoding.EncodeToString(seed))
+	require.NoError(t, err)
+
+	store := &fakeCheckpointStore{}
+	checkpointer := NewCheckpointer(CheckpointerConfig{Store: store, Key: key, Interval: time.Hour})
+
+	checkpoint, err := checkpointer.Checkpoint()
+	require.NoError(t, err)
+	assert.Nil(t, checkpoint)
+
+	events := buildChain(t, 3)
+	store.latest = events[2]
+
+	checkpoint, err = checkpointer.Checkpoint()
+	require.NoError(t, err)
+	require.NotNil(t, checkpoint)
+	assert.Equal(t, events[2].Hash, checkpoint.Hash)
+
+	publicKey := key.Public().(ed25519.PublicKey)
+	assert.NoError(t, VerifyCheckpoint(publicKey, checkpoint))
+
+	// Nothing new since the last checkpoint
+	again, err := checkpointer.Checkpoint()
+	require.NoError(t, err)
+	assert.Nil(t, again)
+
+	checkpoint.Hash = events[1].Hash
+	assert.ErrorIs(t, VerifyCheckpoint(publicKey, checkpoint), ErrInvalidCheckpoint)
+}
@@ -0,0 +1,112 @@
+package audit
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+)
+
+// CheckpointStore is implemented by db.Connection
+type CheckpointStore interface {
+	LatestAuditEvent() (*entity.AuditEvent, error)
+	LatestAuditCheckpoint() (*entity.AuditCheckpoint, error)
+	InsertAuditCheckpoint(checkpoint *entity.AuditCheckpoint) error
+}
+
+// Checkpointer periodically signs the hash of the latest audit event, so that
+// rewriting the chain up to a checkpoint requires the signing key
+type Checkpointer struct {
+	store    CheckpointStore
+	key      ed25519.PrivateKey
+	interval time.Duration
+	now      func() time.Time
+}
+
+type CheckpointerConfig struct {
+	Store    CheckpointStore
+	Key      ed25519.PrivateKey
+	Interval time.Duration
+}
+
+func NewCheckpointer(config CheckpointerConfig) *Checkpointer {
+	return &Checkpointer{
+		store:    config.Store,
+		key:      config.Key,
+		interval: config.Interval,
+		now:      time.Now,
+	}
+}
+
+// Run takes a checkpoint every interval until the context is cancelled
+func (c *Checkpointer) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := c.Checkpoint(); err != nil {
+				log.Printf("Failed to checkpoint audit log: %v", err)
+			}
+		}
+	}
+}
+
+// Checkpoint signs the latest event. It returns nil without error when no
+// event was recorded since the previous checkpoint.
+func (c *Checkpointer) Checkpoint() (*entity.AuditCheckpoint, error) {
+	event, err := c.store.LatestAuditEvent()
+	if errors.Is(err, db.ErrAuditEventNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := c.store.LatestAuditCheckpoint()
+	if err != nil && !errors.Is(err, db.ErrCheckpointNotFound) {
+		return nil, err
+	}
+	if previous != nil && previous.EventId >= event.Id {
+		return nil, nil
+	}
+
+	checkpoint := &entity.AuditCheckpoint{
+		EventId:   event.Id,
+		Hash:      event.Hash,
+		CreatedAt: c.now().UTC().Truncate(time.Microsecond),
+	}
+	SignCheckpoint(c.key, checkpoint)
+
+	if err := c.store.InsertAuditCheckpoint(checkpoint); err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+// ParseSigningKey decodes a base64 encoded 32 byte Ed25519 seed
+func ParseSigningKey(encoded string) (ed25519.PrivateKey, error) {
+	seed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("audit signing key must be a base64 encoded %d byte seed", ed25519.SeedSize)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// ParsePublicKey decodes a base64 encoded Ed25519 public key
+func ParsePublicKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("audit public key must be a base64 encoded %d byte key", ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(key), nil
+}
@@ -0,0 +1,77 @@
+package account
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// PurgeStore finds and erases accounts whose deletion grace period is over
+type PurgeStore interface {
+	DueDeletions(now time.Time) ([]int64, error)
+	PurgeUser(userId int64, at time.Time) error
+}
+
+// Purger periodically purges accounts whose deletion is due
+type Purger struct {
+	store    PurgeStore
+	interval time.Duration
+	now      func() time.Time
+}
+
+type PurgerConfig struct {
+	Store    PurgeStore
+	Interval time.Duration
+}
+
+func NewPurger(config PurgerConfig) *Purger {
+	return &Purger{
+		store:    config.Store,
+		interval: config.Interval,
+		now:      time.Now,
+	}
+}
+
+// Run purges due accounts every interval until the context is cancelled
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := p.PurgeDue(); err != nil {
+			log.Printf("Failed to purge deleted accounts: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeDue purges every account whose grace period has ended and returns how
+// many were purged. A failing account does not stop the others; it is
+// retried on the next run.
+func (p *Purger) PurgeDue() (int, error) {
+	now := p.now()
+
+	ids, err := p.store.DueDeletions(now)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, id := range ids {
+		if err := p.store.PurgeUser(id, now); err != nil {
+			log.Printf("Failed to purge user %d: %v", id, err)
+			continue
+		}
+		purged++
+	}
+
+	if purged > 0 {
+		log.Printf("Purged %d deleted account(s)", purged)
+	}
+	return purged, nil
+}
@@ -0,0 +1,44 @@
+package account
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePurgeStore struct {
+	due    []int64
+	failOn int64
+	purged []int64
+	at     time.Time
+}
+
+func (s *fakePurgeStore) DueDeletions(now time.Time) ([]int64, error) {
+	s.at = now
+	return s.due, nil
+}
+
+func (s *fakePurgeStore) PurgeUser(userId int64, at time.Time) error {
+	if userId == s.failOn {
+		return errors.New("boom")
+	}
+	s.purged = append(s.purged, userId)
+	return nil
+}
+
+func TestPurgeDue(t *testing.T) {
+	now := time.Date(2025, 6, 1, 3, 0, 0, 0, time.UTC)
+	store := &fakePurgeStore{due: []int64{3, 5, 8}, failOn: 5}
+
+	purger := NewPurger(PurgerConfig{Store: store, Interval: time.Hour})
+	purger.now = func() time.Time { return now }
+
+	purged, err := purger.PurgeDue()
+	require.NoError(t, err)
+	assert.Equal(t, 2, purged)
+	assert.Equal(t, []int64{3, 8}, store.purged)
+	assert.Equal(t, now, store.at)
+}
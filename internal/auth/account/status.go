@@ -0,0 +1,80 @@
+package account
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+)
+
+// Errors returned for accounts that may not sign in. Each has a distinct
+// machine readable code, see ErrorCode.
+var (
+	ErrAccountPending   = errors.New("account is pending activation")
+	ErrAccountSuspended = errors.New("account is suspended")
+	ErrAccountDeleted   = errors.New("account is deleted")
+)
+
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// transitions lists the statuses each status may move to. Deleted is final.
+var transitions = map[entity.UserStatus][]entity.UserStatus{
+	entity.UserStatusPending:   {entity.UserStatusActive, entity.UserStatusDeleted},
+	entity.UserStatusActive:    {entity.UserStatusSuspended, entity.UserStatusDeleted},
+	entity.UserStatusSuspended: {entity.UserStatusActive, entity.UserStatusDeleted},
+}
+
+// CanTransition reports whether an account may move from one status to another
+func CanTransition(from, to entity.UserStatus) bool {
+	return slices.Contains(transitions[from], to)
+}
+
+// Transition validates a status change of the user and describes it. The
+// user itself is not modified.
+func Transition(user *entity.User, to entity.UserStatus, reason, changedBy string, at time.Time) (*entity.StatusChange, error) {
+	if !CanTransition(user.Status, to) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidTransition, user.Status, to)
+	}
+
+	return &entity.StatusChange{
+		UserId:    user.Id,
+		From:      user.Status,
+		To:        to,
+		Reason:    reason,
+		ChangedBy: changedBy,
+		ChangedAt: at,
+	}, nil
+}
+
+// CheckActive returns nil for active accounts and the error explaining why
+// the account may not be used otherwise
+func CheckActive(status entity.UserStatus) error {
+	switch status {
+	case entity.UserStatusActive:
+		return nil
+	case entity.UserStatusPending:
+		return ErrAccountPending
+	case entity.UserStatusSuspended:
+		return ErrAccountSuspended
+	case entity.UserStatusDeleted:
+		return ErrAccountDeleted
+	default:
+		return fmt.Errorf("unknown account status %q", status)
+	}
+}
+
+// ErrorCode maps the errors of CheckActive to the codes sent to clients
+func ErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrAccountPending):
+		return "account_pending"
+	case errors.Is(err, ErrAccountSuspended):
+		return "account_suspended"
+	case errors.Is(err, ErrAccountDeleted):
+		return "account_deleted"
+	default:
+		return "account_inactive"
+	}
+}
@@ -0,0 +1,58 @@
+package account
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to entity.UserStatus
+		allowed  bool
+	}{
+		{entity.UserStatusPending, entity.UserStatusActive, true},
+		{entity.UserStatusPending, entity.UserStatusSuspended, false},
+		{entity.UserStatusActive, entity.UserStatusSuspended, true},
+		{entity.UserStatusActive, entity.UserStatusPending, false},
+		{entity.UserStatusSuspended, entity.UserStatusActive, true},
+		{entity.UserStatusSuspended, entity.UserStatusDeleted, true},
+		{entity.UserStatusDeleted, entity.UserStatusActive, false},
+		{entity.UserStatusActive, entity.UserStatusActive, false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.allowed, CanTransition(tt.from, tt.to), "%s -> %s", tt.from, tt.to)
+	}
+}
+
+func TestTransition(t *testing.T) {
+	user := &entity.User{Id: 7, Status: entity.UserStatusActive}
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	change, err := Transition(user, entity.UserStatusSuspended, "Chargeback", "admin", at)
+	require.NoError(t, err)
+	assert.Equal(t, &entity.StatusChange{
+		UserId:    7,
+		From:      entity.UserStatusActive,
+		To:        entity.UserStatusSuspended,
+		Reason:    "Chargeback",
+		ChangedBy: "admin",
+		ChangedAt: at,
+	}, change)
+	assert.Equal(t, entity.UserStatusActive, user.Status)
+
+	_, err = Transition(user, entity.UserStatusPending, "", "admin", at)
+	assert.ErrorIs(t, err, ErrInvalidTransition)
+}
+
+func TestCheckActive(t *testing.T) {
+	assert.NoError(t, CheckActive(entity.UserStatusActive))
+	assert.Equal(t, "account_pending", ErrorCode(CheckActive(entity.UserStatusPending)))
+	assert.Equal(t, "account_suspended", ErrorCode(CheckActive(entity.UserStatusSuspended)))
+	assert.Equal(t, "account_deleted", ErrorCode(CheckActive(entity.UserStatusDeleted)))
+	assert.Equal(t, "account_inactive", ErrorCode(CheckActive("disabled")))
+}
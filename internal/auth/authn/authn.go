@@ -0,0 +1,85 @@
+package authn
+
+import (
+	"context"
+	"errors"
+
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+)
+
+var (
+	// ErrUnknownUser means an authenticator does not know the user, so the
+	// next one in a Chain is asked
+	ErrUnknownUser = errors.New("unknown user")
+	// ErrInvalidCredentials means the user is known but the password is wrong
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Identity is a user whose password an authenticator verified
+type Identity struct {
+	// Username of the local account, as the authenticator spells it
+	Username string
+	Email    string
+	// Roles the user holds according to the authenticator, out of the
+	// ManagedRoles it decides about. Other roles are left alone.
+	Roles        []string
+	ManagedRoles []string
+	// Provision allows creating the local account on first sign-in
+	Provision bool
+	// Source names the authenticator, e.g. for the audit log
+	Source string
+}
+
+// Authenticator verifies a username and password
+type Authenticator interface {
+	Authenticate(ctx context.Context, username string, password string) (*Identity, error)
+}
+
+// Chain asks each authenticator in turn until one knows the user. Any other
+// error, including an unreachable directory, ends the chain: falling through
+// to the next authenticator would let it decide about users it does not own.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(ctx context.Context, username string, password string) (*Identity, error) {
+	for _, authenticator := range c {
+		identity, err := authenticator.Authenticate(ctx, username, password)
+		if errors.Is(err, ErrUnknownUser) {
+			continue
+		}
+		return identity, err
+	}
+	return nil, ErrUnknownUser
+}
+
+// UserStore looks up local accounts
+type UserStore interface {
+	GetUser(username string) (*entity.User, error)
+}
+
+// localPassword is accepted for every local account until passwords are
+// stored
+const localPassword = "wwco2025"
+
+// Local authenticates the accounts stored in the users table
+type Local struct {
+	Store UserStore
+}
+
+func (l Local) Authenticate(ctx context.Context, username string, password string) (*Identity, error) {
+	user, err := l.Store.GetUser(username)
+	if errors.Is(err, db.ErrUsernameNotFound) {
+		return nil, ErrUnknownUser
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Accounts of directories and identity providers have no password here,
+	// even when their source no longer knows them
+	if user.Source != entity.UserSourceLocal || password != localPassword {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &Identity{Username: user.Username, Email: user.Email, Source: "local"}, nil
+}
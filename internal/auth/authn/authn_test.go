@@ -0,0 +1,89 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubStore map[string]*entity.User
+
+func (s stubStore) GetUser(username string) (*entity.User, error) {
+	if user, ok := s[username]; ok {
+		return user, nil
+	}
+	return nil, db.ErrUsernameNotFound
+}
+
+// stubAuthenticator answers with a fixed result and counts its calls
+type stubAuthenticator struct {
+	identity *Identity
+	err      error
+	calls    int
+}
+
+func (s *stubAuthenticator) Authenticate(ctx context.Context, username string, password string) (*Identity, error) {
+	s.calls++
+	return s.identity, s.err
+}
+
+func TestLocal(t *testing.T) {
+	local := Local{Store: stubStore{
+		"ada":   {Id: 1, Username: "ada", Email: "ada@example.com", Source: entity.UserSourceLocal},
+		"grace": {Id: 2, Username: "grace", Source: entity.UserSourceFederated},
+	}}
+
+	identity, err := local.Authenticate(context.Background(), "ada", localPassword)
+	require.NoError(t, err)
+	assert.Equal(t, &Identity{Username: "ada", Email: "ada@example.com", Source: "local"}, identity)
+
+	_, err = local.Authenticate(context.Background(), "ada", "guess")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	_, err = local.Authenticate(context.Background(), "bob", localPassword)
+	assert.ErrorIs(t, err, ErrUnknownUser)
+
+	// Accounts from elsewhere do not sign in with a local password
+	_, err = local.Authenticate(context.Background(), "grace", localPassword)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestChain(t *testing.T) {
+	directory := &stubAuthenticator{err: ErrUnknownUser}
+	local := &stubAuthenticator{identity: &Identity{Username: "ada"}}
+
+	identity, err := Chain{directory, local}.Authenticate(context.Background(), "ada", "pw")
+	require.NoError(t, err)
+	assert.Equal(t, "ada", identity.Username)
+	assert.Equal(t, 1, directory.calls)
+
+	// A wrong password ends the chain
+	directory.err = ErrInvalidCredentials
+	_, err = Chain{directory, local}.Authenticate(context.Background(), "ada", "pw")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.Equal(t, 1, local.calls)
+
+	// So does a directory that cannot be reached
+	directory.err = errors.New("connection refused")
+	_, err = Chain{directory, local}.Authenticate(context.Background(), "ada", "pw")
+	assert.EqualError(t, err, "connection refused")
+	assert.Equal(t, 1, local.calls)
+
+	_, err = Chain{}.Authenticate(context.Background(), "ada", "pw")
+	assert.ErrorIs(t, err, ErrUnknownUser)
+}
+
+func TestChainDoesNotFallBackForDirectoryAccounts(t *testing.T) {
+	// The user was removed from the directory after their account was
+	// provisioned
+	directory := &stubAuthenticator{err: ErrUnknownUser}
+	local := Local{Store: stubStore{"ada": {Id: 1, Username: "ada", Source: "ldap"}}}
+
+	_, err := Chain{directory, local}.Authenticate(context.Background(), "ada", localPassword)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
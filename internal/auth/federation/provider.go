@@ -0,0 +1,328 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/joeariasc/go-auth/internal/auth/oauth"
+	"github.com/joeariasc/go-auth/internal/auth/oidc"
+)
+
+// discoveryPath is where OpenID Connect Discovery publishes the metadata
+// below an issuer
+const discoveryPath = "/.well-known/openid-configuration"
+
+// clockSkew is how far the clocks of an identity provider and this service
+// may drift apart when checking ID token times
+const clockSkew = time.Minute
+
+var (
+	ErrDiscovery      = errors.New("identity provider discovery failed")
+	ErrExchange       = errors.New("authorization code exchange failed")
+	ErrInvalidIDToken = errors.New("invalid ID token from identity provider")
+)
+
+// ProviderConfig describes an upstream OpenID Connect identity provider
+type ProviderConfig struct {
+	// Name identifies the provider in URLs and linked identities, DisplayName
+	// is shown on the sign-in button
+	Name        string
+	DisplayName string
+	// DiscoveryURL is the issuer's /.well-known/openid-configuration
+	DiscoveryURL string
+	ClientID     string
+	ClientSecret string
+	// Scopes requested besides openid
+	Scopes []string
+	// RedirectURL is the callback of this service registered at the provider
+	RedirectURL string
+	// Provision creates an account for identities not linked to one yet
+	Provision bool
+	// HTTPClient talks to the provider, http.DefaultClient when nil
+	HTTPClient *http.Client
+}
+
+// Metadata is the part of the provider's discovery document used here
+type Metadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// Identity is the user an identity provider vouched for
+type Identity struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+}
+
+// idTokenClaims are the claims of an upstream ID token
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce"`
+	AZP               string `json:"azp"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+}
+
+// Provider signs users in with an upstream identity provider using the
+// authorization code flow with PKCE. Metadata and keys are fetched when first
+// needed and cached; the keys are fetched again when a token names an
+// unknown one.
+type Provider struct {
+	config ProviderConfig
+	client *http.Client
+
+	mu       sync.Mutex
+	metadata *Metadata
+	keys     *oidc.JWKS
+}
+
+func NewProvider(config ProviderConfig) *Provider {
+	client := config.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Provider{config: config, client: client}
+}
+
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+func (p *Provider) DisplayName() string {
+	if p.config.DisplayName == "" {
+		return p.config.Name
+	}
+	return p.config.DisplayName
+}
+
+// Provision reports whether accounts are created for unknown identities
+func (p *Provider) Provision() bool {
+	return p.config.Provision
+}
+
+// AuthCodeURL returns the address of the provider to send the browser to.
+// The state comes back with the callback, the nonce inside the ID token.
+func (p *Provider) AuthCodeURL(ctx context.Context, state string, nonce string, codeVerifier string) (string, error) {
+	metadata, err := p.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	scopes := append([]string{oidc.ScopeOpenID}, p.config.Scopes...)
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(slices.Compact(scopes), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {oauth.CodeChallenge(codeVerifier)},
+		"code_challenge_method": {oauth.MethodS256},
+	}
+	return oauth.WithQuery(metadata.AuthorizationEndpoint, query), nil
+}
+
+// Exchange redeems the code of a callback and verifies the ID token it
+// yields, which must carry the nonce of the authorization request
+func (p *Provider) Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (*Identity, error) {
+	metadata, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+
+	// client_secret_basic is the default when the provider does not say
+	basic := len(metadata.TokenEndpointAuthMethodsSupported) == 0 ||
+		slices.Contains(metadata.TokenEndpointAuthMethodsSupported, oauth.AuthMethodSecretBasic)
+	if !basic {
+		form.Set("client_id", p.config.ClientID)
+		form.Set("client_secret", p.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if basic {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("%w: unreadable response: %v", ErrExchange, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s %s", ErrExchange, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return nil, fmt.Errorf("%w: no ID token in the response", ErrExchange)
+	}
+
+	return p.verifyIDToken(ctx, metadata, body.IDToken, nonce)
+}
+
+// verifyIDToken checks an ID token as OpenID Connect Core section 3.1.3.7
+// asks of a confidential client
+func (p *Provider) verifyIDToken(ctx context.Context, metadata *Metadata, idToken string, nonce string) (*Identity, error) {
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, metadata, kid)
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if len(claims.Audience) > 1 && claims.AZP != p.config.ClientID {
+		return nil, fmt.Errorf("%w: issued to another party", ErrInvalidIDToken)
+	}
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+
+	return &Identity{
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		PreferredUsername: claims.PreferredUsername,
+		Name:              claims.Name,
+	}, nil
+}
+
+// Metadata returns the provider's discovery document, fetching it on first use
+func (p *Provider) Metadata(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var metadata Metadata
+	if err := p.getJSON(ctx, p.config.DiscoveryURL, &metadata); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+
+	// The issuer must be the URL the document was discovered at, otherwise
+	// one provider could issue tokens in the name of another
+	if metadata.Issuer == "" || strings.TrimSuffix(metadata.Issuer, "/")+discoveryPath != p.config.DiscoveryURL {
+		return nil, fmt.Errorf("%w: issuer %q does not match the discovery URL", ErrDiscovery, metadata.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: incomplete metadata", ErrDiscovery)
+	}
+
+	p.metadata = &metadata
+	return p.metadata, nil
+}
+
+// key finds the public key an ID token was signed with
+func (p *Provider) key(ctx context.Context, metadata *Metadata, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for refreshed := false; ; refreshed = true {
+		if p.keys != nil {
+			for _, key := range p.keys.Keys {
+				if kid == "" && len(p.keys.Keys) == 1 || key.KeyID == kid {
+					return key.PublicKey()
+				}
+			}
+		}
+		if refreshed {
+			return nil, oidc.ErrInvalidKey
+		}
+
+		// Providers rotate keys, so an unknown kid is a reason to look again
+		var keys oidc.JWKS
+		if err := p.getJSON(ctx, metadata.JWKSURI, &keys); err != nil {
+			return nil, err
+		}
+		p.keys = &keys
+	}
+}
+
+func (p *Provider) getJSON(ctx context.Context, uri string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", uri, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Registry holds the configured identity providers in the order they are
+// offered to users
+type Registry struct {
+	providers []*Provider
+}
+
+func NewRegistry(providers ...*Provider) *Registry {
+	return &Registry{providers: providers}
+}
+
+func (r *Registry) Get(name string) (*Provider, bool) {
+	for _, provider := range r.providers {
+		if provider.Name() == name {
+			return provider, true
+		}
+	}
+	return nil, false
+}
+
+func (r *Registry) All() []*Provider {
+	return r.providers
+}
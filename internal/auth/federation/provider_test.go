@@ -0,0 +1,269 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/joeariasc/go-auth/internal/auth/oauth"
+	"github.com/joeariasc/go-auth/internal/auth/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testClientID     = "go-auth"
+	testClientSecret = "s3cret/+="
+	testRedirectURL  = "https://auth.example.com/api/auth/federated/corp/callback"
+)
+
+// stubIdP is a minimal OpenID provider. It approves every authorization
+// request; signer and claims let a test tamper with the ID tokens it issues.
+type stubIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *oidc.SigningKey // published
+	signer *oidc.SigningKey // signs ID tokens, key when nil
+	issuer string
+	claims func(c jwt.MapClaims)
+
+	// code -> authorization request
+	requests map[string]url.Values
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	key, err := oidc.GenerateSigningKey()
+	require.NoError(t, err)
+
+	idp := &stubIdP{t: t, key: key, requests: map[string]url.Values{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Metadata{
+			Issuer:                            idp.issuer,
+			AuthorizationEndpoint:             idp.server.URL + "/authorize",
+			TokenEndpoint:                     idp.server.URL + "/token",
+			JWKSURI:                           idp.server.URL + "/jwks",
+			TokenEndpointAuthMethodsSupported: []string{oauth.AuthMethodSecretBasic},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidc.JWKS{Keys: []oidc.JWK{idp.key.JWK()}})
+	})
+	mux.HandleFunc("POST /token", idp.token)
+
+	idp.server = httptest.NewServer(mux)
+	idp.issuer = idp.server.URL
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *stubIdP) provider() *Provider {
+	return NewProvider(ProviderConfig{
+		Name:         "corp",
+		DiscoveryURL: idp.server.URL + discoveryPath,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		Scopes:       []string{"email", "profile"},
+		RedirectURL:  testRedirectURL,
+	})
+}
+
+// authorize plays the user signing in at the provider and returns the code
+// the browser would bring back to the callback
+func (idp *stubIdP) authorize(authCodeURL string) string {
+	u, err := url.Parse(authCodeURL)
+	require.NoError(idp.t, err)
+
+	code, _, err := oauth.NewOpaqueToken()
+	require.NoError(idp.t, err)
+	idp.requests[code] = u.Query()
+	return code
+}
+
+func (idp *stubIdP) token(w http.ResponseWriter, r *http.Request) {
+	writeError := func(code string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+
+	id, secret, ok := r.BasicAuth()
+	id, _ = url.QueryUnescape(id)
+	secret, _ = url.QueryUnescape(secret)
+	if !ok || id != testClientID || secret != testClientSecret {
+		writeError("invalid_client")
+		return
+	}
+
+	request, ok := idp.requests[r.PostFormValue("code")]
+	if !ok || request.Get("redirect_uri") != r.PostFormValue("redirect_uri") ||
+		!oauth.VerifyCodeVerifier(request.Get("code_challenge"), request.Get("code_challenge_method"), r.PostFormValue("code_verifier")) {
+		writeError("invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":                idp.issuer,
+		"sub":                "00u1a2b3c",
+		"aud":                testClientID,
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"iat":                now.Unix(),
+		"nonce":              request.Get("nonce"),
+		"email":              "ada@corp.example",
+		"email_verified":     true,
+		"preferred_username": "ada",
+	}
+	if idp.claims != nil {
+		idp.claims(claims)
+	}
+
+	signer := idp.key
+	if idp.signer != nil {
+		signer = idp.signer
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = signer.ID
+	idToken, err := token.SignedString(signer.Key)
+	require.NoError(idp.t, err)
+
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": idToken})
+}
+
+func signIn(t *testing.T, provider *Provider, idp *stubIdP, nonce string) (*Identity, error) {
+	verifier, _, err := oauth.NewOpaqueToken()
+	require.NoError(t, err)
+
+	authCodeURL, err := provider.AuthCodeURL(context.Background(), "state-1", nonce, verifier)
+	require.NoError(t, err)
+
+	return provider.Exchange(context.Background(), idp.authorize(authCodeURL), verifier, nonce)
+}
+
+func TestSignIn(t *testing.T) {
+	idp := newStubIdP(t)
+	provider := idp.provider()
+
+	verifier, _, err := oauth.NewOpaqueToken()
+	require.NoError(t, err)
+
+	authCodeURL, err := provider.AuthCodeURL(context.Background(), "state-1", "nonce-1", verifier)
+	require.NoError(t, err)
+
+	u, err := url.Parse(authCodeURL)
+	require.NoError(t, err)
+	assert.Equal(t, idp.server.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+	query := u.Query()
+	assert.Equal(t, "code", query.Get("response_type"))
+	assert.Equal(t, testClientID, query.Get("client_id"))
+	assert.Equal(t, testRedirectURL, query.Get("redirect_uri"))
+	assert.Equal(t, "openid email profile", query.Get("scope"))
+	assert.Equal(t, "state-1", query.Get("state"))
+	assert.Equal(t, "nonce-1", query.Get("nonce"))
+	assert.Equal(t, oauth.MethodS256, query.Get("code_challenge_method"))
+
+	identity, err := provider.Exchange(context.Background(), idp.authorize(authCodeURL), verifier, "nonce-1")
+	require.NoError(t, err)
+	assert.Equal(t, &Identity{
+		Subject:           "00u1a2b3c",
+		Email:             "ada@corp.example",
+		EmailVerified:     true,
+		PreferredUsername: "ada",
+	}, identity)
+
+	// The code was issued for another verifier
+	code := idp.authorize(authCodeURL)
+	other, _, err := oauth.NewOpaqueToken()
+	require.NoError(t, err)
+	_, err = provider.Exchange(context.Background(), code, other, "nonce-1")
+	assert.ErrorIs(t, err, ErrExchange)
+}
+
+func TestSignInRejectsNonceMismatch(t *testing.T) {
+	idp := newStubIdP(t)
+	provider := idp.provider()
+
+	idp.claims = func(c jwt.MapClaims) { c["nonce"] = "replayed" }
+	_, err := signIn(t, provider, idp, "nonce-1")
+	assert.ErrorIs(t, err, ErrInvalidIDToken)
+}
+
+func TestSignInRejectsInvalidIDTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims func(c jwt.MapClaims)
+	}{
+		{"other audience", func(c jwt.MapClaims) { c["aud"] = "another-client" }},
+		{"other issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{"no expiry", func(c jwt.MapClaims) { delete(c, "exp") }},
+		{"no subject", func(c jwt.MapClaims) { delete(c, "sub") }},
+		{"other authorized party", func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "another-client"}
+			c["azp"] = "another-client"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newStubIdP(t)
+			idp.claims = tt.claims
+
+			_, err := signIn(t, idp.provider(), idp, "nonce-1")
+			assert.ErrorIs(t, err, ErrInvalidIDToken)
+		})
+	}
+}
+
+func TestSignInFollowsKeyRotation(t *testing.T) {
+	idp := newStubIdP(t)
+	provider := idp.provider()
+
+	_, err := signIn(t, provider, idp, "nonce-1")
+	require.NoError(t, err)
+
+	rotated, err := oidc.GenerateSigningKey()
+	require.NoError(t, err)
+	idp.key = rotated
+
+	_, err = signIn(t, provider, idp, "nonce-2")
+	assert.NoError(t, err, "the new key is fetched when the token names it")
+}
+
+func TestSignInRejectsUnknownKeys(t *testing.T) {
+	idp := newStubIdP(t)
+
+	forged, err := oidc.GenerateSigningKey()
+	require.NoError(t, err)
+	idp.signer = forged
+
+	_, err = signIn(t, idp.provider(), idp, "nonce-1")
+	assert.ErrorIs(t, err, ErrInvalidIDToken)
+}
+
+func TestDiscoveryRequiresMatchingIssuer(t *testing.T) {
+	idp := newStubIdP(t)
+	idp.issuer = "https://impostor.example.com"
+
+	_, err := idp.provider().Metadata(context.Background())
+	assert.ErrorIs(t, err, ErrDiscovery)
+}
+
+func TestRegistry(t *testing.T) {
+	corp := NewProvider(ProviderConfig{Name: "corp", DisplayName: "Corporate SSO"})
+	partner := NewProvider(ProviderConfig{Name: "partner"})
+	registry := NewRegistry(corp, partner)
+
+	provider, ok := registry.Get("partner")
+	require.True(t, ok)
+	assert.Equal(t, "partner", provider.DisplayName())
+
+	_, ok = registry.Get("other")
+	assert.False(t, ok)
+	assert.Equal(t, []*Provider{corp, partner}, registry.All())
+}
@@ -0,0 +1,153 @@
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/auth/authn"
+)
+
+var errAmbiguousUser = errors.New("ldap: more than one entry matches the username")
+
+// Config describes how users are found in a directory. The defaults suit
+// OpenLDAP; Active Directory uses the user attribute sAMAccountName and the
+// object class user.
+type Config struct {
+	// URL of the server, ldaps://host[:port] or ldap://host[:port]
+	URL       string
+	TLSConfig *tls.Config
+	// The service account users are searched with
+	BindDN       string
+	BindPassword string
+	// BaseDN is the subtree users are searched in
+	BaseDN string
+	// UserAttribute holds the username, "uid" by default. The directory's
+	// spelling of it becomes the local username.
+	UserAttribute string
+	// UserObjectClass restricts the search to user entries, "person" by default
+	UserObjectClass string
+	// EmailAttribute is "mail" by default
+	EmailAttribute string
+	// GroupAttribute lists the DNs of the user's groups, "memberOf" by default
+	GroupAttribute string
+	// GroupRoles maps group DNs to the role their members hold
+	GroupRoles map[string]string
+	// Provision creates a local account on a user's first sign-in
+	Provision bool
+	// Timeout bounds connecting and every operation, 10 seconds by default
+	Timeout time.Duration
+}
+
+// Authenticator verifies passwords by binding to a directory as the user.
+// The user's DN is looked up with the service account first.
+type Authenticator struct {
+	config Config
+}
+
+func NewAuthenticator(config Config) *Authenticator {
+	if config.UserAttribute == "" {
+		config.UserAttribute = "uid"
+	}
+	if config.UserObjectClass == "" {
+		config.UserObjectClass = "person"
+	}
+	if config.EmailAttribute == "" {
+		config.EmailAttribute = "mail"
+	}
+	if config.GroupAttribute == "" {
+		config.GroupAttribute = "memberOf"
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+	return &Authenticator{config: config}
+}
+
+func (a *Authenticator) Authenticate(ctx context.Context, username string, password string) (*authn.Identity, error) {
+	// A simple bind without a password is an anonymous bind, which succeeds
+	// whatever the DN
+	if username == "" || password == "" {
+		return nil, authn.ErrInvalidCredentials
+	}
+
+	c, err := dial(ctx, a.config.URL, a.config.TLSConfig, a.config.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+
+	if err := c.bind(a.config.BindDN, a.config.BindPassword); err != nil {
+		return nil, fmt.Errorf("ldap: service account bind failed: %w", err)
+	}
+
+	// A size limit of two is enough to tell ambiguous usernames
+	entries, err := c.search(searchRequest{
+		baseDN: a.config.BaseDN,
+		filter: and(
+			equal("objectClass", a.config.UserObjectClass),
+			equal(a.config.UserAttribute, username),
+		),
+		attributes: []string{a.config.UserAttribute, a.config.EmailAttribute, a.config.GroupAttribute},
+		sizeLimit:  2,
+	})
+	if len(entries) > 1 {
+		return nil, errAmbiguousUser
+	}
+	if err != nil && !isResult(err, resultNoSuchObject) {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, authn.ErrUnknownUser
+	}
+	user := entries[0]
+
+	if err := c.bind(user.dn, password); err != nil {
+		if isResult(err, resultInvalidCredentials) {
+			return nil, authn.ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	identity := &authn.Identity{
+		Username:     user.value(a.config.UserAttribute),
+		Email:        user.value(a.config.EmailAttribute),
+		Roles:        a.roles(user.values(a.config.GroupAttribute)),
+		ManagedRoles: a.managedRoles(),
+		Provision:    a.config.Provision,
+		Source:       "ldap",
+	}
+	if identity.Username == "" {
+		identity.Username = username
+	}
+	return identity, nil
+}
+
+// roles maps the user's groups to roles. DNs are compared ignoring case.
+func (a *Authenticator) roles(groups []string) []string {
+	roles := []string{}
+	for groupDN, role := range a.config.GroupRoles {
+		member := slices.ContainsFunc(groups, func(group string) bool { return strings.EqualFold(group, groupDN) })
+		if member && !slices.Contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	slices.Sort(roles)
+	return roles
+}
+
+// managedRoles are the roles the directory decides about
+func (a *Authenticator) managedRoles() []string {
+	roles := []string{}
+	for _, role := range a.config.GroupRoles {
+		if !slices.Contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	slices.Sort(roles)
+	return roles
+}
@@ -0,0 +1,237 @@
+package ldap
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// The subset of the Basic Encoding Rules LDAP messages are made of, X.690.
+// Tag numbers above 30 and indefinite lengths do not occur in LDAP.
+
+// Tag classes
+const (
+	classUniversal   byte = 0x00
+	classApplication byte = 0x40
+	classContext     byte = 0x80
+)
+
+const constructedBit byte = 0x20
+
+// Universal tags
+const (
+	tagBoolean     byte = 0x01
+	tagInteger     byte = 0x02
+	tagOctetString byte = 0x04
+	tagEnumerated  byte = 0x0a
+	tagSequence    byte = 0x10
+	tagSet         byte = 0x11
+)
+
+// maxPacketSize bounds the messages read, directory entries are far smaller
+const maxPacketSize = 1 << 20
+
+var errMalformed = errors.New("ldap: malformed message")
+
+// packet is a BER element. Constructed elements have children, primitive
+// ones a value.
+type packet struct {
+	class       byte
+	constructed bool
+	tag         byte
+	value       []byte
+	children    []*packet
+}
+
+func newConstructed(class byte, tag byte, children ...*packet) *packet {
+	return &packet{class: class, constructed: true, tag: tag, children: children}
+}
+
+func newPrimitive(class byte, tag byte, value []byte) *packet {
+	return &packet{class: class, tag: tag, value: value}
+}
+
+func newSequence(children ...*packet) *packet {
+	return newConstructed(classUniversal, tagSequence, children...)
+}
+
+func newString(s string) *packet {
+	return newPrimitive(classUniversal, tagOctetString, []byte(s))
+}
+
+func newInteger(n int64) *packet {
+	return newPrimitive(classUniversal, tagInteger, encodeInt(n))
+}
+
+func newEnumerated(n int64) *packet {
+	return newPrimitive(classUniversal, tagEnumerated, encodeInt(n))
+}
+
+func newBoolean(b bool) *packet {
+	if b {
+		return newPrimitive(classUniversal, tagBoolean, []byte{0xff})
+	}
+	return newPrimitive(classUniversal, tagBoolean, []byte{0x00})
+}
+
+// is reports whether the element has the given class and tag
+func (p *packet) is(class byte, tag byte) bool {
+	return p.class == class && p.tag == tag
+}
+
+// child returns the i-th child, or an error when there is none
+func (p *packet) child(i int) (*packet, error) {
+	if i >= len(p.children) {
+		return nil, errMalformed
+	}
+	return p.children[i], nil
+}
+
+func (p *packet) int() (int64, error) {
+	if p.constructed || len(p.value) == 0 || len(p.value) > 8 {
+		return 0, errMalformed
+	}
+	n := int64(int8(p.value[0]))
+	for _, b := range p.value[1:] {
+		n = n<<8 | int64(b)
+	}
+	return n, nil
+}
+
+func (p *packet) string() string {
+	return string(p.value)
+}
+
+// encodeInt returns the shortest two's complement form of n
+func encodeInt(n int64) []byte {
+	b := []byte{byte(n)}
+	for n > 127 || n < -128 {
+		n >>= 8
+		b = append([]byte{byte(n)}, b...)
+	}
+	return b
+}
+
+func (p *packet) bytes() []byte {
+	content := p.value
+	if p.constructed {
+		content = nil
+		for _, child := range p.children {
+			content = append(content, child.bytes()...)
+		}
+	}
+
+	identifier := p.class | p.tag
+	if p.constructed {
+		identifier |= constructedBit
+	}
+
+	out := append([]byte{identifier}, encodeLength(len(content))...)
+	return append(out, content...)
+}
+
+func encodeLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+// readPacket reads one element from a stream
+func readPacket(r *bufio.Reader) (*packet, error) {
+	identifier, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := readLength(r)
+	if err != nil {
+		return nil, err
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return parseContent(identifier, content)
+}
+
+func readLength(r io.ByteReader) (int, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if first < 0x80 {
+		return int(first), nil
+	}
+
+	octets := int(first & 0x7f)
+	if octets == 0 || octets > 4 {
+		return 0, errMalformed
+	}
+	length := 0
+	for i := 0; i < octets; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		length = length<<8 | int(b)
+	}
+	if length > maxPacketSize {
+		return 0, errMalformed
+	}
+	return length, nil
+}
+
+func parseContent(identifier byte, content []byte) (*packet, error) {
+	if identifier&0x1f == 0x1f {
+		return nil, errMalformed
+	}
+
+	p := &packet{
+		class:       identifier & 0xc0,
+		constructed: identifier&constructedBit != 0,
+		tag:         identifier & 0x1f,
+	}
+	if !p.constructed {
+		p.value = content
+		return p, nil
+	}
+
+	for len(content) > 0 {
+		child, rest, err := decodePacket(content)
+		if err != nil {
+			return nil, err
+		}
+		p.children = append(p.children, child)
+		content = rest
+	}
+	return p, nil
+}
+
+// decodePacket decodes the element at the start of data and returns what
+// follows it
+func decodePacket(data []byte) (*packet, []byte, error) {
+	if len(data) < 2 {
+		return nil, nil, errMalformed
+	}
+
+	r := bytes.NewReader(data[1:])
+	length, err := readLength(r)
+	if err != nil {
+		return nil, nil, errMalformed
+	}
+
+	offset := len(data) - r.Len()
+	if length > len(data)-offset {
+		return nil, nil, errMalformed
+	}
+
+	p, err := parseContent(data[0], data[offset:offset+length])
+	return p, data[offset+length:], err
+}
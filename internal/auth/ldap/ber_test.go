@@ -0,0 +1,63 @@
+package ldap
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegerEncoding(t *testing.T) {
+	for _, n := range []int64{0, 1, 127, 128, 255, 256, -1, -128, -129, 1 << 40} {
+		p, err := decodeOne(newInteger(n).bytes())
+		require.NoError(t, err)
+
+		decoded, err := p.int()
+		require.NoError(t, err)
+		assert.Equal(t, n, decoded)
+	}
+
+	assert.Equal(t, []byte{0x02, 0x01, 0x03}, newInteger(3).bytes())
+	assert.Equal(t, []byte{0x02, 0x02, 0x00, 0x80}, newInteger(128).bytes())
+}
+
+func TestPacketRoundTrip(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	message := newSequence(
+		newInteger(7),
+		newConstructed(classApplication, appBindRequest,
+			newInteger(3), newString(long), newPrimitive(classContext, 0, []byte("secret"))),
+	)
+
+	encoded := message.bytes()
+	decoded, err := decodeOne(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, encoded, decoded.bytes())
+
+	bind := decoded.children[1]
+	assert.True(t, bind.is(classApplication, appBindRequest))
+	assert.True(t, bind.constructed)
+	assert.Equal(t, long, bind.children[1].string())
+	assert.Equal(t, "secret", bind.children[2].string())
+}
+
+func TestMalformedPackets(t *testing.T) {
+	encoded := newSequence(newString("dn"), newString("value")).bytes()
+
+	// A child cut off inside its parent
+	truncated := append([]byte{}, encoded...)
+	truncated[1] -= 2
+	_, err := decodeOne(truncated[:len(truncated)-2])
+	assert.ErrorIs(t, err, errMalformed)
+
+	// Lengths beyond the maximum are refused before allocating
+	_, err = decodeOne([]byte{0x30, 0x84, 0x7f, 0xff, 0xff, 0xff})
+	assert.ErrorIs(t, err, errMalformed)
+}
+
+func decodeOne(data []byte) (*packet, error) {
+	return readPacket(bufio.NewReader(bytes.NewReader(data)))
+}
@@ -0,0 +1,297 @@
+package ldap
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Protocol operations of RFC 4511 used here, application tags
+const (
+	appBindRequest           byte = 0
+	appBindResponse          byte = 1
+	appUnbindRequest         byte = 2
+	appSearchRequest         byte = 3
+	appSearchResultEntry     byte = 4
+	appSearchResultDone      byte = 5
+	appSearchResultReference byte = 19
+)
+
+// Result codes
+const (
+	resultSuccess            = 0
+	resultNoSuchObject       = 32
+	resultInvalidCredentials = 49
+)
+
+const (
+	scopeWholeSubtree = 2
+	derefNever        = 0
+)
+
+// Search filter choices, context tags
+const (
+	filterAnd      byte = 0
+	filterEquality byte = 3
+)
+
+var errDisconnected = errors.New("ldap: the server ended the connection")
+
+// ResultError is an operation the server did not complete successfully
+type ResultError struct {
+	Code    int64
+	Message string
+}
+
+func (e *ResultError) Error() string {
+	return fmt.Sprintf("ldap: result code %d: %s", e.Code, e.Message)
+}
+
+// isResult reports whether err is a ResultError with the given code
+func isResult(err error, code int64) bool {
+	var resultErr *ResultError
+	return errors.As(err, &resultErr) && resultErr.Code == code
+}
+
+// and matches entries matching all filters. Filters are built rather than
+// parsed from their string form, so values need no escaping.
+func and(filters ...*packet) *packet {
+	return newConstructed(classContext, filterAnd, filters...)
+}
+
+// equal matches entries with an attribute value
+func equal(attribute string, value string) *packet {
+	return newConstructed(classContext, filterEquality, newString(attribute), newString(value))
+}
+
+// entry is a search result. Attribute names are lower-cased.
+type entry struct {
+	dn         string
+	attributes map[string][]string
+}
+
+func (e *entry) values(attribute string) []string {
+	return e.attributes[strings.ToLower(attribute)]
+}
+
+func (e *entry) value(attribute string) string {
+	if values := e.values(attribute); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+type searchRequest struct {
+	baseDN     string
+	filter     *packet
+	attributes []string
+	sizeLimit  int64
+}
+
+// conn is a connection to a directory server running one operation at a
+// time, each bounded by timeout
+type conn struct {
+	c       net.Conn
+	r       *bufio.Reader
+	lastID  int64
+	timeout time.Duration
+}
+
+// dial connects to an ldap:// or ldaps:// URL
+func dial(ctx context.Context, rawURL string, tlsConfig *tls.Config, timeout time.Duration) (*conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: invalid URL: %w", err)
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	var c net.Conn
+
+	switch u.Scheme {
+	case "ldap":
+		c, err = dialer.DialContext(ctx, "tcp", hostPort(u, "389"))
+	case "ldaps":
+		config := &tls.Config{}
+		if tlsConfig != nil {
+			config = tlsConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName = u.Hostname()
+		}
+		c, err = (&tls.Dialer{NetDialer: dialer, Config: config}).DialContext(ctx, "tcp", hostPort(u, "636"))
+	default:
+		return nil, fmt.Errorf("ldap: unsupported URL scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &conn{c: c, r: bufio.NewReader(c), timeout: timeout}, nil
+}
+
+func hostPort(u *url.URL, defaultPort string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
+
+// send wraps an operation in a message and writes it
+func (c *conn) send(op *packet) (int64, error) {
+	c.lastID++
+	if err := c.c.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	_, err := c.c.Write(newSequence(newInteger(c.lastID), op).bytes())
+	return c.lastID, err
+}
+
+// receive reads the operation of the next message answering id
+func (c *conn) receive(id int64) (*packet, error) {
+	for {
+		message, err := readPacket(c.r)
+		if err != nil {
+			return nil, err
+		}
+		if !message.is(classUniversal, tagSequence) || len(message.children) < 2 {
+			return nil, errMalformed
+		}
+
+		messageID, err := message.children[0].int()
+		if err != nil {
+			return nil, err
+		}
+		// Message ID 0 is an unsolicited notification, in practice always a
+		// notice of disconnection
+		if messageID == 0 {
+			return nil, errDisconnected
+		}
+		if messageID == id {
+			return message.children[1], nil
+		}
+	}
+}
+
+// bind authenticates the connection with a DN and password
+func (c *conn) bind(dn string, password string) error {
+	id, err := c.send(newConstructed(classApplication, appBindRequest,
+		newInteger(3), newString(dn), newPrimitive(classContext, 0, []byte(password))))
+	if err != nil {
+		return err
+	}
+
+	op, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if !op.is(classApplication, appBindResponse) {
+		return errMalformed
+	}
+	return parseResult(op)
+}
+
+// search returns the entries below the base DN matching the filter.
+// Referrals are not followed.
+func (c *conn) search(req searchRequest) ([]*entry, error) {
+	attributes := newSequence()
+	for _, attribute := range req.attributes {
+		attributes.children = append(attributes.children, newString(attribute))
+	}
+
+	id, err := c.send(newConstructed(classApplication, appSearchRequest,
+		newString(req.baseDN),
+		newEnumerated(scopeWholeSubtree),
+		newEnumerated(derefNever),
+		newInteger(req.sizeLimit),
+		newInteger(int64(c.timeout.Seconds())),
+		newBoolean(false),
+		req.filter,
+		attributes))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*entry
+	for {
+		op, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case op.is(classApplication, appSearchResultEntry):
+			e, err := parseEntry(op)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, e)
+		case op.is(classApplication, appSearchResultReference):
+		case op.is(classApplication, appSearchResultDone):
+			return entries, parseResult(op)
+		default:
+			return nil, errMalformed
+		}
+	}
+}
+
+// close unbinds and closes the connection
+func (c *conn) close() error {
+	c.send(newPrimitive(classApplication, appUnbindRequest, nil))
+	return c.c.Close()
+}
+
+// parseResult turns an LDAPResult into an error unless it reports success
+func parseResult(op *packet) error {
+	codePacket, err := op.child(0)
+	if err != nil {
+		return err
+	}
+	code, err := codePacket.int()
+	if err != nil {
+		return err
+	}
+	if code == resultSuccess {
+		return nil
+	}
+
+	message := ""
+	if diagnostic, err := op.child(2); err == nil {
+		message = diagnostic.string()
+	}
+	return &ResultError{Code: code, Message: message}
+}
+
+func parseEntry(op *packet) (*entry, error) {
+	dn, err := op.child(0)
+	if err != nil {
+		return nil, err
+	}
+	attributes, err := op.child(1)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &entry{dn: dn.string(), attributes: map[string][]string{}}
+	for _, attribute := range attributes.children {
+		name, err := attribute.child(0)
+		if err != nil {
+			return nil, err
+		}
+		values, err := attribute.child(1)
+		if err != nil {
+			return nil, err
+		}
+
+		key := strings.ToLower(name.string())
+		for _, value := range values.children {
+			e.attributes[key] = append(e.attributes[key], value.string())
+		}
+	}
+	return e, nil
+}
@@ -0,0 +1,259 @@
+package ldap
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/auth/authn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	serviceDN       = "cn=go-auth,ou=services,dc=example,dc=com"
+	servicePassword = "service-secret"
+	adaDN           = "uid=ada,ou=people,dc=example,dc=com"
+	adminsDN        = "cn=Admins,ou=groups,dc=example,dc=com"
+)
+
+const resultInsufficientAccessRights = 50
+
+// directory is an in-process LDAP server speaking just enough of the
+// protocol for the authenticator: simple binds and searches with equality
+// and "and" filters. Only the service account may search.
+type directory struct {
+	t         *testing.T
+	listener  net.Listener
+	entries   []*entry
+	passwords map[string]string // DN -> password
+
+	mu    sync.Mutex
+	binds []string // DNs of successful binds
+}
+
+func newDirectory(t *testing.T) *directory {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	d := &directory{
+		t:        t,
+		listener: listener,
+		passwords: map[string]string{
+			serviceDN: servicePassword,
+			adaDN:     "correct horse",
+		},
+		entries: []*entry{
+			{dn: adaDN, attributes: map[string][]string{
+				"objectclass": {"top", "person", "inetOrgPerson"},
+				"uid":         {"ada"},
+				"mail":        {"ada@example.com"},
+				"memberof":    {adminsDN, "cn=Staff,ou=groups,dc=example,dc=com"},
+			}},
+			{dn: "ou=people,dc=example,dc=com", attributes: map[string][]string{
+				"objectclass": {"organizationalUnit"},
+			}},
+		},
+	}
+
+	go func() {
+		for {
+			c, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(c)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return d
+}
+
+func (d *directory) url() string {
+	return "ldap://" + d.listener.Addr().String()
+}
+
+func (d *directory) authenticator(configure func(c *Config)) *Authenticator {
+	config := Config{
+		URL:          d.url(),
+		BindDN:       serviceDN,
+		BindPassword: servicePassword,
+		BaseDN:       "dc=example,dc=com",
+		GroupRoles: map[string]string{
+			strings.ToLower(adminsDN):                 "admin",
+			"cn=auditors,ou=groups,dc=example,dc=com": "auditor",
+		},
+		Timeout: time.Second,
+	}
+	if configure != nil {
+		configure(&config)
+	}
+	return NewAuthenticator(config)
+}
+
+func (d *directory) bound() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string{}, d.binds...)
+}
+
+func (d *directory) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	bound := ""
+
+	respond := func(id *packet, op *packet) {
+		c.Write(newSequence(id, op).bytes())
+	}
+	result := func(tag byte, code int64) *packet {
+		return newConstructed(classApplication, tag, newEnumerated(code), newString(""), newString(""))
+	}
+
+	for {
+		message, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		id, op := message.children[0], message.children[1]
+
+		switch {
+		case op.is(classApplication, appBindRequest):
+			dn, password := op.children[1].string(), op.children[2].string()
+			code := int64(resultInvalidCredentials)
+			if expected, ok := d.passwords[dn]; ok && password == expected {
+				code, bound = resultSuccess, dn
+				d.mu.Lock()
+				d.binds = append(d.binds, dn)
+				d.mu.Unlock()
+			}
+			respond(id, result(appBindResponse, code))
+		case op.is(classApplication, appSearchRequest):
+			if bound != serviceDN {
+				respond(id, result(appSearchResultDone, resultInsufficientAccessRights))
+				continue
+			}
+			base, filter := strings.ToLower(op.children[0].string()), op.children[6]
+			for _, e := range d.entries {
+				if strings.HasSuffix(strings.ToLower(e.dn), base) && matches(filter, e) {
+					respond(id, encodeEntry(e))
+				}
+			}
+			respond(id, result(appSearchResultDone, resultSuccess))
+		case op.is(classApplication, appUnbindRequest):
+			return
+		}
+	}
+}
+
+// matches evaluates a filter, comparing values ignoring case as directories
+// do for most attributes
+func matches(filter *packet, e *entry) bool {
+	switch {
+	case filter.is(classContext, filterAnd):
+		for _, child := range filter.children {
+			if !matches(child, e) {
+				return false
+			}
+		}
+		return true
+	case filter.is(classContext, filterEquality):
+		attribute, value := filter.children[0].string(), filter.children[1].string()
+		for _, v := range e.values(attribute) {
+			if strings.EqualFold(v, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func encodeEntry(e *entry) *packet {
+	attributes := newSequence()
+	for name, values := range e.attributes {
+		set := newConstructed(classUniversal, tagSet)
+		for _, value := range values {
+			set.children = append(set.children, newString(value))
+		}
+		attributes.children = append(attributes.children, newSequence(newString(name), set))
+	}
+	return newConstructed(classApplication, appSearchResultEntry, newString(e.dn), attributes)
+}
+
+func TestAuthenticate(t *testing.T) {
+	d := newDirectory(t)
+
+	identity, err := d.authenticator(func(c *Config) { c.Provision = true }).
+		Authenticate(context.Background(), "ADA", "correct horse")
+	require.NoError(t, err)
+
+	assert.Equal(t, &authn.Identity{
+		Username:     "ada",
+		Email:        "ada@example.com",
+		Roles:        []string{"admin"},
+		ManagedRoles: []string{"admin", "auditor"},
+		Provision:    true,
+		Source:       "ldap",
+	}, identity)
+	assert.Equal(t, []string{serviceDN, adaDN}, d.bound())
+}
+
+func TestAuthenticateWrongPassword(t *testing.T) {
+	d := newDirectory(t)
+
+	_, err := d.authenticator(nil).Authenticate(context.Background(), "ada", "battery staple")
+	assert.ErrorIs(t, err, authn.ErrInvalidCredentials)
+}
+
+func TestAuthenticateRejectsEmptyPassword(t *testing.T) {
+	d := newDirectory(t)
+
+	_, err := d.authenticator(nil).Authenticate(context.Background(), "ada", "")
+	assert.ErrorIs(t, err, authn.ErrInvalidCredentials)
+	assert.Empty(t, d.bound(), "an empty password must not reach the directory")
+}
+
+func TestAuthenticateUnknownUser(t *testing.T) {
+	d := newDirectory(t)
+
+	_, err := d.authenticator(nil).Authenticate(context.Background(), "grace", "correct horse")
+	assert.ErrorIs(t, err, authn.ErrUnknownUser)
+
+	// Entries of other object classes are not users
+	_, err = d.authenticator(func(c *Config) { c.UserAttribute = "objectClass" }).
+		Authenticate(context.Background(), "organizationalUnit", "correct horse")
+	assert.ErrorIs(t, err, authn.ErrUnknownUser)
+}
+
+func TestAuthenticateAmbiguousUser(t *testing.T) {
+	d := newDirectory(t)
+	d.entries = append(d.entries, &entry{dn: "uid=ada,ou=contractors,dc=example,dc=com", attributes: map[string][]string{
+		"objectclass": {"person"},
+		"uid":         {"ada"},
+	}})
+
+	_, err := d.authenticator(nil).Authenticate(context.Background(), "ada", "correct horse")
+	assert.ErrorIs(t, err, errAmbiguousUser)
+}
+
+func TestAuthenticateServiceAccountFailure(t *testing.T) {
+	d := newDirectory(t)
+
+	_, err := d.authenticator(func(c *Config) { c.BindPassword = "expired" }).
+		Authenticate(context.Background(), "ada", "correct horse")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, authn.ErrInvalidCredentials, "the user's password was never checked")
+	assert.NotErrorIs(t, err, authn.ErrUnknownUser)
+}
+
+func TestAuthenticateUnreachableDirectory(t *testing.T) {
+	d := newDirectory(t)
+	d.listener.Close()
+
+	_, err := d.authenticator(nil).Authenticate(context.Background(), "ada", "correct horse")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, authn.ErrUnknownUser)
+}
@@ -0,0 +1,119 @@
+package oauth
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/joeariasc/go-auth/internal/auth/scope"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+)
+
+// AuthorizeRequest holds the parameters of an authorization request
+type AuthorizeRequest struct {
+	ClientId            string
+	RedirectURI         string
+	ResponseType        string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	// Nonce is echoed in the ID token of OpenID Connect requests
+	Nonce string
+}
+
+// ParseAuthorizeRequest reads an authorization request from query parameters
+func ParseAuthorizeRequest(values url.Values) *AuthorizeRequest {
+	return &AuthorizeRequest{
+		ClientId:            values.Get("client_id"),
+		RedirectURI:         values.Get("redirect_uri"),
+		ResponseType:        values.Get("response_type"),
+		Scope:               values.Get("scope"),
+		State:               values.Get("state"),
+		CodeChallenge:       values.Get("code_challenge"),
+		CodeChallengeMethod: values.Get("code_challenge_method"),
+		Nonce:               values.Get("nonce"),
+	}
+}
+
+// ResolveRedirectURI returns where responses to the request go. A registered
+// URI must match exactly; it may only be omitted when the client has a single
+// one. Failing this, the error must be shown to the user rather than
+// redirected.
+func ResolveRedirectURI(client *entity.OAuthClient, redirectURI string) (string, *Error) {
+	if redirectURI == "" {
+		if len(client.RedirectURIs) == 1 {
+			return client.RedirectURIs[0], nil
+		}
+		return "", NewError(ErrInvalidRequest, "redirect_uri is required")
+	}
+
+	if !slices.Contains(client.RedirectURIs, redirectURI) {
+		return "", NewError(ErrInvalidRequest, "redirect_uri is not registered for this client")
+	}
+	return redirectURI, nil
+}
+
+// Validate checks the parameters whose errors are reported to the client
+// through its redirect URI
+func (req *AuthorizeRequest) Validate(client *entity.OAuthClient) *Error {
+	if req.ResponseType != "code" {
+		return NewError(ErrUnsupportedResponseType, "only the code response type is supported")
+	}
+	if req.CodeChallenge == "" {
+		return NewError(ErrInvalidRequest, "code_challenge is required")
+	}
+	if !ValidCodeChallenge(req.CodeChallenge, req.CodeChallengeMethod) {
+		return NewError(ErrInvalidRequest, "code_challenge must be a S256 challenge")
+	}
+	if _, err := RequestedScopes(client, req.Scope); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RequestedScopes returns the scopes a client asks for, defaulting to all it
+// is registered for. Scopes outside its registration are an error.
+func RequestedScopes(client *entity.OAuthClient, requested string) ([]string, *Error) {
+	scopes := scope.Parse(requested)
+	if len(scopes) == 0 {
+		return client.Scopes, nil
+	}
+
+	for _, s := range scopes {
+		if !slices.Contains(client.Scopes, s) {
+			return nil, NewError(ErrInvalidScope, "the client may not request "+s)
+		}
+	}
+	return scopes, nil
+}
+
+// CodeRedirect builds the redirect handing an authorization code to a client
+func CodeRedirect(redirectURI string, code string, state string) string {
+	return redirectWith(redirectURI, url.Values{"code": {code}}, state)
+}
+
+// ErrorRedirect builds the redirect reporting err to a client
+func ErrorRedirect(redirectURI string, err *Error, state string) string {
+	params := url.Values{"error": {err.Code}}
+	if err.Description != "" {
+		params.Set("error_description", err.Description)
+	}
+	return redirectWith(redirectURI, params, state)
+}
+
+func redirectWith(redirectURI string, params url.Values, state string) string {
+	if state != "" {
+		params.Set("state", state)
+	}
+	return WithQuery(redirectURI, params)
+}
+
+// WithQuery appends parameters to a URI that may already have a query
+func WithQuery(uri string, params url.Values) string {
+	separator := "?"
+	if strings.Contains(uri, "?") {
+		separator = "&"
+	}
+	return uri + separator + params.Encode()
+}
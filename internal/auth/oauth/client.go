@@ -0,0 +1,204 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/joeariasc/go-auth/internal/auth/oidc"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// How clients authenticate at the token endpoint. Public clients cannot keep
+// a secret and use "none"; the others are confidential.
+const (
+	AuthMethodNone          = "none"
+	AuthMethodSecretBasic   = "client_secret_basic"
+	AuthMethodSecretPost    = "client_secret_post"
+	AuthMethodPrivateKeyJWT = "private_key_jwt"
+)
+
+// AuthMethods lists the supported token endpoint authentication methods
+var AuthMethods = []string{AuthMethodNone, AuthMethodSecretBasic, AuthMethodSecretPost, AuthMethodPrivateKeyJWT}
+
+// ClientAssertionType is the client_assertion_type of private_key_jwt
+const ClientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// maxAssertionLifetime bounds how long a client assertion may be valid, and so
+// how long its ID has to be remembered to detect replays
+const maxAssertionLifetime = 5 * time.Minute
+
+// IsConfidential reports whether a client authenticates at the token endpoint
+func IsConfidential(client *entity.OAuthClient) bool {
+	return client.TokenEndpointAuthMethod != "" && client.TokenEndpointAuthMethod != AuthMethodNone
+}
+
+// GenerateClientSecret returns a new client secret and the bcrypt hash it is
+// stored as
+func GenerateClientSecret() (secret string, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret = base64.RawURLEncoding.EncodeToString(b)
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", "", err
+	}
+	return secret, string(hashed), nil
+}
+
+// ParseJWKS parses the public keys a private_key_jwt client registered
+func ParseJWKS(data []byte) (*oidc.JWKS, error) {
+	var jwks oidc.JWKS
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, oidc.ErrInvalidKey
+	}
+	if len(jwks.Keys) == 0 {
+		return nil, oidc.ErrInvalidKey
+	}
+	for _, key := range jwks.Keys {
+		if _, err := key.PublicKey(); err != nil {
+			return nil, err
+		}
+	}
+	return &jwks, nil
+}
+
+// ClientAuthentication holds the credentials a client presented at the token
+// endpoint
+type ClientAuthentication struct {
+	ClientId  string
+	Method    string
+	Secret    string
+	Assertion string
+}
+
+// Assertion identifies a verified private_key_jwt assertion, which must not
+// be accepted a second time before it expires
+type Assertion struct {
+	ID        string
+	ExpiresAt time.Time
+}
+
+// ParseClientAuthentication reads the client credentials of a token request,
+// whose form must already be parsed. Presenting more than one is an error.
+func ParseClientAuthentication(r *http.Request) (*ClientAuthentication, *Error) {
+	auth := &ClientAuthentication{ClientId: r.PostForm.Get("client_id"), Method: AuthMethodNone}
+	methods := 0
+
+	if id, secret, ok := r.BasicAuth(); ok {
+		// RFC 6749 section 2.3.1: both parts are form-encoded
+		id, idErr := url.QueryUnescape(id)
+		secret, secretErr := url.QueryUnescape(secret)
+		if idErr != nil || secretErr != nil {
+			return nil, NewError(ErrInvalidClient, "malformed authorization header")
+		}
+		if auth.ClientId != "" && auth.ClientId != id {
+			return nil, NewError(ErrInvalidRequest, "client_id does not match the authorization header")
+		}
+		auth.ClientId, auth.Secret = id, secret
+		auth.Method = AuthMethodSecretBasic
+		methods++
+	}
+
+	if secret := r.PostForm.Get("client_secret"); secret != "" {
+		auth.Secret = secret
+		auth.Method = AuthMethodSecretPost
+		methods++
+	}
+
+	if assertion := r.PostForm.Get("client_assertion"); assertion != "" {
+		if r.PostForm.Get("client_assertion_type") != ClientAssertionType {
+			return nil, NewError(ErrInvalidRequest, "unsupported client_assertion_type")
+		}
+		auth.Assertion = assertion
+		auth.Method = AuthMethodPrivateKeyJWT
+		methods++
+
+		// The client_id parameter is optional, the assertion names the client
+		if auth.ClientId == "" {
+			claims := &jwt.RegisteredClaims{}
+			if _, _, err := jwt.NewParser().ParseUnverified(assertion, claims); err == nil {
+				auth.ClientId = claims.Subject
+			}
+		}
+	}
+
+	if methods > 1 {
+		return nil, NewError(ErrInvalidRequest, "more than one client authentication method was used")
+	}
+	if auth.ClientId == "" {
+		return nil, NewError(ErrInvalidClient, "client authentication is required")
+	}
+	return auth, nil
+}
+
+// Verify checks the credentials against the client's registration. audiences
+// are the identifiers of this server a client assertion may be addressed to.
+func (a *ClientAuthentication) Verify(client *entity.OAuthClient, audiences []string, now time.Time) (*Assertion, *Error) {
+	method := client.TokenEndpointAuthMethod
+	if method == "" {
+		method = AuthMethodNone
+	}
+
+	if a.Method != method {
+		return nil, NewError(ErrInvalidClient, "the client must authenticate with "+method)
+	}
+
+	switch method {
+	case AuthMethodSecretBasic, AuthMethodSecretPost:
+		if bcrypt.CompareHashAndPassword([]byte(client.SecretHash), []byte(a.Secret)) != nil {
+			return nil, NewError(ErrInvalidClient, "client authentication failed")
+		}
+	case AuthMethodPrivateKeyJWT:
+		return verifyAssertion(client, a.Assertion, audiences, now)
+	}
+	return nil, nil
+}
+
+// verifyAssertion checks a private_key_jwt assertion as RFC 7523 section 3
+// describes
+func verifyAssertion(client *entity.OAuthClient, assertion string, audiences []string, now time.Time) (*Assertion, *Error) {
+	failed := NewError(ErrInvalidClient, "client authentication failed")
+
+	jwks, err := ParseJWKS(client.JWKS)
+	if err != nil {
+		return nil, failed
+	}
+
+	claims := &jwt.RegisteredClaims{}
+	_, err = jwt.ParseWithClaims(assertion, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		for _, key := range jwks.Keys {
+			if kid == "" && len(jwks.Keys) == 1 || key.KeyID == kid {
+				return key.PublicKey()
+			}
+		}
+		return nil, oidc.ErrInvalidKey
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithTimeFunc(func() time.Time { return now }),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(client.ClientId),
+		jwt.WithSubject(client.ClientId))
+	if err != nil {
+		return nil, failed
+	}
+
+	if !slices.ContainsFunc(audiences, func(audience string) bool { return slices.Contains(claims.Audience, audience) }) {
+		return nil, failed
+	}
+
+	if claims.ID == "" || claims.ExpiresAt.Sub(now) > maxAssertionLifetime {
+		return nil, NewError(ErrInvalidClient, "client assertions need a jti and may be valid for at most five minutes")
+	}
+
+	return &Assertion{ID: claims.ID, ExpiresAt: claims.ExpiresAt.Time}, nil
+}
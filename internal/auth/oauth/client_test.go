@@ -0,0 +1,152 @@
+package oauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/joeariasc/go-auth/internal/auth/oidc"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testTokenEndpoint = "https://auth.example.com/oauth/token"
+
+func tokenRequest(t *testing.T, form url.Values, configure func(r *http.Request)) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if configure != nil {
+		configure(r)
+	}
+	require.NoError(t, r.ParseForm())
+	return r
+}
+
+func TestClientSecretAuthentication(t *testing.T) {
+	secret, hash, err := GenerateClientSecret()
+	require.NoError(t, err)
+
+	client := &entity.OAuthClient{ClientId: "billing-job", TokenEndpointAuthMethod: AuthMethodSecretBasic, SecretHash: hash}
+	now := time.Now()
+
+	basic := tokenRequest(t, url.Values{"grant_type": {"client_credentials"}}, func(r *http.Request) {
+		r.SetBasicAuth(url.QueryEscape("billing-job"), url.QueryEscape(secret))
+	})
+	credentials, oauthErr := ParseClientAuthentication(basic)
+	require.Nil(t, oauthErr)
+	assert.Equal(t, "billing-job", credentials.ClientId)
+
+	assertion, oauthErr := credentials.Verify(client, nil, now)
+	assert.Nil(t, oauthErr)
+	assert.Nil(t, assertion)
+
+	wrong := tokenRequest(t, url.Values{}, func(r *http.Request) { r.SetBasicAuth("billing-job", "guess") })
+	credentials, _ = ParseClientAuthentication(wrong)
+	_, oauthErr = credentials.Verify(client, nil, now)
+	require.NotNil(t, oauthErr)
+	assert.Equal(t, ErrInvalidClient, oauthErr.Code)
+
+	// The secret must be presented the way the client registered
+	post := tokenRequest(t, url.Values{"client_id": {"billing-job"}, "client_secret": {secret}}, nil)
+	credentials, _ = ParseClientAuthentication(post)
+	_, oauthErr = credentials.Verify(client, nil, now)
+	require.NotNil(t, oauthErr)
+	assert.Equal(t, ErrInvalidClient, oauthErr.Code)
+
+	// Leaving the secret out does not turn a confidential client public
+	public := tokenRequest(t, url.Values{"client_id": {"billing-job"}}, nil)
+	credentials, _ = ParseClientAuthentication(public)
+	_, oauthErr = credentials.Verify(client, nil, now)
+	assert.NotNil(t, oauthErr)
+}
+
+func TestClientAuthenticationMethodsAreExclusive(t *testing.T) {
+	r := tokenRequest(t, url.Values{"client_secret": {"s"}}, func(r *http.Request) { r.SetBasicAuth("a", "s") })
+	_, oauthErr := ParseClientAuthentication(r)
+	require.NotNil(t, oauthErr)
+	assert.Equal(t, ErrInvalidRequest, oauthErr.Code)
+
+	_, oauthErr = ParseClientAuthentication(tokenRequest(t, url.Values{}, nil))
+	require.NotNil(t, oauthErr)
+	assert.Equal(t, ErrInvalidClient, oauthErr.Code)
+}
+
+func TestPrivateKeyJWTAuthentication(t *testing.T) {
+	key, err := oidc.GenerateSigningKey()
+	require.NoError(t, err)
+	jwks, err := json.Marshal(oidc.JWKS{Keys: []oidc.JWK{key.JWK()}})
+	require.NoError(t, err)
+
+	client := &entity.OAuthClient{ClientId: "reporting", TokenEndpointAuthMethod: AuthMethodPrivateKeyJWT, JWKS: jwks}
+	now := time.Now()
+
+	sign := func(claims jwt.RegisteredClaims, signer *oidc.SigningKey) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = signer.ID
+		signed, err := token.SignedString(signer.Key)
+		require.NoError(t, err)
+		return signed
+	}
+	claims := jwt.RegisteredClaims{
+		Issuer:    "reporting",
+		Subject:   "reporting",
+		Audience:  jwt.ClaimStrings{testTokenEndpoint},
+		ID:        "assertion-1",
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+	}
+
+	authenticate := func(assertion string) (*Assertion, *Error) {
+		r := tokenRequest(t, url.Values{"client_assertion_type": {ClientAssertionType}, "client_assertion": {assertion}}, nil)
+		credentials, oauthErr := ParseClientAuthentication(r)
+		if oauthErr != nil {
+			return nil, oauthErr
+		}
+		return credentials.Verify(client, []string{"https://auth.example.com", testTokenEndpoint}, now)
+	}
+
+	verified, oauthErr := authenticate(sign(claims, key))
+	require.Nil(t, oauthErr)
+	assert.Equal(t, "assertion-1", verified.ID)
+
+	other, err := oidc.GenerateSigningKey()
+	require.NoError(t, err)
+	_, oauthErr = authenticate(sign(claims, other))
+	assert.NotNil(t, oauthErr, "signed with a key the client did not register")
+
+	wrongAudience := claims
+	wrongAudience.Audience = jwt.ClaimStrings{"https://other.example.com/token"}
+	_, oauthErr = authenticate(sign(wrongAudience, key))
+	assert.NotNil(t, oauthErr)
+
+	longLived := claims
+	longLived.ExpiresAt = jwt.NewNumericDate(now.Add(time.Hour))
+	_, oauthErr = authenticate(sign(longLived, key))
+	assert.NotNil(t, oauthErr)
+
+	noID := claims
+	noID.ID = ""
+	_, oauthErr = authenticate(sign(noID, key))
+	assert.NotNil(t, oauthErr)
+
+	expired := claims
+	expired.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute))
+	_, oauthErr = authenticate(sign(expired, key))
+	assert.NotNil(t, oauthErr)
+}
+
+func TestParseJWKS(t *testing.T) {
+	_, err := ParseJWKS([]byte(`{"keys":[]}`))
+	assert.Error(t, err)
+
+	_, err = ParseJWKS([]byte(`{"keys":[{"kty":"EC"}]}`))
+	assert.Error(t, err)
+
+	_, err = ParseJWKS([]byte(`not json`))
+	assert.Error(t, err)
+}
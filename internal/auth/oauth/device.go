@@ -0,0 +1,63 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// GrantTypeDeviceCode is the grant_type of RFC 8628 token requests
+const GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+// SlowDownIncrement is added to the polling interval of a device that polls
+// too fast, RFC 8628 section 3.5
+const SlowDownIncrement = 5 * time.Second
+
+// userCodeAlphabet has no vowels, so codes cannot spell words, and no
+// characters that are easily confused
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+const userCodeLength = 8
+
+// NewUserCode returns a code for the user to enter on the verification page,
+// formatted as XXXX-XXXX. At 20^8 possible codes it is meant to live only
+// minutes.
+func NewUserCode() (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+
+	for i := 0; i < userCodeLength; i++ {
+		if i == userCodeLength/2 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// NormalizeUserCode turns what a user typed into the stored form of a user
+// code, ignoring case, spaces and dashes. It returns "" for input that cannot
+// be a user code.
+func NormalizeUserCode(input string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(input) {
+		switch {
+		case r == '-' || r == ' ':
+			continue
+		case !strings.ContainsRune(userCodeAlphabet, r):
+			return ""
+		}
+		b.WriteRune(r)
+	}
+
+	code := b.String()
+	if len(code) != userCodeLength {
+		return ""
+	}
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
@@ -0,0 +1,35 @@
+package oauth
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewUserCode(t *testing.T) {
+	format := regexp.MustCompile(`^[BCDFGHJKLMNPQRSTVWXZ]{4}-[BCDFGHJKLMNPQRSTVWXZ]{4}$`)
+
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		code, err := NewUserCode()
+		require.NoError(t, err)
+		assert.Regexp(t, format, code)
+		assert.Equal(t, code, NormalizeUserCode(code))
+		seen[code] = true
+	}
+	assert.Greater(t, len(seen), 95)
+}
+
+func TestNormalizeUserCode(t *testing.T) {
+	assert.Equal(t, "WDJB-MJHT", NormalizeUserCode("wdjb-mjht"))
+	assert.Equal(t, "WDJB-MJHT", NormalizeUserCode("WDJBMJHT"))
+	assert.Equal(t, "WDJB-MJHT", NormalizeUserCode(" wdjb mjht "))
+
+	assert.Empty(t, NormalizeUserCode("WDJB-MJH"), "too short")
+	assert.Empty(t, NormalizeUserCode("WDJB-MJHTX"), "too long")
+	assert.Empty(t, NormalizeUserCode("AEIO-MJHT"), "vowels are never issued")
+	assert.Empty(t, NormalizeUserCode("WDJB_MJHT"))
+	assert.Empty(t, NormalizeUserCode(""))
+}
@@ -0,0 +1,67 @@
+package oauth
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Error codes of RFC 6749 sections 4.1.2.1 and 5.2
+const (
+	ErrInvalidRequest          = "invalid_request"
+	ErrInvalidClient           = "invalid_client"
+	ErrInvalidGrant            = "invalid_grant"
+	ErrUnauthorizedClient      = "unauthorized_client"
+	ErrUnsupportedGrantType    = "unsupported_grant_type"
+	ErrUnsupportedResponseType = "unsupported_response_type"
+	ErrInvalidScope            = "invalid_scope"
+	ErrAccessDenied            = "access_denied"
+	ErrServerError             = "server_error"
+)
+
+// Error codes of the device authorization grant, RFC 8628 section 3.5
+const (
+	ErrAuthorizationPending = "authorization_pending"
+	ErrSlowDown             = "slow_down"
+	ErrExpiredToken         = "expired_token"
+)
+
+// ErrUnsupportedTokenType is returned for tokens that cannot be revoked,
+// RFC 7009 section 2.2.1
+const ErrUnsupportedTokenType = "unsupported_token_type"
+
+// Error is an OAuth error response
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func NewError(code string, description string) *Error {
+	return &Error{Code: code, Description: description}
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+// Status is the HTTP status the token endpoint answers the error with
+func (e *Error) Status() int {
+	switch e.Code {
+	case ErrInvalidClient:
+		return http.StatusUnauthorized
+	case ErrServerError:
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// WriteError writes err as a token endpoint error response
+func WriteError(w http.ResponseWriter, err *Error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(err.Status())
+	json.NewEncoder(w).Encode(err)
+}
@@ -0,0 +1,142 @@
+package oauth
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// From RFC 7636 appendix B
+const (
+	testVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func testClient() *entity.OAuthClient {
+	return &entity.OAuthClient{
+		ClientId:     "spa",
+		RedirectURIs: []string{"https://app.example.com/callback", "http://localhost:3000/callback"},
+		Scopes:       []string{"profile", "sessions"},
+	}
+}
+
+func TestPKCE(t *testing.T) {
+	assert.Equal(t, testChallenge, CodeChallenge(testVerifier))
+	assert.True(t, ValidCodeChallenge(testChallenge, MethodS256))
+	assert.False(t, ValidCodeChallenge(testChallenge, "plain"))
+	assert.False(t, ValidCodeChallenge("short", MethodS256))
+
+	assert.True(t, VerifyCodeVerifier(testChallenge, MethodS256, testVerifier))
+	assert.False(t, VerifyCodeVerifier(testChallenge, MethodS256, testVerifier+"x"))
+	assert.False(t, VerifyCodeVerifier(testChallenge, "plain", testVerifier))
+	assert.False(t, VerifyCodeVerifier(CodeChallenge("too-short"), MethodS256, "too-short"))
+}
+
+func TestResolveRedirectURI(t *testing.T) {
+	client := testClient()
+
+	uri, err := ResolveRedirectURI(client, "http://localhost:3000/callback")
+	assert.Nil(t, err)
+	assert.Equal(t, "http://localhost:3000/callback", uri)
+
+	_, err = ResolveRedirectURI(client, "https://app.example.com/callback/../evil")
+	require.NotNil(t, err)
+	assert.Equal(t, ErrInvalidRequest, err.Code)
+
+	_, err = ResolveRedirectURI(client, "")
+	assert.NotNil(t, err, "omitting the URI is ambiguous with several registered")
+
+	client.RedirectURIs = client.RedirectURIs[:1]
+	uri, err = ResolveRedirectURI(client, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://app.example.com/callback", uri)
+}
+
+func TestAuthorizeRequestValidate(t *testing.T) {
+	client := testClient()
+	values := url.Values{
+		"client_id":             {"spa"},
+		"response_type":         {"code"},
+		"scope":                 {"profile"},
+		"state":                 {"xyz"},
+		"code_challenge":        {testChallenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	assert.Nil(t, ParseAuthorizeRequest(values).Validate(client))
+
+	testCases := []struct {
+		name  string
+		param string
+		value string
+		code  string
+	}{
+		{"Implicit grant", "response_type", "token", ErrUnsupportedResponseType},
+		{"Missing challenge", "code_challenge", "", ErrInvalidRequest},
+		{"Plain challenge", "code_challenge_method", "plain", ErrInvalidRequest},
+		{"Unregistered scope", "scope", "profile users:write", ErrInvalidScope},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			invalid := url.Values{}
+			for k, v := range values {
+				invalid[k] = v
+			}
+			invalid.Set(tc.param, tc.value)
+
+			err := ParseAuthorizeRequest(invalid).Validate(client)
+			require.NotNil(t, err)
+			assert.Equal(t, tc.code, err.Code)
+		})
+	}
+}
+
+func TestRequestedScopes(t *testing.T) {
+	client := testClient()
+
+	scopes, err := RequestedScopes(client, "")
+	assert.Nil(t, err)
+	assert.Equal(t, client.Scopes, scopes)
+
+	scopes, err = RequestedScopes(client, "sessions")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"sessions"}, scopes)
+
+	_, err = RequestedScopes(client, "sessions roles:write")
+	assert.NotNil(t, err)
+}
+
+func TestRedirects(t *testing.T) {
+	assert.Equal(t, "https://app.example.com/cb?code=abc&state=s+1", CodeRedirect("https://app.example.com/cb", "abc", "s 1"))
+	assert.Equal(t, "https://app.example.com/cb?tenant=1&code=abc", CodeRedirect("https://app.example.com/cb?tenant=1", "abc", ""))
+
+	location := ErrorRedirect("https://app.example.com/cb", NewError(ErrAccessDenied, "denied"), "xyz")
+	parsed, err := url.Parse(location)
+	require.NoError(t, err)
+	assert.Equal(t, "access_denied", parsed.Query().Get("error"))
+	assert.Equal(t, "denied", parsed.Query().Get("error_description"))
+	assert.Equal(t, "xyz", parsed.Query().Get("state"))
+}
+
+func TestOpaqueToken(t *testing.T) {
+	token, hash, err := NewOpaqueToken()
+	require.NoError(t, err)
+	assert.Len(t, token, 43)
+	assert.Equal(t, hash, HashToken(token))
+	assert.NotEqual(t, token, hash)
+
+	other, _, err := NewOpaqueToken()
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func TestErrorStatus(t *testing.T) {
+	assert.Equal(t, http.StatusUnauthorized, NewError(ErrInvalidClient, "").Status())
+	assert.Equal(t, http.StatusBadRequest, NewError(ErrInvalidGrant, "").Status())
+	assert.Equal(t, "invalid_grant: expired", NewError(ErrInvalidGrant, "expired").Error())
+}
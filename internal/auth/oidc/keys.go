@@ -0,0 +1,115 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+)
+
+var ErrInvalidKey = errors.New("invalid OIDC signing key")
+
+// SigningKey signs ID tokens. ID is the key's RFC 7638 thumbprint, published
+// as the kid of its JWK.
+type SigningKey struct {
+	ID  string
+	Key *rsa.PrivateKey
+}
+
+func NewSigningKey(key *rsa.PrivateKey) *SigningKey {
+	return &SigningKey{ID: thumbprint(&key.PublicKey), Key: key}
+}
+
+// GenerateSigningKey creates a 2048 bit RSA key. Tokens signed with it stop
+// verifying once the process exits, so it is only meant for development.
+func GenerateSigningKey() (*SigningKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigningKey(key), nil
+}
+
+// ParseSigningKey reads a PEM encoded PKCS#1 or PKCS#8 RSA private key
+func ParseSigningKey(data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidKey
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return NewSigningKey(key), nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+	return NewSigningKey(key), nil
+}
+
+// JWK is the public part of a signing key as published in the JWKS
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK returns the public key in JWK form
+func (k *SigningKey) JWK() JWK {
+	n, e := encodePublicKey(&k.Key.PublicKey)
+	return JWK{KeyType: "RSA", Use: "sig", Algorithm: "RS256", KeyID: k.ID, N: n, E: e}
+}
+
+// PublicKey decodes an RSA JWK
+func (j JWK) PublicKey() (*rsa.PublicKey, error) {
+	if j.KeyType != "RSA" {
+		return nil, ErrInvalidKey
+	}
+
+	n, err := base64.RawURLEncoding.DecodeString(j.N)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	e, err := base64.RawURLEncoding.DecodeString(j.E)
+	if err != nil || len(e) > 4 {
+		return nil, ErrInvalidKey
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+func encodePublicKey(key *rsa.PublicKey) (n string, e string) {
+	return base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+}
+
+// thumbprint is the RFC 7638 JWK thumbprint of an RSA key
+func thumbprint(key *rsa.PublicKey) string {
+	n, e := encodePublicKey(key)
+	// Members in lexicographic order, no whitespace
+	canonical, _ := json.Marshal(struct {
+		E   string `json:"e"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+	}{e, "RSA", n})
+
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
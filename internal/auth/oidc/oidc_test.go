@@ -0,0 +1,216 @@
+package oidc
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// relyingParty verifies ID tokens the way a client library would, knowing
+// nothing but the issuer URL
+type relyingParty struct {
+	issuer   string
+	clientID string
+}
+
+func (rp *relyingParty) getJSON(t *testing.T, url string, v any) {
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+}
+
+func (rp *relyingParty) verify(t *testing.T, idToken string, nonce string) (*IDTokenClaims, error) {
+	var discovery Discovery
+	rp.getJSON(t, rp.issuer+"/.well-known/openid-configuration", &discovery)
+	require.Equal(t, rp.issuer, discovery.Issuer, "issuer must match the URL it was discovered at")
+
+	var jwks JWKS
+	rp.getJSON(t, discovery.JWKSURI, &jwks)
+
+	claims := &IDTokenClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		for _, key := range jwks.Keys {
+			if key.KeyID == token.Header["kid"] {
+				return key.PublicKey()
+			}
+		}
+		return nil, fmt.Errorf("unknown key %v", token.Header["kid"])
+	}, jwt.WithValidMethods(discovery.IDTokenSigningAlgValuesSupported),
+		jwt.WithIssuer(discovery.Issuer), jwt.WithAudience(rp.clientID), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("nonce mismatch")
+	}
+	return claims, nil
+}
+
+func newTestProvider(t *testing.T) (*Provider, *httptest.Server) {
+	key, err := GenerateSigningKey()
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	provider := NewProvider(ProviderConfig{
+		Issuer:     server.URL,
+		Key:        key,
+		IDTokenTTL: 5 * time.Minute,
+		Scopes:     []string{ScopeOpenID, ScopeProfile, ScopeEmail},
+	})
+	mux.HandleFunc("GET /.well-known/openid-configuration", provider.ServeDiscovery)
+	mux.HandleFunc("GET /oauth/jwks", provider.ServeJWKS)
+
+	return provider, server
+}
+
+func TestRelyingPartyVerifiesIDToken(t *testing.T) {
+	provider, server := newTestProvider(t)
+	rp := &relyingParty{issuer: server.URL, clientID: "spa"}
+
+	authTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+	idToken, err := provider.SignIDToken(IDTokenParams{
+		Subject:   "42",
+		ClientID:  "spa",
+		Nonce:     "n-0S6_WzA2Mj",
+		SessionID: "session-1",
+		AuthTime:  authTime,
+		AMR:       []string{AMRPassword},
+		ACR:       ACRPassword,
+	})
+	require.NoError(t, err)
+
+	claims, err := rp.verify(t, idToken, "n-0S6_WzA2Mj")
+	require.NoError(t, err)
+	assert.Equal(t, "42", claims.Subject)
+	assert.Equal(t, "spa", claims.AZP)
+	assert.Equal(t, authTime, claims.AuthTime.Time)
+	assert.Equal(t, []string{"pwd"}, claims.AMR)
+	assert.Equal(t, ACRPassword, claims.ACR)
+	assert.Equal(t, "session-1", claims.SID)
+
+	_, err = rp.verify(t, idToken, "replayed-nonce")
+	assert.Error(t, err)
+
+	other := &relyingParty{issuer: server.URL, clientID: "other-client"}
+	_, err = other.verify(t, idToken, "n-0S6_WzA2Mj")
+	assert.Error(t, err, "the token is not meant for another client")
+}
+
+func TestRelyingPartyRejectsForeignKey(t *testing.T) {
+	_, server := newTestProvider(t)
+	impostor, _ := newTestProvider(t)
+	impostor.issuer = server.URL
+
+	idToken, err := impostor.SignIDToken(IDTokenParams{Subject: "42", ClientID: "spa", AuthTime: time.Now()})
+	require.NoError(t, err)
+
+	rp := &relyingParty{issuer: server.URL, clientID: "spa"}
+	_, err = rp.verify(t, idToken, "")
+	assert.Error(t, err)
+}
+
+func TestDiscovery(t *testing.T) {
+	_, server := newTestProvider(t)
+	rp := &relyingParty{issuer: server.URL}
+
+	var discovery Discovery
+	rp.getJSON(t, server.URL+"/.well-known/openid-configuration", &discovery)
+
+	assert.Equal(t, server.URL, discovery.Issuer)
+	assert.Equal(t, server.URL+"/oauth/token", discovery.TokenEndpoint)
+	assert.Equal(t, server.URL+"/oauth/introspect", discovery.IntrospectionEndpoint)
+	assert.Equal(t, server.URL+"/oauth/revoke", discovery.RevocationEndpoint)
+	assert.Equal(t, server.URL+"/oauth/device_authorization", discovery.DeviceAuthorizationEndpoint)
+	assert.Equal(t, []string{ScopeOpenID, ScopeProfile, ScopeEmail}, discovery.ScopesSupported)
+	assert.Contains(t, discovery.GrantTypesSupported, "client_credentials")
+}
+
+func TestParseIDTokenHint(t *testing.T) {
+	provider, _ := newTestProvider(t)
+
+	expired := NewProvider(ProviderConfig{Issuer: provider.issuer, Key: provider.key, IDTokenTTL: -time.Hour})
+	idToken, err := expired.SignIDToken(IDTokenParams{Subject: "42", ClientID: "spa", SessionID: "s1", AuthTime: time.Now()})
+	require.NoError(t, err)
+
+	claims, err := provider.ParseIDTokenHint(idToken)
+	require.NoError(t, err, "expired hints are accepted")
+	assert.Equal(t, "s1", claims.SID)
+
+	otherIssuer := NewProvider(ProviderConfig{Issuer: "https://elsewhere.example", Key: provider.key, IDTokenTTL: time.Hour})
+	idToken, err = otherIssuer.SignIDToken(IDTokenParams{Subject: "42", ClientID: "spa", AuthTime: time.Now()})
+	require.NoError(t, err)
+	_, err = provider.ParseIDTokenHint(idToken)
+	assert.ErrorIs(t, err, ErrInvalidIDToken)
+}
+
+func TestParseSigningKey(t *testing.T) {
+	key, err := GenerateSigningKey()
+	require.NoError(t, err)
+
+	pkcs1 := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key.Key)})
+	parsed, err := ParseSigningKey(pkcs1)
+	require.NoError(t, err)
+	assert.Equal(t, key.ID, parsed.ID)
+
+	der, err := x509.MarshalPKCS8PrivateKey(key.Key)
+	require.NoError(t, err)
+	parsed, err = ParseSigningKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	require.NoError(t, err)
+	assert.Equal(t, key.ID, parsed.ID)
+
+	_, err = ParseSigningKey([]byte("not a key"))
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	public, err := key.JWK().PublicKey()
+	require.NoError(t, err)
+	assert.True(t, public.Equal(&key.Key.PublicKey))
+}
+
+func TestNewUserInfo(t *testing.T) {
+	user := &entity.User{Id: 42, Username: "joe", Email: "joe@example.com", EmailVerified: true}
+
+	info := NewUserInfo(user, []string{ScopeOpenID})
+	assert.Equal(t, UserInfo{Subject: "42"}, info)
+
+	info = NewUserInfo(user, []string{ScopeOpenID, ScopeProfile, ScopeEmail})
+	assert.Equal(t, "joe", info.PreferredUsername)
+	assert.Equal(t, "joe@example.com", info.Email)
+	require.NotNil(t, info.EmailVerified)
+	assert.True(t, *info.EmailVerified)
+
+	user.Email = ""
+	info = NewUserInfo(user, []string{ScopeOpenID, ScopeEmail})
+	assert.Empty(t, info.Email)
+	assert.Nil(t, info.EmailVerified)
+}
+
+func TestAuthenticationContext(t *testing.T) {
+	amr, acr := AuthenticationContext(AMRPassword)
+	assert.Equal(t, []string{"pwd"}, amr)
+	assert.Equal(t, ACRPassword, acr)
+
+	amr, acr = AuthenticationContext(AMRFederated)
+	assert.Equal(t, []string{"fed"}, amr)
+	assert.Equal(t, ACRFederated, acr)
+
+	// Sessions from before methods were recorded claim nothing
+	amr, acr = AuthenticationContext("")
+	assert.Nil(t, amr)
+	assert.Empty(t, acr)
+}
@@ -0,0 +1,248 @@
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+)
+
+// Scopes with a meaning defined by OpenID Connect Core
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// Authentication methods and the context classes reported in ID tokens.
+// Users sign in with a password, checked here or by the directory, or at an
+// external identity provider.
+const (
+	AMRPassword  = "pwd"
+	AMRFederated = "fed"
+	ACRPassword  = "urn:go-auth:acr:password"
+	ACRFederated = "urn:go-auth:acr:federated"
+)
+
+// AuthenticationContext returns the amr and acr of an ID token for a sign-in
+// with method, one of the AMR constants. Both are empty for unknown methods,
+// e.g. of sessions started before methods were recorded.
+func AuthenticationContext(method string) ([]string, string) {
+	switch method {
+	case AMRPassword:
+		return []string{AMRPassword}, ACRPassword
+	case AMRFederated:
+		return []string{AMRFederated}, ACRFederated
+	default:
+		return nil, ""
+	}
+}
+
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce    string           `json:"nonce,omitempty"`
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	AMR      []string         `json:"amr,omitempty"`
+	ACR      string           `json:"acr,omitempty"`
+	AZP      string           `json:"azp,omitempty"`
+	// SID identifies the OAuth session, ending it logs the client out
+	SID string `json:"sid,omitempty"`
+}
+
+type IDTokenParams struct {
+	Subject   string
+	ClientID  string
+	Nonce     string
+	SessionID string
+	AuthTime  time.Time
+	AMR       []string
+	ACR       string
+}
+
+// Provider issues ID tokens and publishes what relying parties need to verify
+// them
+type Provider struct {
+	issuer     string
+	key        *SigningKey
+	idTokenTTL time.Duration
+	scopes     []string
+}
+
+type ProviderConfig struct {
+	// Issuer is the public base URL of this service; endpoints are below it
+	Issuer     string
+	Key        *SigningKey
+	IDTokenTTL time.Duration
+	// Scopes are advertised as supported in the discovery document
+	Scopes []string
+}
+
+func NewProvider(config ProviderConfig) *Provider {
+	return &Provider{
+		issuer:     config.Issuer,
+		key:        config.Key,
+		idTokenTTL: config.IDTokenTTL,
+		scopes:     config.Scopes,
+	}
+}
+
+func (p *Provider) Issuer() string {
+	return p.issuer
+}
+
+// Subject is the stable identifier of a user in ID tokens and userinfo
+func Subject(user *entity.User) string {
+	return strconv.FormatInt(user.Id, 10)
+}
+
+// SignIDToken issues an ID token for the client a user signed in to
+func (p *Provider) SignIDToken(params IDTokenParams) (string, error) {
+	now := time.Now()
+
+	claims := IDTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    p.issuer,
+			Subject:   params.Subject,
+			Audience:  jwt.ClaimStrings{params.ClientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(p.idTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		Nonce:    params.Nonce,
+		AuthTime: jwt.NewNumericDate(params.AuthTime),
+		AMR:      params.AMR,
+		ACR:      params.ACR,
+		AZP:      params.ClientID,
+		SID:      params.SessionID,
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = p.key.ID
+
+	signed, err := token.SignedString(p.key.Key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign ID token: %w", err)
+	}
+	return signed, nil
+}
+
+// ParseIDTokenHint verifies an ID token this provider issued, as passed back
+// by a relying party at logout. Expired tokens are accepted as the
+// specification recommends.
+func (p *Provider) ParseIDTokenHint(tokenString string) (*IDTokenClaims, error) {
+	claims := &IDTokenClaims{}
+
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		return &p.key.Key.PublicKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	// Claims validation was skipped for the expiry, so check the issuer here
+	if claims.Issuer != p.issuer || len(claims.Audience) == 0 {
+		return nil, ErrInvalidIDToken
+	}
+	return claims, nil
+}
+
+// Discovery is the OpenID Provider metadata document
+type Discovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	EndSessionEndpoint                string   `json:"end_session_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	TokenEndpointAuthSigningAlgs      []string `json:"token_endpoint_auth_signing_alg_values_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	ACRValuesSupported                []string `json:"acr_values_supported"`
+}
+
+func (p *Provider) Discovery() Discovery {
+	return Discovery{
+		Issuer:                      p.issuer,
+		AuthorizationEndpoint:       p.issuer + "/oauth/authorize",
+		TokenEndpoint:               p.issuer + "/oauth/token",
+		UserinfoEndpoint:            p.issuer + "/oauth/userinfo",
+		JWKSURI:                     p.issuer + "/oauth/jwks",
+		EndSessionEndpoint:          p.issuer + "/oauth/logout",
+		DeviceAuthorizationEndpoint: p.issuer + "/oauth/device_authorization",
+		IntrospectionEndpoint:       p.issuer + "/oauth/introspect",
+		RevocationEndpoint:          p.issuer + "/oauth/revoke",
+		ScopesSupported:             p.scopes,
+		ResponseTypesSupported:      []string{"code"},
+		GrantTypesSupported: []string{"authorization_code", "refresh_token", "client_credentials",
+			"urn:ietf:params:oauth:grant-type:device_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{jwt.SigningMethodRS256.Alg()},
+		TokenEndpointAuthMethodsSupported: []string{"none", "client_secret_basic", "client_secret_post", "private_key_jwt"},
+		TokenEndpointAuthSigningAlgs:      []string{jwt.SigningMethodRS256.Alg()},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported: []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "amr", "acr", "azp", "sid",
+			"preferred_username", "email", "email_verified"},
+		ACRValuesSupported: []string{ACRPassword, ACRFederated},
+	}
+}
+
+func (p *Provider) JWKS() JWKS {
+	return JWKS{Keys: []JWK{p.key.JWK()}}
+}
+
+// ServeDiscovery answers /.well-known/openid-configuration
+func (p *Provider) ServeDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeCacheableJSON(w, p.Discovery())
+}
+
+// ServeJWKS publishes the keys ID tokens are signed with
+func (p *Provider) ServeJWKS(w http.ResponseWriter, r *http.Request) {
+	writeCacheableJSON(w, p.JWKS())
+}
+
+func writeCacheableJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	json.NewEncoder(w).Encode(v)
+}
+
+// UserInfo holds the claims about a user released for the granted scopes
+type UserInfo struct {
+	Subject           string `json:"sub"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+}
+
+// NewUserInfo maps a user to standard claims, releasing only those the
+// scopes cover
+func NewUserInfo(user *entity.User, scopes []string) UserInfo {
+	info := UserInfo{Subject: Subject(user)}
+
+	if slices.Contains(scopes, ScopeProfile) {
+		info.PreferredUsername = user.Username
+	}
+
+	if slices.Contains(scopes, ScopeEmail) && user.Email != "" {
+		info.Email = user.Email
+		info.EmailVerified = &user.EmailVerified
+	}
+	return info
+}
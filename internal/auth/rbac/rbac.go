@@ -0,0 +1,160 @@
+package rbac
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+)
+
+// Built-in permissions. Downstream services may register their own using the
+// same "resource:action" naming.
+const (
+	PermAll           = "*"
+	PermUsersRead     = "users:read"
+	PermUsersWrite    = "users:write"
+	PermRolesRead     = "roles:read"
+	PermRolesWrite    = "roles:write"
+	PermAuditRead     = "audit:read"
+	PermWebhooksRead  = "webhooks:read"
+	PermWebhooksWrite = "webhooks:write"
+	PermClientsRead   = "clients:read"
+	PermClientsWrite  = "clients:write"
+	PermSCIMProvision = "scim:provision"
+)
+
+// AdminRole is granted every permission
+const AdminRole = "admin"
+
+var builtinPermissions = []entity.Permission{
+	{Name: PermAll, Description: "All permissions"},
+	{Name: PermUsersRead, Description: "View user accounts"},
+	{Name: PermUsersWrite, Description: "Manage user accounts and their role assignments"},
+	{Name: PermRolesRead, Description: "View roles and permissions"},
+	{Name: PermRolesWrite, Description: "Manage roles and permissions"},
+	{Name: PermAuditRead, Description: "View the security audit log"},
+	{Name: PermWebhooksRead, Description: "View webhook subscriptions and deliveries"},
+	{Name: PermWebhooksWrite, Description: "Manage webhook subscriptions and retry deliveries"},
+	{Name: PermClientsRead, Description: "View OAuth clients"},
+	{Name: PermClientsWrite, Description: "Register and manage OAuth clients"},
+	{Name: PermSCIMProvision, Description: "Provision users and groups through SCIM"},
+}
+
+var (
+	permissionPattern = regexp.MustCompile(`^[a-z0-9_-]+:([a-z0-9_-]+|\*)$`)
+	rolePattern       = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+)
+
+func ValidPermissionName(name string) bool {
+	return name == PermAll || permissionPattern.MatchString(name)
+}
+
+func ValidRoleName(name string) bool {
+	return rolePattern.MatchString(name)
+}
+
+// RoleNameFor turns a display name, such as the name of a group at an identity
+// provider, into a role name: lower case with runs of other characters
+// replaced by a dash. The result is empty when nothing usable is left.
+func RoleNameFor(displayName string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(displayName) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-':
+			b.WriteRune(r)
+			dash = false
+		case !dash && b.Len() > 0:
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+
+	name := strings.TrimRight(b.String(), "-")
+	if len(name) > 64 {
+		name = strings.TrimRight(name[:64], "-")
+	}
+	return name
+}
+
+// Allows reports whether the granted permissions satisfy required. A grant of
+// "*" allows everything and "resource:*" allows every action on resource.
+func Allows(granted []string, required string) bool {
+	resource, _, _ := strings.Cut(required, ":")
+
+	for _, permission := range granted {
+		if permission == PermAll || permission == required || permission == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAll reports whether the granted permissions satisfy every one of
+// required, e.g. those of a role someone wants to hand out
+func AllowsAll(granted []string, required []string) bool {
+	for _, permission := range required {
+		if !Allows(granted, permission) {
+			return false
+		}
+	}
+	return true
+}
+
+// Privileged reports whether a permission grants access to this service
+// itself rather than to a downstream one: "*" and every permission on a
+// resource of the built-in permissions.
+func Privileged(permission string) bool {
+	if permission == PermAll {
+		return true
+	}
+
+	resource, _, _ := strings.Cut(permission, ":")
+	for _, builtin := range builtinPermissions {
+		if prefix, _, ok := strings.Cut(builtin.Name, ":"); ok && prefix == resource {
+			return true
+		}
+	}
+	return false
+}
+
+// Provisionable reports whether SCIM clients may manage a role: it has to be
+// marked as such and must not grant any privileged permission, so that an
+// identity provider cannot hand out administrative access.
+func Provisionable(role *entity.Role) bool {
+	return role.Provisionable && !slices.ContainsFunc(role.Permissions, Privileged)
+}
+
+// Seed makes sure the built-in permissions and the admin role exist, and
+// assigns the admin role to the given bootstrap users.
+func Seed(conn *db.Connection, adminUsernames []string) error {
+	for _, permission := range builtinPermissions {
+		if err := conn.EnsurePermission(permission.Name, permission.Description); err != nil {
+			return fmt.Errorf("failed to seed permission %s: %w", permission.Name, err)
+		}
+	}
+
+	admin := &entity.Role{
+		Name:        AdminRole,
+		Description: "Full administrative access",
+		Permissions: []string{PermAll},
+	}
+	if err := conn.EnsureRole(admin); err != nil {
+		return fmt.Errorf("failed to seed admin role: %w", err)
+	}
+
+	for _, username := range adminUsernames {
+		user, err := conn.GetUser(username)
+		if err != nil {
+			return fmt.Errorf("failed to bootstrap admin %s: %w", username, err)
+		}
+		if err := conn.AssignRole(user.Id, AdminRole); err != nil {
+			return fmt.Errorf("failed to bootstrap admin %s: %w", username, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package rbac
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllows(t *testing.T) {
+	testCases := []struct {
+		name     string
+		granted  []string
+		required string
+		expected bool
+	}{
+		{"Exact match", []string{"users:read"}, "users:read", true},
+		{"Different action", []string{"users:read"}, "users:write", false},
+		{"Resource wildcard", []string{"users:*"}, "users:write", true},
+		{"Wildcard of other resource", []string{"roles:*"}, "users:write", false},
+		{"Global wildcard", []string{"*"}, "reports:export", true},
+		{"No permissions", nil, "users:read", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Allows(tc.granted, tc.required))
+		})
+	}
+}
+
+func TestNameValidation(t *testing.T) {
+	assert.True(t, ValidPermissionName("users:write"))
+	assert.True(t, ValidPermissionName("reports:*"))
+	assert.True(t, ValidPermissionName("*"))
+	assert.False(t, ValidPermissionName("users"))
+	assert.False(t, ValidPermissionName("Users:Write"))
+
+	assert.True(t, ValidRoleName("support-staff"))
+	assert.False(t, ValidRoleName("Support Staff"))
+	assert.False(t, ValidRoleName(""))
+}
+
+func TestRoleNameFor(t *testing.T) {
+	testCases := []struct {
+		displayName string
+		expected    string
+	}{
+		{"support", "support"},
+		{"Support Staff", "support-staff"},
+		{"  Sales & Marketing (EMEA) ", "sales-marketing-emea"},
+		{"on_call-team", "on_call-team"},
+		{"Équipe", "quipe"},
+		{"!!!", ""},
+		{strings.Repeat("ab ", 40), strings.Repeat("ab-", 21) + "a"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.displayName, func(t *testing.T) {
+			name := RoleNameFor(tc.displayName)
+			assert.Equal(t, tc.expected, name)
+			if name != "" {
+				assert.True(t, ValidRoleName(name))
+			}
+		})
+	}
+}
+
+func TestAllowsAll(t *testing.T) {
+	assert.True(t, AllowsAll([]string{PermAll}, []string{PermAll, PermUsersWrite}))
+	assert.True(t, AllowsAll([]string{"users:*", "reports:read"}, []string{PermUsersRead, "reports:read"}))
+	assert.True(t, AllowsAll([]string{}, []string{}), "a role without permissions can be handed out by anyone")
+	assert.False(t, AllowsAll([]string{"users:*"}, []string{PermUsersRead, PermRolesWrite}))
+	assert.False(t, AllowsAll([]string{"users:*"}, []string{PermAll}))
+}
+
+func TestPrivileged(t *testing.T) {
+	assert.True(t, Privileged(PermAll))
+	assert.True(t, Privileged(PermUsersRead))
+	assert.True(t, Privileged("roles:*"))
+	assert.True(t, Privileged("scim:anything"))
+	assert.False(t, Privileged("reports:read"))
+	assert.False(t, Privileged("reports:*"))
+}
+
+func TestProvisionable(t *testing.T) {
+	assert.True(t, Provisionable(&entity.Role{Name: "engineering", Provisionable: true}))
+	assert.True(t, Provisionable(&entity.Role{Name: "support", Provisionable: true, Permissions: []string{"tickets:write"}}))
+	assert.False(t, Provisionable(&entity.Role{Name: "support", Permissions: []string{"tickets:write"}}), "not marked")
+	assert.False(t, Provisionable(&entity.Role{Name: "helpdesk", Provisionable: true, Permissions: []string{PermUsersWrite}}))
+	assert.False(t, Provisionable(&entity.Role{Name: "owners", Provisionable: true, Permissions: []string{PermAll}}))
+}
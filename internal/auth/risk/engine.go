@@ -0,0 +1,192 @@
+package risk
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/models"
+)
+
+// Decision is the outcome of a risk assessment
+type Decision string
+
+const (
+	Allow      Decision = "allow"
+	RequireMFA Decision = "require_mfa"
+	Deny       Decision = "deny"
+)
+
+// Stage tells signals where in the authentication flow they are evaluated
+type Stage string
+
+const (
+	StageLogin  Stage = "login"
+	StageVerify Stage = "verify"
+)
+
+// Input is everything known about an authentication attempt
+type Input struct {
+	Stage         Stage
+	UserId        int64
+	Username      string
+	ClientType    models.ClientType
+	IP            string
+	UserAgent     string
+	Time          time.Time
+	NewDevice     bool
+	TrustedDevice bool
+	Mobile        *models.MobileFingerprint
+}
+
+// Finding is what a signal concluded about an attempt. Besides adding to the
+// score, a signal may demand a minimum decision, e.g. step-up verification.
+type Finding struct {
+	Score    int
+	Decision Decision
+	Detail   string
+}
+
+// Signal contributes to the risk score of an attempt. Implementations return
+// a zero Finding when they have nothing to say about the input.
+type Signal interface {
+	Name() string
+	Evaluate(in *Input) Finding
+}
+
+// Reason records how a single signal contributed to a result
+type Reason struct {
+	Signal   string   `json:"signal"`
+	Score    int      `json:"score"`
+	Decision Decision `json:"decision,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+type Result struct {
+	Score    int      `json:"score"`
+	Decision Decision `json:"decision"`
+	Reasons  []Reason `json:"reasons"`
+}
+
+// Policy maps scores to decisions. Scores at or above DenyThreshold are
+// denied, at or above MFAThreshold require MFA, everything else is allowed.
+type Policy struct {
+	MFAThreshold  int
+	DenyThreshold int
+}
+
+// severity orders decisions from least to most restrictive
+func severity(d Decision) int {
+	switch d {
+	case RequireMFA:
+		return 1
+	case Deny:
+		return 2
+	default:
+		return 0
+	}
+}
+
+func (p Policy) Decide(score int) Decision {
+	switch {
+	case p.DenyThreshold > 0 && score >= p.DenyThreshold:
+		return Deny
+	case p.MFAThreshold > 0 && score >= p.MFAThreshold:
+		return RequireMFA
+	default:
+		return Allow
+	}
+}
+
+// Recorder persists decisions for audit
+type Recorder interface {
+	InsertRiskDecision(decision *entity.RiskDecision) error
+}
+
+type Engine struct {
+	policy   Policy
+	signals  []Signal
+	recorder Recorder
+}
+
+type EngineConfig struct {
+	Policy   Policy
+	Signals  []Signal
+	Recorder Recorder // optional
+}
+
+func NewEngine(config EngineConfig) *Engine {
+	return &Engine{
+		policy:   config.Policy,
+		signals:  config.Signals,
+		recorder: config.Recorder,
+	}
+}
+
+// Assess scores the input with every signal and applies the policy. Trusted
+// devices skip MFA required by the score, but not decisions demanded by a
+// signal. Login decisions are always recorded; token verification decisions
+// only when they are not allowed, to avoid a write per request.
+func (e *Engine) Assess(in *Input) Result {
+	if in.Time.IsZero() {
+		in.Time = time.Now()
+	}
+
+	result := Result{Reasons: []Reason{}}
+	demanded := Allow
+	for _, signal := range e.signals {
+		finding := signal.Evaluate(in)
+		if finding.Score == 0 && severity(finding.Decision) == 0 {
+			continue
+		}
+
+		result.Score += finding.Score
+		result.Reasons = append(result.Reasons, Reason{
+			Signal:   signal.Name(),
+			Score:    finding.Score,
+			Decision: finding.Decision,
+			Detail:   finding.Detail,
+		})
+		if severity(finding.Decision) > severity(demanded) {
+			demanded = finding.Decision
+		}
+	}
+
+	result.Decision = e.policy.Decide(result.Score)
+	if result.Decision == RequireMFA && in.TrustedDevice {
+		result.Decision = Allow
+	}
+	if severity(demanded) > severity(result.Decision) {
+		result.Decision = demanded
+	}
+
+	if e.recorder != nil && (in.Stage == StageLogin || result.Decision != Allow) {
+		e.record(in, result)
+	}
+
+	return result
+}
+
+func (e *Engine) record(in *Input, result Result) {
+	reasons, err := json.Marshal(result.Reasons)
+	if err != nil {
+		log.Printf("Failed to encode risk reasons: %v", err)
+		return
+	}
+
+	err = e.recorder.InsertRiskDecision(&entity.RiskDecision{
+		UserId:     in.UserId,
+		Username:   in.Username,
+		Stage:      string(in.Stage),
+		IP:         in.IP,
+		ClientType: string(in.ClientType),
+		Score:      result.Score,
+		Decision:   string(result.Decision),
+		Reasons:    reasons,
+		CreatedAt:  in.Time,
+	})
+	if err != nil {
+		log.Printf("Failed to record risk decision: %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package risk
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	decisions []*entity.RiskDecision
+}
+
+func (r *recorder) InsertRiskDecision(decision *entity.RiskDecision) error {
+	r.decisions = append(r.decisions, decision)
+	return nil
+}
+
+type failureCounter struct {
+	failures int
+	err      error
+}
+
+func (c failureCounter) CountRecentFailures(username string, ip string, since time.Time) (int, error) {
+	return c.failures, c.err
+}
+
+func TestPolicyDecide(t *testing.T) {
+	policy := Policy{MFAThreshold: 50, DenyThreshold: 80}
+
+	assert.Equal(t, Allow, policy.Decide(0))
+	assert.Equal(t, Allow, policy.Decide(49))
+	assert.Equal(t, RequireMFA, policy.Decide(50))
+	assert.Equal(t, Deny, policy.Decide(80))
+	assert.Equal(t, Allow, Policy{}.Decide(1000))
+}
+
+func TestEngineAssess(t *testing.T) {
+	rec := &recorder{}
+	engine := NewEngine(EngineConfig{
+		Policy:   Policy{MFAThreshold: 50, DenyThreshold: 80},
+		Signals:  []Signal{NewDevice{Weight: 30}, Emulator{Weight: 40}},
+		Recorder: rec,
+	})
+
+	result := engine.Assess(&Input{Stage: StageLogin, Username: "joe", NewDevice: true})
+	assert.Equal(t, Allow, result.Decision)
+	assert.Equal(t, 30, result.Score)
+
+	emulated := &models.MobileFingerprint{IsEmulator: true}
+	result = engine.Assess(&Input{Stage: StageLogin, Username: "joe", NewDevice: true, Mobile: emulated})
+	assert.Equal(t, RequireMFA, result.Decision)
+	assert.Equal(t, []Reason{{Signal: "new_device", Score: 30}, {Signal: "emulator", Score: 40}}, result.Reasons)
+
+	result = engine.Assess(&Input{Stage: StageLogin, Username: "joe", NewDevice: true, Mobile: emulated, TrustedDevice: true})
+	assert.Equal(t, Allow, result.Decision, "trusted devices skip MFA")
+
+	require.Len(t, rec.decisions, 3)
+	assert.Equal(t, "require_mfa", rec.decisions[1].Decision)
+	var reasons []Reason
+	require.NoError(t, json.Unmarshal(rec.decisions[1].Reasons, &reasons))
+	assert.Len(t, reasons, 2)
+}
+
+func TestEngineRecordsOnlyNotableVerifications(t *testing.T) {
+	rec := &recorder{}
+	list := &IPList{}
+	require.NoError(t, list.Add("198.51.100.0/24"))
+
+	engine := NewEngine(EngineConfig{
+		Policy:   Policy{MFAThreshold: 50, DenyThreshold: 80},
+		Signals:  []Signal{IPReputation{List: list, Weight: 90}},
+		Recorder: rec,
+	})
+
+	assert.Equal(t, Allow, engine.Assess(&Input{Stage: StageVerify, IP: "203.0.113.1"}).Decision)
+	assert.Empty(t, rec.decisions)
+
+	assert.Equal(t, Deny, engine.Assess(&Input{Stage: StageVerify, IP: "198.51.100.7"}).Decision)
+	assert.Len(t, rec.decisions, 1)
+}
+
+func TestFailureVelocity(t *testing.T) {
+	signal := FailureVelocity{Counter: failureCounter{failures: 2}, Window: time.Minute, Threshold: 4, Weight: 40}
+	assert.Equal(t, 20, signal.Evaluate(&Input{Stage: StageLogin}).Score)
+	assert.Equal(t, 0, signal.Evaluate(&Input{Stage: StageVerify}).Score)
+
+	signal.Counter = failureCounter{failures: 9}
+	assert.Equal(t, 40, signal.Evaluate(&Input{Stage: StageLogin}).Score)
+
+	signal.Counter = failureCounter{err: errors.New("db down")}
+	assert.Equal(t, 0, signal.Evaluate(&Input{Stage: StageLogin}).Score)
+}
+
+func TestUnusualHour(t *testing.T) {
+	at := func(hour int) *Input {
+		return &Input{Time: time.Date(2025, 1, 1, hour, 30, 0, 0, time.UTC)}
+	}
+
+	night := UnusualHour{StartHour: 0, EndHour: 5, Weight: 15}
+	assert.Equal(t, 15, night.Evaluate(at(3)).Score)
+	assert.Equal(t, 0, night.Evaluate(at(5)).Score)
+
+	wrapping := UnusualHour{StartHour: 22, EndHour: 4, Weight: 15}
+	assert.Equal(t, 15, wrapping.Evaluate(at(23)).Score)
+	assert.Equal(t, 15, wrapping.Evaluate(at(1)).Score)
+	assert.Equal(t, 0, wrapping.Evaluate(at(12)).Score)
+
+	assert.Equal(t, 0, UnusualHour{Weight: 15}.Evaluate(at(3)).Score)
+}
+
+func TestIPList(t *testing.T) {
+	list := &IPList{}
+	require.NoError(t, list.Add("192.0.2.10"))
+	require.NoError(t, list.Add("2001:db8::/32"))
+	assert.Error(t, list.Add("not-an-ip"))
+
+	assert.True(t, list.Contains("192.0.2.10"))
+	assert.False(t, list.Contains("192.0.2.11"))
+	assert.True(t, list.Contains("2001:db8::1"))
+	assert.False(t, list.Contains("garbage"))
+}
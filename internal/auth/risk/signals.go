@@ -0,0 +1,183 @@
+package risk
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// NewDevice scores sign-ins from a fingerprint not yet registered for the user
+type NewDevice struct {
+	Weight int
+}
+
+func (s NewDevice) Name() string { return "new_device" }
+
+func (s NewDevice) Evaluate(in *Input) Finding {
+	if in.NewDevice {
+		return Finding{Score: s.Weight}
+	}
+	return Finding{}
+}
+
+// Emulator scores mobile clients reporting that they run on an emulator
+type Emulator struct {
+	Weight int
+}
+
+func (s Emulator) Name() string { return "emulator" }
+
+func (s Emulator) Evaluate(in *Input) Finding {
+	if in.Mobile != nil && in.Mobile.IsEmulator {
+		return Finding{Score: s.Weight}
+	}
+	return Finding{}
+}
+
+// FailureCounter counts failed logins for a username or IP address
+type FailureCounter interface {
+	CountRecentFailures(username string, ip string, since time.Time) (int, error)
+}
+
+// FailureVelocity scores failed logins within Window at login time, growing
+// linearly up to Weight once Threshold failures have been seen
+type FailureVelocity struct {
+	Counter   FailureCounter
+	Window    time.Duration
+	Threshold int
+	Weight    int
+}
+
+func (s FailureVelocity) Name() string { return "failure_velocity" }
+
+func (s FailureVelocity) Evaluate(in *Input) Finding {
+	if in.Stage != StageLogin || s.Threshold <= 0 {
+		return Finding{}
+	}
+
+	failures, err := s.Counter.CountRecentFailures(in.Username, in.IP, in.Time.Add(-s.Window))
+	if err != nil {
+		log.Printf("Failed to count recent login failures: %v", err)
+		return Finding{}
+	}
+
+	if failures >= s.Threshold {
+		return Finding{Score: s.Weight}
+	}
+	return Finding{Score: s.Weight * failures / s.Threshold}
+}
+
+// UnusualHour scores attempts made between StartHour (inclusive) and EndHour
+// (exclusive) UTC. The range may wrap around midnight.
+type UnusualHour struct {
+	StartHour int
+	EndHour   int
+	Weight    int
+}
+
+func (s UnusualHour) Name() string { return "unusual_hour" }
+
+func (s UnusualHour) Evaluate(in *Input) Finding {
+	if s.StartHour == s.EndHour {
+		return Finding{}
+	}
+
+	hour := in.Time.UTC().Hour()
+	inRange := hour >= s.StartHour && hour < s.EndHour
+	if s.StartHour > s.EndHour {
+		inRange = hour >= s.StartHour || hour < s.EndHour
+	}
+
+	if inRange {
+		return Finding{Score: s.Weight}
+	}
+	return Finding{}
+}
+
+// IPReputation scores addresses found on a local block list
+type IPReputation struct {
+	List   *IPList
+	Weight int
+}
+
+func (s IPReputation) Name() string { return "ip_reputation" }
+
+func (s IPReputation) Evaluate(in *Input) Finding {
+	if s.List != nil && s.List.Contains(in.IP) {
+		return Finding{Score: s.Weight}
+	}
+	return Finding{}
+}
+
+// IPList is a set of addresses and networks
+type IPList struct {
+	networks []*net.IPNet
+}
+
+// LoadIPList reads one IP address or CIDR network per line. Blank lines and
+// lines starting with # are ignored.
+func LoadIPList(path string) (*IPList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	list := &IPList{}
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if err := list.Add(line); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+		}
+	}
+
+	return list, scanner.Err()
+}
+
+// Add inserts an address or CIDR network into the list
+func (l *IPList) Add(entry string) error {
+	if !strings.Contains(entry, "/") {
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return fmt.Errorf("invalid IP address %q", entry)
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		l.networks = append(l.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		return nil
+	}
+
+	_, network, err := net.ParseCIDR(entry)
+	if err != nil {
+		return err
+	}
+	l.networks = append(l.networks, network)
+	return nil
+}
+
+func (l *IPList) Contains(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range l.networks {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package risk
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/geoip"
+)
+
+// LocationHistory provides the location of a user's previous login, nil when
+// the user has not completed one yet
+type LocationHistory interface {
+	LastLoginLocation(userId int64) (*entity.LoginLocation, error)
+}
+
+// ImpossibleTravel flags logins whose distance from the previous login could
+// not have been covered in the elapsed time. Flagged logins require step-up
+// verification regardless of the total score, even from trusted devices.
+type ImpossibleTravel struct {
+	Locator       geoip.Locator
+	History       LocationHistory
+	MaxSpeedKmh   float64
+	MinDistanceKm float64 // ignore jumps within GeoIP accuracy
+	Weight        int
+}
+
+func (s ImpossibleTravel) Name() string { return "impossible_travel" }
+
+func (s ImpossibleTravel) Evaluate(in *Input) Finding {
+	if in.Stage != StageLogin || in.UserId == 0 {
+		return Finding{}
+	}
+
+	current, err := s.Locator.Locate(in.IP)
+	if err != nil || !current.HasCoords {
+		return Finding{}
+	}
+
+	previous, err := s.History.LastLoginLocation(in.UserId)
+	if err != nil {
+		log.Printf("Failed to load previous login location: %v", err)
+		return Finding{}
+	}
+	if previous == nil {
+		return Finding{}
+	}
+
+	distance := geoip.DistanceKm(previous.Latitude, previous.Longitude, current.Latitude, current.Longitude)
+	if distance < s.MinDistanceKm {
+		return Finding{}
+	}
+
+	// Treat logins in quick succession as a minute apart to avoid dividing by zero
+	elapsed := max(in.Time.Sub(previous.LoggedInAt), time.Minute)
+	speed := distance / elapsed.Hours()
+	if speed <= s.MaxSpeedKmh {
+		return Finding{}
+	}
+
+	detail := fmt.Sprintf("%.0f km from %s (%s) in %s, %.0f km/h",
+		distance, previous.IP, previous.CountryCode, elapsed.Round(time.Minute), speed)
+	log.Printf("Impossible travel for user %d: %s", in.UserId, detail)
+
+	return Finding{Score: s.Weight, Decision: RequireMFA, Detail: detail}
+}
@@ -0,0 +1,87 @@
+package risk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/geoip"
+	"github.com/stretchr/testify/assert"
+)
+
+type fixedLocator map[string]*geoip.Location
+
+func (l fixedLocator) Locate(ip string) (*geoip.Location, error) {
+	if location, ok := l[ip]; ok {
+		return location, nil
+	}
+	return nil, geoip.ErrNotFound
+}
+
+type lastLocation struct {
+	location *entity.LoginLocation
+}
+
+func (h lastLocation) LastLoginLocation(userId int64) (*entity.LoginLocation, error) {
+	return h.location, nil
+}
+
+func TestImpossibleTravel(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	locator := fixedLocator{
+		"81.2.69.142":  {CountryCode: "GB", Latitude: 51.5142, Longitude: -0.0931, HasCoords: true},
+		"1.128.0.1":    {CountryCode: "AU", Latitude: -33.8688, Longitude: 151.2093, HasCoords: true},
+		"2.125.160.21": {CountryCode: "GB", Latitude: 51.75, Longitude: -1.25, HasCoords: true},
+	}
+	londonLogin := &entity.LoginLocation{
+		IP: "81.2.69.142", CountryCode: "GB", Latitude: 51.5142, Longitude: -0.0931,
+		LoggedInAt: now.Add(-2 * time.Hour),
+	}
+
+	signal := ImpossibleTravel{
+		Locator:       locator,
+		History:       lastLocation{londonLogin},
+		MaxSpeedKmh:   1000,
+		MinDistanceKm: 300,
+		Weight:        40,
+	}
+	input := func(ip string) *Input {
+		return &Input{Stage: StageLogin, UserId: 1, IP: ip, Time: now}
+	}
+
+	finding := signal.Evaluate(input("1.128.0.1"))
+	assert.Equal(t, RequireMFA, finding.Decision, "London to Sydney in two hours")
+	assert.Equal(t, 40, finding.Score)
+	assert.Contains(t, finding.Detail, "km/h")
+
+	assert.Zero(t, signal.Evaluate(input("2.125.160.21")), "nearby logins are within GeoIP accuracy")
+	assert.Zero(t, signal.Evaluate(input("192.0.2.1")), "unknown locations are not flagged")
+
+	slow := signal
+	slow.History = lastLocation{&entity.LoginLocation{
+		Latitude: londonLogin.Latitude, Longitude: londonLogin.Longitude, LoggedInAt: now.Add(-48 * time.Hour),
+	}}
+	assert.Zero(t, slow.Evaluate(input("1.128.0.1")), "two days is enough to fly to Sydney")
+
+	first := signal
+	first.History = lastLocation{}
+	assert.Zero(t, first.Evaluate(input("1.128.0.1")), "first login has nothing to compare against")
+}
+
+func TestEngineEscalationOverridesTrustedDevice(t *testing.T) {
+	engine := NewEngine(EngineConfig{
+		Policy: Policy{MFAThreshold: 50, DenyThreshold: 80},
+		Signals: []Signal{ImpossibleTravel{
+			Locator: fixedLocator{"1.128.0.1": {Latitude: -33.8688, Longitude: 151.2093, HasCoords: true}},
+			History: lastLocation{&entity.LoginLocation{
+				Latitude: 51.5142, Longitude: -0.0931, LoggedInAt: time.Now().Add(-time.Hour),
+			}},
+			MaxSpeedKmh: 1000,
+			Weight:      10,
+		}},
+	})
+
+	result := engine.Assess(&Input{Stage: StageLogin, UserId: 1, IP: "1.128.0.1", TrustedDevice: true})
+	assert.Equal(t, RequireMFA, result.Decision)
+	assert.Equal(t, 10, result.Score)
+}
@@ -0,0 +1,118 @@
+package saml
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+// canonicalize serializes an element with Exclusive XML Canonicalization
+// without comments, the algorithm SAML signatures use. Namespace
+// declarations are rendered where they are first used, plus those of the
+// inclusive prefixes ("#default" for the default namespace) wherever in
+// scope. The exclude element, the enveloped signature, is left out.
+func canonicalize(e *element, inclusive []string, exclude *element) []byte {
+	var b strings.Builder
+	writeCanonical(&b, e, map[string]string{}, inclusive, exclude)
+	return []byte(b.String())
+}
+
+// writeCanonical writes an element; rendered holds the namespace
+// declarations in effect in the output so far
+func writeCanonical(b *strings.Builder, e *element, rendered map[string]string, inclusive []string, exclude *element) {
+	used := []string{e.prefix}
+	for _, a := range e.attributes {
+		if a.prefix != "" && a.prefix != "xml" {
+			used = append(used, a.prefix)
+		}
+	}
+	for _, prefix := range inclusive {
+		if prefix == "#default" {
+			prefix = ""
+		}
+		if _, ok := e.lookup(prefix); ok {
+			used = append(used, prefix)
+		}
+	}
+	slices.Sort(used)
+	used = slices.Compact(used)
+
+	// A missing entry stands for the empty default namespace, prefixed
+	// namespaces are never empty
+	var declarations []namespace
+	for _, prefix := range used {
+		uri, _ := e.lookup(prefix)
+		if rendered[prefix] != uri {
+			declarations = append(declarations, namespace{prefix: prefix, uri: uri})
+		}
+	}
+	if len(declarations) > 0 {
+		rendered = maps.Clone(rendered)
+		for _, ns := range declarations {
+			rendered[ns.prefix] = ns.uri
+		}
+	}
+
+	attributes := slices.Clone(e.attributes)
+	slices.SortFunc(attributes, func(a, b attribute) int {
+		aSpace, _ := e.lookup(a.prefix)
+		bSpace, _ := e.lookup(b.prefix)
+		if a.prefix == "" {
+			aSpace = ""
+		}
+		if b.prefix == "" {
+			bSpace = ""
+		}
+		if c := strings.Compare(aSpace, bSpace); c != 0 {
+			return c
+		}
+		return strings.Compare(a.local, b.local)
+	})
+
+	name := qualifiedName(e.prefix, e.local)
+	b.WriteString("<" + name)
+	for _, ns := range declarations {
+		b.WriteString(" " + qualifiedName("xmlns", ns.prefix) + `="` + escapeAttribute(ns.uri) + `"`)
+	}
+	for _, a := range attributes {
+		b.WriteString(" " + qualifiedName(a.prefix, a.local) + `="` + escapeAttribute(a.value) + `"`)
+	}
+	b.WriteString(">")
+
+	for _, child := range e.children {
+		switch c := child.(type) {
+		case string:
+			b.WriteString(escapeText(c))
+		case *element:
+			if c != exclude {
+				writeCanonical(b, c, rendered, inclusive, exclude)
+			}
+		}
+	}
+	b.WriteString("</" + name + ">")
+}
+
+func qualifiedName(prefix string, local string) string {
+	if prefix == "xmlns" && local == "" {
+		return "xmlns"
+	}
+	if prefix == "" {
+		return local
+	}
+	return prefix + ":" + local
+}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+
+	attributeEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;",
+		"\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+func escapeAttribute(s string) string {
+	return attributeEscaper.Replace(s)
+}
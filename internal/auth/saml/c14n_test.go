@@ -0,0 +1,102 @@
+package saml
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		name      string
+		document  string
+		path      []string // local names leading to the canonicalized element
+		inclusive []string
+		expected  string
+	}{
+		{
+			name:     "namespaces rendered where used, attributes sorted",
+			document: `<root xmlns="urn:a" xmlns:b="urn:b" xmlns:unused="urn:u"><b:child z="1" b:attr="3" a="2">text &amp; &lt;more&gt;<empty/></b:child></root>`,
+			path:     []string{"child"},
+			expected: `<b:child xmlns:b="urn:b" a="2" z="1" b:attr="3">text &amp; &lt;more&gt;<empty xmlns="urn:a"></empty></b:child>`,
+		},
+		{
+			name:     "default namespace undeclared",
+			document: `<a xmlns="urn:a"><b xmlns=""><c/></b></a>`,
+			expected: `<a xmlns="urn:a"><b xmlns=""><c></c></b></a>`,
+		},
+		{
+			name:     "empty default namespace not rendered at the apex",
+			document: `<a xmlns="urn:a"><b xmlns=""><c/></b></a>`,
+			path:     []string{"b"},
+			expected: `<b><c></c></b>`,
+		},
+		{
+			name:     "redundant declarations dropped",
+			document: `<p:a xmlns:p="urn:p"><p:b xmlns:p="urn:p" attr='say "hi"&#9;'/></p:a>`,
+			expected: `<p:a xmlns:p="urn:p"><p:b attr="say &quot;hi&quot;&#x9;"></p:b></p:a>`,
+		},
+		{
+			name:     "comments removed and the text around them joined",
+			document: `<a><!-- note -->x<!---->y</a>`,
+			expected: `<a>xy</a>`,
+		},
+		{
+			name:      "inclusive prefixes rendered when in scope",
+			document:  `<r xmlns:xs="urn:xs" xmlns:p="urn:p"><p:v type="xs:string">x</p:v></r>`,
+			path:      []string{"v"},
+			inclusive: []string{"xs", "missing"},
+			expected:  `<p:v xmlns:p="urn:p" xmlns:xs="urn:xs" type="xs:string">x</p:v>`,
+		},
+		{
+			name:     "prefixes only used in values are not rendered",
+			document: `<r xmlns:xs="urn:xs" xmlns:p="urn:p"><p:v type="xs:string">x</p:v></r>`,
+			path:     []string{"v"},
+			expected: `<p:v xmlns:p="urn:p" type="xs:string">x</p:v>`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e, err := parseXML([]byte(test.document))
+			require.NoError(t, err)
+
+			for _, local := range test.path {
+				e = childNamed(e, local)
+				require.NotNil(t, e)
+			}
+
+			assert.Equal(t, test.expected, string(canonicalize(e, test.inclusive, nil)))
+		})
+	}
+}
+
+func TestParseXMLRejectsMalformedDocuments(t *testing.T) {
+	for _, document := range []string{
+		`<a><b></a></b>`,
+		`<a>`,
+		`<a/><b/>`,
+		`<p:a/>`,
+		`text<a/>`,
+		`<a ID="1" ID="2"/>`,
+		`<a xmlns:p="urn:x" xmlns:q="urn:x" p:id="1" q:id="2"/>`,
+		`<a xmlns:p="urn:x" xmlns:p="urn:y"/>`,
+		`<a><?php echo 1 ?></a>`,
+		`<a/><?pi?>`,
+		strings.Repeat("<a>", maxDepth+1) + strings.Repeat("</a>", maxDepth+1),
+	} {
+		_, err := parseXML([]byte(document))
+		assert.ErrorIs(t, err, errMalformedXML, document)
+	}
+}
+
+func childNamed(e *element, local string) *element {
+	for _, child := range e.children {
+		if c, ok := child.(*element); ok && c.local == local {
+			return c
+		}
+	}
+	return nil
+}
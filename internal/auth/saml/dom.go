@@ -0,0 +1,240 @@
+package saml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The XML of SAML messages is parsed into a small tree that keeps the
+// namespace prefixes and declarations encoding/xml resolves away, since
+// canonicalization needs them.
+
+const nsXML = "http://www.w3.org/XML/1998/namespace"
+
+// maxDepth bounds the nesting of elements, SAML responses need about ten
+const maxDepth = 64
+
+var errMalformedXML = errors.New("saml: malformed XML")
+
+// element is an XML element. Its children are elements or character data.
+type element struct {
+	parent *element
+	prefix string
+	local  string
+	// namespaces declared on the element, "" is the default namespace
+	namespaces []namespace
+	attributes []attribute
+	children   []any
+}
+
+type namespace struct {
+	prefix string
+	uri    string
+}
+
+type attribute struct {
+	prefix string
+	local  string
+	value  string
+}
+
+// parseXML reads a document. Document type declarations are refused, they
+// are not used by SAML and only invite entity expansion attacks. So are
+// processing instructions past the XML declaration and elements with
+// duplicate attributes, which signature checks and readers of the document
+// could interpret differently. Comments are dropped, text around them is
+// joined as canonicalization does, so a comment cannot cut a signed value
+// short.
+func parseXML(data []byte) (*element, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+
+	var root, current *element
+	depth := 0
+	for {
+		token, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errMalformedXML, err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if current == nil && root != nil {
+				return nil, fmt.Errorf("%w: more than one root element", errMalformedXML)
+			}
+			e := &element{parent: current, prefix: t.Name.Space, local: t.Name.Local}
+			for _, a := range t.Attr {
+				switch {
+				case a.Name.Space == "xmlns":
+					e.namespaces = append(e.namespaces, namespace{prefix: a.Name.Local, uri: a.Value})
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					e.namespaces = append(e.namespaces, namespace{uri: a.Value})
+				default:
+					e.attributes = append(e.attributes, attribute{prefix: a.Name.Space, local: a.Name.Local, value: a.Value})
+				}
+			}
+			if depth++; depth > maxDepth {
+				return nil, fmt.Errorf("%w: elements nested too deeply", errMalformedXML)
+			}
+			if err := e.checkPrefixes(); err != nil {
+				return nil, err
+			}
+			if err := e.checkDuplicates(); err != nil {
+				return nil, err
+			}
+
+			if current == nil {
+				root = e
+			} else {
+				current.children = append(current.children, e)
+			}
+			current = e
+		case xml.EndElement:
+			// RawToken leaves matching end elements to the caller
+			if current == nil || t.Name.Space != current.prefix || t.Name.Local != current.local {
+				return nil, fmt.Errorf("%w: unexpected end element %s", errMalformedXML, t.Name.Local)
+			}
+			current = current.parent
+			depth--
+		case xml.CharData:
+			if current == nil {
+				if len(bytes.TrimSpace(t)) > 0 {
+					return nil, fmt.Errorf("%w: text outside the root element", errMalformedXML)
+				}
+				continue
+			}
+			if n := len(current.children); n > 0 {
+				if text, ok := current.children[n-1].(string); ok {
+					current.children[n-1] = text + string(t)
+					continue
+				}
+			}
+			current.children = append(current.children, string(t))
+		case xml.Directive:
+			return nil, fmt.Errorf("%w: document type declarations are not allowed", errMalformedXML)
+		case xml.ProcInst:
+			if t.Target != "xml" || root != nil {
+				return nil, fmt.Errorf("%w: processing instructions are not allowed", errMalformedXML)
+			}
+		}
+	}
+
+	if root == nil || current != nil {
+		return nil, fmt.Errorf("%w: incomplete document", errMalformedXML)
+	}
+	return root, nil
+}
+
+// checkPrefixes makes sure every prefix the element uses is declared
+func (e *element) checkPrefixes() error {
+	prefixes := []string{e.prefix}
+	for _, a := range e.attributes {
+		if a.prefix != "" {
+			prefixes = append(prefixes, a.prefix)
+		}
+	}
+
+	for _, prefix := range prefixes {
+		if _, ok := e.lookup(prefix); !ok && prefix != "" {
+			return fmt.Errorf("%w: undeclared namespace prefix %s", errMalformedXML, prefix)
+		}
+	}
+	return nil
+}
+
+// checkDuplicates makes sure the element declares each prefix and each
+// attribute once, also when two prefixes stand for the same namespace
+func (e *element) checkDuplicates() error {
+	prefixes := map[string]bool{}
+	for _, ns := range e.namespaces {
+		if prefixes[ns.prefix] {
+			return fmt.Errorf("%w: namespace prefix %s declared twice", errMalformedXML, ns.prefix)
+		}
+		prefixes[ns.prefix] = true
+	}
+
+	names := map[[2]string]bool{}
+	for _, a := range e.attributes {
+		space := ""
+		if a.prefix != "" {
+			space, _ = e.lookup(a.prefix)
+		}
+		name := [2]string{space, a.local}
+		if names[name] {
+			return fmt.Errorf("%w: attribute %s repeated", errMalformedXML, a.local)
+		}
+		names[name] = true
+	}
+	return nil
+}
+
+// lookup resolves a prefix in the scope of the element
+func (e *element) lookup(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return nsXML, true
+	}
+	for scope := e; scope != nil; scope = scope.parent {
+		for _, ns := range scope.namespaces {
+			if ns.prefix == prefix {
+				return ns.uri, true
+			}
+		}
+	}
+	return "", false
+}
+
+// space is the namespace URI of the element
+func (e *element) space() string {
+	uri, _ := e.lookup(e.prefix)
+	return uri
+}
+
+func (e *element) is(space string, local string) bool {
+	return e.local == local && e.space() == space
+}
+
+// elements returns the child elements with the given name
+func (e *element) elements(space string, local string) []*element {
+	var elements []*element
+	for _, child := range e.children {
+		if c, ok := child.(*element); ok && c.is(space, local) {
+			elements = append(elements, c)
+		}
+	}
+	return elements
+}
+
+// element returns the first child element with the given name, or nil
+func (e *element) element(space string, local string) *element {
+	if elements := e.elements(space, local); len(elements) > 0 {
+		return elements[0]
+	}
+	return nil
+}
+
+// attr returns the value of an attribute without a namespace
+func (e *element) attr(local string) string {
+	for _, a := range e.attributes {
+		if a.prefix == "" && a.local == local {
+			return a.value
+		}
+	}
+	return ""
+}
+
+// text returns the character data of the element, trimmed
+func (e *element) text() string {
+	var b strings.Builder
+	for _, child := range e.children {
+		if text, ok := child.(string); ok {
+			b.WriteString(text)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
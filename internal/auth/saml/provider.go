@@ -0,0 +1,501 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/auth/oauth"
+)
+
+// SAML 2.0 namespaces and identifiers used here
+const (
+	nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+
+	bindingHTTPPost = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+
+	nameIDPersistent   = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+	nameIDTransient    = "urn:oasis:names:tc:SAML:2.0:nameid-format:transient"
+	nameIDEmailAddress = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+
+	confirmationBearer = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+
+	StatusSuccess       = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	StatusAuthnFailed   = "urn:oasis:names:tc:SAML:2.0:status:AuthnFailed"
+	StatusRequestDenied = "urn:oasis:names:tc:SAML:2.0:status:RequestDenied"
+)
+
+// clockSkew is how far the clocks of an identity provider and this service
+// may drift apart when checking assertion times
+const clockSkew = 2 * time.Minute
+
+// maxResponseSize bounds the responses parsed, real ones are a few kilobytes
+const maxResponseSize = 256 << 10
+
+var ErrInvalidResponse = errors.New("saml: invalid response")
+
+// StatusError is a response in which the identity provider reports that it
+// did not authenticate the user
+type StatusError struct {
+	Code    string
+	SubCode string
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("saml: identity provider answered %s %s: %s", e.Code, e.SubCode, e.Message)
+}
+
+// Denied reports whether the user failed or refused to authenticate, as
+// opposed to the provider failing
+func (e *StatusError) Denied() bool {
+	return e.SubCode == StatusAuthnFailed || e.SubCode == StatusRequestDenied
+}
+
+// ProviderConfig describes a SAML identity provider and this service as its
+// service provider
+type ProviderConfig struct {
+	// Name identifies the provider in URLs and linked identities, DisplayName
+	// is shown on the sign-in button
+	Name        string
+	DisplayName string
+	// EntityID of this service provider, where its metadata is published,
+	// and ACSURL where the identity provider posts its responses
+	EntityID string
+	ACSURL   string
+	// The identity provider's entity ID, its single sign-on address for the
+	// HTTP-Redirect binding and the certificates its signatures are checked
+	// with, several while keys are rotated
+	IdPEntityID     string
+	IdPSSOURL       string
+	IdPCertificates []*x509.Certificate
+	// Attributes holding the display username and email. The name ID is used
+	// as the email when its format is emailAddress and EmailAttribute is
+	// missing.
+	UsernameAttribute string
+	EmailAttribute    string
+	// Provision creates an account for identities not linked to one yet
+	Provision bool
+}
+
+// Identity is the user an identity provider vouched for
+type Identity struct {
+	// Subject is the persistent name ID of the user
+	Subject           string
+	Email             string
+	PreferredUsername string
+	Attributes        map[string][]string
+}
+
+// Provider signs users in with a SAML identity provider using the Web
+// Browser SSO profile: requests go by HTTP-Redirect, signed responses come
+// back by HTTP-POST. Only responses to requests of this service are
+// accepted, identity provider initiated sign-in is not supported.
+type Provider struct {
+	config ProviderConfig
+}
+
+func NewProvider(config ProviderConfig) *Provider {
+	return &Provider{config: config}
+}
+
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+func (p *Provider) DisplayName() string {
+	if p.config.DisplayName == "" {
+		return p.config.Name
+	}
+	return p.config.DisplayName
+}
+
+// Provision reports whether accounts are created for unknown identities
+func (p *Provider) Provision() bool {
+	return p.config.Provision
+}
+
+type entityDescriptor struct {
+	XMLName         xml.Name        `xml:"md:EntityDescriptor"`
+	Namespace       string          `xml:"xmlns:md,attr"`
+	EntityID        string          `xml:"entityID,attr"`
+	SPSSODescriptor spSSODescriptor `xml:"md:SPSSODescriptor"`
+}
+
+type spSSODescriptor struct {
+	AuthnRequestsSigned        bool                     `xml:"AuthnRequestsSigned,attr"`
+	WantAssertionsSigned       bool                     `xml:"WantAssertionsSigned,attr"`
+	ProtocolSupportEnumeration string                   `xml:"protocolSupportEnumeration,attr"`
+	NameIDFormat               string                   `xml:"md:NameIDFormat"`
+	AssertionConsumerService   assertionConsumerService `xml:"md:AssertionConsumerService"`
+}
+
+type assertionConsumerService struct {
+	Binding   string `xml:"Binding,attr"`
+	Location  string `xml:"Location,attr"`
+	Index     int    `xml:"index,attr"`
+	IsDefault bool   `xml:"isDefault,attr"`
+}
+
+// Metadata returns the service provider metadata to register at the
+// identity provider
+func (p *Provider) Metadata() ([]byte, error) {
+	metadata, err := xml.MarshalIndent(entityDescriptor{
+		Namespace: nsMetadata,
+		EntityID:  p.config.EntityID,
+		SPSSODescriptor: spSSODescriptor{
+			WantAssertionsSigned:       true,
+			ProtocolSupportEnumeration: nsProtocol,
+			NameIDFormat:               nameIDPersistent,
+			AssertionConsumerService: assertionConsumerService{
+				Binding:   bindingHTTPPost,
+				Location:  p.config.ACSURL,
+				IsDefault: true,
+			},
+		},
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), metadata...), nil
+}
+
+type authnRequest struct {
+	XMLName                     xml.Name     `xml:"samlp:AuthnRequest"`
+	ProtocolNamespace           string       `xml:"xmlns:samlp,attr"`
+	AssertionNamespace          string       `xml:"xmlns:saml,attr"`
+	ID                          string       `xml:"ID,attr"`
+	Version                     string       `xml:"Version,attr"`
+	IssueInstant                string       `xml:"IssueInstant,attr"`
+	Destination                 string       `xml:"Destination,attr"`
+	AssertionConsumerServiceURL string       `xml:"AssertionConsumerServiceURL,attr"`
+	ProtocolBinding             string       `xml:"ProtocolBinding,attr"`
+	Issuer                      string       `xml:"saml:Issuer"`
+	NameIDPolicy                nameIDPolicy `xml:"samlp:NameIDPolicy"`
+}
+
+type nameIDPolicy struct {
+	Format      string `xml:"Format,attr"`
+	AllowCreate bool   `xml:"AllowCreate,attr"`
+}
+
+// NewRequestID returns a random ID for an authentication request. The
+// response must name it, which ties it to the sign-in that sent the request.
+func NewRequestID() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	// IDs are XML names, which cannot start with a digit
+	return "id-" + hex.EncodeToString(b), nil
+}
+
+// AuthnRequestURL returns the address of the identity provider to send the
+// browser to. The relay state comes back with the response.
+func (p *Provider) AuthnRequestURL(requestID string, relayState string) (string, error) {
+	request, err := xml.Marshal(authnRequest{
+		ProtocolNamespace:           nsProtocol,
+		AssertionNamespace:          nsAssertion,
+		ID:                          requestID,
+		Version:                     "2.0",
+		IssueInstant:                time.Now().UTC().Format(time.RFC3339),
+		Destination:                 p.config.IdPSSOURL,
+		AssertionConsumerServiceURL: p.config.ACSURL,
+		ProtocolBinding:             bindingHTTPPost,
+		Issuer:                      p.config.EntityID,
+		NameIDPolicy:                nameIDPolicy{Format: nameIDPersistent, AllowCreate: true},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// The HTTP-Redirect binding deflates and encodes the request
+	var deflated bytes.Buffer
+	w, err := flate.NewWriter(&deflated, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(request); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	return oauth.WithQuery(p.config.IdPSSOURL, url.Values{
+		"SAMLRequest": {base64.StdEncoding.EncodeToString(deflated.Bytes())},
+		"RelayState":  {relayState},
+	}), nil
+}
+
+// ParseResponse validates the base64 encoded response the identity provider
+// posted in answer to the request with the given ID and returns the user the
+// assertion is about. The assertion, or the response containing it, must be
+// signed with one of the provider's certificates.
+func (p *Provider) ParseResponse(encoded string, requestID string) (*Identity, error) {
+	data, err := decodeBase64(encoded)
+	if err != nil || len(data) > maxResponseSize {
+		return nil, fmt.Errorf("%w: not a base64 encoded response", ErrInvalidResponse)
+	}
+
+	response, err := parseXML(data)
+	if err != nil {
+		return nil, err
+	}
+	if !response.is(nsProtocol, "Response") || response.attr("Version") != "2.0" {
+		return nil, fmt.Errorf("%w: not a SAML 2.0 response", ErrInvalidResponse)
+	}
+
+	if requestID == "" || response.attr("InResponseTo") != requestID {
+		return nil, fmt.Errorf("%w: not an answer to the request", ErrInvalidResponse)
+	}
+	if destination := response.attr("Destination"); destination != "" && destination != p.config.ACSURL {
+		return nil, fmt.Errorf("%w: addressed to %s", ErrInvalidResponse, destination)
+	}
+	if issuer := response.element(nsAssertion, "Issuer"); issuer != nil && issuer.text() != p.config.IdPEntityID {
+		return nil, fmt.Errorf("%w: issued by %s", ErrInvalidResponse, issuer.text())
+	}
+
+	if err := checkStatus(response); err != nil {
+		return nil, err
+	}
+
+	responseSigned, err := verifySignature(response, p.config.IdPCertificates)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.element(nsAssertion, "EncryptedAssertion") != nil {
+		return nil, fmt.Errorf("%w: encrypted assertions are not supported", ErrInvalidResponse)
+	}
+	assertions := response.elements(nsAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, fmt.Errorf("%w: expected one assertion", ErrInvalidResponse)
+	}
+	assertion := assertions[0]
+
+	assertionSigned, err := verifySignature(assertion, p.config.IdPCertificates)
+	if err != nil {
+		return nil, err
+	}
+	if !responseSigned && !assertionSigned {
+		return nil, fmt.Errorf("%w: the assertion is not signed", ErrInvalidSignature)
+	}
+
+	return p.parseAssertion(assertion, requestID, time.Now())
+}
+
+func checkStatus(response *element) error {
+	status := response.element(nsProtocol, "Status")
+	if status == nil {
+		return fmt.Errorf("%w: missing status", ErrInvalidResponse)
+	}
+	code := status.element(nsProtocol, "StatusCode")
+	if code == nil {
+		return fmt.Errorf("%w: missing status code", ErrInvalidResponse)
+	}
+	if code.attr("Value") == StatusSuccess {
+		return nil
+	}
+
+	err := &StatusError{Code: code.attr("Value")}
+	if subCode := code.element(nsProtocol, "StatusCode"); subCode != nil {
+		err.SubCode = subCode.attr("Value")
+	}
+	if message := status.element(nsProtocol, "StatusMessage"); message != nil {
+		err.Message = message.text()
+	}
+	return err
+}
+
+func (p *Provider) parseAssertion(assertion *element, requestID string, now time.Time) (*Identity, error) {
+	if issuer := assertion.element(nsAssertion, "Issuer"); issuer == nil || issuer.text() != p.config.IdPEntityID {
+		return nil, fmt.Errorf("%w: the assertion is not issued by the identity provider", ErrInvalidResponse)
+	}
+
+	if err := p.checkConditions(assertion.element(nsAssertion, "Conditions"), now); err != nil {
+		return nil, err
+	}
+
+	subject := assertion.element(nsAssertion, "Subject")
+	if subject == nil {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidResponse)
+	}
+	if err := p.checkSubjectConfirmation(subject, requestID, now); err != nil {
+		return nil, err
+	}
+
+	nameID := subject.element(nsAssertion, "NameID")
+	if nameID == nil || nameID.text() == "" {
+		return nil, fmt.Errorf("%w: missing name ID", ErrInvalidResponse)
+	}
+	// A transient name ID changes with every sign-in, so it cannot identify
+	// returning users
+	if nameID.attr("Format") == nameIDTransient {
+		return nil, fmt.Errorf("%w: transient name IDs are not supported", ErrInvalidResponse)
+	}
+
+	identity := &Identity{
+		Subject:    nameID.text(),
+		Attributes: attributes(assertion),
+	}
+	identity.PreferredUsername = first(identity.Attributes[p.config.UsernameAttribute])
+	identity.Email = first(identity.Attributes[p.config.EmailAttribute])
+	if identity.Email == "" && nameID.attr("Format") == nameIDEmailAddress {
+		identity.Email = identity.Subject
+	}
+	return identity, nil
+}
+
+// checkConditions checks the validity period and that the assertion is meant
+// for this service provider
+func (p *Provider) checkConditions(conditions *element, now time.Time) error {
+	if conditions == nil {
+		return fmt.Errorf("%w: missing conditions", ErrInvalidResponse)
+	}
+	if err := checkPeriod(conditions, now); err != nil {
+		return err
+	}
+
+	// Every restriction must name this service provider
+	restrictions := conditions.elements(nsAssertion, "AudienceRestriction")
+	if len(restrictions) == 0 {
+		return fmt.Errorf("%w: missing audience restriction", ErrInvalidResponse)
+	}
+	for _, restriction := range restrictions {
+		found := false
+		for _, audience := range restriction.elements(nsAssertion, "Audience") {
+			found = found || audience.text() == p.config.EntityID
+		}
+		if !found {
+			return fmt.Errorf("%w: the assertion is meant for another audience", ErrInvalidResponse)
+		}
+	}
+	return nil
+}
+
+// checkSubjectConfirmation requires a bearer confirmation for this request
+// delivered to this service provider
+func (p *Provider) checkSubjectConfirmation(subject *element, requestID string, now time.Time) error {
+	for _, confirmation := range subject.elements(nsAssertion, "SubjectConfirmation") {
+		data := confirmation.element(nsAssertion, "SubjectConfirmationData")
+		if confirmation.attr("Method") != confirmationBearer || data == nil {
+			continue
+		}
+		if data.attr("Recipient") != p.config.ACSURL || data.attr("NotOnOrAfter") == "" {
+			continue
+		}
+		if inResponseTo := data.attr("InResponseTo"); inResponseTo != "" && inResponseTo != requestID {
+			continue
+		}
+		if checkPeriod(data, now) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: no valid bearer subject confirmation", ErrInvalidResponse)
+}
+
+// checkPeriod checks the NotBefore and NotOnOrAfter attributes of an
+// element, allowing for clock skew
+func checkPeriod(e *element, now time.Time) error {
+	if notBefore := e.attr("NotBefore"); notBefore != "" {
+		t, err := time.Parse(time.RFC3339Nano, notBefore)
+		if err != nil {
+			return fmt.Errorf("%w: invalid NotBefore", ErrInvalidResponse)
+		}
+		if now.Add(clockSkew).Before(t) {
+			return fmt.Errorf("%w: not valid yet", ErrInvalidResponse)
+		}
+	}
+	if notOnOrAfter := e.attr("NotOnOrAfter"); notOnOrAfter != "" {
+		t, err := time.Parse(time.RFC3339Nano, notOnOrAfter)
+		if err != nil {
+			return fmt.Errorf("%w: invalid NotOnOrAfter", ErrInvalidResponse)
+		}
+		if !now.Add(-clockSkew).Before(t) {
+			return fmt.Errorf("%w: expired", ErrInvalidResponse)
+		}
+	}
+	return nil
+}
+
+// attributes collects the values of the assertion's attributes by name
+func attributes(assertion *element) map[string][]string {
+	values := map[string][]string{}
+	for _, statement := range assertion.elements(nsAssertion, "AttributeStatement") {
+		for _, attribute := range statement.elements(nsAssertion, "Attribute") {
+			name := attribute.attr("Name")
+			for _, value := range attribute.elements(nsAssertion, "AttributeValue") {
+				values[name] = append(values[name], value.text())
+			}
+		}
+	}
+	return values
+}
+
+func first(values []string) string {
+	if len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// ParseCertificates reads the PEM encoded certificates of an identity
+// provider
+func ParseCertificates(pemBytes []byte) ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, pemBytes = pem.Decode(pemBytes)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SAML identity provider certificate: %w", err)
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	if len(certificates) == 0 {
+		return nil, errors.New("no SAML identity provider certificate found")
+	}
+	return certificates, nil
+}
+
+// Registry holds the configured identity providers in the order they are
+// offered to users
+type Registry struct {
+	providers []*Provider
+}
+
+func NewRegistry(providers ...*Provider) *Registry {
+	return &Registry{providers: providers}
+}
+
+func (r *Registry) Get(name string) (*Provider, bool) {
+	for _, provider := range r.providers {
+		if provider.Name() == name {
+			return provider, true
+		}
+	}
+	return nil, false
+}
+
+func (r *Registry) All() []*Provider {
+	return r.providers
+}
@@ -0,0 +1,469 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testEntityID    = "https://auth.example.com/api/auth/saml/corp/metadata"
+	testACSURL      = "https://auth.example.com/api/auth/saml/corp/acs"
+	testIdPEntityID = "https://idp.example.com/saml"
+	testRequestID   = "id-0123456789abcdef"
+)
+
+// testIdP issues responses the way an identity provider would, signed with
+// its own key
+type testIdP struct {
+	t           *testing.T
+	key         *rsa.PrivateKey
+	certificate *x509.Certificate
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testIdP{t: t, key: key, certificate: certificate}
+}
+
+func (idp *testIdP) provider() *Provider {
+	return NewProvider(ProviderConfig{
+		Name:              "corp",
+		EntityID:          testEntityID,
+		ACSURL:            testACSURL,
+		IdPEntityID:       testIdPEntityID,
+		IdPSSOURL:         "https://idp.example.com/saml/sso?tenant=acme",
+		IdPCertificates:   []*x509.Certificate{idp.certificate},
+		UsernameAttribute: "uid",
+		EmailAttribute:    "mail",
+	})
+}
+
+// responseParams are the parts of a response tests vary
+type responseParams struct {
+	InResponseTo   string
+	Issuer         string
+	Audience       string
+	Recipient      string
+	NameID         string
+	NameIDFormat   string
+	NotBefore      time.Time
+	NotOnOrAfter   time.Time
+	Status         string
+	SignAssertion  bool
+	SignResponse   bool
+	ExtraAssertion string
+}
+
+func defaultResponse() responseParams {
+	now := time.Now()
+	return responseParams{
+		InResponseTo:  testRequestID,
+		Issuer:        testIdPEntityID,
+		Audience:      testEntityID,
+		Recipient:     testACSURL,
+		NameID:        "ada@example.com",
+		NameIDFormat:  nameIDEmailAddress,
+		NotBefore:     now.Add(-time.Minute),
+		NotOnOrAfter:  now.Add(5 * time.Minute),
+		Status:        StatusSuccess,
+		SignAssertion: true,
+	}
+}
+
+func (idp *testIdP) assertion(p responseParams, id string) string {
+	return fmt.Sprintf(`<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" ID="%[1]s" Version="2.0" IssueInstant="%[2]s">
+  <saml:Issuer>%[3]s</saml:Issuer>
+  <saml:Subject>
+    <saml:NameID Format="%[4]s">%[5]s</saml:NameID>
+    <saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+      <saml:SubjectConfirmationData InResponseTo="%[6]s" Recipient="%[7]s" NotOnOrAfter="%[8]s"/>
+    </saml:SubjectConfirmation>
+  </saml:Subject>
+  <saml:Conditions NotBefore="%[9]s" NotOnOrAfter="%[8]s">
+    <saml:AudienceRestriction>
+      <saml:Audience>%[10]s</saml:Audience>
+    </saml:AudienceRestriction>
+  </saml:Conditions>
+  <saml:AuthnStatement AuthnInstant="%[2]s"/>
+  <saml:AttributeStatement>
+    <saml:Attribute Name="uid"><saml:AttributeValue xsi:type="xs:string">ada</saml:AttributeValue></saml:Attribute>
+    <saml:Attribute Name="mail"><saml:AttributeValue xsi:type="xs:string">ada.lovelace@example.com</saml:AttributeValue></saml:Attribute>
+    <saml:Attribute Name="groups">
+      <saml:AttributeValue>engineering</saml:AttributeValue>
+      <saml:AttributeValue>admins &amp; friends</saml:AttributeValue>
+    </saml:Attribute>
+  </saml:AttributeStatement>
+</saml:Assertion>`, id, instant(time.Now()), p.Issuer, p.NameIDFormat, p.NameID, p.InResponseTo, p.Recipient,
+		instant(p.NotOnOrAfter), instant(p.NotBefore), p.Audience)
+}
+
+func (idp *testIdP) response(p responseParams) string {
+	assertion := idp.assertion(p, "assertion-1")
+	if p.SignAssertion {
+		assertion = idp.sign(assertion, "assertion-1", "</saml:Issuer>")
+	}
+
+	response := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" ID="response-1" Version="2.0" IssueInstant="%s" Destination="%s" InResponseTo="%s"><saml:Issuer xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion">%s</saml:Issuer><samlp:Status><samlp:StatusCode Value="%s"/></samlp:Status>%s%s</samlp:Response>`,
+		instant(time.Now()), testACSURL, p.InResponseTo, p.Issuer, p.Status, assertion, p.ExtraAssertion)
+	if p.SignResponse {
+		response = idp.sign(response, "response-1", "</saml:Issuer>")
+	}
+
+	return base64.StdEncoding.EncodeToString([]byte(response))
+}
+
+// sign inserts an enveloped signature of the element with the ID after the
+// first occurrence of marker
+func (idp *testIdP) sign(document string, id string, marker string) string {
+	root, err := parseXML([]byte(strings.TrimPrefix(document, `<?xml version="1.0" encoding="UTF-8"?>`)))
+	require.NoError(idp.t, err)
+
+	signed := findByID(root, id)
+	require.NotNil(idp.t, signed)
+	digest := sha256.Sum256(canonicalize(signed, []string{"xs"}, nil))
+
+	signedInfo := fmt.Sprintf(`<ds:SignedInfo><ds:CanonicalizationMethod Algorithm="%s"/><ds:SignatureMethod Algorithm="%s"/><ds:Reference URI="#%s"><ds:Transforms><ds:Transform Algorithm="%s"/><ds:Transform Algorithm="%s"><ec:InclusiveNamespaces xmlns:ec="%s" PrefixList="xs"/></ds:Transform></ds:Transforms><ds:DigestMethod Algorithm="%s"/><ds:DigestValue>%s</ds:DigestValue></ds:Reference></ds:SignedInfo>`,
+		algExcC14N, algRSASHA256, id, algEnveloped, algExcC14N, nsExcC14N, algSHA256, base64.StdEncoding.EncodeToString(digest[:]))
+
+	signatureXML, err := parseXML([]byte(`<ds:Signature xmlns:ds="` + nsDSig + `">` + signedInfo + `</ds:Signature>`))
+	require.NoError(idp.t, err)
+	sum := sha256.Sum256(canonicalize(signatureXML.element(nsDSig, "SignedInfo"), nil, nil))
+	value, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, sum[:])
+	require.NoError(idp.t, err)
+
+	signature := `<ds:Signature xmlns:ds="` + nsDSig + `">` + signedInfo +
+		`<ds:SignatureValue>` + base64.StdEncoding.EncodeToString(value) + `</ds:SignatureValue></ds:Signature>`
+	return strings.Replace(document, marker, marker+signature, 1)
+}
+
+func findByID(e *element, id string) *element {
+	if e.attr("ID") == id {
+		return e
+	}
+	for _, child := range e.children {
+		if c, ok := child.(*element); ok {
+			if found := findByID(c, id); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+func instant(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func TestParseResponse(t *testing.T) {
+	idp := newTestIdP(t)
+
+	identity, err := idp.provider().ParseResponse(idp.response(defaultResponse()), testRequestID)
+	require.NoError(t, err)
+
+	assert.Equal(t, "ada@example.com", identity.Subject)
+	assert.Equal(t, "ada", identity.PreferredUsername)
+	assert.Equal(t, "ada.lovelace@example.com", identity.Email)
+	assert.Equal(t, []string{"engineering", "admins & friends"}, identity.Attributes["groups"])
+}
+
+func TestParseResponseSignedResponse(t *testing.T) {
+	idp := newTestIdP(t)
+
+	params := defaultResponse()
+	params.SignAssertion, params.SignResponse = false, true
+	_, err := idp.provider().ParseResponse(idp.response(params), testRequestID)
+	assert.NoError(t, err)
+
+	params.SignAssertion = true
+	_, err = idp.provider().ParseResponse(idp.response(params), testRequestID)
+	assert.NoError(t, err, "both may be signed")
+}
+
+func TestParseResponseEmailFromNameID(t *testing.T) {
+	idp := newTestIdP(t)
+
+	provider := idp.provider()
+	provider.config.EmailAttribute = "email"
+
+	identity, err := provider.ParseResponse(idp.response(defaultResponse()), testRequestID)
+	require.NoError(t, err)
+	assert.Equal(t, "ada@example.com", identity.Email)
+}
+
+func TestParseResponseRejectsSignatureProblems(t *testing.T) {
+	idp := newTestIdP(t)
+	other := newTestIdP(t)
+
+	unsigned := defaultResponse()
+	unsigned.SignAssertion = false
+
+	tests := map[string]string{
+		"unsigned":                   idp.response(unsigned),
+		"signed by another provider": other.response(defaultResponse()),
+		"tampered after signing": tamper(idp.response(defaultResponse()),
+			">ada@example.com</saml:NameID>", ">grace@example.com</saml:NameID>"),
+		"tampered attribute": tamper(idp.response(defaultResponse()),
+			">engineering<", ">payroll<"),
+		"reference to another element": tamper(idp.response(defaultResponse()),
+			`URI="#assertion-1"`, `URI="#response-1"`),
+		"SHA-1 digest": tamper(idp.response(defaultResponse()),
+			algSHA256, "http://www.w3.org/2000/09/xmldsig#sha1"),
+	}
+
+	for name, response := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := idp.provider().ParseResponse(response, testRequestID)
+			assert.ErrorIs(t, err, ErrInvalidSignature)
+		})
+	}
+}
+
+func TestParseResponseRejectsSignatureWrapping(t *testing.T) {
+	idp := newTestIdP(t)
+
+	// A forged assertion next to the signed one
+	params := defaultResponse()
+	forged := params
+	forged.NameID = "admin@example.com"
+	params.ExtraAssertion = idp.assertion(forged, "assertion-2")
+
+	_, err := idp.provider().ParseResponse(idp.response(params), testRequestID)
+	assert.ErrorIs(t, err, ErrInvalidResponse)
+
+	// The signed assertion hidden inside a forged one that carries its ID
+	signed := idp.sign(idp.assertion(defaultResponse(), "assertion-1"), "assertion-1", "</saml:Issuer>")
+	wrapper := strings.Replace(idp.assertion(forged, "assertion-1"), "</saml:Issuer>",
+		"</saml:Issuer><saml:Advice>"+signed+"</saml:Advice>", 1)
+	response := fmt.Sprintf(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" ID="response-1" Version="2.0" InResponseTo="%s"><samlp:Status><samlp:StatusCode Value="%s"/></samlp:Status>%s</samlp:Response>`,
+		testRequestID, StatusSuccess, wrapper)
+
+	_, err = idp.provider().ParseResponse(base64.StdEncoding.EncodeToString([]byte(response)), testRequestID)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
+
+func TestParseResponseCommentInjection(t *testing.T) {
+	idp := newTestIdP(t)
+
+	// The identity provider vouches for an address the attacker registered.
+	// A comment does not change the signed canonical form, so it must not
+	// change the name ID read either.
+	params := defaultResponse()
+	params.NameID = "ada@example.com.evil.com"
+	response := tamper(idp.response(params), "ada@example.com.evil.com", "ada@example.com<!---->.evil.com")
+	data, _ := base64.StdEncoding.DecodeString(response)
+	require.Contains(t, string(data), "ada@example.com<!---->.evil.com")
+
+	identity, err := idp.provider().ParseResponse(response, testRequestID)
+	require.NoError(t, err)
+	assert.Equal(t, "ada@example.com.evil.com", identity.Subject)
+}
+
+func TestParseResponseRejectsKnownAttacks(t *testing.T) {
+	idp := newTestIdP(t)
+
+	tests := map[string]struct {
+		response string
+		err      error
+	}{
+		"canonicalization with comments": {
+			tamper(idp.response(defaultResponse()), `<ds:CanonicalizationMethod Algorithm="`+algExcC14N+`"`,
+				`<ds:CanonicalizationMethod Algorithm="`+algExcC14N+`WithComments"`),
+			ErrInvalidSignature,
+		},
+		"second ID attribute": {
+			tamper(idp.response(defaultResponse()), `ID="assertion-1"`, `ID="assertion-1" ID="assertion-2"`),
+			errMalformedXML,
+		},
+		"processing instruction": {
+			tamper(idp.response(defaultResponse()), "<saml:Subject>", "<?xml-stylesheet href=\"x\"?><saml:Subject>"),
+			errMalformedXML,
+		},
+		"signature moved into a child": {
+			moveSignature(idp.response(defaultResponse()), "<saml:Subject>"),
+			ErrInvalidSignature,
+		},
+		"external entity": {
+			base64.StdEncoding.EncodeToString([]byte(`<!DOCTYPE r [<!ENTITY x SYSTEM "file:///etc/passwd">]><r>&x;</r>`)),
+			errMalformedXML,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := idp.provider().ParseResponse(test.response, testRequestID)
+			assert.ErrorIs(t, err, test.err)
+		})
+	}
+}
+
+// moveSignature moves the signature of a response after marker, where it no
+// longer envelops what it signs
+func moveSignature(encoded string, marker string) string {
+	data, _ := base64.StdEncoding.DecodeString(encoded)
+	document := string(data)
+
+	start := strings.Index(document, "<ds:Signature ")
+	end := strings.Index(document, "</ds:Signature>") + len("</ds:Signature>")
+	signature := document[start:end]
+	document = document[:start] + document[end:]
+
+	return base64.StdEncoding.EncodeToString([]byte(strings.Replace(document, marker, marker+signature, 1)))
+}
+
+func TestParseResponseRejectsInvalidAssertions(t *testing.T) {
+	idp := newTestIdP(t)
+	now := time.Now()
+
+	tests := map[string]func(p *responseParams){
+		"other request":     func(p *responseParams) { p.InResponseTo = "id-other" },
+		"other issuer":      func(p *responseParams) { p.Issuer = "https://evil.example.com" },
+		"other audience":    func(p *responseParams) { p.Audience = "https://other.example.com" },
+		"other recipient":   func(p *responseParams) { p.Recipient = "https://other.example.com/acs" },
+		"expired":           func(p *responseParams) { p.NotOnOrAfter = now.Add(-3 * time.Minute) },
+		"not yet valid":     func(p *responseParams) { p.NotBefore = now.Add(3 * time.Minute) },
+		"transient name ID": func(p *responseParams) { p.NameIDFormat = nameIDTransient },
+	}
+
+	for name, modify := range tests {
+		t.Run(name, func(t *testing.T) {
+			params := defaultResponse()
+			modify(&params)
+
+			_, err := idp.provider().ParseResponse(idp.response(params), testRequestID)
+			assert.ErrorIs(t, err, ErrInvalidResponse)
+		})
+	}
+}
+
+func TestParseResponseAllowsClockSkew(t *testing.T) {
+	idp := newTestIdP(t)
+	now := time.Now()
+
+	params := defaultResponse()
+	params.NotBefore = now.Add(time.Minute)
+	_, err := idp.provider().ParseResponse(idp.response(params), testRequestID)
+	assert.NoError(t, err)
+
+	params = defaultResponse()
+	params.NotOnOrAfter = now.Add(-time.Minute)
+	_, err = idp.provider().ParseResponse(idp.response(params), testRequestID)
+	assert.NoError(t, err)
+}
+
+func TestParseResponseStatus(t *testing.T) {
+	idp := newTestIdP(t)
+
+	response := fmt.Sprintf(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" ID="response-1" Version="2.0" InResponseTo="%s"><samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Responder"><samlp:StatusCode Value="%s"/></samlp:StatusCode><samlp:StatusMessage>User cancelled</samlp:StatusMessage></samlp:Status></samlp:Response>`,
+		testRequestID, StatusAuthnFailed)
+
+	_, err := idp.provider().ParseResponse(base64.StdEncoding.EncodeToString([]byte(response)), testRequestID)
+
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.True(t, statusErr.Denied())
+	assert.Equal(t, "User cancelled", statusErr.Message)
+}
+
+func TestParseResponseRejectsDocumentTypes(t *testing.T) {
+	idp := newTestIdP(t)
+
+	response := `<?xml version="1.0"?><!DOCTYPE r [<!ENTITY a "aaaaaaaa">]><samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol">&a;</samlp:Response>`
+
+	_, err := idp.provider().ParseResponse(base64.StdEncoding.EncodeToString([]byte(response)), testRequestID)
+	assert.ErrorIs(t, err, errMalformedXML)
+}
+
+func TestAuthnRequestURL(t *testing.T) {
+	idp := newTestIdP(t)
+
+	requestID, err := NewRequestID()
+	require.NoError(t, err)
+
+	authnURL, err := idp.provider().AuthnRequestURL(requestID, "state-123")
+	require.NoError(t, err)
+
+	u, err := url.Parse(authnURL)
+	require.NoError(t, err)
+	assert.Equal(t, "idp.example.com", u.Host)
+	assert.Equal(t, "acme", u.Query().Get("tenant"))
+	assert.Equal(t, "state-123", u.Query().Get("RelayState"))
+
+	deflated, err := base64.StdEncoding.DecodeString(u.Query().Get("SAMLRequest"))
+	require.NoError(t, err)
+	data, err := io.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	require.NoError(t, err)
+
+	request, err := parseXML(data)
+	require.NoError(t, err)
+	assert.True(t, request.is(nsProtocol, "AuthnRequest"))
+	assert.Equal(t, requestID, request.attr("ID"))
+	assert.Equal(t, testACSURL, request.attr("AssertionConsumerServiceURL"))
+	assert.Equal(t, bindingHTTPPost, request.attr("ProtocolBinding"))
+	assert.Equal(t, testEntityID, request.element(nsAssertion, "Issuer").text())
+}
+
+func TestMetadata(t *testing.T) {
+	idp := newTestIdP(t)
+
+	data, err := idp.provider().Metadata()
+	require.NoError(t, err)
+
+	metadata, err := parseXML(data)
+	require.NoError(t, err)
+	assert.True(t, metadata.is(nsMetadata, "EntityDescriptor"))
+	assert.Equal(t, testEntityID, metadata.attr("entityID"))
+
+	acs := metadata.element(nsMetadata, "SPSSODescriptor").element(nsMetadata, "AssertionConsumerService")
+	require.NotNil(t, acs)
+	assert.Equal(t, testACSURL, acs.attr("Location"))
+	assert.Equal(t, bindingHTTPPost, acs.attr("Binding"))
+}
+
+func TestParseCertificates(t *testing.T) {
+	idp := newTestIdP(t)
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: idp.certificate.Raw})
+
+	certificates, err := ParseCertificates(append(certificate, certificate...))
+	require.NoError(t, err)
+	assert.Len(t, certificates, 2)
+
+	_, err = ParseCertificates([]byte("not a certificate"))
+	assert.Error(t, err)
+}
+
+func tamper(encoded string, old string, new string) string {
+	data, _ := base64.StdEncoding.DecodeString(encoded)
+	return base64.StdEncoding.EncodeToString([]byte(strings.Replace(string(data), old, new, 1)))
+}
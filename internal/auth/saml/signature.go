@@ -0,0 +1,187 @@
+package saml
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// XML Signature namespaces and the algorithms accepted. SHA-1 is not.
+const (
+	nsDSig     = "http://www.w3.org/2000/09/xmldsig#"
+	nsExcC14N  = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algExcC14N = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	// The enveloped signature transform removes the signature from what it
+	// signs
+	algEnveloped = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	algRSASHA256 = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algRSASHA512 = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	algSHA256    = "http://www.w3.org/2001/04/xmlenc#sha256"
+	algSHA512    = "http://www.w3.org/2001/04/xmlenc#sha512"
+)
+
+var signatureHashes = map[string]crypto.Hash{
+	algRSASHA256: crypto.SHA256,
+	algRSASHA512: crypto.SHA512,
+}
+
+var digestHashes = map[string]crypto.Hash{
+	algSHA256: crypto.SHA256,
+	algSHA512: crypto.SHA512,
+}
+
+var ErrInvalidSignature = errors.New("saml: invalid signature")
+
+// verifySignature checks the enveloped signature of an element against the
+// identity provider's certificates. It reports false without an error when
+// the element is not signed.
+//
+// The signature must reference the element itself by its ID, so a valid
+// signature moved next to forged content does not vouch for it; callers use
+// the element they passed in, never one looked up by ID.
+func verifySignature(e *element, certificates []*x509.Certificate) (bool, error) {
+	signatures := e.elements(nsDSig, "Signature")
+	switch len(signatures) {
+	case 0:
+		return false, nil
+	case 1:
+	default:
+		return false, fmt.Errorf("%w: more than one signature", ErrInvalidSignature)
+	}
+	signature := signatures[0]
+
+	signedInfo, err := single(signature, nsDSig, "SignedInfo")
+	if err != nil {
+		return false, err
+	}
+
+	canonicalization, err := single(signedInfo, nsDSig, "CanonicalizationMethod")
+	if err != nil {
+		return false, err
+	}
+	if canonicalization.attr("Algorithm") != algExcC14N {
+		return false, fmt.Errorf("%w: unsupported canonicalization %s", ErrInvalidSignature, canonicalization.attr("Algorithm"))
+	}
+
+	signatureMethod, err := single(signedInfo, nsDSig, "SignatureMethod")
+	if err != nil {
+		return false, err
+	}
+	signatureHash, ok := signatureHashes[signatureMethod.attr("Algorithm")]
+	if !ok {
+		return false, fmt.Errorf("%w: unsupported signature algorithm %s", ErrInvalidSignature, signatureMethod.attr("Algorithm"))
+	}
+
+	if err := verifyReference(e, signature, signedInfo); err != nil {
+		return false, err
+	}
+
+	signatureValue, err := single(signature, nsDSig, "SignatureValue")
+	if err != nil {
+		return false, err
+	}
+	value, err := decodeBase64(signatureValue.text())
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	h := signatureHash.New()
+	h.Write(canonicalize(signedInfo, inclusivePrefixes(canonicalization), nil))
+	sum := h.Sum(nil)
+
+	for _, certificate := range certificates {
+		key, ok := certificate.PublicKey.(*rsa.PublicKey)
+		if ok && rsa.VerifyPKCS1v15(key, signatureHash, sum, value) == nil {
+			return true, nil
+		}
+	}
+	return false, fmt.Errorf("%w: not signed by the identity provider", ErrInvalidSignature)
+}
+
+// verifyReference checks that the signed info covers the element and that
+// its digest matches
+func verifyReference(e *element, signature *element, signedInfo *element) error {
+	reference, err := single(signedInfo, nsDSig, "Reference")
+	if err != nil {
+		return err
+	}
+
+	id := e.attr("ID")
+	if id == "" || reference.attr("URI") != "#"+id {
+		return fmt.Errorf("%w: the signature does not reference the signed element", ErrInvalidSignature)
+	}
+
+	var inclusive []string
+	enveloped := false
+	if transforms := reference.element(nsDSig, "Transforms"); transforms != nil {
+		for _, transform := range transforms.elements(nsDSig, "Transform") {
+			switch transform.attr("Algorithm") {
+			case algEnveloped:
+				enveloped = true
+			case algExcC14N:
+				inclusive = inclusivePrefixes(transform)
+			default:
+				return fmt.Errorf("%w: unsupported transform %s", ErrInvalidSignature, transform.attr("Algorithm"))
+			}
+		}
+	}
+	if !enveloped {
+		return fmt.Errorf("%w: the signature is not enveloped", ErrInvalidSignature)
+	}
+
+	digestMethod, err := single(reference, nsDSig, "DigestMethod")
+	if err != nil {
+		return err
+	}
+	digestHash, ok := digestHashes[digestMethod.attr("Algorithm")]
+	if !ok {
+		return fmt.Errorf("%w: unsupported digest algorithm %s", ErrInvalidSignature, digestMethod.attr("Algorithm"))
+	}
+
+	digestValue, err := single(reference, nsDSig, "DigestValue")
+	if err != nil {
+		return err
+	}
+	expected, err := decodeBase64(digestValue.text())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	h := digestHash.New()
+	h.Write(canonicalize(e, inclusive, signature))
+	if subtle.ConstantTimeCompare(h.Sum(nil), expected) != 1 {
+		return fmt.Errorf("%w: digest mismatch", ErrInvalidSignature)
+	}
+	return nil
+}
+
+// inclusivePrefixes reads the InclusiveNamespaces parameter of an exclusive
+// canonicalization
+func inclusivePrefixes(method *element) []string {
+	if parameter := method.element(nsExcC14N, "InclusiveNamespaces"); parameter != nil {
+		return strings.Fields(parameter.attr("PrefixList"))
+	}
+	return nil
+}
+
+// single returns the only child element with the given name
+func single(e *element, space string, local string) (*element, error) {
+	elements := e.elements(space, local)
+	if len(elements) != 1 {
+		return nil, fmt.Errorf("%w: expected one %s element", ErrInvalidSignature, local)
+	}
+	return elements[0], nil
+}
+
+// decodeBase64 decodes base64 that may be wrapped across lines
+func decodeBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
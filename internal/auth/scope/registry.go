@@ -0,0 +1,127 @@
+package scope
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/joeariasc/go-auth/internal/auth/rbac"
+)
+
+var ErrInvalidScope = errors.New("invalid scope")
+
+// Scope is a named slice of access a token can carry. A scope with a
+// Permission is only granted to users holding that permission.
+type Scope struct {
+	Name        string
+	Description string
+	Permission  string
+}
+
+// Registry holds the scopes clients may request
+type Registry struct {
+	scopes map[string]Scope
+}
+
+func NewRegistry(scopes ...Scope) *Registry {
+	r := &Registry{scopes: make(map[string]Scope, len(scopes))}
+	for _, s := range scopes {
+		r.scopes[s.Name] = s
+	}
+	return r
+}
+
+// DefaultRegistry contains the scopes used by this service's own routes
+func DefaultRegistry() *Registry {
+	return NewRegistry(
+		Scope{Name: "openid", Description: "Sign you in with your account"},
+		Scope{Name: "profile", Description: "See your username"},
+		Scope{Name: "account", Description: "Read, export, update and delete your account"},
+		Scope{Name: "email", Description: "See your email address"},
+		Scope{Name: "devices", Description: "View and manage your devices"},
+		Scope{Name: "sessions", Description: "View and sign out your active sessions"},
+		Scope{Name: "tokens", Description: "Create and revoke your personal access tokens"},
+		Scope{Name: rbac.PermUsersRead, Description: "View user accounts", Permission: rbac.PermUsersRead},
+		Scope{Name: rbac.PermUsersWrite, Description: "Manage user accounts", Permission: rbac.PermUsersWrite},
+		Scope{Name: rbac.PermRolesRead, Description: "View roles and permissions", Permission: rbac.PermRolesRead},
+		Scope{Name: rbac.PermRolesWrite, Description: "Manage roles and permissions", Permission: rbac.PermRolesWrite},
+		Scope{Name: rbac.PermAuditRead, Description: "View the security audit log", Permission: rbac.PermAuditRead},
+		Scope{Name: rbac.PermWebhooksRead, Description: "View webhook subscriptions and deliveries", Permission: rbac.PermWebhooksRead},
+		Scope{Name: rbac.PermWebhooksWrite, Description: "Manage webhook subscriptions and retry deliveries", Permission: rbac.PermWebhooksWrite},
+		Scope{Name: rbac.PermClientsRead, Description: "View OAuth clients", Permission: rbac.PermClientsRead},
+		Scope{Name: rbac.PermClientsWrite, Description: "Register and manage OAuth clients", Permission: rbac.PermClientsWrite},
+		Scope{Name: rbac.PermSCIMProvision, Description: "Provision users and groups through SCIM", Permission: rbac.PermSCIMProvision},
+	)
+}
+
+// Register adds or replaces a scope
+func (r *Registry) Register(s Scope) {
+	r.scopes[s.Name] = s
+}
+
+func (r *Registry) Lookup(name string) (Scope, bool) {
+	s, ok := r.scopes[name]
+	return s, ok
+}
+
+// All returns the registered scopes sorted by name
+func (r *Registry) All() []Scope {
+	all := make([]Scope, 0, len(r.scopes))
+	for _, s := range r.scopes {
+		all = append(all, s)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
+
+// Grant intersects the requested scopes with those the permissions allow.
+// Requesting an unknown scope is an error, while known scopes the user may not
+// have are silently dropped as RFC 6749 allows. An empty request grants every
+// allowed scope.
+func (r *Registry) Grant(requested []string, permissions []string) ([]string, error) {
+	if len(requested) == 0 {
+		for name := range r.scopes {
+			requested = append(requested, name)
+		}
+	}
+
+	granted := []string{}
+	for _, name := range requested {
+		s, ok := r.scopes[name]
+		if !ok {
+			return nil, ErrInvalidScope
+		}
+		if s.Permission != "" && !rbac.Allows(permissions, s.Permission) {
+			continue
+		}
+		if !slices.Contains(granted, name) {
+			granted = append(granted, name)
+		}
+	}
+
+	sort.Strings(granted)
+	return granted, nil
+}
+
+// Parse splits a space-delimited scope string as used in tokens and requests
+func Parse(s string) []string {
+	return strings.Fields(s)
+}
+
+// Format joins scopes into a space-delimited string
+func Format(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// Contains reports whether a space-delimited scope string includes every
+// required scope
+func Contains(granted string, required ...string) bool {
+	have := Parse(granted)
+	for _, s := range required {
+		if !slices.Contains(have, s) {
+			return false
+		}
+	}
+	return true
+}
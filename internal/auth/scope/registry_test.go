@@ -0,0 +1,50 @@
+package scope
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRegistry() *Registry {
+	return NewRegistry(
+		Scope{Name: "profile", Description: "Profile"},
+		Scope{Name: "devices", Description: "Devices"},
+		Scope{Name: "users:write", Description: "Manage users", Permission: "users:write"},
+	)
+}
+
+func TestGrant(t *testing.T) {
+	registry := testRegistry()
+
+	granted, err := registry.Grant([]string{"profile", "users:write", "profile"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"profile"}, granted, "scopes the user lacks permission for are dropped")
+
+	granted, err = registry.Grant([]string{"users:write"}, []string{"users:*"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"users:write"}, granted)
+
+	granted, err = registry.Grant(nil, []string{"users:write"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"devices", "profile", "users:write"}, granted, "an empty request grants everything allowed")
+
+	_, err = registry.Grant([]string{"profile", "payments"}, nil)
+	assert.ErrorIs(t, err, ErrInvalidScope)
+}
+
+func TestContains(t *testing.T) {
+	assert.True(t, Contains("profile devices", "devices"))
+	assert.True(t, Contains("profile devices", "profile", "devices"))
+	assert.False(t, Contains("profile", "devices"))
+	assert.True(t, Contains(""))
+	assert.Equal(t, "a b", Format(Parse("  a   b ")))
+}
+
+func TestAllIsSorted(t *testing.T) {
+	all := testRegistry().All()
+	require.Len(t, all, 3)
+	assert.Equal(t, "devices", all[0].Name)
+	assert.Equal(t, "users:write", all[2].Name)
+}
@@ -0,0 +1,56 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrSessionLimitReached = errors.New("session limit reached")
+
+// LimitAction decides what happens when a new login would exceed a Limit
+type LimitAction string
+
+const (
+	EvictOldest LimitAction = "evict"
+	RejectNew   LimitAction = "reject"
+)
+
+func (a LimitAction) IsValid() bool {
+	switch a {
+	case EvictOldest, RejectNew:
+		return true
+	default:
+		return false
+	}
+}
+
+func ParseLimitAction(s string) (LimitAction, error) {
+	if s == "" {
+		return EvictOldest, nil
+	}
+	action := LimitAction(s)
+	if !action.IsValid() {
+		return "", fmt.Errorf("invalid session limit action: %q", s)
+	}
+	return action, nil
+}
+
+// Limit caps the number of concurrent sessions a user may hold for one client
+// type. A MaxSessions of zero means unlimited.
+type Limit struct {
+	MaxSessions int
+	Action      LimitAction
+}
+
+// Evictions returns how many of the existing sessions must be terminated
+// before a new one can be started, or ErrSessionLimitReached when the limit
+// rejects new logins instead.
+func (l Limit) Evictions(active int) (int, error) {
+	if l.MaxSessions <= 0 || active < l.MaxSessions {
+		return 0, nil
+	}
+	if l.Action == RejectNew {
+		return 0, ErrSessionLimitReached
+	}
+	return active - l.MaxSessions + 1, nil
+}
@@ -0,0 +1,44 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitEvictions(t *testing.T) {
+	testCases := []struct {
+		name      string
+		limit     Limit
+		active    int
+		evictions int
+		err       error
+	}{
+		{"Unlimited", Limit{MaxSessions: 0, Action: RejectNew}, 10, 0, nil},
+		{"Below limit", Limit{MaxSessions: 3, Action: EvictOldest}, 2, 0, nil},
+		{"At limit evicts one", Limit{MaxSessions: 3, Action: EvictOldest}, 3, 1, nil},
+		{"Over limit evicts surplus", Limit{MaxSessions: 3, Action: EvictOldest}, 5, 3, nil},
+		{"At limit rejects", Limit{MaxSessions: 3, Action: RejectNew}, 3, 0, ErrSessionLimitReached},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			evictions, err := tc.limit.Evictions(tc.active)
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, tc.evictions, evictions)
+		})
+	}
+}
+
+func TestParseLimitAction(t *testing.T) {
+	action, err := ParseLimitAction("")
+	assert.NoError(t, err)
+	assert.Equal(t, EvictOldest, action)
+
+	action, err = ParseLimitAction("reject")
+	assert.NoError(t, err)
+	assert.Equal(t, RejectNew, action)
+
+	_, err = ParseLimitAction("drop")
+	assert.Error(t, err)
+}
@@ -0,0 +1,132 @@
+package session
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/utils"
+)
+
+type Manager struct {
+	conn          *db.Connection
+	tokenDuration time.Duration
+	limits        map[models.ClientType]Limit
+}
+
+type ManagerConfig struct {
+	Conn          *db.Connection
+	TokenDuration time.Duration
+	Limits        map[models.ClientType]Limit
+}
+
+type StartParams struct {
+	UserId     int64
+	ClientType models.ClientType
+	IP         string
+	UserAgent  string
+	// Scope granted to the session's tokens
+	Scope string
+	// AuthMethod is how the user signed in
+	AuthMethod string
+}
+
+func NewManager(config ManagerConfig) *Manager {
+	return &Manager{
+		conn:          config.Conn,
+		tokenDuration: config.TokenDuration,
+		limits:        config.Limits,
+	}
+}
+
+// WithConn returns a copy of the manager that works on conn, typically the
+// transaction of an InTx
+func (m *Manager) WithConn(conn *db.Connection) *Manager {
+	copy := *m
+	copy.conn = conn
+	return &copy
+}
+
+// Start records a new session for the user, enforcing the concurrent session
+// limit configured for the client type. Evicted sessions are revoked so their
+// tokens fail verification from then on. The user's row stays locked until
+// the session is stored, so concurrent logins cannot exceed the limit.
+func (m *Manager) Start(params StartParams) (*entity.Session, error) {
+	jti, err := utils.GenerateRandomID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate session id: %w", err)
+	}
+
+	now := time.Now()
+	session := &entity.Session{
+		JTI:        jti,
+		UserId:     params.UserId,
+		ClientType: string(params.ClientType),
+		IP:         params.IP,
+		UserAgent:  params.UserAgent,
+		Scope:      params.Scope,
+		AuthMethod: params.AuthMethod,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(m.tokenDuration),
+	}
+
+	err = m.conn.InTx(func(tx *db.Connection) error {
+		if err := tx.LockUser(params.UserId); err != nil {
+			return err
+		}
+
+		if err := m.WithConn(tx).enforceLimit(params.UserId, params.ClientType); err != nil {
+			return err
+		}
+
+		session.Id, err = tx.CreateSession(session)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (m *Manager) enforceLimit(userId int64, clientType models.ClientType) error {
+	limit, ok := m.limits[clientType]
+	if !ok || limit.MaxSessions <= 0 {
+		return nil
+	}
+
+	sessions, err := m.conn.ListActiveSessions(userId)
+	if err != nil {
+		return err
+	}
+
+	active := make([]*entity.Session, 0, len(sessions))
+	for _, s := range sessions {
+		if s.ClientType == string(clientType) {
+			active = append(active, s)
+		}
+	}
+
+	evictions, err := limit.Evictions(len(active))
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].CreatedAt.Before(active[j].CreatedAt)
+	})
+
+	for _, s := range active[:evictions] {
+		if err := m.conn.RevokeSession(userId, s.Id); err != nil {
+			return err
+		}
+		log.Printf("Evicted %s session %d of user %d", clientType, s.Id, userId)
+	}
+
+	return nil
+}
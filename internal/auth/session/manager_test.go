@@ -0,0 +1,72 @@
+package session
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/test_utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startConcurrently starts n sessions of the user at once and returns how
+// many were started
+func startConcurrently(t *testing.T, m *Manager, userId int64, n int) int {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	started := 0
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.Start(StartParams{UserId: userId, ClientType: models.WebClient, IP: "203.0.113.7"})
+			if err == nil {
+				mu.Lock()
+				started++
+				mu.Unlock()
+				return
+			}
+			assert.ErrorIs(t, err, ErrSessionLimitReached)
+		}()
+	}
+	wg.Wait()
+	return started
+}
+
+func TestConcurrentLoginsRespectRejectingLimit(t *testing.T) {
+	conn := test_utils.OpenDatabase(t)
+	user := test_utils.InsertUser(t, conn, "limit")
+
+	m := NewManager(ManagerConfig{
+		Conn:          conn,
+		TokenDuration: time.Hour,
+		Limits:        map[models.ClientType]Limit{models.WebClient: {MaxSessions: 2, Action: RejectNew}},
+	})
+
+	assert.Equal(t, 2, startConcurrently(t, m, user.Id, 10))
+
+	sessions, err := conn.ListActiveSessions(user.Id)
+	require.NoError(t, err)
+	assert.Len(t, sessions, 2)
+}
+
+func TestConcurrentLoginsRespectEvictingLimit(t *testing.T) {
+	conn := test_utils.OpenDatabase(t)
+	user := test_utils.InsertUser(t, conn, "limit")
+
+	m := NewManager(ManagerConfig{
+		Conn:          conn,
+		TokenDuration: time.Hour,
+		Limits:        map[models.ClientType]Limit{models.WebClient: {MaxSessions: 2, Action: EvictOldest}},
+	})
+
+	assert.Equal(t, 10, startConcurrently(t, m, user.Id, 10))
+
+	sessions, err := conn.ListActiveSessions(user.Id)
+	require.NoError(t, err)
+	assert.Len(t, sessions, 2)
+}
@@ -1,11 +1,19 @@
 package token
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"time"
 
+	"github.com/joeariasc/go-auth/internal/auth/account"
+	"github.com/joeariasc/go-auth/internal/auth/oauth"
+	"github.com/joeariasc/go-auth/internal/auth/scope"
 	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
 	"github.com/joeariasc/go-auth/internal/models"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -16,38 +24,71 @@ var (
 	ErrTokenExpired       = errors.New("token is expired")
 	ErrInvalidFingerprint = errors.New("invalid fingerprint")
 	ErrInvalidClaims      = errors.New("invalid claims")
+	ErrDeviceRevoked      = errors.New("device has been removed")
+	ErrSessionRevoked     = errors.New("session has been terminated")
+	ErrWrongTokenType     = errors.New("token was issued to a different kind of client")
 )
 
 type Manager struct {
 	Conn          *db.Connection
 	TokenDuration time.Duration
+	secretKey     []byte
 }
 
 type Params struct {
+	SessionID   string
 	Username    string
 	Fingerprint string
 	ClientType  models.ClientType
-	Secret      []byte
+	Roles       []string
+	Scope       string
+	// Secret of the user, mixed with the server secret into the signing key
+	Secret []byte
+	// ClientID is the OAuth client the token is issued to, empty for the
+	// session tokens of this service's own clients
+	ClientID string
 }
 
 type ManagerConfig struct {
 	Conn          *db.Connection
 	TokenDuration time.Duration
+	// SecretKey signs server-issued tokens, and together with the user secret
+	// those issued to users
+	SecretKey []byte
 }
 
 func NewManager(config ManagerConfig) *Manager {
 	return &Manager{
 		Conn:          config.Conn,
 		TokenDuration: config.TokenDuration,
+		secretKey:     config.SecretKey,
 	}
 }
 
+// NewUserSecret generates the secret of a new user
+func NewUserSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate user secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// userKey derives the key that signs the tokens of a user. Only the server can
+// compute it, while changing the user secret revokes all of the user's tokens.
+func (m *Manager) userKey(secret []byte) []byte {
+	mac := hmac.New(sha256.New, m.secretKey)
+	mac.Write(secret)
+	return mac.Sum(nil)
+}
+
 func (m *Manager) GenerateToken(params Params) (string, error) {
 	now := time.Now()
 
 	// Create claims with standard JWT claims and custom fields
 	claims := &models.UserClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        params.SessionID,
 			ExpiresAt: jwt.NewNumericDate(now.Add(m.TokenDuration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(now),
@@ -56,12 +97,15 @@ func (m *Manager) GenerateToken(params Params) (string, error) {
 		Username:    params.Username,
 		Fingerprint: params.Fingerprint,
 		ClientType:  string(params.ClientType),
+		Roles:       params.Roles,
+		Scope:       params.Scope,
+		ClientID:    params.ClientID,
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	// Sign and get the complete encoded token as a string
-	tokenString, err := token.SignedString(params.Secret)
+	tokenString, err := token.SignedString(m.userKey(params.Secret))
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -70,22 +114,96 @@ func (m *Manager) GenerateToken(params Params) (string, error) {
 }
 
 func (m *Manager) VerifyToken(tokenString, currentFingerprint string) (*models.UserClaims, error) {
-	parser := jwt.NewParser(jwt.WithoutClaimsValidation())
+	claims, user, err := m.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
 
-	token, _ := parser.ParseWithClaims(tokenString, &models.UserClaims{}, func(t *jwt.Token) (interface{}, error) {
-		return nil, nil // We'll verify later with the correct secret
-	})
+	if claims.ClientID != "" {
+		return nil, ErrWrongTokenType
+	}
 
-	// Extract preliminary claims to get the user ID
-	prelimClaims, ok := token.Claims.(*models.UserClaims)
-	if !ok {
-		return nil, ErrInvalidClaims
+	// Verify fingerprint
+	if claims.Fingerprint != currentFingerprint {
+		return nil, ErrInvalidFingerprint
+	}
+
+	// The device must still be registered; removing it signs it out
+	device, err := m.Conn.GetDeviceByFingerprint(user.Id, claims.Fingerprint)
+	if err != nil {
+		if errors.Is(err, db.ErrDeviceNotFound) {
+			return nil, ErrDeviceRevoked
+		}
+		return nil, err
+	}
+
+	if err := m.Conn.TouchDevice(device.Id); err != nil {
+		return nil, err
+	}
+	claims.UserID, claims.TrustedDevice = user.Id, device.Trusted
+
+	if err := m.checkSession(claims, user); err != nil {
+		return nil, err
+	}
+	return claims, m.loadRoles(claims, user)
+}
+
+// VerifyClientToken verifies an access token issued to an OAuth client. These
+// are plain bearer tokens, not bound to a device fingerprint.
+func (m *Manager) VerifyClientToken(tokenString string) (*models.UserClaims, error) {
+	claims, user, err := m.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.ClientID == "" {
+		return nil, ErrWrongTokenType
+	}
+
+	if err := m.checkSession(claims, user); err != nil {
+		return nil, err
+	}
+	claims.UserID = user.Id
+	return claims, m.loadRoles(claims, user)
+}
+
+// loadRoles replaces the roles of the token with those the user holds now, so
+// granting or removing a role applies to tokens already issued
+func (m *Manager) loadRoles(claims *models.UserClaims, user *entity.User) error {
+	roles, err := m.Conn.GetUserRoles(user.Id)
+	if err != nil {
+		return err
+	}
+	claims.Roles = roles
+	return nil
+}
+
+// IsClientToken reports whether a token claims to be issued to an OAuth
+// client. The token is not verified.
+func IsClientToken(tokenString string) bool {
+	claims := &models.UserClaims{}
+	_, _, err := jwt.NewParser().ParseUnverified(tokenString, claims)
+	return err == nil && claims.ClientID != ""
+}
+
+// parse verifies the signature of a token with the key of the user it was
+// issued to, and that the user may still sign in
+func (m *Manager) parse(tokenString string) (*models.UserClaims, *entity.User, error) {
+	// Read the claims unverified to find the user, whose key verifies them
+	prelimClaims := &models.UserClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, prelimClaims); err != nil {
+		return nil, nil, ErrInvalidToken
+	}
+
+	// Tokens of the client credentials grant have no user
+	if prelimClaims.IsClient() {
+		return nil, nil, ErrWrongTokenType
 	}
 
 	// Get user's secret from database
 	user, err := m.Conn.GetUser(prelimClaims.Username)
 	if err != nil {
-		return nil, ErrInvalidToken
+		return nil, nil, ErrInvalidToken
 	}
 
 	// Now parse and validate with the correct user secret
@@ -93,29 +211,59 @@ func (m *Manager) VerifyToken(tokenString, currentFingerprint string) (*models.U
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
 		}
-		return []byte(user.Secret), nil
+		return m.userKey([]byte(user.Secret)), nil
 	})
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
-			return nil, ErrTokenExpired
+			return nil, nil, ErrTokenExpired
 		}
-		return nil, fmt.Errorf("failed to parse token: %w", err)
+		return nil, nil, fmt.Errorf("failed to parse token: %w", err)
 	}
 
 	if !validToken.Valid {
-		return nil, ErrInvalidToken
+		return nil, nil, ErrInvalidToken
 	}
 
 	claims, ok := validToken.Claims.(*models.UserClaims)
 	if !ok {
-		return nil, ErrInvalidClaims
+		return nil, nil, ErrInvalidClaims
 	}
 
-	// Verify fingerprint
-	if claims.Fingerprint != currentFingerprint {
-		return nil, ErrInvalidFingerprint
+	// Tokens of pending, suspended or deleted accounts stop working at once
+	if err := account.CheckActive(user.Status); err != nil {
+		return nil, nil, err
+	}
+
+	return claims, user, nil
+}
+
+// checkSession rejects sessions that were signed out remotely, and tokens
+// claiming scopes or a client the session was not started with
+func (m *Manager) checkSession(claims *models.UserClaims, user *entity.User) error {
+	session, err := m.Conn.GetSessionByJTI(claims.ID)
+	if err != nil {
+		if errors.Is(err, db.ErrSessionNotFound) {
+			return ErrSessionRevoked
+		}
+		return err
+	}
+
+	if session.RevokedAt != nil || session.UserId != user.Id {
+		return ErrSessionRevoked
+	}
+
+	if claims.ClientID != "" {
+		if session.ClientType != oauth.SessionClientType || session.ClientId != claims.ClientID {
+			return ErrWrongTokenType
+		}
+	} else if session.ClientType == oauth.SessionClientType {
+		return ErrWrongTokenType
+	}
+
+	if !scope.Contains(session.Scope, scope.Parse(claims.Scope)...) {
+		return ErrInvalidClaims
 	}
 
-	return claims, nil
+	return m.Conn.TouchSession(session.Id)
 }
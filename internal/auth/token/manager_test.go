@@ -0,0 +1,83 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsClientToken(t *testing.T) {
+	m := NewManager(ManagerConfig{TokenDuration: time.Minute})
+
+	sessionToken, err := m.GenerateToken(Params{SessionID: "s1", Username: "joe", Fingerprint: "fp", Secret: []byte("secret")})
+	require.NoError(t, err)
+	assert.False(t, IsClientToken(sessionToken))
+
+	clientToken, err := m.GenerateToken(Params{SessionID: "s2", Username: "joe", ClientID: "spa", Secret: []byte("secret")})
+	require.NoError(t, err)
+	assert.True(t, IsClientToken(clientToken))
+
+	assert.False(t, IsClientToken("not-a-token"))
+}
+
+func TestUserTokensNeedTheServerSecret(t *testing.T) {
+	m := NewManager(ManagerConfig{TokenDuration: time.Minute, SecretKey: []byte("server-secret")})
+
+	tokenString, err := m.GenerateToken(Params{SessionID: "s1", Username: "joe", Fingerprint: "fp", Secret: []byte("secret")})
+	require.NoError(t, err)
+
+	// Knowing the user secret is not enough to sign tokens
+	_, err = jwt.Parse(tokenString, func(*jwt.Token) (interface{}, error) { return []byte("secret"), nil })
+	assert.ErrorIs(t, err, jwt.ErrSignatureInvalid)
+
+	_, err = jwt.Parse(tokenString, func(*jwt.Token) (interface{}, error) { return m.userKey([]byte("secret")), nil })
+	assert.NoError(t, err)
+
+	other := NewManager(ManagerConfig{TokenDuration: time.Minute, SecretKey: []byte("other-secret")})
+	assert.NotEqual(t, m.userKey([]byte("secret")), other.userKey([]byte("secret")))
+}
+
+func TestVerifyRejectsMalformedTokens(t *testing.T) {
+	m := NewManager(ManagerConfig{TokenDuration: time.Minute, SecretKey: []byte("server-secret")})
+
+	for _, tokenString := range []string{"", "not-a-token", "gat_opaque", "a.b.c"} {
+		_, err := m.VerifyToken(tokenString, "fp")
+		assert.ErrorIs(t, err, ErrInvalidToken, tokenString)
+
+		_, err = m.VerifyClientToken(tokenString)
+		assert.ErrorIs(t, err, ErrInvalidToken, tokenString)
+	}
+}
+
+func TestNewUserSecret(t *testing.T) {
+	a, err := NewUserSecret()
+	require.NoError(t, err)
+	b, err := NewUserSecret()
+	require.NoError(t, err)
+
+	assert.Len(t, a, 64)
+	assert.NotEqual(t, a, b)
+}
+
+func TestServiceTokenIsNotAUserToken(t *testing.T) {
+	m := NewManager(ManagerConfig{TokenDuration: time.Minute, SecretKey: []byte("server-secret")})
+
+	serviceToken, err := m.GenerateServiceToken(ServiceParams{TokenID: "t1", ClientID: "billing-job", Scope: "users:read"})
+	require.NoError(t, err)
+	assert.True(t, IsServiceToken(serviceToken))
+	assert.True(t, IsClientToken(serviceToken))
+
+	_, err = m.VerifyToken(serviceToken, "fp")
+	assert.ErrorIs(t, err, ErrWrongTokenType)
+
+	clientToken, err := m.GenerateToken(Params{SessionID: "s1", Username: "joe", ClientID: "spa", Secret: []byte("secret")})
+	require.NoError(t, err)
+	assert.False(t, IsServiceToken(clientToken))
+
+	// Tokens issued to clients on behalf of users are no service tokens
+	_, err = m.VerifyServiceToken(clientToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
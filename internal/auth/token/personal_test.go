@@ -0,0 +1,35 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/auth/oauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPersonalToken(t *testing.T) {
+	token, hash, hint, err := NewPersonalToken()
+	require.NoError(t, err)
+
+	assert.True(t, IsPersonalToken(token))
+	assert.Equal(t, oauth.HashToken(token), hash)
+	assert.NotContains(t, hash, token)
+	assert.Len(t, hint, len(PersonalTokenPrefix)+4)
+	assert.Equal(t, token[:len(hint)], hint)
+
+	other, _, _, err := NewPersonalToken()
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func TestIsPersonalToken(t *testing.T) {
+	m := NewManager(ManagerConfig{TokenDuration: time.Minute})
+
+	sessionToken, err := m.GenerateToken(Params{SessionID: "s1", Username: "joe", Fingerprint: "fp", Secret: []byte("secret")})
+	require.NoError(t, err)
+	assert.False(t, IsPersonalToken(sessionToken))
+	assert.False(t, IsPersonalToken(""))
+	assert.True(t, IsPersonalToken("gat_abc"))
+}
@@ -0,0 +1,49 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const revocationAudience = "session-revocation"
+
+// GenerateRevocationToken signs a token that lets its bearer terminate the
+// given session, e.g. from a "this wasn't me" link in a notification email.
+func (m *Manager) GenerateRevocationToken(sessionID string, expiresAt time.Time) (string, error) {
+	claims := jwt.RegisteredClaims{
+		ID:        sessionID,
+		Audience:  jwt.ClaimStrings{revocationAudience},
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}
+
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(m.secretKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+	return tokenString, nil
+}
+
+// VerifyRevocationToken returns the session ID a revocation token was issued for
+func (m *Manager) VerifyRevocationToken(tokenString string) (string, error) {
+	claims := &jwt.RegisteredClaims{}
+
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		return m.secretKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(revocationAudience))
+
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return "", ErrTokenExpired
+		}
+		return "", ErrInvalidToken
+	}
+
+	if claims.ID == "" {
+		return "", ErrInvalidClaims
+	}
+	return claims.ID, nil
+}
@@ -0,0 +1,29 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevocationToken(t *testing.T) {
+	m := NewManager(ManagerConfig{SecretKey: []byte("server-secret")})
+
+	tokenString, err := m.GenerateRevocationToken("session-1", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	sessionID, err := m.VerifyRevocationToken(tokenString)
+	require.NoError(t, err)
+	assert.Equal(t, "session-1", sessionID)
+
+	other := NewManager(ManagerConfig{SecretKey: []byte("other-secret")})
+	_, err = other.VerifyRevocationToken(tokenString)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	expired, err := m.GenerateRevocationToken("session-1", time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	_, err = m.VerifyRevocationToken(expired)
+	assert.ErrorIs(t, err, ErrTokenExpired)
+}
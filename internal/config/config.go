@@ -20,6 +20,130 @@ type Config struct {
 	DbUser         string
 	DbPassword     string
 	DbName         string
+
+	// Concurrent session limits per client type, 0 means unlimited.
+	// The action is either "evict" (the oldest session) or "reject".
+	WebSessionLimit          int
+	WebSessionLimitAction    string
+	MobileSessionLimit       int
+	MobileSessionLimitAction string
+
+	// Public base URL of this service, used to build links in notifications
+	PublicURL string
+	// Path to a MaxMind GeoLite2-City database, optional
+	GeoIPDbPath string
+
+	// Security notifications. Without SMTP_ADDR emails are only logged.
+	SmtpAddr     string
+	SmtpUsername string
+	SmtpPassword string
+	MailFrom     string
+
+	// Risk engine. Scores at or above the thresholds require MFA or are denied.
+	RiskMFAThreshold   int
+	RiskDenyThreshold  int
+	IPReputationList   string // path to a block list of IPs and CIDRs, optional
+	UnusualHoursStart  int    // UTC hour, inclusive
+	UnusualHoursEnd    int    // UTC hour, exclusive
+	LoginFailureWindow int    // seconds
+	LoginFailureLimit  int
+
+	// Impossible travel detection, enabled when a GeoIP database is configured
+	TravelMaxSpeedKmh   int
+	TravelMinDistanceKm int
+
+	// Users granted the admin role at startup
+	AdminUsernames []string
+
+	// Self-service account deletion. Accounts are purged after the grace
+	// period; deleting, like trusting a device, requires a token issued within
+	// ReauthMaxAge seconds.
+	AccountDeletionGraceDays int
+	AccountPurgeInterval     int // seconds
+	ReauthMaxAge             int // seconds
+
+	// Base64 Ed25519 seed signing audit log checkpoints, checkpoints are
+	// disabled without it
+	AuditSigningKey         string
+	AuditCheckpointInterval int // seconds
+
+	// Webhook delivery of authentication events. A failed delivery is retried
+	// after WebhookBaseBackoff seconds, doubling up to WebhookMaxBackoff, and
+	// dead-lettered after WebhookMaxAttempts.
+	WebhookDispatchInterval int // seconds
+	WebhookMaxAttempts      int
+	WebhookBaseBackoff      int // seconds
+	WebhookMaxBackoff       int // seconds
+
+	// OAuth authorization server. OAuthLoginURL is the page of the web client
+	// that signs users in and lets them approve authorization requests.
+	OAuthLoginURL        string
+	OAuthCodeTTL         int // seconds
+	OAuthRefreshTokenTTL int // seconds
+
+	// Device authorization grant. OAuthDeviceURL is the page of the web client
+	// where users enter the code shown by the device.
+	OAuthDeviceURL          string
+	OAuthDeviceCodeTTL      int // seconds
+	OAuthDevicePollInterval int // seconds
+
+	// OpenID Connect. ID tokens are signed with the RSA key in the PEM file
+	// OIDCSigningKeyFile; PublicURL is the issuer.
+	OIDCSigningKeyFile string
+	OIDCIDTokenTTL     int // seconds
+
+	// Sign-in with upstream OpenID Connect providers. FederatedLoginURL is the
+	// page of the web client that completes the sign-in after the provider
+	// redirected back.
+	FederatedProviders []FederatedProvider
+	FederatedLoginURL  string
+	SAMLProviders      []SAMLProvider
+
+	// Password sign-in against a directory, tried before local accounts when
+	// LDAPURL is set. LDAPGroupRoles maps group DNs to roles.
+	LDAPURL             string
+	LDAPBindDN          string
+	LDAPBindPassword    string
+	LDAPBaseDN          string
+	LDAPUserAttribute   string
+	LDAPUserObjectClass string
+	LDAPEmailAttribute  string
+	LDAPGroupAttribute  string
+	LDAPGroupRoles      map[string]string
+	LDAPProvision       bool
+	LDAPTimeout         int // seconds
+}
+
+// FederatedProvider configures an upstream OpenID Connect provider. Providers
+// are named in FEDERATED_PROVIDERS and each is configured by variables with
+// the prefix FEDERATED_<NAME>_, e.g. FEDERATED_CORP_CLIENT_ID.
+type FederatedProvider struct {
+	Name         string
+	DisplayName  string
+	DiscoveryURL string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// Provision creates accounts for users signing in for the first time
+	Provision bool
+}
+
+// SAMLProvider configures a SAML identity provider. Providers are named in
+// SAML_PROVIDERS and each is configured by variables with the prefix
+// SAML_<NAME>_, e.g. SAML_ACME_IDP_SSO_URL. They share the names and the
+// completion page of federated providers.
+type SAMLProvider struct {
+	Name        string
+	DisplayName string
+	IdPEntityID string
+	IdPSSOURL   string
+	// IdPCertificateFile holds the PEM certificates the identity provider
+	// signs with
+	IdPCertificateFile string
+	UsernameAttribute  string
+	EmailAttribute     string
+	// Provision creates accounts for users signing in for the first time
+	Provision bool
 }
 
 // LoadEnvFile loads environment variables from a file and returns Config
@@ -97,6 +221,148 @@ func loadFromEnvironment() (*Config, error) {
 		return nil, fmt.Errorf("invalid DB_PORT value: %v", err)
 	}
 
+	webSessionLimit, err := getEnvInt("WEB_SESSION_LIMIT", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	mobileSessionLimit, err := getEnvInt("MOBILE_SESSION_LIMIT", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	riskMFAThreshold, err := getEnvInt("RISK_MFA_THRESHOLD", 50)
+	if err != nil {
+		return nil, err
+	}
+
+	riskDenyThreshold, err := getEnvInt("RISK_DENY_THRESHOLD", 80)
+	if err != nil {
+		return nil, err
+	}
+
+	unusualHoursStart, err := getEnvInt("UNUSUAL_HOURS_START", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	unusualHoursEnd, err := getEnvInt("UNUSUAL_HOURS_END", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	loginFailureWindow, err := getEnvInt("LOGIN_FAILURE_WINDOW", 900)
+	if err != nil {
+		return nil, err
+	}
+
+	loginFailureLimit, err := getEnvInt("LOGIN_FAILURE_LIMIT", 5)
+	if err != nil {
+		return nil, err
+	}
+
+	travelMaxSpeed, err := getEnvInt("IMPOSSIBLE_TRAVEL_MAX_SPEED", 1000)
+	if err != nil {
+		return nil, err
+	}
+
+	travelMinDistance, err := getEnvInt("IMPOSSIBLE_TRAVEL_MIN_DISTANCE", 300)
+	if err != nil {
+		return nil, err
+	}
+
+	deletionGraceDays, err := getEnvInt("ACCOUNT_DELETION_GRACE_DAYS", 30)
+	if err != nil {
+		return nil, err
+	}
+
+	purgeInterval, err := getEnvInt("ACCOUNT_PURGE_INTERVAL", 3600)
+	if err != nil {
+		return nil, err
+	}
+
+	reauthMaxAge, err := getEnvInt("REAUTH_MAX_AGE", 300)
+	if err != nil {
+		return nil, err
+	}
+
+	auditCheckpointInterval, err := getEnvInt("AUDIT_CHECKPOINT_INTERVAL", 3600)
+	if err != nil {
+		return nil, err
+	}
+
+	webhookDispatchInterval, err := getEnvInt("WEBHOOK_DISPATCH_INTERVAL", 5)
+	if err != nil {
+		return nil, err
+	}
+
+	webhookMaxAttempts, err := getEnvInt("WEBHOOK_MAX_ATTEMPTS", 8)
+	if err != nil {
+		return nil, err
+	}
+
+	webhookBaseBackoff, err := getEnvInt("WEBHOOK_BASE_BACKOFF", 30)
+	if err != nil {
+		return nil, err
+	}
+
+	webhookMaxBackoff, err := getEnvInt("WEBHOOK_MAX_BACKOFF", 21600)
+	if err != nil {
+		return nil, err
+	}
+
+	oauthCodeTTL, err := getEnvInt("OAUTH_CODE_TTL", 60)
+	if err != nil {
+		return nil, err
+	}
+
+	oauthRefreshTokenTTL, err := getEnvInt("OAUTH_REFRESH_TOKEN_TTL", 2592000)
+	if err != nil {
+		return nil, err
+	}
+
+	oauthDeviceCodeTTL, err := getEnvInt("OAUTH_DEVICE_CODE_TTL", 600)
+	if err != nil {
+		return nil, err
+	}
+
+	oauthDevicePollInterval, err := getEnvInt("OAUTH_DEVICE_POLL_INTERVAL", 5)
+	if err != nil {
+		return nil, err
+	}
+
+	oidcIDTokenTTL, err := getEnvInt("OIDC_ID_TOKEN_TTL", 300)
+	if err != nil {
+		return nil, err
+	}
+
+	federatedProviders, err := loadFederatedProviders()
+	if err != nil {
+		return nil, err
+	}
+
+	samlProviders, err := loadSAMLProviders(federatedProviders)
+	if err != nil {
+		return nil, err
+	}
+
+	ldapGroupRoles, err := parseGroupRoles(os.Getenv("LDAP_GROUP_ROLES"))
+	if err != nil {
+		return nil, err
+	}
+
+	ldapProvision := false
+	if value := os.Getenv("LDAP_PROVISION"); value != "" {
+		if ldapProvision, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("invalid LDAP_PROVISION value: %v", err)
+		}
+	}
+
+	ldapTimeout, err := getEnvInt("LDAP_TIMEOUT", 10)
+	if err != nil {
+		return nil, err
+	}
+
 	originsStr := os.Getenv("ALLOWED_ORIGINS")
 
 	var allowedOrigins []string
@@ -110,6 +376,13 @@ func loadFromEnvironment() (*Config, error) {
 		log.Printf("Warning: ALLOWED_ORIGINS is empty")
 	}
 
+	var adminUsernames []string
+	for _, username := range strings.Split(os.Getenv("ADMIN_USERNAMES"), ",") {
+		if username = strings.TrimSpace(username); username != "" {
+			adminUsernames = append(adminUsernames, username)
+		}
+	}
+
 	config := &Config{
 		SecretKey:      os.Getenv("SECRET_KEY"),
 		TokenDuration:  tokenDuration,
@@ -120,6 +393,71 @@ func loadFromEnvironment() (*Config, error) {
 		DbUser:         os.Getenv("DB_USER"),
 		DbPassword:     os.Getenv("DB_PASSWORD"),
 		DbName:         os.Getenv("DB_NAME"),
+
+		WebSessionLimit:          webSessionLimit,
+		WebSessionLimitAction:    os.Getenv("WEB_SESSION_LIMIT_ACTION"),
+		MobileSessionLimit:       mobileSessionLimit,
+		MobileSessionLimitAction: os.Getenv("MOBILE_SESSION_LIMIT_ACTION"),
+
+		PublicURL:   os.Getenv("PUBLIC_URL"),
+		GeoIPDbPath: os.Getenv("GEOIP_DB_PATH"),
+
+		SmtpAddr:     os.Getenv("SMTP_ADDR"),
+		SmtpUsername: os.Getenv("SMTP_USERNAME"),
+		SmtpPassword: os.Getenv("SMTP_PASSWORD"),
+		MailFrom:     os.Getenv("MAIL_FROM"),
+
+		RiskMFAThreshold:   riskMFAThreshold,
+		RiskDenyThreshold:  riskDenyThreshold,
+		IPReputationList:   os.Getenv("IP_REPUTATION_LIST"),
+		UnusualHoursStart:  unusualHoursStart,
+		UnusualHoursEnd:    unusualHoursEnd,
+		LoginFailureWindow: loginFailureWindow,
+		LoginFailureLimit:  loginFailureLimit,
+
+		TravelMaxSpeedKmh:   travelMaxSpeed,
+		TravelMinDistanceKm: travelMinDistance,
+
+		AdminUsernames: adminUsernames,
+
+		AccountDeletionGraceDays: deletionGraceDays,
+		AccountPurgeInterval:     purgeInterval,
+		ReauthMaxAge:             reauthMaxAge,
+
+		AuditSigningKey:         os.Getenv("AUDIT_SIGNING_KEY"),
+		AuditCheckpointInterval: auditCheckpointInterval,
+
+		WebhookDispatchInterval: webhookDispatchInterval,
+		WebhookMaxAttempts:      webhookMaxAttempts,
+		WebhookBaseBackoff:      webhookBaseBackoff,
+		WebhookMaxBackoff:       webhookMaxBackoff,
+
+		OAuthLoginURL:        os.Getenv("OAUTH_LOGIN_URL"),
+		OAuthCodeTTL:         oauthCodeTTL,
+		OAuthRefreshTokenTTL: oauthRefreshTokenTTL,
+
+		OAuthDeviceURL:          os.Getenv("OAUTH_DEVICE_URL"),
+		OAuthDeviceCodeTTL:      oauthDeviceCodeTTL,
+		OAuthDevicePollInterval: oauthDevicePollInterval,
+
+		OIDCSigningKeyFile: os.Getenv("OIDC_SIGNING_KEY_FILE"),
+		OIDCIDTokenTTL:     oidcIDTokenTTL,
+
+		FederatedProviders: federatedProviders,
+		FederatedLoginURL:  os.Getenv("FEDERATED_LOGIN_URL"),
+		SAMLProviders:      samlProviders,
+
+		LDAPURL:             os.Getenv("LDAP_URL"),
+		LDAPBindDN:          os.Getenv("LDAP_BIND_DN"),
+		LDAPBindPassword:    os.Getenv("LDAP_BIND_PASSWORD"),
+		LDAPBaseDN:          os.Getenv("LDAP_BASE_DN"),
+		LDAPUserAttribute:   os.Getenv("LDAP_USER_ATTRIBUTE"),
+		LDAPUserObjectClass: os.Getenv("LDAP_USER_OBJECT_CLASS"),
+		LDAPEmailAttribute:  os.Getenv("LDAP_EMAIL_ATTRIBUTE"),
+		LDAPGroupAttribute:  os.Getenv("LDAP_GROUP_ATTRIBUTE"),
+		LDAPGroupRoles:      ldapGroupRoles,
+		LDAPProvision:       ldapProvision,
+		LDAPTimeout:         ldapTimeout,
 	}
 
 	// Validate required fields
@@ -131,5 +469,127 @@ func loadFromEnvironment() (*Config, error) {
 		return nil, fmt.Errorf("SERVER_ADDRESS is required")
 	}
 
+	if config.LDAPURL != "" && config.LDAPBaseDN == "" {
+		return nil, fmt.Errorf("LDAP_BASE_DN is required with LDAP_URL")
+	}
+
 	return config, nil
 }
+
+// getEnvInt reads an optional integer variable, falling back to def when unset
+func getEnvInt(key string, def int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value: %v", key, err)
+	}
+	return n, nil
+}
+
+// loadFederatedProviders reads the providers listed in FEDERATED_PROVIDERS
+func loadFederatedProviders() ([]FederatedProvider, error) {
+	var providers []FederatedProvider
+
+	for _, name := range strings.Split(os.Getenv("FEDERATED_PROVIDERS"), ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		prefix := "FEDERATED_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+
+		provider := FederatedProvider{
+			Name:         name,
+			DisplayName:  os.Getenv(prefix + "DISPLAY_NAME"),
+			DiscoveryURL: os.Getenv(prefix + "DISCOVERY_URL"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+			Provision:    true,
+		}
+
+		if provider.DiscoveryURL == "" || provider.ClientID == "" {
+			return nil, fmt.Errorf("%sDISCOVERY_URL and %sCLIENT_ID are required", prefix, prefix)
+		}
+		if provider.Scopes == nil {
+			provider.Scopes = []string{"email", "profile"}
+		}
+		if value := os.Getenv(prefix + "PROVISION"); value != "" {
+			provision, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %sPROVISION value: %v", prefix, err)
+			}
+			provider.Provision = provision
+		}
+
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
+
+// loadSAMLProviders reads the providers listed in SAML_PROVIDERS, whose names
+// must differ from those of the federated providers
+func loadSAMLProviders(federatedProviders []FederatedProvider) ([]SAMLProvider, error) {
+	var providers []SAMLProvider
+
+	for _, name := range strings.Split(os.Getenv("SAML_PROVIDERS"), ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		for _, federated := range federatedProviders {
+			if federated.Name == name {
+				return nil, fmt.Errorf("identity provider %s is listed in both FEDERATED_PROVIDERS and SAML_PROVIDERS", name)
+			}
+		}
+		prefix := "SAML_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+
+		provider := SAMLProvider{
+			Name:               name,
+			DisplayName:        os.Getenv(prefix + "DISPLAY_NAME"),
+			IdPEntityID:        os.Getenv(prefix + "IDP_ENTITY_ID"),
+			IdPSSOURL:          os.Getenv(prefix + "IDP_SSO_URL"),
+			IdPCertificateFile: os.Getenv(prefix + "IDP_CERTIFICATE_FILE"),
+			UsernameAttribute:  os.Getenv(prefix + "USERNAME_ATTRIBUTE"),
+			EmailAttribute:     os.Getenv(prefix + "EMAIL_ATTRIBUTE"),
+			Provision:          true,
+		}
+
+		if provider.IdPEntityID == "" || provider.IdPSSOURL == "" || provider.IdPCertificateFile == "" {
+			return nil, fmt.Errorf("%sIDP_ENTITY_ID, %sIDP_SSO_URL and %sIDP_CERTIFICATE_FILE are required", prefix, prefix, prefix)
+		}
+		if provider.EmailAttribute == "" {
+			provider.EmailAttribute = "email"
+		}
+		if value := os.Getenv(prefix + "PROVISION"); value != "" {
+			provision, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %sPROVISION value: %v", prefix, err)
+			}
+			provider.Provision = provision
+		}
+
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
+
+// parseGroupRoles reads role=groupDN pairs separated by semicolons, as group
+// DNs contain commas
+func parseGroupRoles(value string) (map[string]string, error) {
+	groupRoles := map[string]string{}
+
+	for _, pair := range strings.Split(value, ";") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		role, groupDN, ok := strings.Cut(pair, "=")
+		role, groupDN = strings.TrimSpace(role), strings.TrimSpace(groupDN)
+		if !ok || role == "" || groupDN == "" {
+			return nil, fmt.Errorf("invalid LDAP_GROUP_ROLES entry %q, expected role=groupDN", pair)
+		}
+		groupRoles[groupDN] = role
+	}
+	return groupRoles, nil
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+)
+
+// ScheduleDeletion marks a user for purging once purgeAfter has passed
+func (c *Connection) ScheduleDeletion(userId int64, requestedAt time.Time, purgeAfter time.Time) error {
+	query := `UPDATE users SET deletion_requested_at=$1, purge_after=$2 WHERE id=$3`
+
+	result, err := c.q().Exec(query, requestedAt, purgeAfter, userId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrIDNotFound)
+}
+
+// CancelDeletion withdraws a pending deletion and reports whether there was one
+func (c *Connection) CancelDeletion(userId int64) (bool, error) {
+	query := `UPDATE users SET deletion_requested_at=NULL, purge_after=NULL
+		WHERE id=$1 AND purge_after IS NOT NULL`
+
+	result, err := c.q().Exec(query, userId)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// DueDeletions returns the ids of users whose grace period ended before now
+func (c *Connection) DueDeletions(now time.Time) ([]int64, error) {
+	rows, err := c.q().Query(`SELECT id FROM users WHERE purge_after <= $1 ORDER BY purge_after`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// PurgeUser erases the personal data of a user whose deletion is due. Data
+// that only describes the user is deleted; the user row is kept, anonymized
+// and marked deleted, so that records referencing it stay consistent. Webhook
+// events about the user keep only their id, type and time, so deliveries
+// still pending or retried later carry no username, IP or user agent.
+//
+// Audit events are deliberately kept, including the username, email and IP
+// addresses they name. They are the security record used to investigate
+// account takeover and abuse, which is a legitimate interest that outlasts
+// the account, and they are hash chained: rewriting them would make the log
+// fail verification. Operators needing a shorter retention period archive
+// and drop the log as a whole, see the README.
+func (c *Connection) PurgeUser(userId int64, at time.Time) error {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+
+	tx, err := c.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var username string
+	var status entity.UserStatus
+	err = tx.QueryRow(`SELECT username, status FROM users WHERE id=$1 AND purge_after <= $2 FOR UPDATE`, userId, at).
+		Scan(&username, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrIDNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	statements := []struct {
+		query string
+		args  []any
+	}{
+		{`DELETE FROM oauth_refresh_tokens WHERE user_id=$1`, []any{userId}},
+		{`DELETE FROM oauth_codes WHERE user_id=$1`, []any{userId}},
+		{`DELETE FROM oauth_device_grants WHERE user_id=$1`, []any{userId}},
+		{`DELETE FROM federated_logins WHERE link_user_id=$1`, []any{userId}},
+		{`DELETE FROM federated_identities WHERE user_id=$1`, []any{userId}},
+		{`DELETE FROM personal_access_tokens WHERE user_id=$1`, []any{userId}},
+		{`DELETE FROM sessions WHERE user_id=$1`, []any{userId}},
+		{`DELETE FROM devices WHERE user_id=$1`, []any{userId}},
+		{`DELETE FROM login_locations WHERE user_id=$1`, []any{userId}},
+		{`DELETE FROM user_roles WHERE user_id=$1`, []any{userId}},
+		{`DELETE FROM risk_decisions WHERE user_id=$1 OR username=$2`, []any{userId, username}},
+		{`DELETE FROM login_attempts WHERE username=$1`, []any{username}},
+		{`UPDATE user_status_history SET changed_by='deleted-user' WHERE changed_by=$1`, []any{username}},
+		{`UPDATE outbox_events SET payload = json_build_object('id', payload->'id', 'type', payload->'type',
+			'occurredAt', payload->'occurredAt', 'data', json_build_object('userId', $1::bigint))
+			WHERE payload->'data'->>'userId' = $1::text`, []any{userId}},
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement.query, statement.args...); err != nil {
+			return err
+		}
+	}
+
+	reason := "Account deleted at the user's request"
+	if status != entity.UserStatusDeleted {
+		_, err = tx.Exec(`INSERT INTO user_status_history (user_id, from_status, to_status, reason, changed_by, changed_at)
+			VALUES ($1, $2, $3, $4, 'system', $5)`, userId, status, entity.UserStatusDeleted, reason, at)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE users SET username=$1, description='', fingerprint=NULL, secret=$2, email=NULL,
+		external_id=NULL, email_verified=FALSE, mfa_enabled=FALSE, status=$3, status_reason=$4, status_changed_at=$5, purge_after=NULL
+		WHERE id=$6`,
+		fmt.Sprintf("deleted-%d", userId), hex.EncodeToString(secret), entity.UserStatusDeleted, reason, at, userId)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,259 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+)
+
+// Audit events outlive the users they mention, so there are no foreign keys.
+// Updates and deletes are rejected by a trigger. Each event is hash chained to
+// its predecessor; details are stored as JSON rather than JSONB so the hashed
+// text is returned unchanged.
+const createAudit string = `
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    type TEXT NOT NULL,
+    outcome TEXT NOT NULL,
+    actor_id INTEGER NULL,
+    actor TEXT NOT NULL,
+    target_type TEXT NOT NULL,
+    target_id TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    client_type TEXT NOT NULL,
+    details JSON NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    prev_hash TEXT NOT NULL,
+    hash TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_events_type_idx ON audit_events (type, id);
+CREATE INDEX IF NOT EXISTS audit_events_actor_idx ON audit_events (actor_id, id);
+CREATE INDEX IF NOT EXISTS audit_events_target_idx ON audit_events (target_type, target_id, id);
+
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+CREATE TABLE IF NOT EXISTS audit_checkpoints (
+    id SERIAL PRIMARY KEY,
+    event_id BIGINT NOT NULL REFERENCES audit_events(id),
+    hash TEXT NOT NULL,
+    signature BYTEA NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+DROP TRIGGER IF EXISTS audit_checkpoints_append_only ON audit_checkpoints;
+CREATE TRIGGER audit_checkpoints_append_only BEFORE UPDATE OR DELETE ON audit_checkpoints
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+`
+
+// auditChainLock serializes appends so each event links to its predecessor
+const auditChainLock = 0x617564697400
+
+var (
+	ErrAuditEventNotFound = errors.New("audit event not found")
+	ErrCheckpointNotFound = errors.New("audit checkpoint not found")
+)
+
+const auditColumns = `id, type, outcome, COALESCE(actor_id, 0), actor, target_type, target_id, ip, client_type, details, created_at, prev_hash, hash`
+
+// AuditFilter selects audit events. Zero values are ignored. Events are
+// returned newest first; Before is the id to continue after.
+type AuditFilter struct {
+	Type       string
+	Outcome    string
+	ActorId    int64
+	TargetType string
+	TargetId   string
+	IP         string
+	Since      time.Time
+	Until      time.Time
+	Before     int64
+	Limit      int
+}
+
+// InsertAuditEvent appends an event to the chain. It sets event.PrevHash to
+// the hash of the latest event and calls seal, which must set event.Hash,
+// while holding the chain lock.
+func (c *Connection) InsertAuditEvent(event *entity.AuditEvent, seal func(event *entity.AuditEvent)) error {
+	tx, err := c.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, auditChainLock); err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(`SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1`).Scan(&event.PrevHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	seal(event)
+
+	query := `INSERT INTO audit_events (type, outcome, actor_id, actor, target_type, target_id, ip, client_type, details,
+		created_at, prev_hash, hash)
+		VALUES ($1, $2, NULLIF($3, 0), $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id`
+
+	err = tx.QueryRow(query, event.Type, event.Outcome, event.ActorId, event.Actor, event.TargetType,
+		event.TargetId, event.IP, event.ClientType, string(event.Details), event.CreatedAt, event.PrevHash, event.Hash).
+		Scan(&event.Id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListAuditChain returns up to limit events with an id greater than afterId,
+// in chain order
+func (c *Connection) ListAuditChain(afterId int64, limit int) ([]*entity.AuditEvent, error) {
+	query := `SELECT ` + auditColumns + ` FROM audit_events WHERE id > $1 ORDER BY id LIMIT $2`
+	return c.queryAuditEvents(query, afterId, limit)
+}
+
+func (c *Connection) LatestAuditEvent() (*entity.AuditEvent, error) {
+	events, err := c.queryAuditEvents(`SELECT ` + auditColumns + ` FROM audit_events ORDER BY id DESC LIMIT 1`)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, ErrAuditEventNotFound
+	}
+	return events[0], nil
+}
+
+func (c *Connection) InsertAuditCheckpoint(checkpoint *entity.AuditCheckpoint) error {
+	query := `INSERT INTO audit_checkpoints (event_id, hash, signature, created_at) VALUES ($1, $2, $3, $4) RETURNING id`
+
+	return c.q().QueryRow(query, checkpoint.EventId, checkpoint.Hash, checkpoint.Signature, checkpoint.CreatedAt).
+		Scan(&checkpoint.Id)
+}
+
+func (c *Connection) LatestAuditCheckpoint() (*entity.AuditCheckpoint, error) {
+	checkpoints, err := c.queryAuditCheckpoints(`SELECT id, event_id, hash, signature, created_at
+		FROM audit_checkpoints ORDER BY id DESC LIMIT 1`)
+	if err != nil {
+		return nil, err
+	}
+	if len(checkpoints) == 0 {
+		return nil, ErrCheckpointNotFound
+	}
+	return checkpoints[0], nil
+}
+
+// ListAuditCheckpoints returns all checkpoints in the order they were taken
+func (c *Connection) ListAuditCheckpoints() ([]*entity.AuditCheckpoint, error) {
+	return c.queryAuditCheckpoints(`SELECT id, event_id, hash, signature, created_at FROM audit_checkpoints ORDER BY id`)
+}
+
+func (c *Connection) queryAuditCheckpoints(query string, args ...any) ([]*entity.AuditCheckpoint, error) {
+	rows, err := c.q().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checkpoints := []*entity.AuditCheckpoint{}
+	for rows.Next() {
+		checkpoint := entity.AuditCheckpoint{}
+		err := rows.Scan(&checkpoint.Id, &checkpoint.EventId, &checkpoint.Hash, &checkpoint.Signature, &checkpoint.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, &checkpoint)
+	}
+
+	return checkpoints, rows.Err()
+}
+
+// ListAuditEvents returns up to filter.Limit events matching the filter
+func (c *Connection) ListAuditEvents(filter AuditFilter) ([]*entity.AuditEvent, error) {
+	var conditions []string
+	var args []any
+
+	add := func(condition string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Type != "" {
+		add("type = $%d", filter.Type)
+	}
+	if filter.Outcome != "" {
+		add("outcome = $%d", filter.Outcome)
+	}
+	if filter.ActorId != 0 {
+		add("actor_id = $%d", filter.ActorId)
+	}
+	if filter.TargetType != "" {
+		add("target_type = $%d", filter.TargetType)
+	}
+	if filter.TargetId != "" {
+		add("target_id = $%d", filter.TargetId)
+	}
+	if filter.IP != "" {
+		add("ip = $%d", filter.IP)
+	}
+	if !filter.Since.IsZero() {
+		add("created_at >= $%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		add("created_at < $%d", filter.Until)
+	}
+	if filter.Before != 0 {
+		add("id < $%d", filter.Before)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	args = append(args, filter.Limit)
+	query := fmt.Sprintf(`SELECT %s FROM audit_events%s ORDER BY id DESC LIMIT $%d`, auditColumns, where, len(args))
+
+	return c.queryAuditEvents(query, args...)
+}
+
+// ListAuditEventsForUser returns the events a user performed or was the
+// target of, oldest first
+func (c *Connection) ListAuditEventsForUser(userId int64) ([]*entity.AuditEvent, error) {
+	query := `SELECT ` + auditColumns + ` FROM audit_events
+		WHERE actor_id=$1 OR (target_type='user' AND target_id=$2) ORDER BY id`
+
+	return c.queryAuditEvents(query, userId, fmt.Sprint(userId))
+}
+
+func (c *Connection) queryAuditEvents(query string, args ...any) ([]*entity.AuditEvent, error) {
+	rows, err := c.q().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*entity.AuditEvent{}
+	for rows.Next() {
+		event := entity.AuditEvent{}
+		err := rows.Scan(&event.Id, &event.Type, &event.Outcome, &event.ActorId, &event.Actor, &event.TargetType,
+			&event.TargetId, &event.IP, &event.ClientType, &event.Details, &event.CreatedAt, &event.PrevHash, &event.Hash)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+
+	return events, rows.Err()
+}
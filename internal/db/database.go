@@ -18,21 +18,42 @@ CREATE TABLE IF NOT EXISTS users (
     fingerprint TEXT NULL,
     secret TEXT NOT NULL
 );
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email TEXT NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMP NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_requested_at TIMESTAMP NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS purge_after TIMESTAMP NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS external_id TEXT NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT 'local';
 `
 
+const userColumns = `id, username, created_at, description, fingerprint, secret, email, status, status_reason, status_changed_at, email_verified, mfa_enabled, deletion_requested_at, purge_after, external_id, source`
+
 type Connection struct {
 	DB *sql.DB
+	tx *sql.Tx
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
 }
 
 var ErrIDNotFound = errors.New("id not found")
 var ErrUsernameNotFound = errors.New("username not found")
 
-func NewConnection(stringConn string) (*Connection, error) {
+// Open connects to an existing database without creating or migrating the
+// schema, for tools that only inspect it
+func Open(stringConn string) (*Connection, error) {
 	db, err := sql.Open("postgres", stringConn)
 	if err != nil {
 		return nil, err
 	}
-	if _, err := db.Exec(create); err != nil {
+	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, err
 	}
 	return &Connection{
@@ -40,79 +61,87 @@ func NewConnection(stringConn string) (*Connection, error) {
 	}, nil
 }
 
-func (c *Connection) Insert(user *entity.User) (int, error) {
-	query := `INSERT INTO users (username, created_at, description, fingerprint, secret) VALUES ($1, $2, $3, $4, $5) RETURNING id`
-
-	var id int
-
-	err := c.DB.QueryRow(query, user.Username, user.CreatedAt, user.Description, user.Fingerprint, user.Secret).Scan(&id)
-
+func NewConnection(stringConn string) (*Connection, error) {
+	db, err := sql.Open("postgres", stringConn)
 	if err != nil {
-		log.Printf("Unable to execute the query. %v", err)
-		return 0, err
+		return nil, err
 	}
-
-	log.Printf("Added %v as %d", user, id)
-	return id, nil
+	for _, schema := range []string{create, createDevices, createSessions, createRisk, createLoginLocations, createRBAC, createStatusHistory, createAudit, createWebhooks, createOAuth, createOAuthDevice, createFederation, createPersonalTokens} {
+		if _, err := db.Exec(schema); err != nil {
+			return nil, err
+		}
+	}
+	return &Connection{
+		DB: db,
+	}, nil
 }
 
-func (c *Connection) SetFingerprint(username string, fingerprint string) (entity.User, error) {
-	user := entity.User{}
+func (c *Connection) Insert(user *entity.User) (int, error) {
+	if user.Status == "" {
+		user.Status = entity.UserStatusActive
+	}
+	if user.Source == "" {
+		user.Source = entity.UserSourceLocal
+	}
 
-	query := `SELECT * FROM users WHERE username=$1`
+	query := `INSERT INTO users (username, created_at, description, fingerprint, secret, email, status, external_id, source) VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, NULLIF($8, ''), $9) RETURNING id`
 
-	row := c.DB.QueryRow(query, username)
+	var id int
 
-	err := row.Scan(&user.Id, &user.Username, &user.CreatedAt, &user.Description, &user.Fingerprint, &user.Secret)
-
-	if errors.Is(err, sql.ErrNoRows) {
-		return entity.User{}, ErrUsernameNotFound
-	}
+	err := c.q().QueryRow(query, user.Username, user.CreatedAt, user.Description, user.Fingerprint, user.Secret, user.Email, user.Status, user.ExternalID, user.Source).Scan(&id)
 
 	if err != nil {
-		return entity.User{}, err
+		log.Printf("Unable to execute the query. %v", err)
+		return 0, err
 	}
 
-	query = `UPDATE users SET fingerprint=$1 WHERE username=$2`
-	_, err = c.DB.Exec(query, fingerprint, user.Username)
-	if err != nil {
-		return entity.User{}, err
-	}
-	return user, nil
+	log.Printf("Added user %s as %d", user.Username, id)
+	return id, nil
 }
 
 func (c *Connection) GetUser(username string) (*entity.User, error) {
 	log.Printf("Getting info for %v", username)
 
-	user := entity.User{}
-
-	query := `SELECT * FROM users WHERE username=$1`
-
-	row := c.DB.QueryRow(query, username)
+	query := `SELECT ` + userColumns + ` FROM users WHERE username=$1`
 
-	err := row.Scan(&user.Id, &user.Username, &user.CreatedAt, &user.Description, &user.Fingerprint, &user.Secret)
-
-	if errors.Is(err, sql.ErrNoRows) {
-		return nil, ErrUsernameNotFound
-	}
-
-	return &user, err
+	return scanUser(c.q().QueryRow(query, username))
 }
 
 func (c *Connection) Retrieve(id int) (*entity.User, error) {
 	log.Printf("Getting info for id: %v", id)
 
-	user := entity.User{}
+	query := `SELECT ` + userColumns + ` FROM users WHERE id=$1`
 
-	query := `SELECT * FROM users WHERE id=$1`
+	return scanUser(c.q().QueryRow(query, id))
+}
 
-	row := c.DB.QueryRow(query, id)
+func scanUser(row scanner) (*entity.User, error) {
+	user := entity.User{}
+	var email, externalID sql.NullString
+	var statusChangedAt, deletionRequestedAt, purgeAfter sql.NullTime
 
-	err := row.Scan(&user.Id, &user.Username, &user.CreatedAt, &user.Description, &user.Fingerprint, &user.Secret)
+	err := row.Scan(&user.Id, &user.Username, &user.CreatedAt, &user.Description, &user.Fingerprint, &user.Secret, &email,
+		&user.Status, &user.StatusReason, &statusChangedAt, &user.EmailVerified, &user.MFAEnabled,
+		&deletionRequestedAt, &purgeAfter, &externalID, &user.Source)
 
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, ErrUsernameNotFound
 	}
 
-	return &user, err
+	if err != nil {
+		return nil, err
+	}
+
+	user.Email = email.String
+	user.ExternalID = externalID.String
+	if statusChangedAt.Valid {
+		user.StatusChangedAt = &statusChangedAt.Time
+	}
+	if deletionRequestedAt.Valid {
+		user.DeletionRequestedAt = &deletionRequestedAt.Time
+	}
+	if purgeAfter.Valid {
+		user.PurgeAfter = &purgeAfter.Time
+	}
+	return &user, nil
 }
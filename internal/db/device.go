@@ -0,0 +1,135 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+)
+
+const createDevices string = `
+CREATE TABLE IF NOT EXISTS devices (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    fingerprint TEXT NOT NULL,
+    client_type TEXT NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    trusted BOOLEAN NOT NULL DEFAULT FALSE,
+    first_seen_at TIMESTAMP NOT NULL,
+    last_seen_at TIMESTAMP NOT NULL,
+    UNIQUE (user_id, fingerprint)
+);
+`
+
+const deviceColumns = `id, user_id, fingerprint, client_type, name, trusted, first_seen_at, last_seen_at`
+
+var ErrDeviceNotFound = errors.New("device not found")
+
+func scanDevice(row scanner) (*entity.Device, error) {
+	device := entity.Device{}
+	err := row.Scan(&device.Id, &device.UserId, &device.Fingerprint, &device.ClientType,
+		&device.Name, &device.Trusted, &device.FirstSeenAt, &device.LastSeenAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDeviceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// UpsertDevice records a sign-in from the given fingerprint. The returned flag
+// reports whether the device had never been seen before for this user.
+func (c *Connection) UpsertDevice(userId int64, fingerprint string, clientType string) (*entity.Device, bool, error) {
+	now := time.Now()
+
+	query := `INSERT INTO devices (user_id, fingerprint, client_type, first_seen_at, last_seen_at)
+		VALUES ($1, $2, $3, $4, $4)
+		ON CONFLICT (user_id, fingerprint) DO UPDATE SET last_seen_at = EXCLUDED.last_seen_at
+		RETURNING ` + deviceColumns + `, (xmax = 0)`
+
+	device := entity.Device{}
+	var created bool
+
+	err := c.q().QueryRow(query, userId, fingerprint, clientType, now).Scan(&device.Id, &device.UserId,
+		&device.Fingerprint, &device.ClientType, &device.Name, &device.Trusted,
+		&device.FirstSeenAt, &device.LastSeenAt, &created)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &device, created, nil
+}
+
+func (c *Connection) ListDevices(userId int64) ([]*entity.Device, error) {
+	query := `SELECT ` + deviceColumns + ` FROM devices WHERE user_id=$1 ORDER BY last_seen_at DESC`
+
+	rows, err := c.q().Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []*entity.Device{}
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+
+	return devices, rows.Err()
+}
+
+func (c *Connection) GetDevice(userId int64, id int64) (*entity.Device, error) {
+	query := `SELECT ` + deviceColumns + ` FROM devices WHERE user_id=$1 AND id=$2`
+	return scanDevice(c.q().QueryRow(query, userId, id))
+}
+
+func (c *Connection) GetDeviceByFingerprint(userId int64, fingerprint string) (*entity.Device, error) {
+	query := `SELECT ` + deviceColumns + ` FROM devices WHERE user_id=$1 AND fingerprint=$2`
+	return scanDevice(c.q().QueryRow(query, userId, fingerprint))
+}
+
+// UpdateDevice persists the user-editable fields of a device.
+func (c *Connection) UpdateDevice(device *entity.Device) error {
+	query := `UPDATE devices SET name=$1, trusted=$2 WHERE user_id=$3 AND id=$4`
+
+	result, err := c.q().Exec(query, device.Name, device.Trusted, device.UserId, device.Id)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result, ErrDeviceNotFound)
+}
+
+func (c *Connection) DeleteDevice(userId int64, id int64) error {
+	query := `DELETE FROM devices WHERE user_id=$1 AND id=$2`
+
+	result, err := c.q().Exec(query, userId, id)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result, ErrDeviceNotFound)
+}
+
+// expectAffected returns notFound when a statement matched no rows.
+func expectAffected(result sql.Result, notFound error) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
+
+func (c *Connection) TouchDevice(id int64) error {
+	query := `UPDATE devices SET last_seen_at=$1 WHERE id=$2`
+	_, err := c.q().Exec(query, time.Now(), id)
+	return err
+}
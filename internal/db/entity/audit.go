@@ -0,0 +1,32 @@
+package entity
+
+import "time"
+
+// AuditEvent is an entry of the append-only security audit log. ActorId is
+// zero for anonymous requests and system actions.
+type AuditEvent struct {
+	Id         int64
+	Type       string
+	Outcome    string
+	ActorId    int64
+	Actor      string
+	TargetType string
+	TargetId   string
+	IP         string
+	ClientType string
+	Details    []byte // JSON object
+	CreatedAt  time.Time
+	// PrevHash is the hash of the preceding event, Hash covers this event
+	// and PrevHash
+	PrevHash string
+	Hash     string
+}
+
+// AuditCheckpoint is a signed statement of the chain hash at an event
+type AuditCheckpoint struct {
+	Id        int64
+	EventId   int64
+	Hash      string
+	Signature []byte
+	CreatedAt time.Time
+}
@@ -0,0 +1,16 @@
+package entity
+
+import "time"
+
+// Device is a client the user has signed in from, identified by its
+// fingerprint. Trusted devices are exempt from MFA challenges.
+type Device struct {
+	Id          int64
+	UserId      int64
+	Fingerprint string
+	ClientType  string
+	Name        string
+	Trusted     bool
+	FirstSeenAt time.Time
+	LastSeenAt  time.Time
+}
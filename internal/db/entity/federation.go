@@ -0,0 +1,40 @@
+package entity
+
+import "time"
+
+// FederatedIdentity links a user to their account at an upstream identity
+// provider, which is known by the subject of its ID tokens
+type FederatedIdentity struct {
+	Id          int64
+	UserId      int64
+	Provider    string
+	Subject     string
+	Email       string
+	CreatedAt   time.Time
+	LastLoginAt *time.Time
+}
+
+// FederatedLogin tracks a sign-in at an upstream identity provider from the
+// redirect to the provider until the device that started it collects the
+// result. Only hashes of the state and the completion code are stored.
+type FederatedLogin struct {
+	Id           int64
+	StateHash    string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	// Fingerprint of the device that started the sign-in, which alone may
+	// complete it
+	Fingerprint string
+	// LinkUserId is set when a signed in user links the identity to their
+	// account instead of signing in with it
+	LinkUserId int64
+	// Set by the callback once the provider vouched for the user
+	CompletionHash    string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	CreatedAt         time.Time
+	ExpiresAt         time.Time
+}
@@ -0,0 +1,15 @@
+package entity
+
+import "time"
+
+// LoginLocation is where a completed login came from, as resolved by GeoIP
+type LoginLocation struct {
+	Id          int64
+	UserId      int64
+	IP          string
+	City        string
+	CountryCode string
+	Latitude    float64
+	Longitude   float64
+	LoggedInAt  time.Time
+}
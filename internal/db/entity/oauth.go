@@ -0,0 +1,97 @@
+package entity
+
+import "time"
+
+// OAuthClient is an application allowed to request tokens on behalf of users.
+// Redirects are only made to one of its RedirectURIs, compared exactly.
+type OAuthClient struct {
+	Id           int64
+	ClientId     string
+	Name         string
+	RedirectURIs []string
+	Scopes       []string // scopes the client may request
+	// PostLogoutRedirectURIs are where the client may send users back to
+	// after logging them out
+	PostLogoutRedirectURIs []string
+	// TokenEndpointAuthMethod is how the client authenticates at the token
+	// endpoint, "none" for public clients
+	TokenEndpointAuthMethod string
+	// SecretHash is the bcrypt hash of the client secret
+	SecretHash string
+	// JWKS holds the public keys of private_key_jwt clients
+	JWKS []byte
+	// Roles hold the permissions of tokens the client obtains for itself
+	// with the client credentials grant
+	Roles     []string
+	CreatedAt time.Time
+}
+
+// AuthorizationCode is a single-use code handed to a client at its redirect
+// URI. Only a hash of the code is stored.
+type AuthorizationCode struct {
+	CodeHash            string
+	ClientId            string
+	UserId              int64
+	RedirectURI         string
+	Scope               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+	// AuthTime is when the user last entered their credentials
+	AuthTime time.Time
+	// AuthMethod is how they did, see oidc.AuthenticationContext
+	AuthMethod string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	UsedAt     *time.Time
+	// SessionJTI is the session the code was exchanged for, revoked should
+	// the code be replayed
+	SessionJTI string
+}
+
+// RefreshToken renews the access tokens of an OAuth session. Tokens are
+// rotated on use: the old one is revoked and a new one issued.
+type RefreshToken struct {
+	Id         int64
+	TokenHash  string
+	ClientId   string
+	UserId     int64
+	SessionJTI string
+	Scope      string
+	AuthTime   time.Time
+	AuthMethod string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	RevokedAt  *time.Time
+}
+
+type DeviceGrantStatus string
+
+const (
+	DeviceGrantPending  DeviceGrantStatus = "pending"
+	DeviceGrantApproved DeviceGrantStatus = "approved"
+	DeviceGrantDenied   DeviceGrantStatus = "denied"
+	// DeviceGrantConsumed is an approved grant the device exchanged for tokens
+	DeviceGrantConsumed DeviceGrantStatus = "consumed"
+)
+
+// DeviceGrant is a device authorization request: the device polls with its
+// device code, stored hashed, while the user approves the user code
+type DeviceGrant struct {
+	Id             int64
+	DeviceCodeHash string
+	UserCode       string
+	ClientId       string
+	// Scope is what the device requested, replaced by the granted scope once
+	// the user approves
+	Scope        string
+	Status       DeviceGrantStatus
+	UserId       int64 // set once the user decided
+	AuthTime     *time.Time
+	AuthMethod   string
+	Interval     time.Duration // minimum time between two polls
+	LastPolledAt *time.Time
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+	DecidedAt    *time.Time
+}
@@ -0,0 +1,20 @@
+package entity
+
+import "time"
+
+// PersonalToken is a long-lived access token a user created for scripts and
+// other tools. Only the hash of the token is stored.
+type PersonalToken struct {
+	Id        int64
+	UserId    int64
+	Name      string
+	TokenHash string
+	// Hint is the start of the token, enough for users to recognize it
+	Hint      string
+	Scope     string
+	CreatedAt time.Time
+	// ExpiresAt is nil for tokens that do not expire
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
@@ -0,0 +1,27 @@
+package entity
+
+import "time"
+
+// RiskDecision is the recorded outcome of a risk assessment. UserId is zero
+// when the attempt could not be tied to a user.
+type RiskDecision struct {
+	Id         int64
+	UserId     int64
+	Username   string
+	Stage      string
+	IP         string
+	ClientType string
+	Score      int
+	Decision   string
+	Reasons    []byte // JSON encoded list of contributing signals
+	CreatedAt  time.Time
+}
+
+// LoginAttempt is a single username/password check, kept to measure the
+// velocity of failed logins
+type LoginAttempt struct {
+	Username    string
+	IP          string
+	Succeeded   bool
+	AttemptedAt time.Time
+}
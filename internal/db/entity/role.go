@@ -0,0 +1,19 @@
+package entity
+
+import "time"
+
+type Permission struct {
+	Id          int64
+	Name        string
+	Description string
+}
+
+type Role struct {
+	Id          int64
+	Name        string
+	Description string
+	Permissions []string
+	// Provisionable roles may be managed as groups by SCIM clients
+	Provisionable bool
+	CreatedAt     time.Time
+}
@@ -0,0 +1,25 @@
+package entity
+
+import "time"
+
+// Session is a single issued token, keyed by its JWT ID. A session with a
+// RevokedAt time was signed out and its token must no longer be accepted.
+type Session struct {
+	Id         int64
+	JTI        string
+	UserId     int64
+	ClientType string
+	IP         string
+	UserAgent  string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  *time.Time
+	// Scope is what was granted when the session started. Tokens of the
+	// session cannot carry scopes beyond it.
+	Scope string
+	// ClientId is the OAuth client of sessions started by an OAuth grant
+	ClientId string
+	// AuthMethod is how the user signed in, see oidc.AuthenticationContext
+	AuthMethod string
+}
@@ -3,10 +3,67 @@ package entity
 import "time"
 
 type User struct {
-	Id          int64
-	Username    string
-	CreatedAt   time.Time
-	Description string
-	Fingerprint string
-	Secret      string
+	Id              int64
+	Username        string
+	CreatedAt       time.Time
+	Description     string
+	Fingerprint     string
+	Secret          string
+	Email           string
+	EmailVerified   bool
+	MFAEnabled      bool
+	Status          UserStatus
+	StatusReason    string
+	StatusChangedAt *time.Time
+	// Set while a self-service deletion is pending; the account is purged
+	// once PurgeAfter has passed
+	DeletionRequestedAt *time.Time
+	PurgeAfter          *time.Time
+	// ExternalID is the identifier a provisioning client knows the user by
+	ExternalID string
+	// Source is where the account comes from. Only local accounts sign in
+	// with a password checked by this service; those provisioned by a
+	// directory carry the name of its authenticator, e.g. ldap.
+	Source UserSource
+}
+
+type UserSource string
+
+const (
+	UserSourceLocal UserSource = "local"
+	// UserSourceFederated accounts were created on first sign-in at an
+	// external identity provider
+	UserSourceFederated UserSource = "federated"
+	// UserSourceSCIM accounts were created by a SCIM provisioning client,
+	// which is the only one allowed to change them through SCIM
+	UserSourceSCIM UserSource = "scim"
+)
+
+type UserStatus string
+
+const (
+	UserStatusPending   UserStatus = "pending"
+	UserStatusActive    UserStatus = "active"
+	UserStatusSuspended UserStatus = "suspended"
+	UserStatusDeleted   UserStatus = "deleted"
+)
+
+func (s UserStatus) IsValid() bool {
+	switch s {
+	case UserStatusPending, UserStatusActive, UserStatusSuspended, UserStatusDeleted:
+		return true
+	default:
+		return false
+	}
+}
+
+// StatusChange is an entry of a user's status history
+type StatusChange struct {
+	Id        int64
+	UserId    int64
+	From      UserStatus
+	To        UserStatus
+	Reason    string
+	ChangedBy string
+	ChangedAt time.Time
 }
@@ -0,0 +1,56 @@
+package entity
+
+import "time"
+
+// WebhookSubscription receives the events listed in Events, or every event
+// when the list is empty
+type WebhookSubscription struct {
+	Id          int64
+	URL         string
+	Events      []string
+	Secret      string
+	Description string
+	Active      bool
+	CreatedAt   time.Time
+}
+
+// OutboxEvent is an event written in the same transaction as the change it
+// describes, waiting to be fanned out to subscriptions
+type OutboxEvent struct {
+	Id           int64
+	EventId      string
+	Type         string
+	Payload      []byte // JSON envelope as posted to receivers
+	OccurredAt   time.Time
+	DispatchedAt *time.Time
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryDead is a delivery that ran out of attempts
+	DeliveryDead DeliveryStatus = "dead"
+)
+
+// WebhookDelivery is one event to be posted to one subscription
+type WebhookDelivery struct {
+	Id             int64
+	SubscriptionId int64
+	OutboxEventId  int64
+	Status         DeliveryStatus
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastError      string
+	LastStatusCode int
+	CreatedAt      time.Time
+	DeliveredAt    *time.Time
+
+	// Joined from the subscription and the event for sending
+	URL       string
+	Secret    string
+	EventId   string
+	EventType string
+	Payload   []byte
+}
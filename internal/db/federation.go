@@ -0,0 +1,205 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+)
+
+const createFederation string = `
+CREATE TABLE IF NOT EXISTS federated_identities (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT NULL,
+    created_at TIMESTAMP NOT NULL,
+    last_login_at TIMESTAMP NULL,
+    UNIQUE (provider, subject),
+    UNIQUE (user_id, provider)
+);
+
+CREATE TABLE IF NOT EXISTS federated_logins (
+    id BIGSERIAL PRIMARY KEY,
+    state_hash TEXT UNIQUE NOT NULL,
+    provider TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    fingerprint TEXT NOT NULL,
+    link_user_id INTEGER NULL REFERENCES users(id) ON DELETE CASCADE,
+    completion_hash TEXT UNIQUE NULL,
+    subject TEXT NULL,
+    email TEXT NULL,
+    email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+    preferred_username TEXT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+`
+
+var (
+	ErrFederatedLoginNotFound    = errors.New("federated login not found")
+	ErrFederatedIdentityNotFound = errors.New("federated identity not found")
+	ErrFederatedIdentityExists   = errors.New("federated identity already linked")
+)
+
+const federatedIdentityColumns = `id, user_id, provider, subject, email, created_at, last_login_at`
+
+func scanFederatedIdentity(row scanner) (*entity.FederatedIdentity, error) {
+	identity := entity.FederatedIdentity{}
+	var email sql.NullString
+	var lastLoginAt sql.NullTime
+
+	err := row.Scan(&identity.Id, &identity.UserId, &identity.Provider, &identity.Subject, &email,
+		&identity.CreatedAt, &lastLoginAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrFederatedIdentityNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	identity.Email = email.String
+	if lastLoginAt.Valid {
+		identity.LastLoginAt = &lastLoginAt.Time
+	}
+	return &identity, nil
+}
+
+func (c *Connection) GetFederatedIdentity(provider string, subject string) (*entity.FederatedIdentity, error) {
+	query := `SELECT ` + federatedIdentityColumns + ` FROM federated_identities WHERE provider=$1 AND subject=$2`
+	return scanFederatedIdentity(c.q().QueryRow(query, provider, subject))
+}
+
+func (c *Connection) ListFederatedIdentities(userId int64) ([]*entity.FederatedIdentity, error) {
+	query := `SELECT ` + federatedIdentityColumns + ` FROM federated_identities WHERE user_id=$1 ORDER BY provider`
+
+	rows, err := c.q().Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []*entity.FederatedIdentity{}
+	for rows.Next() {
+		identity, err := scanFederatedIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+// CreateFederatedIdentity links an identity to a user. An identity belongs to
+// one user only, and a user has at most one identity per provider.
+func (c *Connection) CreateFederatedIdentity(identity *entity.FederatedIdentity) error {
+	query := `INSERT INTO federated_identities (user_id, provider, subject, email, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5) RETURNING id`
+
+	err := c.q().QueryRow(query, identity.UserId, identity.Provider, identity.Subject, identity.Email,
+		identity.CreatedAt).Scan(&identity.Id)
+	if isUniqueViolation(err) {
+		return ErrFederatedIdentityExists
+	}
+	return err
+}
+
+// TouchFederatedIdentity records a sign-in with the identity and the email
+// address the provider now reports
+func (c *Connection) TouchFederatedIdentity(id int64, email string, at time.Time) error {
+	query := `UPDATE federated_identities SET last_login_at=$1, email=NULLIF($2, '') WHERE id=$3`
+
+	result, err := c.q().Exec(query, at, email, id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrFederatedIdentityNotFound)
+}
+
+func (c *Connection) DeleteFederatedIdentity(userId int64, provider string) error {
+	result, err := c.q().Exec(`DELETE FROM federated_identities WHERE user_id=$1 AND provider=$2`, userId, provider)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrFederatedIdentityNotFound)
+}
+
+const federatedLoginColumns = `id, state_hash, provider, nonce, code_verifier, fingerprint, link_user_id,
+	completion_hash, subject, email, email_verified, preferred_username, created_at, expires_at`
+
+func scanFederatedLogin(row scanner) (*entity.FederatedLogin, error) {
+	login := entity.FederatedLogin{}
+	var linkUserId sql.NullInt64
+	var completionHash, subject, email, preferredUsername sql.NullString
+
+	err := row.Scan(&login.Id, &login.StateHash, &login.Provider, &login.Nonce, &login.CodeVerifier,
+		&login.Fingerprint, &linkUserId, &completionHash, &subject, &email, &login.EmailVerified,
+		&preferredUsername, &login.CreatedAt, &login.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrFederatedLoginNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	login.LinkUserId = linkUserId.Int64
+	login.CompletionHash = completionHash.String
+	login.Subject = subject.String
+	login.Email = email.String
+	login.PreferredUsername = preferredUsername.String
+	return &login, nil
+}
+
+// CreateFederatedLogin stores a sign-in that is about to be sent to the
+// provider, clearing out those that expired
+func (c *Connection) CreateFederatedLogin(login *entity.FederatedLogin) error {
+	tx, err := c.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM federated_logins WHERE expires_at < $1`, login.CreatedAt); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO federated_logins (state_hash, provider, nonce, code_verifier, fingerprint, link_user_id,
+		created_at, expires_at) VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), $7, $8) RETURNING id`
+
+	err = tx.QueryRow(query, login.StateHash, login.Provider, login.Nonce, login.CodeVerifier, login.Fingerprint,
+		login.LinkUserId, login.CreatedAt, login.ExpiresAt).Scan(&login.Id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c *Connection) GetFederatedLogin(stateHash string) (*entity.FederatedLogin, error) {
+	query := `SELECT ` + federatedLoginColumns + ` FROM federated_logins WHERE state_hash=$1`
+	return scanFederatedLogin(c.q().QueryRow(query, stateHash))
+}
+
+// CompleteFederatedLogin stores the identity the provider returned. A state
+// is only accepted once.
+func (c *Connection) CompleteFederatedLogin(login *entity.FederatedLogin) error {
+	query := `UPDATE federated_logins SET completion_hash=$1, subject=$2, email=NULLIF($3, ''), email_verified=$4,
+		preferred_username=NULLIF($5, '') WHERE id=$6 AND completion_hash IS NULL`
+
+	result, err := c.q().Exec(query, login.CompletionHash, login.Subject, login.Email, login.EmailVerified,
+		login.PreferredUsername, login.Id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrFederatedLoginNotFound)
+}
+
+// ConsumeFederatedLogin removes and returns the completed sign-in of a
+// completion code that has not expired. Only the first call succeeds.
+func (c *Connection) ConsumeFederatedLogin(completionHash string, at time.Time) (*entity.FederatedLogin, error) {
+	query := `DELETE FROM federated_logins WHERE completion_hash=$1 AND expires_at > $2
+		RETURNING ` + federatedLoginColumns
+	return scanFederatedLogin(c.q().QueryRow(query, completionHash, at))
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+)
+
+const createLoginLocations string = `
+CREATE TABLE IF NOT EXISTS login_locations (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ip TEXT NOT NULL,
+    city TEXT NOT NULL,
+    country_code TEXT NOT NULL,
+    latitude DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    logged_in_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS login_locations_user_id_idx ON login_locations (user_id, logged_in_at);
+`
+
+func (c *Connection) InsertLoginLocation(location *entity.LoginLocation) error {
+	query := `INSERT INTO login_locations (user_id, ip, city, country_code, latitude, longitude, logged_in_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+
+	return c.q().QueryRow(query, location.UserId, location.IP, location.City, location.CountryCode,
+		location.Latitude, location.Longitude, location.LoggedInAt).Scan(&location.Id)
+}
+
+// LastLoginLocation returns the location of the most recent completed login,
+// or nil when no login of the user was located yet
+func (c *Connection) LastLoginLocation(userId int64) (*entity.LoginLocation, error) {
+	query := `SELECT id, user_id, ip, city, country_code, latitude, longitude, logged_in_at
+		FROM login_locations WHERE user_id=$1 ORDER BY logged_in_at DESC LIMIT 1`
+
+	location := entity.LoginLocation{}
+	err := c.q().QueryRow(query, userId).Scan(&location.Id, &location.UserId, &location.IP, &location.City,
+		&location.CountryCode, &location.Latitude, &location.Longitude, &location.LoggedInAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &location, nil
+}
+
+// ListLoginLocations returns all recorded login locations of a user
+func (c *Connection) ListLoginLocations(userId int64) ([]*entity.LoginLocation, error) {
+	query := `SELECT id, user_id, ip, city, country_code, latitude, longitude, logged_in_at
+		FROM login_locations WHERE user_id=$1 ORDER BY logged_in_at DESC`
+
+	rows, err := c.q().Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locations := []*entity.LoginLocation{}
+	for rows.Next() {
+		location := entity.LoginLocation{}
+		err := rows.Scan(&location.Id, &location.UserId, &location.IP, &location.City,
+			&location.CountryCode, &location.Latitude, &location.Longitude, &location.LoggedInAt)
+		if err != nil {
+			return nil, err
+		}
+		locations = append(locations, &location)
+	}
+
+	return locations, rows.Err()
+}
@@ -0,0 +1,299 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/lib/pq"
+)
+
+const createOAuth string = `
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id SERIAL PRIMARY KEY,
+    client_id TEXT UNIQUE NOT NULL,
+    name TEXT NOT NULL,
+    redirect_uris TEXT[] NOT NULL,
+    scopes TEXT[] NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    post_logout_redirect_uris TEXT[] NOT NULL DEFAULT '{}',
+    token_endpoint_auth_method TEXT NOT NULL DEFAULT 'none',
+    secret_hash TEXT NOT NULL DEFAULT '',
+    jwks JSONB NULL,
+    roles TEXT[] NOT NULL DEFAULT '{}'
+);
+
+CREATE TABLE IF NOT EXISTS oauth_codes (
+    code_hash TEXT PRIMARY KEY,
+    client_id TEXT NOT NULL REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scope TEXT NOT NULL,
+    code_challenge TEXT NOT NULL,
+    code_challenge_method TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    session_jti TEXT NOT NULL DEFAULT '',
+    nonce TEXT NOT NULL DEFAULT '',
+    auth_time TIMESTAMP NULL,
+    auth_method TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS oauth_refresh_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    token_hash TEXT UNIQUE NOT NULL,
+    client_id TEXT NOT NULL REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    session_jti TEXT NOT NULL,
+    scope TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP NULL,
+    auth_time TIMESTAMP NULL,
+    auth_method TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS oauth_refresh_tokens_session_idx ON oauth_refresh_tokens (session_jti);
+
+CREATE TABLE IF NOT EXISTS oauth_client_assertions (
+    client_id TEXT NOT NULL REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+    jti TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (client_id, jti)
+);
+`
+
+var (
+	ErrClientNotFound       = errors.New("oauth client not found")
+	ErrCodeNotFound         = errors.New("authorization code not found")
+	ErrCodeUsed             = errors.New("authorization code already used")
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrAssertionReplayed    = errors.New("client assertion already used")
+)
+
+const clientColumns = `id, client_id, name, redirect_uris, scopes, post_logout_redirect_uris,
+	token_endpoint_auth_method, secret_hash, jwks, roles, created_at`
+
+func scanClient(row scanner) (*entity.OAuthClient, error) {
+	client := entity.OAuthClient{}
+	var jwks sql.NullString
+
+	err := row.Scan(&client.Id, &client.ClientId, &client.Name, pq.Array(&client.RedirectURIs),
+		pq.Array(&client.Scopes), pq.Array(&client.PostLogoutRedirectURIs), &client.TokenEndpointAuthMethod,
+		&client.SecretHash, &jwks, pq.Array(&client.Roles), &client.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrClientNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if jwks.Valid {
+		client.JWKS = []byte(jwks.String)
+	}
+	return &client, nil
+}
+
+func (c *Connection) CreateClient(client *entity.OAuthClient) error {
+	query := `INSERT INTO oauth_clients (client_id, name, redirect_uris, scopes, post_logout_redirect_uris,
+		token_endpoint_auth_method, secret_hash, jwks, roles, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, '')::jsonb, $9, $10) RETURNING id`
+
+	return c.q().QueryRow(query, client.ClientId, client.Name, pq.Array(client.RedirectURIs),
+		pq.Array(client.Scopes), pq.Array(client.PostLogoutRedirectURIs), client.TokenEndpointAuthMethod,
+		client.SecretHash, string(client.JWKS), pq.Array(client.Roles), client.CreatedAt).Scan(&client.Id)
+}
+
+func (c *Connection) ListClients() ([]*entity.OAuthClient, error) {
+	rows, err := c.q().Query(`SELECT ` + clientColumns + ` FROM oauth_clients ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []*entity.OAuthClient{}
+	for rows.Next() {
+		client, err := scanClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+
+	return clients, rows.Err()
+}
+
+func (c *Connection) GetClient(clientId string) (*entity.OAuthClient, error) {
+	query := `SELECT ` + clientColumns + ` FROM oauth_clients WHERE client_id=$1`
+	return scanClient(c.q().QueryRow(query, clientId))
+}
+
+func (c *Connection) UpdateClient(client *entity.OAuthClient) error {
+	query := `UPDATE oauth_clients SET name=$1, redirect_uris=$2, scopes=$3, post_logout_redirect_uris=$4,
+		jwks=NULLIF($5, '')::jsonb, roles=$6 WHERE client_id=$7`
+
+	result, err := c.q().Exec(query, client.Name, pq.Array(client.RedirectURIs), pq.Array(client.Scopes),
+		pq.Array(client.PostLogoutRedirectURIs), string(client.JWKS), pq.Array(client.Roles), client.ClientId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrClientNotFound)
+}
+
+// SetClientSecret replaces the secret of a client, the old one stops working
+func (c *Connection) SetClientSecret(clientId string, secretHash string) error {
+	result, err := c.q().Exec(`UPDATE oauth_clients SET secret_hash=$1 WHERE client_id=$2`, secretHash, clientId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrClientNotFound)
+}
+
+// UseClientAssertion records the ID of a client assertion until it expires,
+// failing with ErrAssertionReplayed if it was recorded before
+func (c *Connection) UseClientAssertion(clientId string, jti string, expiresAt time.Time, now time.Time) error {
+	if _, err := c.q().Exec(`DELETE FROM oauth_client_assertions WHERE expires_at < $1`, now); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO oauth_client_assertions (client_id, jti, expires_at) VALUES ($1, $2, $3)`
+	if _, err := c.q().Exec(query, clientId, jti, expiresAt); err != nil {
+		if isUniqueViolation(err) {
+			return ErrAssertionReplayed
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteClient removes a client together with its codes and refresh tokens
+func (c *Connection) DeleteClient(clientId string) error {
+	result, err := c.q().Exec(`DELETE FROM oauth_clients WHERE client_id=$1`, clientId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrClientNotFound)
+}
+
+func (c *Connection) CreateAuthorizationCode(code *entity.AuthorizationCode) error {
+	query := `INSERT INTO oauth_codes (code_hash, client_id, user_id, redirect_uri, scope, code_challenge,
+		code_challenge_method, nonce, auth_time, auth_method, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+
+	_, err := c.q().Exec(query, code.CodeHash, code.ClientId, code.UserId, code.RedirectURI, code.Scope,
+		code.CodeChallenge, code.CodeChallengeMethod, code.Nonce, code.AuthTime, code.AuthMethod, code.CreatedAt, code.ExpiresAt)
+	return err
+}
+
+const codeColumns = `code_hash, client_id, user_id, redirect_uri, scope, code_challenge, code_challenge_method,
+	nonce, COALESCE(auth_time, created_at), auth_method, created_at, expires_at, used_at, session_jti`
+
+func scanCode(row scanner) (*entity.AuthorizationCode, error) {
+	code := entity.AuthorizationCode{}
+	var usedAt sql.NullTime
+
+	err := row.Scan(&code.CodeHash, &code.ClientId, &code.UserId, &code.RedirectURI, &code.Scope,
+		&code.CodeChallenge, &code.CodeChallengeMethod, &code.Nonce, &code.AuthTime, &code.AuthMethod, &code.CreatedAt, &code.ExpiresAt,
+		&usedAt, &code.SessionJTI)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCodeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if usedAt.Valid {
+		code.UsedAt = &usedAt.Time
+	}
+	return &code, nil
+}
+
+// ConsumeAuthorizationCode marks a code used and returns it. Only the first
+// call succeeds, later ones return the code along with ErrCodeUsed so the
+// caller can react to the replay.
+func (c *Connection) ConsumeAuthorizationCode(codeHash string, now time.Time) (*entity.AuthorizationCode, error) {
+	query := `UPDATE oauth_codes SET used_at=$1 WHERE code_hash=$2 AND used_at IS NULL
+		RETURNING ` + codeColumns
+
+	code, err := scanCode(c.q().QueryRow(query, now, codeHash))
+	if !errors.Is(err, ErrCodeNotFound) {
+		return code, err
+	}
+
+	code, err = scanCode(c.q().QueryRow(`SELECT `+codeColumns+` FROM oauth_codes WHERE code_hash=$1`, codeHash))
+	if err != nil {
+		return nil, err
+	}
+	return code, ErrCodeUsed
+}
+
+// SetCodeSession records the session an authorization code was exchanged for
+func (c *Connection) SetCodeSession(codeHash string, sessionJTI string) error {
+	result, err := c.q().Exec(`UPDATE oauth_codes SET session_jti=$1 WHERE code_hash=$2`, sessionJTI, codeHash)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrCodeNotFound)
+}
+
+func (c *Connection) CreateRefreshToken(token *entity.RefreshToken) error {
+	query := `INSERT INTO oauth_refresh_tokens (token_hash, client_id, user_id, session_jti, scope, auth_time,
+		auth_method, created_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`
+
+	return c.q().QueryRow(query, token.TokenHash, token.ClientId, token.UserId, token.SessionJTI, token.Scope,
+		token.AuthTime, token.AuthMethod, token.CreatedAt, token.ExpiresAt).Scan(&token.Id)
+}
+
+func (c *Connection) GetRefreshToken(tokenHash string) (*entity.RefreshToken, error) {
+	query := `SELECT id, token_hash, client_id, user_id, session_jti, scope, COALESCE(auth_time, created_at),
+		auth_method, created_at, expires_at, revoked_at FROM oauth_refresh_tokens WHERE token_hash=$1`
+
+	token := entity.RefreshToken{}
+	var revokedAt sql.NullTime
+
+	err := c.q().QueryRow(query, tokenHash).Scan(&token.Id, &token.TokenHash, &token.ClientId, &token.UserId,
+		&token.SessionJTI, &token.Scope, &token.AuthTime, &token.AuthMethod, &token.CreatedAt, &token.ExpiresAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return &token, nil
+}
+
+// RevokeRefreshToken revokes a token unless that already happened, in which
+// case ErrRefreshTokenNotFound is returned
+func (c *Connection) RevokeRefreshToken(id int64, at time.Time) error {
+	result, err := c.q().Exec(`UPDATE oauth_refresh_tokens SET revoked_at=$1 WHERE id=$2 AND revoked_at IS NULL`, at, id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrRefreshTokenNotFound)
+}
+
+// RevokeOAuthSession signs out the session with the given JWT ID and revokes
+// every refresh token issued for it
+func (c *Connection) RevokeOAuthSession(sessionJTI string, at time.Time) error {
+	tx, err := c.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE sessions SET revoked_at=$1 WHERE jti=$2 AND revoked_at IS NULL`, at, sessionJTI); err != nil {
+		return err
+	}
+
+	query := `UPDATE oauth_refresh_tokens SET revoked_at=$1 WHERE session_jti=$2 AND revoked_at IS NULL`
+	if _, err := tx.Exec(query, at, sessionJTI); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
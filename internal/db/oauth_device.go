@@ -0,0 +1,140 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+)
+
+const createOAuthDevice string = `
+CREATE TABLE IF NOT EXISTS oauth_device_grants (
+    id BIGSERIAL PRIMARY KEY,
+    device_code_hash TEXT UNIQUE NOT NULL,
+    user_code TEXT UNIQUE NOT NULL,
+    client_id TEXT NOT NULL REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+    scope TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    user_id INTEGER NULL REFERENCES users(id) ON DELETE CASCADE,
+    auth_time TIMESTAMP NULL,
+    interval_seconds INTEGER NOT NULL,
+    last_polled_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    decided_at TIMESTAMP NULL,
+    auth_method TEXT NOT NULL DEFAULT ''
+);
+`
+
+var (
+	ErrDeviceGrantNotFound = errors.New("device authorization not found")
+	ErrUserCodeExists      = errors.New("user code already in use")
+)
+
+// deviceGrantRetention is how long expired device grants are kept so polling
+// devices learn that their code expired rather than that it is unknown
+const deviceGrantRetention = 24 * time.Hour
+
+const deviceGrantColumns = `id, device_code_hash, user_code, client_id, scope, status, user_id, auth_time,
+	auth_method, interval_seconds, last_polled_at, created_at, expires_at, decided_at`
+
+func scanDeviceGrant(row scanner) (*entity.DeviceGrant, error) {
+	grant := entity.DeviceGrant{}
+	var userId sql.NullInt64
+	var authTime, lastPolledAt, decidedAt sql.NullTime
+	var interval int
+
+	err := row.Scan(&grant.Id, &grant.DeviceCodeHash, &grant.UserCode, &grant.ClientId, &grant.Scope, &grant.Status,
+		&userId, &authTime, &grant.AuthMethod, &interval, &lastPolledAt, &grant.CreatedAt, &grant.ExpiresAt, &decidedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDeviceGrantNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	grant.UserId = userId.Int64
+	grant.Interval = time.Duration(interval) * time.Second
+	if authTime.Valid {
+		grant.AuthTime = &authTime.Time
+	}
+	if lastPolledAt.Valid {
+		grant.LastPolledAt = &lastPolledAt.Time
+	}
+	if decidedAt.Valid {
+		grant.DecidedAt = &decidedAt.Time
+	}
+	return &grant, nil
+}
+
+// CreateDeviceGrant stores a new device authorization request, clearing out
+// those that expired a while ago
+func (c *Connection) CreateDeviceGrant(grant *entity.DeviceGrant) error {
+	tx, err := c.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM oauth_device_grants WHERE expires_at < $1`, grant.CreatedAt.Add(-deviceGrantRetention)); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO oauth_device_grants (device_code_hash, user_code, client_id, scope, status, interval_seconds,
+		created_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+
+	err = tx.QueryRow(query, grant.DeviceCodeHash, grant.UserCode, grant.ClientId, grant.Scope, grant.Status,
+		int(grant.Interval.Seconds()), grant.CreatedAt, grant.ExpiresAt).Scan(&grant.Id)
+	if isUniqueViolation(err) {
+		return ErrUserCodeExists
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c *Connection) GetDeviceGrant(deviceCodeHash string) (*entity.DeviceGrant, error) {
+	query := `SELECT ` + deviceGrantColumns + ` FROM oauth_device_grants WHERE device_code_hash=$1`
+	return scanDeviceGrant(c.q().QueryRow(query, deviceCodeHash))
+}
+
+func (c *Connection) GetDeviceGrantByUserCode(userCode string) (*entity.DeviceGrant, error) {
+	query := `SELECT ` + deviceGrantColumns + ` FROM oauth_device_grants WHERE user_code=$1`
+	return scanDeviceGrant(c.q().QueryRow(query, userCode))
+}
+
+// DecideDeviceGrant records the user's decision on a pending grant that has
+// not expired. Approving replaces the requested scope with the granted one.
+func (c *Connection) DecideDeviceGrant(grant *entity.DeviceGrant, at time.Time) error {
+	query := `UPDATE oauth_device_grants SET status=$1, user_id=$2, scope=$3, auth_time=$4, auth_method=$5,
+		decided_at=$6 WHERE id=$7 AND status='pending' AND expires_at > $6`
+
+	result, err := c.q().Exec(query, grant.Status, grant.UserId, grant.Scope, grant.AuthTime, grant.AuthMethod, at, grant.Id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrDeviceGrantNotFound)
+}
+
+// PollDeviceGrant records a poll of the device and its polling interval
+func (c *Connection) PollDeviceGrant(id int64, interval time.Duration, at time.Time) error {
+	query := `UPDATE oauth_device_grants SET last_polled_at=$1, interval_seconds=$2 WHERE id=$3`
+
+	result, err := c.q().Exec(query, at, int(interval.Seconds()), id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrDeviceGrantNotFound)
+}
+
+// ConsumeDeviceGrant marks an approved grant as exchanged for tokens. Only the
+// first call succeeds.
+func (c *Connection) ConsumeDeviceGrant(id int64) error {
+	result, err := c.q().Exec(`UPDATE oauth_device_grants SET status='consumed' WHERE id=$1 AND status='approved'`, id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrDeviceGrantNotFound)
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+)
+
+const createPersonalTokens string = `
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    token_hash TEXT UNIQUE NOT NULL,
+    hint TEXT NOT NULL,
+    scope TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NULL,
+    last_used_at TIMESTAMP NULL,
+    revoked_at TIMESTAMP NULL
+);
+CREATE INDEX IF NOT EXISTS personal_access_tokens_user_idx ON personal_access_tokens (user_id);
+`
+
+var ErrPersonalTokenNotFound = errors.New("personal access token not found")
+
+// personalTokenTouchInterval is how often the last use of a token is written
+const personalTokenTouchInterval = time.Minute
+
+const personalTokenColumns = `id, user_id, name, token_hash, hint, scope, created_at, expires_at, last_used_at, revoked_at`
+
+func scanPersonalToken(row scanner) (*entity.PersonalToken, error) {
+	token := entity.PersonalToken{}
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+
+	err := row.Scan(&token.Id, &token.UserId, &token.Name, &token.TokenHash, &token.Hint, &token.Scope,
+		&token.CreatedAt, &expiresAt, &lastUsedAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPersonalTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return &token, nil
+}
+
+func (c *Connection) CreatePersonalToken(token *entity.PersonalToken) error {
+	query := `INSERT INTO personal_access_tokens (user_id, name, token_hash, hint, scope, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+
+	return c.q().QueryRow(query, token.UserId, token.Name, token.TokenHash, token.Hint, token.Scope,
+		token.CreatedAt, token.ExpiresAt).Scan(&token.Id)
+}
+
+func (c *Connection) GetPersonalTokenByHash(tokenHash string) (*entity.PersonalToken, error) {
+	query := `SELECT ` + personalTokenColumns + ` FROM personal_access_tokens WHERE token_hash=$1`
+	return scanPersonalToken(c.q().QueryRow(query, tokenHash))
+}
+
+// ListPersonalTokens returns the tokens of a user that were not revoked,
+// newest first. Expired tokens are included until they are revoked.
+func (c *Connection) ListPersonalTokens(userId int64) ([]*entity.PersonalToken, error) {
+	query := `SELECT ` + personalTokenColumns + ` FROM personal_access_tokens
+		WHERE user_id=$1 AND revoked_at IS NULL ORDER BY created_at DESC, id DESC`
+
+	rows, err := c.q().Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*entity.PersonalToken{}
+	for rows.Next() {
+		token, err := scanPersonalToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// RevokePersonalToken revokes a token of a user. Tokens that are already
+// revoked are reported as not found.
+func (c *Connection) RevokePersonalToken(userId int64, id int64, at time.Time) error {
+	query := `UPDATE personal_access_tokens SET revoked_at=$1 WHERE user_id=$2 AND id=$3 AND revoked_at IS NULL`
+
+	result, err := c.q().Exec(query, at, userId, id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrPersonalTokenNotFound)
+}
+
+// RevokeAllPersonalTokens revokes every token of a user and returns how many
+// were still active
+func (c *Connection) RevokeAllPersonalTokens(userId int64, at time.Time) (int64, error) {
+	query := `UPDATE personal_access_tokens SET revoked_at=$1 WHERE user_id=$2 AND revoked_at IS NULL`
+
+	result, err := c.q().Exec(query, at, userId)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// TouchPersonalToken records the use of a token. A token in constant use is
+// only written once per personalTokenTouchInterval.
+func (c *Connection) TouchPersonalToken(id int64, at time.Time) error {
+	query := `UPDATE personal_access_tokens SET last_used_at=$1
+		WHERE id=$2 AND (last_used_at IS NULL OR last_used_at < $3)`
+
+	_, err := c.q().Exec(query, at, id, at.Add(-personalTokenTouchInterval))
+	return err
+}
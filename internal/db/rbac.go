@@ -0,0 +1,348 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/lib/pq"
+)
+
+const createRBAC string = `
+CREATE TABLE IF NOT EXISTS permissions (
+    id SERIAL PRIMARY KEY,
+    name TEXT UNIQUE NOT NULL,
+    description TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS roles (
+    id SERIAL PRIMARY KEY,
+    name TEXT UNIQUE NOT NULL,
+    description TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    provisionable BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission_id INTEGER NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    assigned_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, role_id)
+);
+`
+
+var (
+	ErrRoleNotFound       = errors.New("role not found")
+	ErrRoleExists         = errors.New("role already exists")
+	ErrPermissionNotFound = errors.New("permission not found")
+	ErrPermissionExists   = errors.New("permission already exists")
+)
+
+// isUniqueViolation reports whether err is a PostgreSQL unique constraint error
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// EnsurePermission creates a permission unless one with that name exists
+func (c *Connection) EnsurePermission(name string, description string) error {
+	query := `INSERT INTO permissions (name, description) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING`
+	_, err := c.q().Exec(query, name, description)
+	return err
+}
+
+func (c *Connection) CreatePermission(permission *entity.Permission) error {
+	query := `INSERT INTO permissions (name, description) VALUES ($1, $2) RETURNING id`
+
+	err := c.q().QueryRow(query, permission.Name, permission.Description).Scan(&permission.Id)
+	if isUniqueViolation(err) {
+		return ErrPermissionExists
+	}
+	return err
+}
+
+func (c *Connection) ListPermissions() ([]*entity.Permission, error) {
+	rows, err := c.q().Query(`SELECT id, name, description FROM permissions ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []*entity.Permission{}
+	for rows.Next() {
+		permission := entity.Permission{}
+		if err := rows.Scan(&permission.Id, &permission.Name, &permission.Description); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, &permission)
+	}
+
+	return permissions, rows.Err()
+}
+
+const roleQuery = `SELECT r.id, r.name, r.description, r.provisionable, r.created_at,
+		COALESCE(array_agg(p.name ORDER BY p.name) FILTER (WHERE p.name IS NOT NULL), '{}')
+	FROM roles r
+	LEFT JOIN role_permissions rp ON rp.role_id = r.id
+	LEFT JOIN permissions p ON p.id = rp.permission_id`
+
+func scanRole(row scanner) (*entity.Role, error) {
+	role := entity.Role{}
+	var permissions pq.StringArray
+
+	err := row.Scan(&role.Id, &role.Name, &role.Description, &role.Provisionable, &role.CreatedAt, &permissions)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRoleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	role.Permissions = permissions
+	return &role, nil
+}
+
+func (c *Connection) ListRoles() ([]*entity.Role, error) {
+	rows, err := c.q().Query(roleQuery + ` GROUP BY r.id ORDER BY r.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*entity.Role{}
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+func (c *Connection) GetRole(name string) (*entity.Role, error) {
+	return scanRole(c.q().QueryRow(roleQuery+` WHERE r.name=$1 GROUP BY r.id`, name))
+}
+
+// CreateRole inserts a role together with its permissions
+func (c *Connection) CreateRole(role *entity.Role) error {
+	tx, err := c.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	role.CreatedAt = time.Now()
+	query := `INSERT INTO roles (name, description, provisionable, created_at) VALUES ($1, $2, $3, $4) RETURNING id`
+
+	err = tx.QueryRow(query, role.Name, role.Description, role.Provisionable, role.CreatedAt).Scan(&role.Id)
+	if isUniqueViolation(err) {
+		return ErrRoleExists
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := setRolePermissions(tx.Tx, role.Id, role.Permissions); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateRole replaces the description, permissions and provisioning flag of a
+// role
+func (c *Connection) UpdateRole(role *entity.Role) error {
+	tx, err := c.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE roles SET description=$1, provisionable=$2 WHERE id=$3`, role.Description, role.Provisionable, role.Id)
+	if err != nil {
+		return err
+	}
+	if err := expectAffected(result, ErrRoleNotFound); err != nil {
+		return err
+	}
+
+	if err := setRolePermissions(tx.Tx, role.Id, role.Permissions); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func setRolePermissions(tx *sql.Tx, roleId int64, permissions []string) error {
+	if _, err := tx.Exec(`DELETE FROM role_permissions WHERE role_id=$1`, roleId); err != nil {
+		return err
+	}
+
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	query := `INSERT INTO role_permissions (role_id, permission_id)
+		SELECT $1, id FROM permissions WHERE name = ANY($2)`
+
+	result, err := tx.Exec(query, roleId, pq.Array(permissions))
+	if err != nil {
+		return err
+	}
+
+	unique := map[string]bool{}
+	for _, name := range permissions {
+		unique[name] = true
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if int(n) != len(unique) {
+		return ErrPermissionNotFound
+	}
+	return nil
+}
+
+// EnsureRole creates a role with the given permissions unless it exists
+func (c *Connection) EnsureRole(role *entity.Role) error {
+	existing, err := c.GetRole(role.Name)
+	if err == nil {
+		role.Id = existing.Id
+		return nil
+	}
+	if !errors.Is(err, ErrRoleNotFound) {
+		return err
+	}
+
+	err = c.CreateRole(role)
+	if errors.Is(err, ErrRoleExists) {
+		return nil
+	}
+	return err
+}
+
+func (c *Connection) DeleteRole(name string) error {
+	result, err := c.q().Exec(`DELETE FROM roles WHERE name=$1`, name)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrRoleNotFound)
+}
+
+// GetUserRoles returns the names of the roles assigned to a user
+func (c *Connection) GetUserRoles(userId int64) ([]string, error) {
+	query := `SELECT r.name FROM user_roles ur JOIN roles r ON r.id = ur.role_id
+		WHERE ur.user_id=$1 ORDER BY r.name`
+
+	rows, err := c.q().Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		roles = append(roles, name)
+	}
+
+	return roles, rows.Err()
+}
+
+// ListRoleMembers returns the users a role is assigned to
+func (c *Connection) ListRoleMembers(roleId int64) ([]*entity.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id IN (SELECT user_id FROM user_roles WHERE role_id=$1) ORDER BY id`
+
+	rows, err := c.q().Query(query, roleId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*entity.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+func (c *Connection) AssignRole(userId int64, roleName string) error {
+	query := `INSERT INTO user_roles (user_id, role_id, assigned_at)
+		SELECT $1, id, $3 FROM roles WHERE name=$2
+		ON CONFLICT DO NOTHING`
+
+	result, err := c.q().Exec(query, userId, roleName, time.Now())
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		// Either the role does not exist or it was already assigned
+		if _, err := c.GetRole(roleName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Connection) RemoveRole(userId int64, roleName string) error {
+	query := `DELETE FROM user_roles WHERE user_id=$1 AND role_id = (SELECT id FROM roles WHERE name=$2)`
+
+	result, err := c.q().Exec(query, userId, roleName)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrRoleNotFound)
+}
+
+// PermissionsForRoles returns the distinct permissions granted by the roles
+func (c *Connection) PermissionsForRoles(roles []string) ([]string, error) {
+	if len(roles) == 0 {
+		return []string{}, nil
+	}
+
+	query := `SELECT DISTINCT p.name FROM roles r
+		JOIN role_permissions rp ON rp.role_id = r.id
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE r.name = ANY($1)`
+
+	rows, err := c.q().Query(query, pq.Array(roles))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, name)
+	}
+
+	return permissions, rows.Err()
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+)
+
+const createRisk string = `
+CREATE TABLE IF NOT EXISTS risk_decisions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NULL REFERENCES users(id) ON DELETE SET NULL,
+    username TEXT NOT NULL,
+    stage TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    client_type TEXT NOT NULL,
+    score INTEGER NOT NULL,
+    decision TEXT NOT NULL,
+    reasons JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS risk_decisions_user_id_idx ON risk_decisions (user_id);
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id SERIAL PRIMARY KEY,
+    username TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    succeeded BOOLEAN NOT NULL,
+    attempted_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS login_attempts_username_idx ON login_attempts (username, attempted_at);
+`
+
+func (c *Connection) InsertRiskDecision(decision *entity.RiskDecision) error {
+	query := `INSERT INTO risk_decisions (user_id, username, stage, ip, client_type, score, decision, reasons, created_at)
+		VALUES (NULLIF($1, 0), $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`
+
+	return c.q().QueryRow(query, decision.UserId, decision.Username, decision.Stage, decision.IP,
+		decision.ClientType, decision.Score, decision.Decision, decision.Reasons, decision.CreatedAt).Scan(&decision.Id)
+}
+
+func (c *Connection) InsertLoginAttempt(attempt *entity.LoginAttempt) error {
+	query := `INSERT INTO login_attempts (username, ip, succeeded, attempted_at) VALUES ($1, $2, $3, $4)`
+
+	_, err := c.q().Exec(query, attempt.Username, attempt.IP, attempt.Succeeded, attempt.AttemptedAt)
+	return err
+}
+
+// CountRecentFailures counts failed logins for a username, or from an IP
+// address, since the given time
+func (c *Connection) CountRecentFailures(username string, ip string, since time.Time) (int, error) {
+	query := `SELECT COUNT(*) FROM login_attempts
+		WHERE NOT succeeded AND attempted_at >= $3 AND (username=$1 OR ip=$2)`
+
+	var count int
+	err := c.q().QueryRow(query, username, ip, since).Scan(&count)
+	return count, err
+}
+
+// ListRiskDecisions returns the risk assessments recorded for a user
+func (c *Connection) ListRiskDecisions(userId int64) ([]*entity.RiskDecision, error) {
+	query := `SELECT id, user_id, username, stage, ip, client_type, score, decision, reasons, created_at
+		FROM risk_decisions WHERE user_id=$1 ORDER BY created_at DESC`
+
+	rows, err := c.q().Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	decisions := []*entity.RiskDecision{}
+	for rows.Next() {
+		decision := entity.RiskDecision{}
+		err := rows.Scan(&decision.Id, &decision.UserId, &decision.Username, &decision.Stage, &decision.IP,
+			&decision.ClientType, &decision.Score, &decision.Decision, &decision.Reasons, &decision.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		decisions = append(decisions, &decision)
+	}
+
+	return decisions, rows.Err()
+}
+
+// ListLoginAttempts returns the login attempts made for a username
+func (c *Connection) ListLoginAttempts(username string) ([]*entity.LoginAttempt, error) {
+	query := `SELECT username, ip, succeeded, attempted_at FROM login_attempts
+		WHERE username=$1 ORDER BY attempted_at DESC`
+
+	rows, err := c.q().Query(query, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := []*entity.LoginAttempt{}
+	for rows.Next() {
+		attempt := entity.LoginAttempt{}
+		if err := rows.Scan(&attempt.Username, &attempt.IP, &attempt.Succeeded, &attempt.AttemptedAt); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, &attempt)
+	}
+
+	return attempts, rows.Err()
+}
@@ -0,0 +1,149 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+)
+
+const createSessions string = `
+CREATE TABLE IF NOT EXISTS sessions (
+    id SERIAL PRIMARY KEY,
+    jti TEXT UNIQUE NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_type TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP NULL,
+    scope TEXT NOT NULL DEFAULT '',
+    client_id TEXT NOT NULL DEFAULT '',
+    auth_method TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+`
+
+const sessionColumns = `id, jti, user_id, client_type, ip, user_agent, created_at, last_used_at, expires_at, revoked_at, scope, client_id, auth_method`
+
+var ErrSessionNotFound = errors.New("session not found")
+
+func scanSession(row scanner) (*entity.Session, error) {
+	session := entity.Session{}
+	var revokedAt sql.NullTime
+
+	err := row.Scan(&session.Id, &session.JTI, &session.UserId, &session.ClientType, &session.IP,
+		&session.UserAgent, &session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt, &revokedAt, &session.Scope, &session.ClientId, &session.AuthMethod)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+	return &session, nil
+}
+
+func (c *Connection) CreateSession(session *entity.Session) (int64, error) {
+	query := `INSERT INTO sessions (jti, user_id, client_type, ip, user_agent, created_at, last_used_at, expires_at, scope, client_id, auth_method)
+		VALUES ($1, $2, $3, $4, $5, $6, $6, $7, $8, $9, $10) RETURNING id`
+
+	var id int64
+	err := c.q().QueryRow(query, session.JTI, session.UserId, session.ClientType, session.IP,
+		session.UserAgent, session.CreatedAt, session.ExpiresAt, session.Scope, session.ClientId, session.AuthMethod).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (c *Connection) GetSessionByJTI(jti string) (*entity.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE jti=$1`
+	return scanSession(c.q().QueryRow(query, jti))
+}
+
+// ListActiveSessions returns the sessions of a user that are neither revoked
+// nor expired, most recently used first.
+func (c *Connection) ListActiveSessions(userId int64) ([]*entity.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions
+		WHERE user_id=$1 AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY last_used_at DESC`
+
+	rows, err := c.q().Query(query, userId, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*entity.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// ListSessions returns every session of a user including revoked and expired
+// ones, most recent first
+func (c *Connection) ListSessions(userId int64) ([]*entity.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE user_id=$1 ORDER BY created_at DESC`
+
+	rows, err := c.q().Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*entity.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (c *Connection) TouchSession(id int64) error {
+	query := `UPDATE sessions SET last_used_at=$1 WHERE id=$2`
+	_, err := c.q().Exec(query, time.Now(), id)
+	return err
+}
+
+// RevokeSession signs out one session of a user. Sessions that are already
+// revoked are reported as not found.
+func (c *Connection) RevokeSession(userId int64, id int64) error {
+	query := `UPDATE sessions SET revoked_at=$1 WHERE user_id=$2 AND id=$3 AND revoked_at IS NULL`
+
+	result, err := c.q().Exec(query, time.Now(), userId, id)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result, ErrSessionNotFound)
+}
+
+// RevokeAllSessions signs a user out everywhere and returns how many sessions
+// were terminated
+func (c *Connection) RevokeAllSessions(userId int64) (int64, error) {
+	query := `UPDATE sessions SET revoked_at=$1 WHERE user_id=$2 AND revoked_at IS NULL`
+
+	result, err := c.q().Exec(query, time.Now(), userId)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,115 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/test_utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateAndGetSession(t *testing.T) {
+	conn := test_utils.OpenDatabase(t)
+	user := test_utils.InsertUser(t, conn, "session")
+
+	created := test_utils.InsertSession(t, conn, user.Id, time.Now(), time.Hour)
+
+	session, err := conn.GetSessionByJTI(created.JTI)
+	require.NoError(t, err)
+	assert.Equal(t, created.Id, session.Id)
+	assert.Equal(t, user.Id, session.UserId)
+	assert.Equal(t, "web", session.ClientType)
+	assert.Equal(t, "profile sessions", session.Scope)
+	assert.Nil(t, session.RevokedAt)
+
+	_, err = conn.GetSessionByJTI("unknown")
+	assert.ErrorIs(t, err, db.ErrSessionNotFound)
+}
+
+func TestOAuthSessionKeepsItsClient(t *testing.T) {
+	conn := test_utils.OpenDatabase(t)
+	user := test_utils.InsertUser(t, conn, "session")
+
+	now := time.Now()
+	created := &entity.Session{
+		JTI:        "oauth-" + user.Username,
+		UserId:     user.Id,
+		ClientType: "oauth",
+		IP:         "203.0.113.7",
+		UserAgent:  "test",
+		Scope:      "openid profile",
+		ClientId:   "spa",
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(time.Hour),
+	}
+	_, err := conn.CreateSession(created)
+	require.NoError(t, err)
+
+	session, err := conn.GetSessionByJTI(created.JTI)
+	require.NoError(t, err)
+	assert.Equal(t, "oauth", session.ClientType)
+	assert.Equal(t, "spa", session.ClientId)
+	assert.Equal(t, "openid profile", session.Scope)
+}
+
+func TestListActiveSessions(t *testing.T) {
+	conn := test_utils.OpenDatabase(t)
+	user := test_utils.InsertUser(t, conn, "session")
+
+	now := time.Now()
+	active := test_utils.InsertSession(t, conn, user.Id, now, time.Hour)
+	expired := test_utils.InsertSession(t, conn, user.Id, now.Add(-2*time.Hour), time.Hour)
+	revoked := test_utils.InsertSession(t, conn, user.Id, now, time.Hour)
+	require.NoError(t, conn.RevokeSession(user.Id, revoked.Id))
+
+	sessions, err := conn.ListActiveSessions(user.Id)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, active.Id, sessions[0].Id)
+
+	// The history still holds the sessions that ended
+	all, err := conn.ListSessions(user.Id)
+	require.NoError(t, err)
+	ids := make([]int64, 0, len(all))
+	for _, session := range all {
+		ids = append(ids, session.Id)
+	}
+	assert.ElementsMatch(t, []int64{active.Id, expired.Id, revoked.Id}, ids)
+}
+
+func TestRevokeSession(t *testing.T) {
+	conn := test_utils.OpenDatabase(t)
+	user := test_utils.InsertUser(t, conn, "session")
+	other := test_utils.InsertUser(t, conn, "session")
+
+	session := test_utils.InsertSession(t, conn, user.Id, time.Now(), time.Hour)
+
+	// Users can only sign out their own sessions
+	assert.ErrorIs(t, conn.RevokeSession(other.Id, session.Id), db.ErrSessionNotFound)
+
+	require.NoError(t, conn.RevokeSession(user.Id, session.Id))
+	assert.ErrorIs(t, conn.RevokeSession(user.Id, session.Id), db.ErrSessionNotFound, "already revoked")
+
+	revoked, err := conn.GetSessionByJTI(session.JTI)
+	require.NoError(t, err)
+	assert.NotNil(t, revoked.RevokedAt)
+}
+
+func TestRevokeAllSessions(t *testing.T) {
+	conn := test_utils.OpenDatabase(t)
+	user := test_utils.InsertUser(t, conn, "session")
+
+	test_utils.InsertSession(t, conn, user.Id, time.Now(), time.Hour)
+	test_utils.InsertSession(t, conn, user.Id, time.Now(), time.Hour)
+
+	revoked, err := conn.RevokeAllSessions(user.Id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), revoked)
+
+	sessions, err := conn.ListActiveSessions(user.Id)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
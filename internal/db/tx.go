@@ -0,0 +1,71 @@
+package db
+
+import (
+	"database/sql"
+)
+
+// querier is implemented by both *sql.DB and *sql.Tx
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// q returns where queries are issued: the transaction of a Connection handed
+// out by InTx, the pool otherwise
+func (c *Connection) q() querier {
+	if c.tx != nil {
+		return c.tx
+	}
+	return c.DB
+}
+
+// InTx runs fn in a transaction. Every query made through the Connection
+// passed to fn, including methods that use a transaction of their own, is
+// part of it. The transaction is committed when fn returns nil.
+func (c *Connection) InTx(fn func(tx *Connection) error) error {
+	t, err := c.begin()
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	if err := fn(&Connection{DB: c.DB, tx: t.Tx}); err != nil {
+		return err
+	}
+	return t.Commit()
+}
+
+// txn is a transaction that may be shared with an enclosing InTx, in which
+// case committing and rolling back are left to its owner
+type txn struct {
+	*sql.Tx
+	owned bool
+}
+
+// begin starts a transaction, or joins the one c belongs to
+func (c *Connection) begin() (*txn, error) {
+	if c.tx != nil {
+		return &txn{Tx: c.tx}, nil
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &txn{Tx: tx, owned: true}, nil
+}
+
+func (t *txn) Commit() error {
+	if !t.owned {
+		return nil
+	}
+	return t.Tx.Commit()
+}
+
+func (t *txn) Rollback() error {
+	if !t.owned {
+		return nil
+	}
+	return t.Tx.Rollback()
+}
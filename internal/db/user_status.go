@@ -0,0 +1,79 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+)
+
+const createStatusHistory string = `
+CREATE TABLE IF NOT EXISTS user_status_history (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    from_status TEXT NOT NULL,
+    to_status TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    changed_by TEXT NOT NULL,
+    changed_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS user_status_history_user_idx ON user_status_history (user_id, changed_at);
+`
+
+// ErrStatusConflict is returned when the user's status is no longer the one
+// the change was based on
+var ErrStatusConflict = errors.New("user status changed concurrently")
+
+// ChangeUserStatus moves a user from change.From to change.To and records the
+// change in the status history
+func (c *Connection) ChangeUserStatus(change *entity.StatusChange) error {
+	tx, err := c.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`UPDATE users SET status=$1, status_reason=$2, status_changed_at=$3 WHERE id=$4 AND status=$5`,
+		change.To, change.Reason, change.ChangedAt, change.UserId, change.From)
+	if err != nil {
+		return err
+	}
+	if err := expectAffected(result, ErrStatusConflict); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO user_status_history (user_id, from_status, to_status, reason, changed_by, changed_at)
+        VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+
+	err = tx.QueryRow(query, change.UserId, change.From, change.To, change.Reason, change.ChangedBy, change.ChangedAt).
+		Scan(&change.Id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListStatusHistory returns a user's status changes, most recent first
+func (c *Connection) ListStatusHistory(userId int64) ([]*entity.StatusChange, error) {
+	query := `SELECT id, user_id, from_status, to_status, reason, changed_by, changed_at
+        FROM user_status_history WHERE user_id=$1 ORDER BY changed_at DESC, id DESC`
+
+	rows, err := c.q().Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []*entity.StatusChange{}
+	for rows.Next() {
+		change := entity.StatusChange{}
+		err := rows.Scan(&change.Id, &change.UserId, &change.From, &change.To, &change.Reason, &change.ChangedBy, &change.ChangedAt)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, &change)
+	}
+
+	return changes, rows.Err()
+}
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+)
+
+// UserFilter selects and orders users for administrative listings
+type UserFilter struct {
+	Query      string // matched against username, description and email
+	Username   string // exact match
+	ExternalID string // exact match
+	Source     entity.UserSource
+	Status     entity.UserStatus
+	// ExcludeStatus leaves out users with that status
+	ExcludeStatus entity.UserStatus
+	Sort          string // one of UserSortColumns
+	Desc          bool
+	Limit         int
+	Offset        int
+}
+
+// UserSortColumns are the columns users can be ordered by
+var UserSortColumns = map[string]string{
+	"id":        "id",
+	"username":  "username",
+	"createdAt": "created_at",
+	"status":    "status",
+}
+
+// ListUsers returns a page of users matching the filter together with the
+// total number of matches
+func (c *Connection) ListUsers(filter UserFilter) ([]*entity.User, int, error) {
+	var conditions []string
+	var args []any
+
+	if filter.Query != "" {
+		args = append(args, "%"+escapeLike(filter.Query)+"%")
+		conditions = append(conditions, fmt.Sprintf(
+			"(username ILIKE $%[1]d OR description ILIKE $%[1]d OR email ILIKE $%[1]d)", len(args)))
+	}
+	if filter.Username != "" {
+		args = append(args, filter.Username)
+		conditions = append(conditions, fmt.Sprintf("username = $%d", len(args)))
+	}
+	if filter.ExternalID != "" {
+		args = append(args, filter.ExternalID)
+		conditions = append(conditions, fmt.Sprintf("external_id = $%d", len(args)))
+	}
+	if filter.Source != "" {
+		args = append(args, filter.Source)
+		conditions = append(conditions, fmt.Sprintf("source = $%d", len(args)))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if filter.ExcludeStatus != "" {
+		args = append(args, filter.ExcludeStatus)
+		conditions = append(conditions, fmt.Sprintf("status <> $%d", len(args)))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := c.q().QueryRow(`SELECT COUNT(*) FROM users`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	column, ok := UserSortColumns[filter.Sort]
+	if !ok {
+		column = "id"
+	}
+	direction := "ASC"
+	if filter.Desc {
+		direction = "DESC"
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	query := fmt.Sprintf(`SELECT %s FROM users%s ORDER BY %s %s, id %s LIMIT $%d OFFSET $%d`,
+		userColumns, where, column, direction, direction, len(args)-1, len(args))
+
+	rows, err := c.q().Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []*entity.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+
+	return users, total, rows.Err()
+}
+
+// UpdateUser persists the editable profile fields of a user. The status is
+// changed through ChangeUserStatus.
+func (c *Connection) UpdateUser(user *entity.User) error {
+	query := `UPDATE users SET description=$1, email=NULLIF($2, ''), email_verified=$3, external_id=NULLIF($4, '') WHERE id=$5`
+
+	result, err := c.q().Exec(query, user.Description, user.Email, user.EmailVerified, user.ExternalID, user.Id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrIDNotFound)
+}
+
+// DeleteUser removes a user; devices, sessions and role assignments cascade
+func (c *Connection) DeleteUser(id int64) error {
+	result, err := c.q().Exec(`DELETE FROM users WHERE id=$1`, id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrIDNotFound)
+}
+
+// LockUser locks the row of a user until the transaction c belongs to ends.
+// Transactions that read data of the user before changing it take the lock
+// first so they do not run interleaved.
+func (c *Connection) LockUser(id int64) error {
+	var locked int64
+	err := c.q().QueryRow(`SELECT id FROM users WHERE id=$1 FOR UPDATE`, id).Scan(&locked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrIDNotFound
+	}
+	return err
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
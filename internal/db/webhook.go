@@ -0,0 +1,296 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/lib/pq"
+)
+
+const createWebhooks string = `
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id SERIAL PRIMARY KEY,
+    url TEXT NOT NULL,
+    events TEXT[] NOT NULL,
+    secret TEXT NOT NULL,
+    description TEXT NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id BIGSERIAL PRIMARY KEY,
+    event_id TEXT UNIQUE NOT NULL,
+    type TEXT NOT NULL,
+    payload JSON NOT NULL,
+    occurred_at TIMESTAMP NOT NULL,
+    dispatched_at TIMESTAMP NULL
+);
+CREATE INDEX IF NOT EXISTS outbox_events_pending_idx ON outbox_events (id) WHERE dispatched_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    subscription_id INTEGER NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+    outbox_event_id BIGINT NOT NULL REFERENCES outbox_events(id),
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    last_status_code INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    delivered_at TIMESTAMP NULL,
+    UNIQUE (subscription_id, outbox_event_id)
+);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+`
+
+var ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+var ErrDeliveryNotFound = errors.New("webhook delivery not found")
+
+const subscriptionColumns = `id, url, events, secret, description, active, created_at`
+
+func scanSubscription(row scanner) (*entity.WebhookSubscription, error) {
+	subscription := entity.WebhookSubscription{}
+
+	err := row.Scan(&subscription.Id, &subscription.URL, pq.Array(&subscription.Events), &subscription.Secret,
+		&subscription.Description, &subscription.Active, &subscription.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func (c *Connection) CreateSubscription(subscription *entity.WebhookSubscription) error {
+	query := `INSERT INTO webhook_subscriptions (url, events, secret, description, active, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+
+	return c.q().QueryRow(query, subscription.URL, pq.Array(subscription.Events), subscription.Secret,
+		subscription.Description, subscription.Active, subscription.CreatedAt).Scan(&subscription.Id)
+}
+
+func (c *Connection) ListSubscriptions() ([]*entity.WebhookSubscription, error) {
+	rows, err := c.q().Query(`SELECT ` + subscriptionColumns + ` FROM webhook_subscriptions ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []*entity.WebhookSubscription{}
+	for rows.Next() {
+		subscription, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, rows.Err()
+}
+
+func (c *Connection) GetSubscription(id int64) (*entity.WebhookSubscription, error) {
+	query := `SELECT ` + subscriptionColumns + ` FROM webhook_subscriptions WHERE id=$1`
+	return scanSubscription(c.q().QueryRow(query, id))
+}
+
+func (c *Connection) UpdateSubscription(subscription *entity.WebhookSubscription) error {
+	query := `UPDATE webhook_subscriptions SET url=$1, events=$2, description=$3, active=$4 WHERE id=$5`
+
+	result, err := c.q().Exec(query, subscription.URL, pq.Array(subscription.Events), subscription.Description,
+		subscription.Active, subscription.Id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrSubscriptionNotFound)
+}
+
+func (c *Connection) DeleteSubscription(id int64) error {
+	result, err := c.q().Exec(`DELETE FROM webhook_subscriptions WHERE id=$1`, id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrSubscriptionNotFound)
+}
+
+// InsertOutboxEvent adds an event to the outbox. Call it on the Connection of
+// an InTx so it commits together with the change it describes.
+func (c *Connection) InsertOutboxEvent(event *entity.OutboxEvent) error {
+	query := `INSERT INTO outbox_events (event_id, type, payload, occurred_at) VALUES ($1, $2, $3, $4) RETURNING id`
+
+	return c.q().QueryRow(query, event.EventId, event.Type, string(event.Payload), event.OccurredAt).Scan(&event.Id)
+}
+
+// FanOutOutbox creates a delivery per matching active subscription for up to
+// limit undispatched outbox events and marks them dispatched. It returns the
+// number of events processed.
+func (c *Connection) FanOutOutbox(limit int, now time.Time) (int, error) {
+	tx, err := c.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT id FROM outbox_events WHERE dispatched_at IS NULL
+		ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED`, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	_, err = tx.Exec(`INSERT INTO webhook_deliveries (subscription_id, outbox_event_id, status, next_attempt_at, created_at)
+		SELECT s.id, e.id, $2, $3, $3
+		FROM outbox_events e JOIN webhook_subscriptions s
+		    ON s.active AND (cardinality(s.events) = 0 OR e.type = ANY(s.events))
+		WHERE e.id = ANY($1)
+		ON CONFLICT (subscription_id, outbox_event_id) DO NOTHING`,
+		pq.Array(ids), entity.DeliveryPending, now)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`UPDATE outbox_events SET dispatched_at=$1 WHERE id = ANY($2)`, now, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(ids), tx.Commit()
+}
+
+const deliveryColumns = `d.id, d.subscription_id, d.outbox_event_id, d.status, d.attempts, d.next_attempt_at,
+	d.last_error, d.last_status_code, d.created_at, d.delivered_at, s.url, s.secret, e.event_id, e.type, e.payload`
+
+const deliveryJoins = ` FROM webhook_deliveries d
+	JOIN webhook_subscriptions s ON s.id = d.subscription_id
+	JOIN outbox_events e ON e.id = d.outbox_event_id`
+
+func scanDelivery(row scanner) (*entity.WebhookDelivery, error) {
+	delivery := entity.WebhookDelivery{}
+	var deliveredAt sql.NullTime
+
+	err := row.Scan(&delivery.Id, &delivery.SubscriptionId, &delivery.OutboxEventId, &delivery.Status,
+		&delivery.Attempts, &delivery.NextAttemptAt, &delivery.LastError, &delivery.LastStatusCode,
+		&delivery.CreatedAt, &deliveredAt, &delivery.URL, &delivery.Secret, &delivery.EventId,
+		&delivery.EventType, &delivery.Payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if deliveredAt.Valid {
+		delivery.DeliveredAt = &deliveredAt.Time
+	}
+	return &delivery, nil
+}
+
+func (c *Connection) queryDeliveries(query string, args ...any) ([]*entity.WebhookDelivery, error) {
+	rows, err := c.q().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*entity.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// ClaimDueDeliveries returns up to limit pending deliveries whose next
+// attempt is due and postpones them by lease, so that other dispatchers skip
+// them while they are being sent
+func (c *Connection) ClaimDueDeliveries(now time.Time, lease time.Duration, limit int) ([]*entity.WebhookDelivery, error) {
+	tx, err := c.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	claimer := &Connection{DB: c.DB, tx: tx.Tx}
+	deliveries, err := claimer.queryDeliveries(`SELECT `+deliveryColumns+deliveryJoins+`
+		WHERE d.status = $1 AND d.next_attempt_at <= $2
+		ORDER BY d.next_attempt_at LIMIT $3 FOR UPDATE OF d SKIP LOCKED`,
+		entity.DeliveryPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		ids = append(ids, delivery.Id)
+	}
+
+	if len(ids) > 0 {
+		_, err = tx.Exec(`UPDATE webhook_deliveries SET next_attempt_at=$1 WHERE id = ANY($2)`,
+			now.Add(lease), pq.Array(ids))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return deliveries, tx.Commit()
+}
+
+// UpdateDelivery records the outcome of an attempt
+func (c *Connection) UpdateDelivery(delivery *entity.WebhookDelivery) error {
+	query := `UPDATE webhook_deliveries SET status=$1, attempts=$2, next_attempt_at=$3, last_error=$4,
+		last_status_code=$5, delivered_at=$6 WHERE id=$7`
+
+	result, err := c.q().Exec(query, delivery.Status, delivery.Attempts, delivery.NextAttemptAt, delivery.LastError,
+		delivery.LastStatusCode, delivery.DeliveredAt, delivery.Id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrDeliveryNotFound)
+}
+
+// ListDeliveries returns the most recent deliveries with the given status,
+// or of any status when it is empty
+func (c *Connection) ListDeliveries(status entity.DeliveryStatus, limit int) ([]*entity.WebhookDelivery, error) {
+	return c.queryDeliveries(`SELECT `+deliveryColumns+deliveryJoins+`
+		WHERE $1 = '' OR d.status = $1 ORDER BY d.id DESC LIMIT $2`, status, limit)
+}
+
+func (c *Connection) GetDelivery(id int64) (*entity.WebhookDelivery, error) {
+	return scanDelivery(c.q().QueryRow(`SELECT `+deliveryColumns+deliveryJoins+` WHERE d.id=$1`, id))
+}
+
+// RetryDelivery puts a dead delivery back in the queue with a fresh set of
+// attempts
+func (c *Connection) RetryDelivery(id int64, now time.Time) error {
+	query := `UPDATE webhook_deliveries SET status=$1, attempts=0, next_attempt_at=$2 WHERE id=$3 AND status=$4`
+
+	result, err := c.q().Exec(query, entity.DeliveryPending, now, id, entity.DeliveryDead)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, ErrDeliveryNotFound)
+}
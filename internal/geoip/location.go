@@ -0,0 +1,37 @@
+package geoip
+
+import "strings"
+
+// Location is the approximate position of an IP address
+type Location struct {
+	City        string  `json:"city,omitempty"`
+	Country     string  `json:"country,omitempty"`
+	CountryCode string  `json:"countryCode,omitempty"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+	HasCoords   bool    `json:"-"`
+}
+
+// Locator resolves IP addresses to locations
+type Locator interface {
+	Locate(ip string) (*Location, error)
+}
+
+// String renders the location for humans, e.g. "Berlin, Germany"
+func (l *Location) String() string {
+	if l == nil {
+		return "Unknown location"
+	}
+
+	parts := make([]string, 0, 2)
+	if l.City != "" {
+		parts = append(parts, l.City)
+	}
+	if l.Country != "" {
+		parts = append(parts, l.Country)
+	}
+	if len(parts) == 0 {
+		return "Unknown location"
+	}
+	return strings.Join(parts, ", ")
+}
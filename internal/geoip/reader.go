@@ -0,0 +1,90 @@
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Reader looks up locations in a MaxMind DB (.mmdb) file such as
+// GeoLite2-City. It is safe for concurrent use.
+type Reader struct {
+	db *maxminddb.Reader
+}
+
+var ErrNotFound = errors.New("address not found in database")
+
+// cityRecord is the part of a GeoLite2-City record a Location is built from
+type cityRecord struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Country struct {
+		IsoCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Location struct {
+		Latitude  *float64 `maxminddb:"latitude"`
+		Longitude *float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+}
+
+// Open opens a MaxMind DB file from disk
+func Open(path string) (*Reader, error) {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{db: db}, nil
+}
+
+// FromBytes opens a MaxMind DB held in memory
+func FromBytes(buf []byte) (*Reader, error) {
+	db, err := maxminddb.FromBytes(buf)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{db: db}, nil
+}
+
+// Close releases the database file
+func (r *Reader) Close() error {
+	return r.db.Close()
+}
+
+// Locate resolves ip using the GeoLite2-City record layout
+func (r *Reader) Locate(ip string) (*Location, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return nil, fmt.Errorf("invalid IP address: %q", ip)
+	}
+
+	// An IPv4-only database knows nothing about IPv6 addresses
+	if parsed.To4() == nil && r.db.Metadata.IPVersion == 4 {
+		return nil, ErrNotFound
+	}
+
+	var record cityRecord
+	_, found, err := r.db.LookupNetwork(parsed, &record)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+
+	location := &Location{
+		City:        record.City.Names["en"],
+		Country:     record.Country.Names["en"],
+		CountryCode: record.Country.IsoCode,
+	}
+	if record.Location.Latitude != nil && record.Location.Longitude != nil {
+		location.Latitude = *record.Location.Latitude
+		location.Longitude = *record.Location.Longitude
+		location.HasCoords = true
+	}
+
+	return location, nil
+}
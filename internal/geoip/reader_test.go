@@ -0,0 +1,252 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pointer makes the test writer emit a data section pointer
+type pointer uint
+
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+const dataSectionSeparator = 16
+
+// Data section types of the MaxMind DB format
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// writeDB builds a small IPv4 MaxMind DB mapping prefixes to records
+func writeDB(t *testing.T, recordSize uint, networks map[string]any) []byte {
+	t.Helper()
+
+	type node struct {
+		children [2]*node
+		data     [2]int
+	}
+	root := &node{data: [2]int{-1, -1}}
+
+	var data []byte
+	cidrs := make([]string, 0, len(networks))
+	for cidr := range networks {
+		cidrs = append(cidrs, cidr)
+	}
+	sort.Strings(cidrs)
+
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		require.NoError(t, err)
+		ones, _ := network.Mask.Size()
+		ip := network.IP.To4()
+
+		offset := len(data)
+		data = append(data, encodeValue(networks[cidr])...)
+
+		current := root
+		for i := 0; i < ones; i++ {
+			bit := (ip[i/8] >> (7 - uint(i%8))) & 1
+			if i == ones-1 {
+				current.data[bit] = offset
+				break
+			}
+			if current.children[bit] == nil {
+				current.children[bit] = &node{data: [2]int{-1, -1}}
+			}
+			current = current.children[bit]
+		}
+	}
+
+	var nodes []*node
+	index := map[*node]uint{}
+	queue := []*node{root}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		index[n] = uint(len(nodes))
+		nodes = append(nodes, n)
+		for _, child := range n.children {
+			if child != nil {
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	nodeCount := uint(len(nodes))
+	var tree []byte
+	for _, n := range nodes {
+		var records [2]uint
+		for bit := 0; bit < 2; bit++ {
+			switch {
+			case n.children[bit] != nil:
+				records[bit] = index[n.children[bit]]
+			case n.data[bit] >= 0:
+				records[bit] = nodeCount + dataSectionSeparator + uint(n.data[bit])
+			default:
+				records[bit] = nodeCount
+			}
+		}
+
+		switch recordSize {
+		case 24:
+			tree = append(tree, byte(records[0]>>16), byte(records[0]>>8), byte(records[0]),
+				byte(records[1]>>16), byte(records[1]>>8), byte(records[1]))
+		case 28:
+			tree = append(tree, byte(records[0]>>16), byte(records[0]>>8), byte(records[0]),
+				byte((records[0]>>20)&0xF0|(records[1]>>24)&0x0F),
+				byte(records[1]>>16), byte(records[1]>>8), byte(records[1]))
+		case 32:
+			tree = binary.BigEndian.AppendUint32(tree, uint32(records[0]))
+			tree = binary.BigEndian.AppendUint32(tree, uint32(records[1]))
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.Write(tree)
+	buf.Write(make([]byte, dataSectionSeparator))
+	buf.Write(data)
+	buf.Write(metadataMarker)
+	buf.Write(encodeValue(map[string]any{
+		"node_count":                  uint64(nodeCount),
+		"record_size":                 uint64(recordSize),
+		"ip_version":                  uint64(4),
+		"database_type":               "Test-City",
+		"binary_format_major_version": uint64(2),
+	}))
+	return buf.Bytes()
+}
+
+func encodeValue(v any) []byte {
+	control := func(typ int, size int) []byte {
+		if size >= 29 {
+			panic("test values must be shorter than 29 bytes")
+		}
+		if typ < 8 {
+			return []byte{byte(typ<<5 | size)}
+		}
+		return []byte{byte(size), byte(typ - 7)}
+	}
+
+	switch v := v.(type) {
+	case pointer:
+		return []byte{byte(typePointer<<5) | byte(v>>8)&0x7, byte(v)}
+	case string:
+		return append(control(typeString, len(v)), v...)
+	case float64:
+		return binary.BigEndian.AppendUint64(control(typeDouble, 8), math.Float64bits(v))
+	case uint64:
+		return binary.BigEndian.AppendUint32(control(typeUint32, 4), uint32(v))
+	case bool:
+		if v {
+			return control(typeBool, 1)
+		}
+		return control(typeBool, 0)
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := control(typeMap, len(v))
+		for _, k := range keys {
+			out = append(out, encodeValue(k)...)
+			out = append(out, encodeValue(v[k])...)
+		}
+		return out
+	default:
+		panic("unsupported test value")
+	}
+}
+
+func londonRecord() map[string]any {
+	return map[string]any{
+		"city":    map[string]any{"names": map[string]any{"en": "London"}},
+		"country": map[string]any{"iso_code": "GB", "names": map[string]any{"en": "United Kingdom"}},
+		"location": map[string]any{
+			"latitude":  51.5142,
+			"longitude": -0.0931,
+			"time_zone": "Europe/London",
+		},
+	}
+}
+
+func TestReaderLocate(t *testing.T) {
+	for _, recordSize := range []uint{24, 28, 32} {
+		db := writeDB(t, recordSize, map[string]any{
+			"81.2.69.0/24": londonRecord(),
+			"2.125.0.0/16": map[string]any{
+				"country":  map[string]any{"iso_code": "SE", "names": map[string]any{"en": "Sweden"}},
+				"location": map[string]any{"latitude": 59.3247, "longitude": 18.056},
+			},
+		})
+
+		reader, err := FromBytes(db)
+		require.NoError(t, err)
+
+		location, err := reader.Locate("81.2.69.142")
+		require.NoError(t, err, "record size %d", recordSize)
+		assert.Equal(t, "London", location.City)
+		assert.Equal(t, "GB", location.CountryCode)
+		assert.Equal(t, "London, United Kingdom", location.String())
+		assert.True(t, location.HasCoords)
+		assert.InDelta(t, 51.5142, location.Latitude, 1e-9)
+
+		location, err = reader.Locate("2.125.160.216")
+		require.NoError(t, err)
+		assert.Equal(t, "Sweden", location.String())
+
+		_, err = reader.Locate("1.2.3.4")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		_, err = reader.Locate("2001:db8::1")
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+}
+
+func TestReaderFollowsPointers(t *testing.T) {
+	// The first record is a bare string so the second can point at it
+	db := writeDB(t, 24, map[string]any{
+		"10.0.0.0/8": "Shared",
+		"11.0.0.0/8": map[string]any{"city": map[string]any{"names": map[string]any{"en": pointer(0)}}},
+	})
+
+	reader, err := FromBytes(db)
+	require.NoError(t, err)
+
+	location, err := reader.Locate("11.1.2.3")
+	require.NoError(t, err)
+	assert.Equal(t, "Shared", location.City)
+}
+
+func TestFromBytesRejectsGarbage(t *testing.T) {
+	_, err := FromBytes([]byte("not a database"))
+	assert.Error(t, err)
+}
+
+func TestDistanceKm(t *testing.T) {
+	// London to Paris is roughly 344 km
+	assert.InDelta(t, 344, DistanceKm(51.5074, -0.1278, 48.8566, 2.3522), 5)
+	assert.Zero(t, DistanceKm(10, 10, 10, 10))
+}
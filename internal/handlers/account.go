@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/audit"
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/utils"
+)
+
+// ExportData returns a JSON archive of everything stored about the caller
+func (h *Handler) ExportData(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(utils.ClaimsKey).(*models.UserClaims)
+
+	user, err := h.conn.GetUser(claims.Username)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	export, err := h.buildExport(user, claims)
+	if err != nil {
+		log.Printf("Error exporting data of %s: %v", user.Username, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventDataExported,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetUser,
+		TargetId:   userTargetId(user),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-export-%s.json"`,
+		user.Username, export.ExportedAt.Format("20060102")))
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(export)
+}
+
+func (h *Handler) buildExport(user *entity.User, claims *models.UserClaims) (*models.DataExport, error) {
+	export := &models.DataExport{
+		ExportedAt: time.Now().UTC(),
+		Profile:    profileResponse(user),
+		Status:     string(user.Status),
+	}
+
+	roles, err := h.conn.GetUserRoles(user.Id)
+	if err != nil {
+		return nil, err
+	}
+	export.Roles = roles
+
+	identities, err := h.conn.ListFederatedIdentities(user.Id)
+	if err != nil {
+		return nil, err
+	}
+	export.Identities = make([]models.IdentityResponse, 0, len(identities))
+	for _, identity := range identities {
+		export.Identities = append(export.Identities, identityResponse(identity))
+	}
+
+	devices, err := h.conn.ListDevices(user.Id)
+	if err != nil {
+		return nil, err
+	}
+	export.Devices = make([]models.DeviceResponse, 0, len(devices))
+	for _, device := range devices {
+		export.Devices = append(export.Devices, deviceResponse(device, claims.Fingerprint))
+	}
+
+	sessions, err := h.conn.ListSessions(user.Id)
+	if err != nil {
+		return nil, err
+	}
+	export.Sessions = make([]models.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		export.Sessions = append(export.Sessions, sessionResponse(session, claims.ID))
+	}
+
+	locations, err := h.conn.ListLoginLocations(user.Id)
+	if err != nil {
+		return nil, err
+	}
+	export.LoginLocations = make([]models.ExportedLoginLocation, 0, len(locations))
+	for _, location := range locations {
+		export.LoginLocations = append(export.LoginLocations, models.ExportedLoginLocation{
+			IP:          location.IP,
+			City:        location.City,
+			CountryCode: location.CountryCode,
+			Latitude:    location.Latitude,
+			Longitude:   location.Longitude,
+			LoggedInAt:  location.LoggedInAt,
+		})
+	}
+
+	attempts, err := h.conn.ListLoginAttempts(user.Username)
+	if err != nil {
+		return nil, err
+	}
+	export.LoginAttempts = make([]models.ExportedLoginAttempt, 0, len(attempts))
+	for _, attempt := range attempts {
+		export.LoginAttempts = append(export.LoginAttempts, models.ExportedLoginAttempt{
+			IP:          attempt.IP,
+			Succeeded:   attempt.Succeeded,
+			AttemptedAt: attempt.AttemptedAt,
+		})
+	}
+
+	decisions, err := h.conn.ListRiskDecisions(user.Id)
+	if err != nil {
+		return nil, err
+	}
+	export.RiskDecisions = make([]models.ExportedRiskDecision, 0, len(decisions))
+	for _, decision := range decisions {
+		export.RiskDecisions = append(export.RiskDecisions, models.ExportedRiskDecision{
+			Stage:      decision.Stage,
+			IP:         decision.IP,
+			ClientType: decision.ClientType,
+			Score:      decision.Score,
+			Decision:   decision.Decision,
+			Reasons:    decision.Reasons,
+			CreatedAt:  decision.CreatedAt,
+		})
+	}
+
+	events, err := h.conn.ListAuditEventsForUser(user.Id)
+	if err != nil {
+		return nil, err
+	}
+	export.AuditEvents = make([]models.AuditEventResponse, 0, len(events))
+	for _, event := range events {
+		export.AuditEvents = append(export.AuditEvents, auditEventResponse(event))
+	}
+
+	changes, err := h.conn.ListStatusHistory(user.Id)
+	if err != nil {
+		return nil, err
+	}
+	export.StatusHistory = make([]models.StatusChangeResponse, 0, len(changes))
+	for _, change := range changes {
+		export.StatusHistory = append(export.StatusHistory, statusChangeResponse(change))
+	}
+
+	return export, nil
+}
+
+// DeleteAccount schedules the caller's account for deletion and signs it out
+// everywhere. Signing in again during the grace period cancels the deletion.
+// The token must have been issued recently so a stolen or forgotten session
+// cannot be used to delete the account.
+func (h *Handler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(utils.ClaimsKey).(*models.UserClaims)
+
+	now := time.Now()
+	if !h.recentlyAuthenticated(claims, now) {
+		h.recordAudit(r, audit.Event{
+			Type:    audit.EventDeletionRequested,
+			Outcome: audit.Denied,
+			Details: map[string]any{"reason": "reauthentication required"},
+		})
+		writeErrorCode(w, http.StatusUnauthorized, "reauthentication_required",
+			"Sign in again to delete your account")
+		return
+	}
+
+	user, err := h.conn.GetUser(claims.Username)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	purgeAfter := now.Add(h.deletionGracePeriod)
+	if user.PurgeAfter != nil {
+		purgeAfter = *user.PurgeAfter
+	}
+
+	err = h.conn.InTx(func(tx *db.Connection) error {
+		if user.PurgeAfter == nil {
+			if err := tx.ScheduleDeletion(user.Id, now, purgeAfter); err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.RevokeAllSessions(user.Id)
+		return err
+	})
+	if err != nil {
+		log.Printf("Error scheduling deletion of %s: %v", user.Username, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventDeletionRequested,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetUser,
+		TargetId:   userTargetId(user),
+		Details:    map[string]any{"purgeAfter": purgeAfter},
+	})
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session",
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+		MaxAge:   -1,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(models.AccountDeletionResponse{
+		Message:    "Your account will be deleted. Sign in before the purge date to keep it. The security log of your sign-ins and account changes is kept.",
+		PurgeAfter: purgeAfter,
+	})
+}
+
+// recentlyAuthenticated reports whether the user signed in within
+// reauthMaxAge. Only session tokens count: those of OAuth clients are renewed
+// without the user, and personal access tokens carry no sign-in time.
+func (h *Handler) recentlyAuthenticated(claims *models.UserClaims, now time.Time) bool {
+	if claims.ClientID != "" || claims.IsPersonalToken() || claims.IssuedAt == nil {
+		return false
+	}
+	return now.Sub(claims.IssuedAt.Time) <= h.reauthMaxAge
+}
@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/audit"
+	"github.com/joeariasc/go-auth/internal/auth/account"
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/utils"
+	"github.com/joeariasc/go-auth/internal/webhook"
+)
+
+const (
+	defaultUserPageSize = 20
+	maxUserPageSize     = 100
+)
+
+// ListUsers pages through users. Supported query parameters are q, status,
+// sort (id, username, createdAt, status, prefix with - for descending),
+// limit and offset.
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter := db.UserFilter{
+		Query: query.Get("q"),
+		Limit: defaultUserPageSize,
+	}
+
+	if status := entity.UserStatus(query.Get("status")); status != "" {
+		if !status.IsValid() {
+			http.Error(w, "Invalid status", http.StatusBadRequest)
+			return
+		}
+		filter.Status = status
+	}
+
+	if sort := query.Get("sort"); sort != "" {
+		if sort[0] == '-' {
+			filter.Desc = true
+			sort = sort[1:]
+		}
+		if _, ok := db.UserSortColumns[sort]; !ok {
+			http.Error(w, "Invalid sort field", http.StatusBadRequest)
+			return
+		}
+		filter.Sort = sort
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = min(limit, maxUserPageSize)
+	}
+
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		filter.Offset = offset
+	}
+
+	users, total, err := h.conn.ListUsers(filter)
+	if err != nil {
+		log.Printf("Error listing users: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.UserListResponse{
+		Users:  make([]models.AdminUserResponse, 0, len(users)),
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	}
+	for _, user := range users {
+		response.Users = append(response.Users, adminUserResponse(user, nil))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	h.writeAdminUser(w, user)
+}
+
+func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Description != nil {
+		user.Description = *req.Description
+	}
+
+	if err := h.conn.UpdateUser(user); err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventUserUpdated,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetUser,
+		TargetId:   userTargetId(user),
+		Details:    map[string]any{"description": user.Description},
+	})
+
+	h.writeAdminUser(w, user)
+}
+
+// ChangeUserStatus moves a user through the account lifecycle. Leaving the
+// active status ends all of the user's sessions.
+func (h *Handler) ChangeUserStatus(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.ChangeStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if h.changeUserStatus(w, r, user, entity.UserStatus(req.Status), req.Reason) {
+		h.writeAdminUser(w, user)
+	}
+}
+
+func (h *Handler) ListUserStatusHistory(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	changes, err := h.conn.ListStatusHistory(user.Id)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	response := make([]models.StatusChangeResponse, 0, len(changes))
+	for _, change := range changes {
+		response = append(response, statusChangeResponse(change))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ForceLogout terminates every active session of a user and revokes their
+// personal access tokens. Their devices stay registered so they can sign in
+// again.
+func (h *Handler) ForceLogout(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var response models.ForceLogoutResponse
+	err := h.conn.InTx(func(tx *db.Connection) error {
+		var err error
+		if response.RevokedSessions, err = tx.RevokeAllSessions(user.Id); err != nil {
+			return err
+		}
+		response.RevokedPersonalTokens, err = tx.RevokeAllPersonalTokens(user.Id, time.Now())
+		return err
+	})
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventUserSessionsRevoked,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetUser,
+		TargetId:   userTargetId(user),
+		Details: map[string]any{
+			"revokedSessions":       response.RevokedSessions,
+			"revokedPersonalTokens": response.RevokedPersonalTokens,
+		},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// DeleteUser marks a user as deleted. The row is kept so the status history
+// remains available.
+func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	reason := r.URL.Query().Get("reason")
+	if len(reason) > 256 {
+		http.Error(w, "Reason is too long", http.StatusBadRequest)
+		return
+	}
+
+	if h.changeUserStatus(w, r, user, entity.UserStatusDeleted, reason) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// changeUserStatus applies a status change requested by the current user,
+// writing an error response and returning false when it is refused
+func (h *Handler) changeUserStatus(w http.ResponseWriter, r *http.Request, user *entity.User, to entity.UserStatus, reason string) bool {
+	changedBy := "system"
+	if claims, ok := r.Context().Value(utils.ClaimsKey).(*models.UserClaims); ok {
+		changedBy = claims.Actor()
+	}
+
+	if changedBy == user.Username && to != entity.UserStatusActive {
+		http.Error(w, "You cannot change the status of your own account", http.StatusBadRequest)
+		return false
+	}
+
+	from := user.Status
+	err := h.transitionUser(r, user, to, reason, changedBy)
+	switch {
+	case errors.Is(err, account.ErrInvalidTransition):
+		writeErrorResponse(w, http.StatusConflict, fmt.Sprintf("Cannot change status from %s to %s", from, to))
+		return false
+	case errors.Is(err, db.ErrStatusConflict):
+		writeErrorResponse(w, http.StatusConflict, "The user's status was changed concurrently")
+		return false
+	case err != nil:
+		writeUserError(w, err)
+		return false
+	}
+	return true
+}
+
+// transitionUser moves a user to another status, announcing and auditing the
+// change. Leaving the active status ends all of the user's sessions.
+func (h *Handler) transitionUser(r *http.Request, user *entity.User, to entity.UserStatus, reason string, changedBy string) error {
+	change, err := account.Transition(user, to, reason, changedBy, time.Now())
+	if err != nil {
+		return err
+	}
+
+	err = h.conn.InTx(func(tx *db.Connection) error {
+		if err := tx.ChangeUserStatus(change); err != nil {
+			return err
+		}
+
+		if to != entity.UserStatusActive {
+			if _, err := tx.RevokeAllSessions(user.Id); err != nil {
+				return err
+			}
+		}
+
+		// Deleted is final, there is no grace period to wait for
+		if to == entity.UserStatusDeleted {
+			if err := tx.ScheduleDeletion(user.Id, change.ChangedAt, change.ChangedAt); err != nil {
+				return err
+			}
+		}
+
+		return publish(tx, webhook.EventUserStatusChanged, webhook.UserEvent{
+			UserID:   user.Id,
+			Username: user.Username,
+			Status:   string(change.To),
+			Reason:   change.Reason,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	user.Status = change.To
+	user.StatusReason = change.Reason
+	user.StatusChangedAt = &change.ChangedAt
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventUserStatusChanged,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetUser,
+		TargetId:   userTargetId(user),
+		Details:    map[string]any{"from": change.From, "to": change.To, "reason": change.Reason},
+	})
+
+	return nil
+}
+
+func (h *Handler) writeAdminUser(w http.ResponseWriter, user *entity.User) {
+	roles, err := h.conn.GetUserRoles(user.Id)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(adminUserResponse(user, roles))
+}
+
+func adminUserResponse(user *entity.User, roles []string) models.AdminUserResponse {
+	return models.AdminUserResponse{
+		ID:              user.Id,
+		Username:        user.Username,
+		Email:           user.Email,
+		Description:     user.Description,
+		Status:          string(user.Status),
+		StatusReason:    user.StatusReason,
+		StatusChangedAt: user.StatusChangedAt,
+		Roles:           roles,
+		CreatedAt:       user.CreatedAt,
+	}
+}
+
+func statusChangeResponse(change *entity.StatusChange) models.StatusChangeResponse {
+	return models.StatusChangeResponse{
+		From:      string(change.From),
+		To:        string(change.To),
+		Reason:    change.Reason,
+		ChangedBy: change.ChangedBy,
+		ChangedAt: change.ChangedAt,
+	}
+}
+
+func writeUserError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, db.ErrIDNotFound), errors.Is(err, db.ErrUsernameNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+	default:
+		log.Printf("Error managing users: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
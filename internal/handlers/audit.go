@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/audit"
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/utils"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+)
+
+// ListAuditEvents pages through the audit log, newest first. Supported query
+// parameters are type, outcome, actorId, targetType, targetId, ip, since and
+// until (RFC 3339), limit and cursor.
+func (h *Handler) ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter := db.AuditFilter{
+		Type:       query.Get("type"),
+		Outcome:    query.Get("outcome"),
+		TargetType: query.Get("targetType"),
+		TargetId:   query.Get("targetId"),
+		IP:         query.Get("ip"),
+		Limit:      defaultAuditPageSize,
+	}
+
+	if value := query.Get("actorId"); value != "" {
+		actorId, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid actorId", http.StatusBadRequest)
+			return
+		}
+		filter.ActorId = actorId
+	}
+
+	for _, param := range []struct {
+		name string
+		dest *time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		if value := query.Get(param.name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				http.Error(w, "Invalid "+param.name, http.StatusBadRequest)
+				return
+			}
+			*param.dest = t.UTC()
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = min(limit, maxAuditPageSize)
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		before, err := audit.DecodeCursor(cursor)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		filter.Before = before
+	}
+
+	// Fetch one extra event to know whether there is another page
+	pageSize := filter.Limit
+	filter.Limit++
+
+	events, err := h.conn.ListAuditEvents(filter)
+	if err != nil {
+		log.Printf("Error listing audit events: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.AuditEventListResponse{}
+	if len(events) > pageSize {
+		events = events[:pageSize]
+		response.NextCursor = audit.EncodeCursor(events[pageSize-1].Id)
+	}
+
+	response.Events = make([]models.AuditEventResponse, 0, len(events))
+	for _, event := range events {
+		response.Events = append(response.Events, auditEventResponse(event))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// recordAudit fills in the client's IP address and type and, for
+// authenticated requests, the acting user before appending the event to the
+// audit log
+func (h *Handler) recordAudit(r *http.Request, event audit.Event) {
+	if event.IP == "" {
+		if ip, err := utils.GetIP(r); err == nil {
+			event.IP = ip
+		}
+	}
+
+	if event.ClientType == "" {
+		event.ClientType = utils.SanitizeHeader(r.Header.Get("X-Client-Type"))
+	}
+
+	if claims, ok := r.Context().Value(utils.ClaimsKey).(*models.UserClaims); ok && event.Actor == "" {
+		event.Actor = claims.Actor()
+		if !claims.IsClient() {
+			if actor, err := h.conn.GetUser(claims.Username); err == nil {
+				event.ActorId = actor.Id
+			}
+		}
+	}
+
+	h.auditLog.Record(event)
+}
+
+// userTargetId identifies a user as the target of an audit event
+func userTargetId(user *entity.User) string {
+	return strconv.FormatInt(user.Id, 10)
+}
+
+func auditEventResponse(event *entity.AuditEvent) models.AuditEventResponse {
+	return models.AuditEventResponse{
+		ID:         event.Id,
+		Type:       event.Type,
+		Outcome:    event.Outcome,
+		ActorID:    event.ActorId,
+		Actor:      event.Actor,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetId,
+		IP:         event.IP,
+		ClientType: event.ClientType,
+		Details:    event.Details,
+		CreatedAt:  event.CreatedAt,
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/audit"
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/utils"
+)
+
+func (h *Handler) ListDevices(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(utils.ClaimsKey).(*models.UserClaims)
+
+	user, err := h.conn.GetUser(claims.Username)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	devices, err := h.conn.ListDevices(user.Id)
+	if err != nil {
+		log.Printf("Error listing devices: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]models.DeviceResponse, 0, len(devices))
+	for _, device := range devices {
+		response = append(response, deviceResponse(device, claims.Fingerprint))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *Handler) UpdateDevice(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(utils.ClaimsKey).(*models.UserClaims)
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid device id", http.StatusBadRequest)
+		return
+	}
+
+	var req models.UpdateDeviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Trusted devices lower the risk of later sign-ins, so a stolen session
+	// must not be able to trust itself
+	if req.Trusted != nil && *req.Trusted && !h.recentlyAuthenticated(claims, time.Now()) {
+		h.recordAudit(r, audit.Event{
+			Type:       audit.EventDeviceUpdated,
+			Outcome:    audit.Denied,
+			TargetType: audit.TargetDevice,
+			TargetId:   strconv.FormatInt(id, 10),
+			Details:    map[string]any{"reason": "reauthentication required"},
+		})
+		writeErrorCode(w, http.StatusUnauthorized, "reauthentication_required",
+			"Sign in again to trust a device")
+		return
+	}
+
+	user, err := h.conn.GetUser(claims.Username)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	device, err := h.conn.GetDevice(user.Id, id)
+	if err != nil {
+		writeDeviceError(w, err)
+		return
+	}
+
+	if req.Name != nil {
+		device.Name = *req.Name
+	}
+	if req.Trusted != nil {
+		device.Trusted = *req.Trusted
+	}
+
+	if err := h.conn.UpdateDevice(device); err != nil {
+		writeDeviceError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventDeviceUpdated,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetDevice,
+		TargetId:   strconv.FormatInt(device.Id, 10),
+		Details:    map[string]any{"name": device.Name, "trusted": device.Trusted},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deviceResponse(device, claims.Fingerprint))
+}
+
+func (h *Handler) DeleteDevice(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(utils.ClaimsKey).(*models.UserClaims)
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid device id", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.conn.GetUser(claims.Username)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.conn.DeleteDevice(user.Id, id); err != nil {
+		writeDeviceError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventDeviceRemoved,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetDevice,
+		TargetId:   strconv.FormatInt(id, 10),
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func deviceResponse(device *entity.Device, currentFingerprint string) models.DeviceResponse {
+	return models.DeviceResponse{
+		ID:          device.Id,
+		Name:        device.Name,
+		ClientType:  device.ClientType,
+		Trusted:     device.Trusted,
+		Current:     device.Fingerprint == currentFingerprint,
+		FirstSeenAt: device.FirstSeenAt,
+		LastSeenAt:  device.LastSeenAt,
+	}
+}
+
+func writeDeviceError(w http.ResponseWriter, err error) {
+	if errors.Is(err, db.ErrDeviceNotFound) {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("Error updating device: %v", err)
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+}
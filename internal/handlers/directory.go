@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/audit"
+	"github.com/joeariasc/go-auth/internal/auth/authn"
+	"github.com/joeariasc/go-auth/internal/auth/token"
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/webhook"
+)
+
+// errForeignAccount means an authenticator verified a user whose account of
+// the same name belongs to another source
+var errForeignAccount = errors.New("account belongs to another source")
+
+// identityUser returns the local account of a user an authenticator
+// verified, creating it on first sign-in when the authenticator allows, and
+// brings the roles the authenticator manages up to date. An authenticator
+// only signs into accounts of its own source: a directory user named like a
+// local or federated account must not take it over.
+func (h *Handler) identityUser(r *http.Request, identity *authn.Identity) (*entity.User, error) {
+	user, err := h.conn.GetUser(identity.Username)
+	if errors.Is(err, db.ErrUsernameNotFound) && identity.Provision {
+		return h.provisionIdentityUser(r, identity)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Source != entity.UserSource(identity.Source) {
+		return nil, errForeignAccount
+	}
+
+	if err := h.syncRoles(r, h.conn, user, identity); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// provisionIdentityUser creates the account of a directory user. It belongs
+// to the directory: once the directory stops knowing the user, the local
+// authenticator does not sign them in either.
+func (h *Handler) provisionIdentityUser(r *http.Request, identity *authn.Identity) (*entity.User, error) {
+	secret, err := token.NewUserSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	user := entity.User{
+		Username:  identity.Username,
+		CreatedAt: time.Now(),
+		Email:     identity.Email,
+		Secret:    secret,
+		Source:    entity.UserSource(identity.Source),
+	}
+
+	err = h.conn.InTx(func(tx *db.Connection) error {
+		id, err := tx.Insert(&user)
+		if err != nil {
+			return err
+		}
+		user.Id = int64(id)
+
+		if err := h.syncRoles(r, tx, &user, identity); err != nil {
+			return err
+		}
+
+		return publish(tx, webhook.EventUserRegistered, webhook.UserEvent{
+			UserID:   user.Id,
+			Username: user.Username,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventUserRegistered,
+		Outcome:    audit.Success,
+		ActorId:    user.Id,
+		Actor:      user.Username,
+		TargetType: audit.TargetUser,
+		TargetId:   userTargetId(&user),
+		Details:    map[string]any{"source": identity.Source},
+	})
+	return &user, nil
+}
+
+// syncRoles assigns the managed roles the identity holds and removes the
+// others. A mapped role missing locally is skipped so a mistake in the
+// mapping does not lock everyone out.
+func (h *Handler) syncRoles(r *http.Request, conn *db.Connection, user *entity.User, identity *authn.Identity) error {
+	if len(identity.ManagedRoles) == 0 {
+		return nil
+	}
+
+	current, err := conn.GetUserRoles(user.Id)
+	if err != nil {
+		return err
+	}
+
+	for _, role := range identity.ManagedRoles {
+		held, granted := slices.Contains(current, role), slices.Contains(identity.Roles, role)
+
+		eventType := ""
+		switch {
+		case granted && !held:
+			err, eventType = conn.AssignRole(user.Id, role), audit.EventRoleAssigned
+		case held && !granted:
+			err, eventType = conn.RemoveRole(user.Id, role), audit.EventRoleRemoved
+		default:
+			continue
+		}
+
+		if errors.Is(err, db.ErrRoleNotFound) {
+			log.Printf("Role %s mapped by %s does not exist", role, identity.Source)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		h.recordAudit(r, audit.Event{
+			Type:       eventType,
+			Outcome:    audit.Success,
+			Actor:      identity.Source,
+			TargetType: audit.TargetUser,
+			TargetId:   userTargetId(user),
+			Details:    map[string]any{"role": role, "source": identity.Source},
+		})
+	}
+	return nil
+}
+
+// auditUnknownUser records a sign-in attempt for an account nobody knows
+func (h *Handler) auditUnknownUser(r *http.Request, username string) {
+	h.recordAudit(r, audit.Event{
+		Type:    audit.EventLoginFailed,
+		Outcome: audit.Failure,
+		Actor:   username,
+		Details: map[string]any{"reason": "unknown user"},
+	})
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/joeariasc/go-auth/internal/auth/authn"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/test_utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentityUserRefusesAccountsOfOtherSources(t *testing.T) {
+	conn := test_utils.OpenDatabase(t)
+	h := NewHandler(HandlerConfig{Conn: conn})
+
+	role := &entity.Role{Name: "directory-test-ops", Description: "Operations"}
+	require.NoError(t, conn.EnsureRole(role))
+
+	// A directory user happens to have the name of a local account
+	local := test_utils.InsertUser(t, conn, "directory")
+	identity := &authn.Identity{
+		Username:     local.Username,
+		Roles:        []string{role.Name},
+		ManagedRoles: []string{role.Name},
+		Provision:    true,
+		Source:       "ldap",
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
+	_, err := h.identityUser(r, identity)
+	assert.ErrorIs(t, err, errForeignAccount)
+
+	roles, err := conn.GetUserRoles(local.Id)
+	require.NoError(t, err)
+	assert.Empty(t, roles, "the directory does not manage the roles of the local account")
+
+	// The local authenticator still signs into it
+	identity = &authn.Identity{Username: local.Username, Source: string(entity.UserSourceLocal)}
+	user, err := h.identityUser(r, identity)
+	require.NoError(t, err)
+	assert.Equal(t, local.Id, user.Id)
+}
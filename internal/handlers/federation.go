@@ -0,0 +1,583 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/audit"
+	"github.com/joeariasc/go-auth/internal/auth/fingerprint"
+	"github.com/joeariasc/go-auth/internal/auth/oauth"
+	"github.com/joeariasc/go-auth/internal/auth/oidc"
+	"github.com/joeariasc/go-auth/internal/auth/saml"
+	"github.com/joeariasc/go-auth/internal/auth/token"
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/utils"
+	"github.com/joeariasc/go-auth/internal/webhook"
+)
+
+// federatedLoginTTL bounds the time from starting a sign-in at a provider to
+// collecting its result
+const federatedLoginTTL = 10 * time.Minute
+
+var errNoLinkedAccount = errors.New("no account is linked to the identity")
+
+// ListFederatedProviders lists the identity providers users can sign in with
+func (h *Handler) ListFederatedProviders(w http.ResponseWriter, r *http.Request) {
+	response := []models.FederatedProviderResponse{}
+	for _, provider := range h.federation.All() {
+		response = append(response, models.FederatedProviderResponse{
+			Name:        provider.Name(),
+			DisplayName: provider.DisplayName(),
+		})
+	}
+	for _, provider := range h.saml.All() {
+		response = append(response, models.FederatedProviderResponse{
+			Name:        provider.Name(),
+			DisplayName: provider.DisplayName(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// StartFederatedLogin begins a sign-in at an identity provider. The web client
+// sends the browser to the returned address; once the provider redirected
+// back, the same device collects the session with CompleteFederatedLogin.
+func (h *Handler) StartFederatedLogin(w http.ResponseWriter, r *http.Request) {
+	h.startFederatedLogin(w, r, 0)
+}
+
+// LinkIdentity begins linking the caller's account at an identity provider,
+// completed the same way as a sign-in
+func (h *Handler) LinkIdentity(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(utils.ClaimsKey).(*models.UserClaims)
+
+	if claims.ClientID != "" {
+		writeErrorResponse(w, http.StatusForbidden, "OAuth clients cannot link identities")
+		return
+	}
+	if claims.IsPersonalToken() {
+		writeErrorResponse(w, http.StatusForbidden, "Personal access tokens cannot link identities")
+		return
+	}
+
+	user, err := h.conn.GetUser(claims.Username)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	h.startFederatedLogin(w, r, user.Id)
+}
+
+func (h *Handler) startFederatedLogin(w http.ResponseWriter, r *http.Request, linkUserId int64) {
+	name := r.PathValue("provider")
+	oidcProvider, isOIDC := h.federation.Get(name)
+	samlProvider, isSAML := h.saml.Get(name)
+	if !isOIDC && !isSAML {
+		http.Error(w, "Unknown identity provider", http.StatusNotFound)
+		return
+	}
+
+	clientType := models.ClientType(r.Header.Get("X-Client-Type"))
+	if !clientType.IsValid() {
+		http.Error(w, "Invalid client type", http.StatusBadRequest)
+		return
+	}
+
+	_, deviceFingerprint, err := h.deviceFingerprint(r, clientType)
+	if err != nil {
+		log.Printf("Failed to fingerprint device: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	state, stateHash, err := oauth.NewOpaqueToken()
+	if err != nil {
+		log.Printf("Failed to generate federated login state: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	login := &entity.FederatedLogin{
+		StateHash:   stateHash,
+		Provider:    name,
+		Fingerprint: deviceFingerprint,
+		LinkUserId:  linkUserId,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(federatedLoginTTL),
+	}
+
+	// OpenID Connect providers get the state back with the code, SAML ones as
+	// the relay state. The nonce of a SAML sign-in is the request ID.
+	var authorizationURL string
+	if isOIDC {
+		nonce, _, nonceErr := oauth.NewOpaqueToken()
+		verifier, _, verifierErr := oauth.NewOpaqueToken()
+		if err := errors.Join(nonceErr, verifierErr); err != nil {
+			log.Printf("Failed to generate federated login state: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		login.Nonce, login.CodeVerifier = nonce, verifier
+
+		authorizationURL, err = oidcProvider.AuthCodeURL(r.Context(), state, nonce, verifier)
+		if err != nil {
+			log.Printf("Identity provider %s unavailable: %v", name, err)
+			writeErrorResponse(w, http.StatusBadGateway, "Identity provider unavailable")
+			return
+		}
+	} else {
+		if login.Nonce, err = saml.NewRequestID(); err == nil {
+			authorizationURL, err = samlProvider.AuthnRequestURL(login.Nonce, state)
+		}
+		if err != nil {
+			log.Printf("Failed to create SAML request for %s: %v", name, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := h.conn.CreateFederatedLogin(login); err != nil {
+		log.Printf("Failed to store federated login: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(models.FederatedLoginResponse{AuthorizationURL: authorizationURL})
+}
+
+// FederatedCallback is where identity providers send the browser back to. It
+// redeems the code and forwards to the web client with a completion code, or
+// with an error when the sign-in failed.
+func (h *Handler) FederatedCallback(w http.ResponseWriter, r *http.Request) {
+	if h.federatedLoginURL == "" {
+		log.Printf("Federated login callback received but FEDERATED_LOGIN_URL is not configured")
+		http.Error(w, "Federated sign-in is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	provider, ok := h.federation.Get(r.PathValue("provider"))
+	if !ok {
+		http.Error(w, "Unknown identity provider", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	fail := func(code string) {
+		h.redirectFederatedLogin(w, r, provider.Name(), http.StatusFound, url.Values{"error": {code}})
+	}
+
+	login, code := h.pendingFederatedLogin(query.Get("state"), provider.Name())
+	if code != "" {
+		fail(code)
+		return
+	}
+
+	if code := query.Get("error"); code != "" {
+		if code != oauth.ErrAccessDenied {
+			log.Printf("Identity provider %s refused the sign-in: %s %s", provider.Name(), code, query.Get("error_description"))
+			code = "provider_error"
+		}
+		fail(code)
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), query.Get("code"), login.CodeVerifier, login.Nonce)
+	if err != nil {
+		log.Printf("Federated login with %s failed: %v", provider.Name(), err)
+		h.auditRejectedResponse(r, provider.Name())
+		fail("provider_error")
+		return
+	}
+
+	login.Subject = identity.Subject
+	login.Email = identity.Email
+	login.EmailVerified = identity.EmailVerified
+	login.PreferredUsername = identity.PreferredUsername
+
+	completion, code := h.completeFederatedCallback(login)
+	if code != "" {
+		fail(code)
+		return
+	}
+
+	h.redirectFederatedLogin(w, r, provider.Name(), http.StatusFound, url.Values{"code": {completion}})
+}
+
+// pendingFederatedLogin finds the sign-in a provider answered by its state.
+// Failures are reported as the error code for the web client.
+func (h *Handler) pendingFederatedLogin(state string, provider string) (*entity.FederatedLogin, string) {
+	login, err := h.conn.GetFederatedLogin(oauth.HashToken(state))
+	if err != nil && !errors.Is(err, db.ErrFederatedLoginNotFound) {
+		log.Printf("Failed to look up federated login: %v", err)
+		return nil, oauth.ErrServerError
+	}
+	if login == nil || login.Provider != provider || login.CompletionHash != "" || time.Now().After(login.ExpiresAt) {
+		return nil, "invalid_state"
+	}
+	return login, ""
+}
+
+// completeFederatedCallback stores who the provider vouched for and returns
+// the completion code for the web client, or the error code
+func (h *Handler) completeFederatedCallback(login *entity.FederatedLogin) (string, string) {
+	completion, completionHash, err := oauth.NewOpaqueToken()
+	if err != nil {
+		log.Printf("Failed to generate completion code: %v", err)
+		return "", oauth.ErrServerError
+	}
+	login.CompletionHash = completionHash
+
+	if err := h.conn.CompleteFederatedLogin(login); err != nil {
+		if errors.Is(err, db.ErrFederatedLoginNotFound) {
+			return "", "invalid_state"
+		}
+		log.Printf("Failed to complete federated login: %v", err)
+		return "", oauth.ErrServerError
+	}
+	return completion, ""
+}
+
+// redirectFederatedLogin forwards the browser to the web client page that
+// completes federated sign-ins
+func (h *Handler) redirectFederatedLogin(w http.ResponseWriter, r *http.Request, provider string, status int, params url.Values) {
+	params.Set("provider", provider)
+	http.Redirect(w, r, oauth.WithQuery(h.federatedLoginURL, params), status)
+}
+
+func (h *Handler) auditRejectedResponse(r *http.Request, provider string) {
+	h.recordAudit(r, audit.Event{
+		Type:    audit.EventLoginFailed,
+		Outcome: audit.Failure,
+		Actor:   provider,
+		Details: map[string]any{"reason": "identity provider response rejected", "provider": provider},
+	})
+}
+
+// CompleteFederatedLogin collects the result of a sign-in at an identity
+// provider on the device that started it. Sign-ins answer like Login; links
+// answer with the linked identity.
+func (h *Handler) CompleteFederatedLogin(w http.ResponseWriter, r *http.Request) {
+	clientType := models.ClientType(r.Header.Get("X-Client-Type"))
+	if !clientType.IsValid() {
+		http.Error(w, "Invalid client type", http.StatusBadRequest)
+		return
+	}
+
+	var req models.CompleteFederatedLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ip, deviceFingerprint, err := h.deviceFingerprint(r, clientType)
+	if err != nil {
+		log.Printf("Failed to fingerprint device: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	login, err := h.conn.ConsumeFederatedLogin(oauth.HashToken(req.Code), time.Now())
+	if errors.Is(err, db.ErrFederatedLoginNotFound) {
+		http.Error(w, "Unknown or expired code", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	// A code that leaked from the browser is of no use on another device
+	if login.Fingerprint != deviceFingerprint {
+		writeErrorResponse(w, http.StatusForbidden, "The sign-in was started on another device")
+		return
+	}
+
+	if login.LinkUserId != 0 {
+		h.completeIdentityLink(w, r, login)
+		return
+	}
+
+	user, err := h.federatedUser(r, login)
+	if err != nil {
+		if errors.Is(err, errNoLinkedAccount) {
+			h.recordAudit(r, audit.Event{
+				Type:    audit.EventLoginFailed,
+				Outcome: audit.Denied,
+				Actor:   login.Provider + ":" + login.Subject,
+				Details: map[string]any{"reason": "no linked account", "provider": login.Provider},
+			})
+			writeErrorResponse(w, http.StatusForbidden, "No account is linked to this identity")
+			return
+		}
+		writeUserError(w, err)
+		return
+	}
+
+	h.signIn(w, r, signInParams{
+		User:       user,
+		ClientType: clientType,
+		ClientData: req.ClientData,
+		Scope:      req.Scope,
+		IP:         ip,
+		AuthMethod: oidc.AMRFederated,
+	})
+}
+
+// federatedUser finds the user an identity is linked to, creating an account
+// for it when the provider allows
+func (h *Handler) federatedUser(r *http.Request, login *entity.FederatedLogin) (*entity.User, error) {
+	identity, err := h.conn.GetFederatedIdentity(login.Provider, login.Subject)
+	if err == nil {
+		if err := h.conn.TouchFederatedIdentity(identity.Id, login.Email, time.Now()); err != nil {
+			log.Printf("Failed to record sign-in with %s identity: %v", login.Provider, err)
+		}
+		return h.conn.Retrieve(int(identity.UserId))
+	}
+	if !errors.Is(err, db.ErrFederatedIdentityNotFound) {
+		return nil, err
+	}
+
+	if !h.federatedProvision(login.Provider) {
+		return nil, errNoLinkedAccount
+	}
+	return h.provisionFederatedUser(r, login)
+}
+
+// federatedProvision reports whether a provider may create accounts
+func (h *Handler) federatedProvision(name string) bool {
+	if provider, ok := h.federation.Get(name); ok {
+		return provider.Provision()
+	}
+	if provider, ok := h.saml.Get(name); ok {
+		return provider.Provision()
+	}
+	return false
+}
+
+// provisionFederatedUser creates the account of a user signing in with an
+// identity for the first time
+func (h *Handler) provisionFederatedUser(r *http.Request, login *entity.FederatedLogin) (*entity.User, error) {
+	username, err := h.federatedUsername(login)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := token.NewUserSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user := entity.User{
+		Username:      username,
+		CreatedAt:     now,
+		Description:   login.PreferredUsername,
+		Email:         login.Email,
+		EmailVerified: login.EmailVerified,
+		Secret:        secret,
+		Source:        entity.UserSourceFederated,
+	}
+
+	err = h.conn.InTx(func(tx *db.Connection) error {
+		id, err := tx.Insert(&user)
+		if err != nil {
+			return err
+		}
+		user.Id = int64(id)
+
+		// Insert leaves the address unverified, the provider may know better
+		if user.EmailVerified {
+			if err := tx.UpdateUser(&user); err != nil {
+				return err
+			}
+		}
+
+		err = tx.CreateFederatedIdentity(&entity.FederatedIdentity{
+			UserId:    user.Id,
+			Provider:  login.Provider,
+			Subject:   login.Subject,
+			Email:     login.Email,
+			CreatedAt: now,
+		})
+		if err != nil {
+			return err
+		}
+
+		return publish(tx, webhook.EventUserRegistered, webhook.UserEvent{
+			UserID:   user.Id,
+			Username: user.Username,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventUserRegistered,
+		Outcome:    audit.Success,
+		ActorId:    user.Id,
+		Actor:      user.Username,
+		TargetType: audit.TargetUser,
+		TargetId:   userTargetId(&user),
+		Details:    map[string]any{"provider": login.Provider},
+	})
+	return &user, nil
+}
+
+// federatedUsername derives the username of a provisioned account from the
+// provider and the subject it vouched for. Names the user controls at the
+// provider, like the preferred username or email, could claim an account
+// name meant for someone else, so they are not used.
+func (h *Handler) federatedUsername(login *entity.FederatedLogin) (string, error) {
+	username := login.Provider + "-" + login.Subject
+
+	_, err := h.conn.GetUser(username)
+	if err == nil {
+		return "", fmt.Errorf("username %s of %s identity is already taken", username, login.Provider)
+	}
+	if !errors.Is(err, db.ErrUsernameNotFound) {
+		return "", err
+	}
+	return username, nil
+}
+
+// completeIdentityLink links the identity a user signed in with at the
+// provider to their account
+func (h *Handler) completeIdentityLink(w http.ResponseWriter, r *http.Request, login *entity.FederatedLogin) {
+	user, err := h.conn.Retrieve(int(login.LinkUserId))
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	identity := &entity.FederatedIdentity{
+		UserId:    user.Id,
+		Provider:  login.Provider,
+		Subject:   login.Subject,
+		Email:     login.Email,
+		CreatedAt: time.Now(),
+	}
+
+	if err := h.conn.CreateFederatedIdentity(identity); err != nil {
+		if errors.Is(err, db.ErrFederatedIdentityExists) {
+			writeErrorResponse(w, http.StatusConflict, "The identity or an identity at this provider is already linked")
+			return
+		}
+		writeUserError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventIdentityLinked,
+		Outcome:    audit.Success,
+		ActorId:    user.Id,
+		Actor:      user.Username,
+		TargetType: audit.TargetUser,
+		TargetId:   userTargetId(user),
+		Details:    map[string]any{"provider": login.Provider},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(identityResponse(identity))
+}
+
+// ListIdentities lists the identities linked to the caller's account
+func (h *Handler) ListIdentities(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(utils.ClaimsKey).(*models.UserClaims)
+
+	user, err := h.conn.GetUser(claims.Username)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	identities, err := h.conn.ListFederatedIdentities(user.Id)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	response := make([]models.IdentityResponse, 0, len(identities))
+	for _, identity := range identities {
+		response = append(response, identityResponse(identity))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// UnlinkIdentity removes the link to the caller's identity at a provider
+func (h *Handler) UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(utils.ClaimsKey).(*models.UserClaims)
+
+	user, err := h.conn.GetUser(claims.Username)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	provider := r.PathValue("provider")
+	if err := h.conn.DeleteFederatedIdentity(user.Id, provider); err != nil {
+		if errors.Is(err, db.ErrFederatedIdentityNotFound) {
+			http.Error(w, "Identity not found", http.StatusNotFound)
+			return
+		}
+		writeUserError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventIdentityUnlinked,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetUser,
+		TargetId:   userTargetId(user),
+		Details:    map[string]any{"provider": provider},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deviceFingerprint derives the fingerprint of the device making a request
+// the way Login does
+func (h *Handler) deviceFingerprint(r *http.Request, clientType models.ClientType) (ip string, deviceFingerprint string, err error) {
+	ip, err = utils.GetIP(r)
+	if err != nil {
+		return "", "", err
+	}
+
+	deviceFingerprint, err = h.fingerprintManager.GenerateFingerprint(fingerprint.Params{
+		ClientType:        clientType,
+		ClientFingerprint: utils.SanitizeHeader(r.Header.Get("X-Fingerprint")),
+		Ip:                ip,
+		UserAgent:         utils.SanitizeHeader(r.UserAgent()),
+	})
+	return ip, deviceFingerprint, err
+}
+
+func identityResponse(identity *entity.FederatedIdentity) models.IdentityResponse {
+	return models.IdentityResponse{
+		Provider:    identity.Provider,
+		Email:       identity.Email,
+		CreatedAt:   identity.CreatedAt,
+		LastLoginAt: identity.LastLoginAt,
+	}
+}
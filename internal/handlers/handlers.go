@@ -1,21 +1,128 @@
 package handlers
 
 import (
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/audit"
+	"github.com/joeariasc/go-auth/internal/auth/authn"
+	"github.com/joeariasc/go-auth/internal/auth/federation"
 	"github.com/joeariasc/go-auth/internal/auth/fingerprint"
+	"github.com/joeariasc/go-auth/internal/auth/oidc"
+	"github.com/joeariasc/go-auth/internal/auth/risk"
+	"github.com/joeariasc/go-auth/internal/auth/saml"
+	"github.com/joeariasc/go-auth/internal/auth/scope"
+	"github.com/joeariasc/go-auth/internal/auth/session"
 	"github.com/joeariasc/go-auth/internal/auth/token"
 	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/geoip"
+	"github.com/joeariasc/go-auth/internal/notify"
 )
 
 type Handler struct {
 	fingerprintManager *fingerprint.Manager
 	tokenManager       *token.Manager
+	sessionManager     *session.Manager
+	riskEngine         *risk.Engine
+	scopes             *scope.Registry
+	notifier           *notify.Notifier
+	locator            geoip.Locator
+	auditLog           *audit.Logger
+	oidc               *oidc.Provider
+	federation         *federation.Registry
+	saml               *saml.Registry
+	authenticator      authn.Authenticator
 	conn               *db.Connection
+
+	deletionGracePeriod time.Duration
+	reauthMaxAge        time.Duration
+
+	oauthLoginURL        string
+	oauthCodeTTL         time.Duration
+	oauthRefreshTokenTTL time.Duration
+
+	oauthDeviceURL          string
+	oauthDeviceCodeTTL      time.Duration
+	oauthDevicePollInterval time.Duration
+
+	federatedLoginURL string
+
+	scimBaseURL string
+}
+
+type HandlerConfig struct {
+	FingerprintManager *fingerprint.Manager
+	TokenManager       *token.Manager
+	SessionManager     *session.Manager
+	RiskEngine         *risk.Engine
+	Scopes             *scope.Registry
+	Notifier           *notify.Notifier
+	Locator            geoip.Locator // optional
+	AuditLog           *audit.Logger
+	OIDC               *oidc.Provider
+	Federation         *federation.Registry
+	SAML               *saml.Registry
+	// Authenticator verifies the passwords of Login
+	Authenticator authn.Authenticator
+	Conn          *db.Connection
+
+	// DeletionGracePeriod is how long a deleted account can still be restored
+	// by signing in, ReauthMaxAge how recent the login must be to delete it
+	// or to trust a device
+	DeletionGracePeriod time.Duration
+	ReauthMaxAge        time.Duration
+
+	// OAuthLoginURL is the page of the web client where users sign in and
+	// approve authorization requests. Codes are valid for OAuthCodeTTL,
+	// OAuth sessions and their refresh tokens for OAuthRefreshTokenTTL.
+	OAuthLoginURL        string
+	OAuthCodeTTL         time.Duration
+	OAuthRefreshTokenTTL time.Duration
+
+	// OAuthDeviceURL is the page of the web client where users enter the
+	// code of a device. Device codes are valid for OAuthDeviceCodeTTL and may
+	// be polled every OAuthDevicePollInterval.
+	OAuthDeviceURL          string
+	OAuthDeviceCodeTTL      time.Duration
+	OAuthDevicePollInterval time.Duration
+
+	// FederatedLoginURL is the page of the web client that completes a
+	// sign-in at an identity provider
+	FederatedLoginURL string
+
+	// SCIMBaseURL is the public address of the SCIM endpoints, resources
+	// link to themselves below it
+	SCIMBaseURL string
 }
 
-func NewHandler(fm *fingerprint.Manager, tm *token.Manager, conn *db.Connection) *Handler {
+func NewHandler(config HandlerConfig) *Handler {
 	return &Handler{
-		fingerprintManager: fm,
-		tokenManager:       tm,
-		conn:               conn,
+		fingerprintManager: config.FingerprintManager,
+		tokenManager:       config.TokenManager,
+		sessionManager:     config.SessionManager,
+		riskEngine:         config.RiskEngine,
+		scopes:             config.Scopes,
+		notifier:           config.Notifier,
+		locator:            config.Locator,
+		auditLog:           config.AuditLog,
+		oidc:               config.OIDC,
+		federation:         config.Federation,
+		saml:               config.SAML,
+		authenticator:      config.Authenticator,
+		conn:               config.Conn,
+
+		deletionGracePeriod: config.DeletionGracePeriod,
+		reauthMaxAge:        config.ReauthMaxAge,
+
+		oauthLoginURL:        config.OAuthLoginURL,
+		oauthCodeTTL:         config.OAuthCodeTTL,
+		oauthRefreshTokenTTL: config.OAuthRefreshTokenTTL,
+
+		oauthDeviceURL:          config.OAuthDeviceURL,
+		oauthDeviceCodeTTL:      config.OAuthDeviceCodeTTL,
+		oauthDevicePollInterval: config.OAuthDevicePollInterval,
+
+		federatedLoginURL: config.FederatedLoginURL,
+
+		scimBaseURL: config.SCIMBaseURL,
 	}
 }
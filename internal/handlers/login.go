@@ -2,13 +2,27 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"time"
 
+	"github.com/joeariasc/go-auth/internal/audit"
+	"github.com/joeariasc/go-auth/internal/auth/account"
+	"github.com/joeariasc/go-auth/internal/auth/authn"
 	"github.com/joeariasc/go-auth/internal/auth/fingerprint"
+	"github.com/joeariasc/go-auth/internal/auth/oidc"
+	"github.com/joeariasc/go-auth/internal/auth/risk"
+	"github.com/joeariasc/go-auth/internal/auth/scope"
+	"github.com/joeariasc/go-auth/internal/auth/session"
 	"github.com/joeariasc/go-auth/internal/auth/token"
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
 	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/notify"
 	"github.com/joeariasc/go-auth/internal/utils"
+	"github.com/joeariasc/go-auth/internal/webhook"
 )
 
 func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
@@ -25,90 +39,375 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := h.conn.GetUser(req.Username)
+	ip, err := utils.GetIP(r)
 
 	if err != nil {
+		log.Printf("Failed to get IP: %v", err)
+		http.Error(w, "Failed to get IP", http.StatusInternalServerError)
+		return
+	}
+
+	identity, err := h.authenticator.Authenticate(r.Context(), req.Username, req.Password)
+
+	switch {
+	case errors.Is(err, authn.ErrUnknownUser):
+		h.auditUnknownUser(r, req.Username)
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
+	case errors.Is(err, authn.ErrInvalidCredentials):
+		h.recordLoginAttempt(req.Username, ip, false)
+		if user, err := h.conn.GetUser(req.Username); err == nil {
+			h.auditLogin(r, user, audit.Failure, "invalid password")
+		} else {
+			h.recordAudit(r, audit.Event{
+				Type:    audit.EventLoginFailed,
+				Outcome: audit.Failure,
+				Actor:   req.Username,
+				Details: map[string]any{"reason": "invalid password"},
+			})
+		}
+		writeErrorResponse(w, http.StatusUnauthorized, "Invalid username or password")
+		return
+	case err != nil:
+		log.Printf("Failed to authenticate %s: %v", req.Username, err)
+		writeErrorResponse(w, http.StatusBadGateway, "Authentication service unavailable")
+		return
 	}
 
-	if req.Password == "wwco2025" {
-		clientFingerprint := utils.SanitizeHeader(r.Header.Get("X-Fingerprint"))
+	user, err := h.identityUser(r, identity)
 
-		ip, err := utils.GetIP(r)
+	if errors.Is(err, db.ErrUsernameNotFound) {
+		h.auditUnknownUser(r, identity.Username)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errForeignAccount) {
+		h.recordLoginAttempt(req.Username, ip, false)
+		h.recordAudit(r, audit.Event{
+			Type:    audit.EventLoginFailed,
+			Outcome: audit.Failure,
+			Actor:   req.Username,
+			Details: map[string]any{"reason": "account of another source", "source": identity.Source},
+		})
+		writeErrorResponse(w, http.StatusUnauthorized, "Invalid username or password")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to load the account of %s: %v", identity.Username, err)
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to sign in")
+		return
+	}
+
+	h.signIn(w, r, signInParams{
+		User:       user,
+		ClientType: clientType,
+		ClientData: req.ClientData,
+		Scope:      req.Scope,
+		IP:         ip,
+		AuthMethod: oidc.AMRPassword,
+	})
+}
+
+// signInParams describes a sign-in whose credentials were already verified
+type signInParams struct {
+	User       *entity.User
+	ClientType models.ClientType
+	ClientData *models.ClientData
+	// Space-delimited scopes the token should carry, all allowed when empty
+	Scope string
+	IP    string
+	// AuthMethod is how the credentials were verified, one of the oidc AMR
+	// constants
+	AuthMethod string
+}
+
+// signIn assesses the risk of a sign-in and starts the session, answering
+// the request with the session token or why none was issued
+func (h *Handler) signIn(w http.ResponseWriter, r *http.Request, params signInParams) {
+	user, clientType, ip := params.User, params.ClientType, params.IP
+
+	if err := account.CheckActive(user.Status); err != nil {
+		h.auditLogin(r, user, audit.Denied, account.ErrorCode(err))
+		writeAccountError(w, err)
+		return
+	}
+
+	clientFingerprint := utils.SanitizeHeader(r.Header.Get("X-Fingerprint"))
+
+	fingerprintParams := fingerprint.Params{
+		ClientType:        clientType,
+		ClientFingerprint: clientFingerprint,
+		Ip:                ip,
+		UserAgent:         utils.SanitizeHeader(r.UserAgent()),
+	}
 
+	newFingerprint, err := h.fingerprintManager.GenerateFingerprint(fingerprintParams)
+
+	if err != nil {
+		http.Error(w, "Failed to generate fingerprint", http.StatusInternalServerError)
+		return
+	}
+
+	knownDevice, err := h.conn.GetDeviceByFingerprint(user.Id, newFingerprint)
+
+	if err != nil && !errors.Is(err, db.ErrDeviceNotFound) {
+		log.Printf("Failed to look up device: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	assessment := h.riskEngine.Assess(&risk.Input{
+		Stage:         risk.StageLogin,
+		UserId:        user.Id,
+		Username:      user.Username,
+		ClientType:    clientType,
+		IP:            ip,
+		UserAgent:     fingerprintParams.UserAgent,
+		NewDevice:     knownDevice == nil,
+		TrustedDevice: knownDevice != nil && knownDevice.Trusted,
+		Mobile: params.ClientData.MobileFingerprint(models.BaseFingerprint{
+			ClientType: clientType,
+			IP:         ip,
+			UserAgent:  fingerprintParams.UserAgent,
+		}),
+	})
+
+	switch assessment.Decision {
+	case risk.Deny:
+		log.Printf("Login of %s denied with risk score %d", user.Username, assessment.Score)
+		h.auditLogin(r, user, audit.Denied, "risk")
+		err := publish(h.conn, webhook.EventUserLockedOut, webhook.UserEvent{
+			UserID:     user.Id,
+			Username:   user.Username,
+			ClientType: string(clientType),
+			IP:         ip,
+			Reason:     "risk",
+		})
 		if err != nil {
-			log.Printf("Failed to get IP: %v", err)
-			http.Error(w, "Failed to get IP", http.StatusInternalServerError)
-			return
+			log.Printf("Failed to publish lockout of %s: %v", user.Username, err)
 		}
+		go h.notifyBlockedLogin(user, notify.BlockedLogin{
+			ClientType: clientType,
+			IP:         ip,
+			UserAgent:  fingerprintParams.UserAgent,
+			AttemptAt:  time.Now(),
+		})
+		writeErrorResponse(w, http.StatusForbidden, "Login denied")
+		return
+	case risk.RequireMFA:
+		h.auditLogin(r, user, audit.Denied, "mfa required")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(models.LoginResponse{
+			Success:     false,
+			Message:     "Additional verification required",
+			MFARequired: true,
+		})
+		return
+	}
 
-		fingerprintParams := fingerprint.Params{
-			ClientType:        clientType,
-			ClientFingerprint: clientFingerprint,
-			Ip:                ip,
-			UserAgent:         utils.SanitizeHeader(r.UserAgent()),
-		}
+	roles, err := h.conn.GetUserRoles(user.Id)
 
-		newFingerprint, err := h.fingerprintManager.GenerateFingerprint(fingerprintParams)
+	if err != nil {
+		log.Printf("Failed to load roles: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
-		if err != nil {
-			http.Error(w, "Failed to generate fingerprint", http.StatusInternalServerError)
+	grantedScope, err := h.grantScope(params.Scope, roles)
+
+	if err != nil {
+		if errors.Is(err, scope.ErrInvalidScope) {
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid scope")
 			return
 		}
+		log.Printf("Failed to grant scopes: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
-		user, err := h.conn.SetFingerprint(req.Username, newFingerprint)
-
+	// The device is registered together with the session, so a sign-in refused
+	// by the session limit is still from a new device when retried
+	var newSession *entity.Session
+	var isNewDevice bool
+	err = h.conn.InTx(func(tx *db.Connection) error {
+		var err error
+		newSession, err = h.sessionManager.WithConn(tx).Start(session.StartParams{
+			UserId:     user.Id,
+			ClientType: clientType,
+			IP:         ip,
+			UserAgent:  fingerprintParams.UserAgent,
+			Scope:      grantedScope,
+			AuthMethod: params.AuthMethod,
+		})
 		if err != nil {
-			http.Error(w, "Failed to set fingerprint", http.StatusInternalServerError)
-			return
+			return err
 		}
 
-		tokenParams := token.Params{
-			Username:    req.Username,
-			Fingerprint: newFingerprint,
-			ClientType:  clientType,
-			Secret:      []byte(user.Secret),
+		if _, isNewDevice, err = tx.UpsertDevice(user.Id, newFingerprint, string(clientType)); err != nil {
+			return fmt.Errorf("failed to register device: %w", err)
 		}
 
-		// Generate token
-		newToken, err := h.tokenManager.GenerateToken(tokenParams)
+		return publish(tx, webhook.EventUserLoggedIn, webhook.UserEvent{
+			UserID:     user.Id,
+			Username:   user.Username,
+			ClientType: string(clientType),
+			IP:         ip,
+		})
+	})
 
-		if err != nil {
-			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+	if err != nil {
+		if errors.Is(err, session.ErrSessionLimitReached) {
+			h.auditLogin(r, user, audit.Denied, "session limit")
+			writeErrorResponse(w, http.StatusConflict, "Too many active sessions")
 			return
 		}
+		log.Printf("Failed to create session: %v", err)
+		http.Error(w, "Failed to start session", http.StatusInternalServerError)
+		return
+	}
+
+	tokenParams := token.Params{
+		SessionID:   newSession.JTI,
+		Username:    user.Username,
+		Fingerprint: newFingerprint,
+		ClientType:  clientType,
+		Roles:       roles,
+		Scope:       grantedScope,
+		Secret:      []byte(user.Secret),
+	}
+
+	// Generate token
+	newToken, err := h.tokenManager.GenerateToken(tokenParams)
+
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	h.recordLoginAttempt(user.Username, ip, true)
+	h.recordLoginLocation(user.Id, ip, newSession.CreatedAt)
+
+	h.auditLogin(r, user, audit.Success, "")
 
-		// For web clients, set the fingerprint cookie
-		if clientType == models.WebClient {
-			http.SetCookie(w, &http.Cookie{
-				Name:     "session",
-				Value:    newToken,
-				Path:     "/",
-				HttpOnly: true,
-				Secure:   true,
-				SameSite: http.SameSiteNoneMode,
-				MaxAge:   int(h.tokenManager.TokenDuration),
+	// Signing in during the grace period keeps the account
+	deletionCancelled := false
+	if user.PurgeAfter != nil {
+		deletionCancelled, err = h.conn.CancelDeletion(user.Id)
+		if err != nil {
+			log.Printf("Failed to cancel deletion of %s: %v", user.Username, err)
+		}
+		if deletionCancelled {
+			h.recordAudit(r, audit.Event{
+				Type:       audit.EventDeletionCancelled,
+				Outcome:    audit.Success,
+				ActorId:    user.Id,
+				Actor:      user.Username,
+				TargetType: audit.TargetUser,
+				TargetId:   userTargetId(user),
 			})
 		}
+	}
 
-		// Send response
-		response := models.LoginResponse{
-			Success:         true,
-			Message:         "Login successful",
-			SessionDuration: int(h.tokenManager.TokenDuration),
-		}
+	if isNewDevice {
+		go h.notifyNewDevice(user, newSession)
+	}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
+	// For web clients, set the fingerprint cookie
+	if clientType == models.WebClient {
+		http.SetCookie(w, &http.Cookie{
+			Name:     "session",
+			Value:    newToken,
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: http.SameSiteNoneMode,
+			MaxAge:   int(h.tokenManager.TokenDuration),
+		})
+	}
+
+	// Send response
+	response := models.LoginResponse{
+		Success:           true,
+		Message:           "Login successful",
+		SessionDuration:   int(h.tokenManager.TokenDuration),
+		Scope:             grantedScope,
+		DeletionCancelled: deletionCancelled,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// auditLogin records the outcome of a login of a known user
+func (h *Handler) auditLogin(r *http.Request, user *entity.User, outcome audit.Outcome, reason string) {
+	event := audit.Event{
+		Type:       audit.EventLoginFailed,
+		Outcome:    outcome,
+		ActorId:    user.Id,
+		Actor:      user.Username,
+		TargetType: audit.TargetUser,
+		TargetId:   userTargetId(user),
+	}
+
+	if outcome == audit.Success {
+		event.Type = audit.EventLoginSucceeded
 	} else {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		response := ErrorResponse{
-			Message: "Invalid username or password",
-			Status:  http.StatusUnauthorized,
-		}
-		json.NewEncoder(w).Encode(response)
+		event.Details = map[string]any{"reason": reason}
+	}
+
+	h.recordAudit(r, event)
+}
+
+// grantScope intersects the requested scopes with what the user's roles allow
+func (h *Handler) grantScope(requested string, roles []string) (string, error) {
+	permissions, err := h.conn.PermissionsForRoles(roles)
+	if err != nil {
+		return "", err
+	}
+
+	granted, err := h.scopes.Grant(scope.Parse(requested), permissions)
+	if err != nil {
+		return "", err
+	}
+
+	return scope.Format(granted), nil
+}
+
+func (h *Handler) recordLoginAttempt(username string, ip string, succeeded bool) {
+	err := h.conn.InsertLoginAttempt(&entity.LoginAttempt{
+		Username:    username,
+		IP:          ip,
+		Succeeded:   succeeded,
+		AttemptedAt: time.Now(),
+	})
+	if err != nil {
+		log.Printf("Failed to record login attempt: %v", err)
 	}
+}
 
+// recordLoginLocation remembers where a completed login came from so the
+// next one can be checked for impossible travel
+func (h *Handler) recordLoginLocation(userId int64, ip string, at time.Time) {
+	if h.locator == nil {
+		return
+	}
+
+	location, err := h.locator.Locate(ip)
+	if err != nil || !location.HasCoords {
+		return
+	}
+
+	err = h.conn.InsertLoginLocation(&entity.LoginLocation{
+		UserId:      userId,
+		IP:          ip,
+		City:        location.City,
+		CountryCode: location.CountryCode,
+		Latitude:    location.Latitude,
+		Longitude:   location.Longitude,
+		LoggedInAt:  at,
+	})
+	if err != nil {
+		log.Printf("Failed to record login location: %v", err)
+	}
 }
@@ -1,6 +1,39 @@
 package handlers
 
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/joeariasc/go-auth/internal/auth/account"
+)
+
 type ErrorResponse struct {
 	Message string `json:"message"`
 	Status  int    `json:"status"`
+	Code    string `json:"code,omitempty"`
+}
+
+func writeErrorResponse(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Message: message,
+		Status:  status,
+	})
+}
+
+// writeErrorCode is writeErrorResponse with a machine readable code
+func writeErrorCode(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Message: message,
+		Status:  status,
+		Code:    code,
+	})
+}
+
+// writeAccountError explains why an account that is not active was refused
+func writeAccountError(w http.ResponseWriter, err error) {
+	writeErrorCode(w, http.StatusForbidden, account.ErrorCode(err), err.Error())
 }
@@ -0,0 +1,686 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/audit"
+	"github.com/joeariasc/go-auth/internal/auth/account"
+	"github.com/joeariasc/go-auth/internal/auth/oauth"
+	"github.com/joeariasc/go-auth/internal/auth/oidc"
+	"github.com/joeariasc/go-auth/internal/auth/scope"
+	"github.com/joeariasc/go-auth/internal/auth/token"
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/utils"
+)
+
+// Authorize is where clients send the browser to start the authorization code
+// flow. Valid requests are forwarded to the sign-in page of the web client,
+// which completes them through ApproveAuthorization once the user decided.
+func (h *Handler) Authorize(w http.ResponseWriter, r *http.Request) {
+	req := oauth.ParseAuthorizeRequest(r.URL.Query())
+
+	// Without a trustworthy redirect URI the error can only be shown here
+	client, redirectURI, oauthErr := h.authorizationClient(req)
+	if oauthErr != nil {
+		http.Error(w, oauthErr.Error(), oauthErr.Status())
+		return
+	}
+
+	if oauthErr := req.Validate(client); oauthErr != nil {
+		http.Redirect(w, r, oauth.ErrorRedirect(redirectURI, oauthErr, req.State), http.StatusFound)
+		return
+	}
+
+	if h.oauthLoginURL == "" {
+		log.Printf("OAuth authorization requested but OAUTH_LOGIN_URL is not configured")
+		oauthErr := oauth.NewError(oauth.ErrServerError, "sign-in is not available")
+		http.Redirect(w, r, oauth.ErrorRedirect(redirectURI, oauthErr, req.State), http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, oauth.WithQuery(h.oauthLoginURL, r.URL.Query()), http.StatusFound)
+}
+
+// ApproveAuthorization issues an authorization code for the signed in user,
+// or reports the denial, and tells the sign-in page where to redirect to
+func (h *Handler) ApproveAuthorization(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(utils.ClaimsKey).(*models.UserClaims)
+
+	// Only the user's own session may hand out access to their account
+	if claims.ClientID != "" {
+		writeErrorResponse(w, http.StatusForbidden, "OAuth clients cannot authorize other clients")
+		return
+	}
+	if claims.IsPersonalToken() {
+		writeErrorResponse(w, http.StatusForbidden, "Personal access tokens cannot authorize OAuth clients")
+		return
+	}
+
+	var body models.ApproveAuthorizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req := &oauth.AuthorizeRequest{
+		ClientId:            body.ClientID,
+		RedirectURI:         body.RedirectURI,
+		ResponseType:        body.ResponseType,
+		Scope:               body.Scope,
+		State:               body.State,
+		CodeChallenge:       body.CodeChallenge,
+		CodeChallengeMethod: body.CodeChallengeMethod,
+		Nonce:               body.Nonce,
+	}
+
+	client, redirectURI, oauthErr := h.authorizationClient(req)
+	if oauthErr != nil {
+		writeErrorCode(w, oauthErr.Status(), oauthErr.Code, oauthErr.Description)
+		return
+	}
+
+	redirect := func(location string) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.AuthorizationResponse{RedirectTo: location})
+	}
+
+	if oauthErr := req.Validate(client); oauthErr != nil {
+		redirect(oauth.ErrorRedirect(redirectURI, oauthErr, req.State))
+		return
+	}
+
+	event := audit.Event{
+		Type:       audit.EventOAuthAuthorized,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetClient,
+		TargetId:   client.ClientId,
+	}
+
+	if !body.Approved {
+		event.Outcome = audit.Denied
+		h.recordAudit(r, event)
+		redirect(oauth.ErrorRedirect(redirectURI, oauth.NewError(oauth.ErrAccessDenied, "the user denied the request"), req.State))
+		return
+	}
+
+	user, err := h.conn.GetUser(claims.Username)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	authMethod, err := h.sessionAuthMethod(claims)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	roles, err := h.conn.GetUserRoles(user.Id)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	requested, _ := oauth.RequestedScopes(client, req.Scope)
+	granted, err := h.grantScope(scope.Format(requested), roles)
+	if err != nil && !errors.Is(err, scope.ErrInvalidScope) {
+		writeUserError(w, err)
+		return
+	}
+	if granted == "" {
+		oauthErr := oauth.NewError(oauth.ErrInvalidScope, "none of the requested scopes can be granted")
+		redirect(oauth.ErrorRedirect(redirectURI, oauthErr, req.State))
+		return
+	}
+
+	code, codeHash, err := oauth.NewOpaqueToken()
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	now := time.Now()
+	err = h.conn.CreateAuthorizationCode(&entity.AuthorizationCode{
+		CodeHash:            codeHash,
+		ClientId:            client.ClientId,
+		UserId:              user.Id,
+		RedirectURI:         redirectURI,
+		Scope:               granted,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		Nonce:               req.Nonce,
+		AuthTime:            claims.IssuedAt.Time,
+		AuthMethod:          authMethod,
+		CreatedAt:           now,
+		ExpiresAt:           now.Add(h.oauthCodeTTL),
+	})
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	event.Details = map[string]any{"scope": granted}
+	h.recordAudit(r, event)
+
+	redirect(oauth.CodeRedirect(redirectURI, code, req.State))
+}
+
+// authorizationClient looks up the client of an authorization request and
+// where to redirect its response
+func (h *Handler) authorizationClient(req *oauth.AuthorizeRequest) (*entity.OAuthClient, string, *oauth.Error) {
+	if req.ClientId == "" {
+		return nil, "", oauth.NewError(oauth.ErrInvalidRequest, "client_id is required")
+	}
+
+	client, err := h.conn.GetClient(req.ClientId)
+	if errors.Is(err, db.ErrClientNotFound) {
+		return nil, "", oauth.NewError(oauth.ErrInvalidClient, "unknown client")
+	}
+	if err != nil {
+		log.Printf("Failed to look up OAuth client: %v", err)
+		return nil, "", oauth.NewError(oauth.ErrServerError, "")
+	}
+
+	redirectURI, oauthErr := oauth.ResolveRedirectURI(client, req.RedirectURI)
+	if oauthErr != nil {
+		return nil, "", oauthErr
+	}
+	return client, redirectURI, nil
+}
+
+// Token is the OAuth token endpoint
+func (h *Handler) Token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauth.WriteError(w, oauth.NewError(oauth.ErrInvalidRequest, "malformed request body"))
+		return
+	}
+
+	client, err := h.authenticateClient(r)
+	if err != nil {
+		// RFC 6749 section 5.2: answer failed basic authentication in kind
+		if _, _, ok := r.BasicAuth(); ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="go-auth"`)
+		}
+		writeOAuthError(w, err)
+		return
+	}
+
+	var response *models.TokenResponse
+
+	switch grantType := r.PostForm.Get("grant_type"); grantType {
+	case "authorization_code":
+		response, err = h.exchangeCode(r, client)
+	case "refresh_token":
+		response, err = h.refreshTokens(r, client)
+	case "client_credentials":
+		response, err = h.clientCredentials(r, client)
+	case oauth.GrantTypeDeviceCode:
+		response, err = h.deviceCode(r, client)
+	case "":
+		err = oauth.NewError(oauth.ErrInvalidRequest, "grant_type is required")
+	default:
+		err = oauth.NewError(oauth.ErrUnsupportedGrantType, "")
+	}
+
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
+}
+
+// authenticateClient identifies the client of a token request, checking the
+// credentials of confidential clients
+func (h *Handler) authenticateClient(r *http.Request) (*entity.OAuthClient, error) {
+	credentials, oauthErr := oauth.ParseClientAuthentication(r)
+	if oauthErr != nil {
+		return nil, oauthErr
+	}
+
+	client, err := h.conn.GetClient(credentials.ClientId)
+	if errors.Is(err, db.ErrClientNotFound) {
+		return nil, oauth.NewError(oauth.ErrInvalidClient, "unknown client")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	discovery := h.oidc.Discovery()
+
+	assertion, oauthErr := credentials.Verify(client, []string{discovery.Issuer, discovery.TokenEndpoint}, now)
+	if oauthErr == nil && assertion != nil {
+		err := h.conn.UseClientAssertion(client.ClientId, assertion.ID, assertion.ExpiresAt, now)
+		if errors.Is(err, db.ErrAssertionReplayed) {
+			oauthErr = oauth.NewError(oauth.ErrInvalidClient, "client assertion was already used")
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	if oauthErr != nil {
+		if oauth.IsConfidential(client) {
+			h.recordAudit(r, audit.Event{
+				Type:       audit.EventOAuthClientAuthFailed,
+				Outcome:    audit.Failure,
+				Actor:      "client:" + client.ClientId,
+				TargetType: audit.TargetClient,
+				TargetId:   client.ClientId,
+				Details:    map[string]any{"method": credentials.Method, "reason": oauthErr.Description},
+			})
+		}
+		return nil, oauthErr
+	}
+	return client, nil
+}
+
+// exchangeCode redeems an authorization code, starting an OAuth session
+func (h *Handler) exchangeCode(r *http.Request, client *entity.OAuthClient) (*models.TokenResponse, error) {
+	now := time.Now()
+
+	code, err := h.conn.ConsumeAuthorizationCode(oauth.HashToken(r.PostForm.Get("code")), now)
+	switch {
+	case errors.Is(err, db.ErrCodeUsed):
+		// RFC 6749 section 4.1.2: tokens issued from a replayed code are revoked
+		h.revokeReplayed(r, client, code.UserId, code.SessionJTI, "authorization_code")
+		return nil, oauth.NewError(oauth.ErrInvalidGrant, "authorization code already used")
+	case errors.Is(err, db.ErrCodeNotFound):
+		return nil, oauth.NewError(oauth.ErrInvalidGrant, "unknown authorization code")
+	case err != nil:
+		return nil, err
+	}
+
+	if code.ClientId != client.ClientId || now.After(code.ExpiresAt) {
+		return nil, oauth.NewError(oauth.ErrInvalidGrant, "invalid or expired authorization code")
+	}
+
+	if redirectURI := r.PostForm.Get("redirect_uri"); redirectURI != "" && redirectURI != code.RedirectURI {
+		return nil, oauth.NewError(oauth.ErrInvalidGrant, "redirect_uri does not match the authorization request")
+	}
+
+	if !oauth.VerifyCodeVerifier(code.CodeChallenge, code.CodeChallengeMethod, r.PostForm.Get("code_verifier")) {
+		return nil, oauth.NewError(oauth.ErrInvalidGrant, "code_verifier does not match the code challenge")
+	}
+
+	user, err := h.oauthUser(code.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	var response *models.TokenResponse
+	err = h.conn.InTx(func(tx *db.Connection) error {
+		session, refreshToken, err := h.startOAuthSession(tx, r, client, user, code.Scope, code.AuthTime, code.AuthMethod)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.SetCodeSession(code.CodeHash, session.JTI); err != nil {
+			return err
+		}
+
+		response, err = h.tokenResponse(tx, user, client, session.JTI, code.Scope)
+		if err != nil {
+			return err
+		}
+		response.RefreshToken = refreshToken
+		return h.addIDToken(response, user, client, session.JTI, code.Nonce, code.AuthTime, code.AuthMethod)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h.auditTokenIssued(r, user, client, "authorization_code", response.Scope)
+	return response, nil
+}
+
+// refreshTokens rotates a refresh token and issues a new access token for the
+// same session. The scope may be narrowed but never widened.
+func (h *Handler) refreshTokens(r *http.Request, client *entity.OAuthClient) (*models.TokenResponse, error) {
+	now := time.Now()
+
+	stored, err := h.conn.GetRefreshToken(oauth.HashToken(r.PostForm.Get("refresh_token")))
+	if errors.Is(err, db.ErrRefreshTokenNotFound) {
+		return nil, oauth.NewError(oauth.ErrInvalidGrant, "unknown refresh token")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// A rotated token coming back means two parties hold it
+	if stored.RevokedAt != nil {
+		h.revokeReplayed(r, client, stored.UserId, stored.SessionJTI, "refresh_token")
+		return nil, oauth.NewError(oauth.ErrInvalidGrant, "refresh token was revoked")
+	}
+
+	if stored.ClientId != client.ClientId || now.After(stored.ExpiresAt) {
+		return nil, oauth.NewError(oauth.ErrInvalidGrant, "invalid or expired refresh token")
+	}
+
+	session, err := h.conn.GetSessionByJTI(stored.SessionJTI)
+	if err != nil && !errors.Is(err, db.ErrSessionNotFound) {
+		return nil, err
+	}
+	if session == nil || session.RevokedAt != nil {
+		return nil, oauth.NewError(oauth.ErrInvalidGrant, "the session was signed out")
+	}
+
+	requested := stored.Scope
+	if value := r.PostForm.Get("scope"); value != "" {
+		for _, s := range scope.Parse(value) {
+			if !slices.Contains(scope.Parse(stored.Scope), s) {
+				return nil, oauth.NewError(oauth.ErrInvalidScope, "the scope exceeds the original grant")
+			}
+		}
+		requested = value
+	}
+
+	user, err := h.oauthUser(stored.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	var response *models.TokenResponse
+	err = h.conn.InTx(func(tx *db.Connection) error {
+		if err := tx.RevokeRefreshToken(stored.Id, now); err != nil {
+			if errors.Is(err, db.ErrRefreshTokenNotFound) {
+				return oauth.NewError(oauth.ErrInvalidGrant, "refresh token was revoked")
+			}
+			return err
+		}
+
+		refreshToken, refreshHash, err := oauth.NewOpaqueToken()
+		if err != nil {
+			return err
+		}
+
+		// The session keeps its original lifetime
+		err = tx.CreateRefreshToken(&entity.RefreshToken{
+			TokenHash:  refreshHash,
+			ClientId:   client.ClientId,
+			UserId:     user.Id,
+			SessionJTI: stored.SessionJTI,
+			Scope:      stored.Scope,
+			AuthTime:   stored.AuthTime,
+			AuthMethod: stored.AuthMethod,
+			CreatedAt:  now,
+			ExpiresAt:  stored.ExpiresAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		response, err = h.tokenResponse(tx, user, client, stored.SessionJTI, requested)
+		if err != nil {
+			return err
+		}
+		response.RefreshToken = refreshToken
+		return h.addIDToken(response, user, client, stored.SessionJTI, "", stored.AuthTime, stored.AuthMethod)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h.auditTokenIssued(r, user, client, "refresh_token", response.Scope)
+	return response, nil
+}
+
+// clientCredentials issues a confidential client an access token for itself.
+// Its permissions come from the client's roles; there is no refresh token, the
+// client can simply authenticate again.
+func (h *Handler) clientCredentials(r *http.Request, client *entity.OAuthClient) (*models.TokenResponse, error) {
+	if !oauth.IsConfidential(client) {
+		return nil, oauth.NewError(oauth.ErrUnauthorizedClient, "public clients cannot use the client credentials grant")
+	}
+
+	requested, oauthErr := oauth.RequestedScopes(client, r.PostForm.Get("scope"))
+	if oauthErr != nil {
+		return nil, oauthErr
+	}
+
+	permissions, err := h.conn.PermissionsForRoles(client.Roles)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := h.scopes.Grant(requested, permissions)
+	if err != nil {
+		return nil, oauth.NewError(oauth.ErrInvalidScope, "")
+	}
+
+	// Scopes without a permission give access to the user's own account,
+	// which a client acting for itself does not have
+	granted := []string{}
+	for _, name := range allowed {
+		if s, _ := h.scopes.Lookup(name); s.Permission != "" {
+			granted = append(granted, name)
+		}
+	}
+	if len(granted) == 0 {
+		return nil, oauth.NewError(oauth.ErrInvalidScope, "none of the requested scopes can be granted")
+	}
+
+	tokenId, err := utils.GenerateRandomID()
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := h.tokenManager.GenerateServiceToken(token.ServiceParams{
+		TokenID:  tokenId,
+		ClientID: client.ClientId,
+		Roles:    client.Roles,
+		Scope:    scope.Format(granted),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventOAuthTokenIssued,
+		Outcome:    audit.Success,
+		Actor:      "client:" + client.ClientId,
+		TargetType: audit.TargetClient,
+		TargetId:   client.ClientId,
+		Details:    map[string]any{"grant": "client_credentials", "scope": scope.Format(granted)},
+	})
+
+	return &models.TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(h.tokenManager.TokenDuration.Seconds()),
+		Scope:       scope.Format(granted),
+	}, nil
+}
+
+// oauthUser loads the user a grant was made by, who must still be active
+func (h *Handler) oauthUser(userId int64) (*entity.User, error) {
+	user, err := h.conn.Retrieve(int(userId))
+	if errors.Is(err, db.ErrUsernameNotFound) {
+		return nil, oauth.NewError(oauth.ErrInvalidGrant, "the user no longer exists")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := account.CheckActive(user.Status); err != nil {
+		return nil, oauth.NewError(oauth.ErrInvalidGrant, account.ErrorCode(err))
+	}
+	return user, nil
+}
+
+// sessionAuthMethod returns how the user signed in to the session of claims
+func (h *Handler) sessionAuthMethod(claims *models.UserClaims) (string, error) {
+	session, err := h.conn.GetSessionByJTI(claims.ID)
+	if err != nil {
+		return "", err
+	}
+	return session.AuthMethod, nil
+}
+
+// startOAuthSession records the session of a new grant together with its
+// first refresh token
+func (h *Handler) startOAuthSession(tx *db.Connection, r *http.Request, client *entity.OAuthClient, user *entity.User, grantedScope string, authTime time.Time, authMethod string) (*entity.Session, string, error) {
+	jti, err := utils.GenerateRandomID()
+	if err != nil {
+		return nil, "", err
+	}
+
+	ip, err := utils.GetIP(r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	session := &entity.Session{
+		JTI:        jti,
+		UserId:     user.Id,
+		ClientType: oauth.SessionClientType,
+		IP:         ip,
+		UserAgent:  utils.SanitizeHeader(r.UserAgent()),
+		Scope:      grantedScope,
+		ClientId:   client.ClientId,
+		AuthMethod: authMethod,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(h.oauthRefreshTokenTTL),
+	}
+
+	if session.Id, err = tx.CreateSession(session); err != nil {
+		return nil, "", err
+	}
+
+	refreshToken, refreshHash, err := oauth.NewOpaqueToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = tx.CreateRefreshToken(&entity.RefreshToken{
+		TokenHash:  refreshHash,
+		ClientId:   client.ClientId,
+		UserId:     user.Id,
+		SessionJTI: jti,
+		Scope:      grantedScope,
+		AuthTime:   authTime,
+		AuthMethod: authMethod,
+		CreatedAt:  now,
+		ExpiresAt:  session.ExpiresAt,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return session, refreshToken, nil
+}
+
+// tokenResponse mints an access token for an OAuth session. The scope is
+// granted again so roles the user lost since are no longer covered.
+func (h *Handler) tokenResponse(conn *db.Connection, user *entity.User, client *entity.OAuthClient, sessionJTI string, requested string) (*models.TokenResponse, error) {
+	roles, err := conn.GetUserRoles(user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	granted, err := h.grantScope(requested, roles)
+	if errors.Is(err, scope.ErrInvalidScope) || (err == nil && granted == "") {
+		return nil, oauth.NewError(oauth.ErrInvalidScope, "none of the requested scopes can be granted")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := h.tokenManager.GenerateToken(token.Params{
+		SessionID: sessionJTI,
+		Username:  user.Username,
+		Roles:     roles,
+		Scope:     granted,
+		Secret:    []byte(user.Secret),
+		ClientID:  client.ClientId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(h.tokenManager.TokenDuration.Seconds()),
+		Scope:       granted,
+	}, nil
+}
+
+// addIDToken adds an ID token to the response when the openid scope was
+// granted. The amr and acr claims describe how the user signed in.
+func (h *Handler) addIDToken(response *models.TokenResponse, user *entity.User, client *entity.OAuthClient, sessionJTI string, nonce string, authTime time.Time, authMethod string) error {
+	if !scope.Contains(response.Scope, oidc.ScopeOpenID) {
+		return nil
+	}
+
+	amr, acr := oidc.AuthenticationContext(authMethod)
+
+	idToken, err := h.oidc.SignIDToken(oidc.IDTokenParams{
+		Subject:   oidc.Subject(user),
+		ClientID:  client.ClientId,
+		Nonce:     nonce,
+		SessionID: sessionJTI,
+		AuthTime:  authTime,
+		AMR:       amr,
+		ACR:       acr,
+	})
+	if err != nil {
+		return err
+	}
+
+	response.IDToken = idToken
+	return nil
+}
+
+// revokeReplayed signs out the session issued from a grant that was presented
+// a second time
+func (h *Handler) revokeReplayed(r *http.Request, client *entity.OAuthClient, userId int64, sessionJTI string, grant string) {
+	if sessionJTI != "" {
+		if err := h.conn.RevokeOAuthSession(sessionJTI, time.Now()); err != nil {
+			log.Printf("Failed to revoke OAuth session after %s replay: %v", grant, err)
+		}
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventOAuthReplay,
+		Outcome:    audit.Denied,
+		ActorId:    userId,
+		TargetType: audit.TargetClient,
+		TargetId:   client.ClientId,
+		Details:    map[string]any{"grant": grant},
+	})
+}
+
+func (h *Handler) auditTokenIssued(r *http.Request, user *entity.User, client *entity.OAuthClient, grant string, granted string) {
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventOAuthTokenIssued,
+		Outcome:    audit.Success,
+		ActorId:    user.Id,
+		Actor:      user.Username,
+		TargetType: audit.TargetClient,
+		TargetId:   client.ClientId,
+		Details:    map[string]any{"grant": grant, "scope": granted},
+	})
+}
+
+// writeOAuthError answers the token endpoint with an OAuth error, hiding the
+// details of internal ones
+func writeOAuthError(w http.ResponseWriter, err error) {
+	var oauthErr *oauth.Error
+	if !errors.As(err, &oauthErr) {
+		log.Printf("OAuth token request failed: %v", err)
+		oauthErr = oauth.NewError(oauth.ErrServerError, "")
+	}
+	oauth.WriteError(w, oauthErr)
+}
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/audit"
+	"github.com/joeariasc/go-auth/internal/auth/oauth"
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/utils"
+)
+
+func (h *Handler) ListClients(w http.ResponseWriter, r *http.Request) {
+	clients, err := h.conn.ListClients()
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	response := make([]models.ClientResponse, 0, len(clients))
+	for _, client := range clients {
+		response = append(response, clientResponse(client))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *Handler) GetClient(w http.ResponseWriter, r *http.Request) {
+	client, err := h.conn.GetClient(r.PathValue("clientId"))
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clientResponse(client))
+}
+
+// CreateClient registers an OAuth client and generates its client ID
+func (h *Handler) CreateClient(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Validate(); err != nil || !h.knownScopes(req.Scopes) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.checkRoles(req.Roles); err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	clientId, err := utils.GenerateRandomID()
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	client := entity.OAuthClient{
+		ClientId:     clientId,
+		Name:         req.Name,
+		RedirectURIs: req.RedirectURIs,
+		Scopes:       req.Scopes,
+		Roles:        req.Roles,
+		CreatedAt:    time.Now(),
+
+		PostLogoutRedirectURIs:  req.PostLogoutRedirectURIs,
+		TokenEndpointAuthMethod: req.TokenEndpointAuthMethod,
+	}
+	if client.TokenEndpointAuthMethod == "" {
+		client.TokenEndpointAuthMethod = oauth.AuthMethodNone
+	}
+	for _, list := range []*[]string{&client.RedirectURIs, &client.PostLogoutRedirectURIs, &client.Roles} {
+		if *list == nil {
+			*list = []string{}
+		}
+	}
+
+	var secret string
+	switch client.TokenEndpointAuthMethod {
+	case oauth.AuthMethodSecretBasic, oauth.AuthMethodSecretPost:
+		if secret, client.SecretHash, err = oauth.GenerateClientSecret(); err != nil {
+			writeClientError(w, err)
+			return
+		}
+	case oauth.AuthMethodPrivateKeyJWT:
+		if _, err := oauth.ParseJWKS(req.JWKS); err != nil {
+			http.Error(w, "Invalid jwks", http.StatusBadRequest)
+			return
+		}
+		client.JWKS = req.JWKS
+	}
+
+	if err := h.conn.CreateClient(&client); err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventClientCreated,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetClient,
+		TargetId:   client.ClientId,
+		Details: map[string]any{"name": client.Name, "redirectUris": client.RedirectURIs, "scopes": client.Scopes,
+			"tokenEndpointAuthMethod": client.TokenEndpointAuthMethod, "roles": client.Roles},
+	})
+
+	response := clientResponse(&client)
+	response.ClientSecret = secret
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *Handler) UpdateClient(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Validate(); err != nil || (req.Scopes != nil && !h.knownScopes(*req.Scopes)) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	client, err := h.conn.GetClient(r.PathValue("clientId"))
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	if req.Name != nil {
+		client.Name = *req.Name
+	}
+	if req.RedirectURIs != nil {
+		client.RedirectURIs = *req.RedirectURIs
+	}
+	if req.Scopes != nil {
+		client.Scopes = *req.Scopes
+	}
+	if req.PostLogoutRedirectURIs != nil {
+		client.PostLogoutRedirectURIs = *req.PostLogoutRedirectURIs
+	}
+	if req.Roles != nil {
+		if err := h.checkRoles(*req.Roles); err != nil {
+			writeClientError(w, err)
+			return
+		}
+		client.Roles = *req.Roles
+	}
+	if req.JWKS != nil {
+		if client.TokenEndpointAuthMethod != oauth.AuthMethodPrivateKeyJWT {
+			http.Error(w, "Only private_key_jwt clients have keys", http.StatusBadRequest)
+			return
+		}
+		if _, err := oauth.ParseJWKS(req.JWKS); err != nil {
+			http.Error(w, "Invalid jwks", http.StatusBadRequest)
+			return
+		}
+		client.JWKS = req.JWKS
+	}
+
+	if err := h.conn.UpdateClient(client); err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventClientUpdated,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetClient,
+		TargetId:   client.ClientId,
+		Details: map[string]any{"name": client.Name, "redirectUris": client.RedirectURIs, "scopes": client.Scopes,
+			"roles": client.Roles, "keysChanged": req.JWKS != nil},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clientResponse(client))
+}
+
+// DeleteClient removes a client. Its refresh tokens go with it, access tokens
+// already issued run out on their own.
+func (h *Handler) DeleteClient(w http.ResponseWriter, r *http.Request) {
+	clientId := r.PathValue("clientId")
+
+	if err := h.conn.DeleteClient(clientId); err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventClientDeleted,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetClient,
+		TargetId:   clientId,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RotateClientSecret replaces the secret of a client_secret_* client. The new
+// secret is only ever returned in this response.
+func (h *Handler) RotateClientSecret(w http.ResponseWriter, r *http.Request) {
+	client, err := h.conn.GetClient(r.PathValue("clientId"))
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	if client.TokenEndpointAuthMethod != oauth.AuthMethodSecretBasic && client.TokenEndpointAuthMethod != oauth.AuthMethodSecretPost {
+		http.Error(w, "The client does not authenticate with a secret", http.StatusBadRequest)
+		return
+	}
+
+	secret, secretHash, err := oauth.GenerateClientSecret()
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	if err := h.conn.SetClientSecret(client.ClientId, secretHash); err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventClientSecretRotated,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetClient,
+		TargetId:   client.ClientId,
+	})
+
+	response := clientResponse(client)
+	response.ClientSecret = secret
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// checkRoles makes sure every role exists
+func (h *Handler) checkRoles(roles []string) error {
+	for _, name := range roles {
+		if _, err := h.conn.GetRole(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// knownScopes reports whether every scope is registered
+func (h *Handler) knownScopes(scopes []string) bool {
+	for _, name := range scopes {
+		if _, ok := h.scopes.Lookup(name); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func clientResponse(client *entity.OAuthClient) models.ClientResponse {
+	return models.ClientResponse{
+		ClientID:     client.ClientId,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectURIs,
+		Scopes:       client.Scopes,
+		CreatedAt:    client.CreatedAt,
+
+		PostLogoutRedirectURIs:  client.PostLogoutRedirectURIs,
+		TokenEndpointAuthMethod: client.TokenEndpointAuthMethod,
+		JWKS:                    client.JWKS,
+		Roles:                   client.Roles,
+	}
+}
+
+func writeClientError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, db.ErrClientNotFound):
+		http.Error(w, "Client not found", http.StatusNotFound)
+	case errors.Is(err, db.ErrRoleNotFound):
+		http.Error(w, "Unknown role", http.StatusBadRequest)
+	default:
+		log.Printf("Error managing OAuth clients: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
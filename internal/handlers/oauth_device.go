@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/audit"
+	"github.com/joeariasc/go-auth/internal/auth/oauth"
+	"github.com/joeariasc/go-auth/internal/auth/scope"
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/utils"
+)
+
+// userCodeAttempts bounds the retries when a generated user code is taken
+const userCodeAttempts = 3
+
+// DeviceAuthorization starts the device authorization grant for clients that
+// cannot receive a redirect, RFC 8628 section 3.1
+func (h *Handler) DeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauth.WriteError(w, oauth.NewError(oauth.ErrInvalidRequest, "malformed request body"))
+		return
+	}
+
+	client, err := h.authenticateClient(r)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	requested, oauthErr := oauth.RequestedScopes(client, r.PostForm.Get("scope"))
+	if oauthErr != nil {
+		oauth.WriteError(w, oauthErr)
+		return
+	}
+
+	deviceCode, deviceCodeHash, err := oauth.NewOpaqueToken()
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	now := time.Now()
+	grant := &entity.DeviceGrant{
+		DeviceCodeHash: deviceCodeHash,
+		ClientId:       client.ClientId,
+		Scope:          scope.Format(requested),
+		Status:         entity.DeviceGrantPending,
+		Interval:       h.oauthDevicePollInterval,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(h.oauthDeviceCodeTTL),
+	}
+
+	for attempt := 0; ; attempt++ {
+		if grant.UserCode, err = oauth.NewUserCode(); err != nil {
+			writeOAuthError(w, err)
+			return
+		}
+
+		err = h.conn.CreateDeviceGrant(grant)
+		if !errors.Is(err, db.ErrUserCodeExists) || attempt == userCodeAttempts-1 {
+			break
+		}
+	}
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	verificationURI := h.oidc.Issuer() + "/oauth/device"
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(models.DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                grant.UserCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: oauth.WithQuery(verificationURI, url.Values{"user_code": {grant.UserCode}}),
+		ExpiresIn:               int(h.oauthDeviceCodeTTL.Seconds()),
+		Interval:                int(grant.Interval.Seconds()),
+	})
+}
+
+// DeviceVerification is the short address users type in. It forwards to the
+// page of the web client where they sign in and enter the code.
+func (h *Handler) DeviceVerification(w http.ResponseWriter, r *http.Request) {
+	if h.oauthDeviceURL == "" {
+		log.Printf("Device verification requested but OAUTH_DEVICE_URL is not configured")
+		http.Error(w, "Device sign-in is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	query := url.Values{}
+	if userCode := r.URL.Query().Get("user_code"); userCode != "" {
+		query.Set("user_code", userCode)
+	}
+	http.Redirect(w, r, oauth.WithQuery(h.oauthDeviceURL, query), http.StatusFound)
+}
+
+// GetDeviceGrant shows the signed in user which client a code belongs to and
+// what it asks for
+func (h *Handler) GetDeviceGrant(w http.ResponseWriter, r *http.Request) {
+	grant, ok := h.pendingDeviceGrant(w, r, r.URL.Query().Get("user_code"))
+	if !ok {
+		return
+	}
+
+	client, err := h.conn.GetClient(grant.ClientId)
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.DeviceGrantResponse{
+		UserCode:   grant.UserCode,
+		ClientID:   client.ClientId,
+		ClientName: client.Name,
+		Scopes:     scope.Parse(grant.Scope),
+		ExpiresAt:  grant.ExpiresAt,
+	})
+}
+
+// DecideDeviceGrant records whether the signed in user approves the request
+// of a device. The device picks up the outcome on its next poll.
+func (h *Handler) DecideDeviceGrant(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(utils.ClaimsKey).(*models.UserClaims)
+
+	// Only the user's own session may hand out access to their account
+	if claims.ClientID != "" {
+		writeErrorResponse(w, http.StatusForbidden, "OAuth clients cannot authorize other clients")
+		return
+	}
+	if claims.IsPersonalToken() {
+		writeErrorResponse(w, http.StatusForbidden, "Personal access tokens cannot authorize OAuth clients")
+		return
+	}
+
+	var req models.DecideDeviceGrantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	grant, ok := h.pendingDeviceGrant(w, r, req.UserCode)
+	if !ok {
+		return
+	}
+
+	user, err := h.conn.GetUser(claims.Username)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	event := audit.Event{
+		Type:       audit.EventOAuthAuthorized,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetClient,
+		TargetId:   grant.ClientId,
+		Details:    map[string]any{"grant": "device_code"},
+	}
+
+	grant.UserId = user.Id
+	grant.Status = entity.DeviceGrantDenied
+
+	if req.Approved {
+		roles, err := h.conn.GetUserRoles(user.Id)
+		if err != nil {
+			writeUserError(w, err)
+			return
+		}
+
+		granted, err := h.grantScope(grant.Scope, roles)
+		if err != nil && !errors.Is(err, scope.ErrInvalidScope) {
+			writeUserError(w, err)
+			return
+		}
+		if granted == "" {
+			writeErrorCode(w, http.StatusForbidden, oauth.ErrInvalidScope, "None of the requested scopes can be granted")
+			return
+		}
+
+		authMethod, err := h.sessionAuthMethod(claims)
+		if err != nil {
+			writeUserError(w, err)
+			return
+		}
+
+		authTime := claims.IssuedAt.Time
+		grant.Status = entity.DeviceGrantApproved
+		grant.Scope = granted
+		grant.AuthTime = &authTime
+		grant.AuthMethod = authMethod
+		event.Details["scope"] = granted
+	} else {
+		event.Outcome = audit.Denied
+	}
+
+	if err := h.conn.DecideDeviceGrant(grant, time.Now()); err != nil {
+		if errors.Is(err, db.ErrDeviceGrantNotFound) {
+			http.Error(w, "Unknown or expired code", http.StatusNotFound)
+			return
+		}
+		writeUserError(w, err)
+		return
+	}
+
+	h.recordAudit(r, event)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pendingDeviceGrant looks up the grant of a user code that still awaits a
+// decision, answering the request itself when there is none
+func (h *Handler) pendingDeviceGrant(w http.ResponseWriter, r *http.Request, userCode string) (*entity.DeviceGrant, bool) {
+	grant, err := h.conn.GetDeviceGrantByUserCode(oauth.NormalizeUserCode(userCode))
+	if err != nil && !errors.Is(err, db.ErrDeviceGrantNotFound) {
+		writeUserError(w, err)
+		return nil, false
+	}
+
+	if grant == nil || grant.Status != entity.DeviceGrantPending || time.Now().After(grant.ExpiresAt) {
+		// Codes are short, so guessing is worth watching
+		h.recordAudit(r, audit.Event{
+			Type:    audit.EventOAuthUserCodeRejected,
+			Outcome: audit.Failure,
+		})
+		http.Error(w, "Unknown or expired code", http.StatusNotFound)
+		return nil, false
+	}
+	return grant, true
+}
+
+// deviceCode answers a polling device, issuing tokens once the user approved
+func (h *Handler) deviceCode(r *http.Request, client *entity.OAuthClient) (*models.TokenResponse, error) {
+	now := time.Now()
+
+	grant, err := h.conn.GetDeviceGrant(oauth.HashToken(r.PostForm.Get("device_code")))
+	if errors.Is(err, db.ErrDeviceGrantNotFound) {
+		return nil, oauth.NewError(oauth.ErrInvalidGrant, "unknown device code")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if grant.ClientId != client.ClientId {
+		return nil, oauth.NewError(oauth.ErrInvalidGrant, "unknown device code")
+	}
+
+	if now.After(grant.ExpiresAt) && grant.Status != entity.DeviceGrantConsumed {
+		return nil, oauth.NewError(oauth.ErrExpiredToken, "the device code expired")
+	}
+
+	switch grant.Status {
+	case entity.DeviceGrantPending:
+		interval := grant.Interval
+		pollErr := oauth.NewError(oauth.ErrAuthorizationPending, "")
+
+		if grant.LastPolledAt != nil && now.Sub(*grant.LastPolledAt) < grant.Interval {
+			interval += oauth.SlowDownIncrement
+			pollErr = oauth.NewError(oauth.ErrSlowDown, "")
+		}
+
+		if err := h.conn.PollDeviceGrant(grant.Id, interval, now); err != nil {
+			return nil, err
+		}
+		return nil, pollErr
+	case entity.DeviceGrantDenied:
+		return nil, oauth.NewError(oauth.ErrAccessDenied, "the user denied the request")
+	case entity.DeviceGrantConsumed:
+		return nil, oauth.NewError(oauth.ErrInvalidGrant, "device code already used")
+	}
+
+	user, err := h.oauthUser(grant.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	var response *models.TokenResponse
+	err = h.conn.InTx(func(tx *db.Connection) error {
+		if err := tx.ConsumeDeviceGrant(grant.Id); err != nil {
+			if errors.Is(err, db.ErrDeviceGrantNotFound) {
+				return oauth.NewError(oauth.ErrInvalidGrant, "device code already used")
+			}
+			return err
+		}
+
+		session, refreshToken, err := h.startOAuthSession(tx, r, client, user, grant.Scope, *grant.AuthTime, grant.AuthMethod)
+		if err != nil {
+			return err
+		}
+
+		response, err = h.tokenResponse(tx, user, client, session.JTI, grant.Scope)
+		if err != nil {
+			return err
+		}
+		response.RefreshToken = refreshToken
+		return h.addIDToken(response, user, client, session.JTI, "", *grant.AuthTime, grant.AuthMethod)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h.auditTokenIssued(r, user, client, "device_code", response.Scope)
+	return response, nil
+}
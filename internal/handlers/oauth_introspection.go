@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/audit"
+	"github.com/joeariasc/go-auth/internal/auth/account"
+	"github.com/joeariasc/go-auth/internal/auth/fingerprint"
+	"github.com/joeariasc/go-auth/internal/auth/oauth"
+	"github.com/joeariasc/go-auth/internal/auth/token"
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/utils"
+)
+
+// Introspect tells a confidential client, typically an API gateway, whether a
+// token is active and what it grants, RFC 7662.
+//
+// Session tokens of this service's own clients are bound to the device they
+// were issued to. They are only reported active when the caller passes on
+// what it received from that device: client_type, client_fingerprint,
+// client_ip and user_agent.
+func (h *Handler) Introspect(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauth.WriteError(w, oauth.NewError(oauth.ErrInvalidRequest, "malformed request body"))
+		return
+	}
+
+	client, err := h.authenticateClient(r)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	if !oauth.IsConfidential(client) {
+		oauth.WriteError(w, oauth.NewError(oauth.ErrUnauthorizedClient, "only confidential clients may introspect tokens"))
+		return
+	}
+
+	tokenString := r.PostForm.Get("token")
+	if tokenString == "" {
+		oauth.WriteError(w, oauth.NewError(oauth.ErrInvalidRequest, "token is required"))
+		return
+	}
+
+	var response models.IntrospectionResponse
+	if isJWT(tokenString) || token.IsPersonalToken(tokenString) {
+		response = h.introspectAccessToken(r, tokenString)
+	} else {
+		response, err = h.introspectRefreshToken(tokenString)
+		if err != nil {
+			writeOAuthError(w, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
+}
+
+// introspectAccessToken verifies an access token or personal access token the
+// way AuthMiddleware would. Tokens that fail for any reason are inactive.
+func (h *Handler) introspectAccessToken(r *http.Request, tokenString string) models.IntrospectionResponse {
+	var claims *models.UserClaims
+	var err error
+
+	switch {
+	case token.IsPersonalToken(tokenString):
+		claims, err = h.tokenManager.VerifyPersonalToken(tokenString)
+	case token.IsServiceToken(tokenString):
+		claims, err = h.tokenManager.VerifyServiceToken(tokenString)
+	case token.IsClientToken(tokenString):
+		claims, err = h.tokenManager.VerifyClientToken(tokenString)
+	default:
+		claims, err = h.verifyForwardedSessionToken(r, tokenString)
+	}
+	if err != nil {
+		return models.IntrospectionResponse{Active: false}
+	}
+
+	response := models.IntrospectionResponse{
+		Active:      true,
+		Scope:       claims.Scope,
+		ClientID:    claims.ClientID,
+		Username:    claims.Username,
+		TokenType:   "Bearer",
+		Subject:     claims.Subject,
+		Issuer:      h.oidc.Issuer(),
+		JTI:         claims.ID,
+		Roles:       claims.Roles,
+		SubjectType: models.SubjectUser,
+	}
+	if claims.IsClient() {
+		response.SubjectType = models.SubjectClient
+	}
+	if claims.ExpiresAt != nil {
+		response.ExpiresAt = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		response.IssuedAt = claims.IssuedAt.Unix()
+	}
+	if claims.NotBefore != nil {
+		response.NotBefore = claims.NotBefore.Unix()
+	}
+	return response
+}
+
+// verifyForwardedSessionToken verifies a session token against the device
+// details the introspecting client forwarded
+func (h *Handler) verifyForwardedSessionToken(r *http.Request, tokenString string) (*models.UserClaims, error) {
+	clientType := models.ClientType(r.PostForm.Get("client_type"))
+	clientFingerprint := utils.SanitizeHeader(r.PostForm.Get("client_fingerprint"))
+	if !clientType.IsValid() || clientFingerprint == "" {
+		return nil, token.ErrInvalidFingerprint
+	}
+
+	currentFingerprint, err := h.fingerprintManager.GenerateFingerprint(fingerprint.Params{
+		ClientType:        clientType,
+		ClientFingerprint: clientFingerprint,
+		Ip:                r.PostForm.Get("client_ip"),
+		UserAgent:         utils.SanitizeHeader(r.PostForm.Get("user_agent")),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return h.tokenManager.VerifyToken(tokenString, currentFingerprint)
+}
+
+// introspectRefreshToken describes a refresh token, active while neither it
+// nor its session was revoked and its user may still sign in
+func (h *Handler) introspectRefreshToken(tokenString string) (models.IntrospectionResponse, error) {
+	inactive := models.IntrospectionResponse{Active: false}
+
+	stored, err := h.conn.GetRefreshToken(oauth.HashToken(tokenString))
+	if errors.Is(err, db.ErrRefreshTokenNotFound) {
+		return inactive, nil
+	}
+	if err != nil {
+		return inactive, err
+	}
+
+	if stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return inactive, nil
+	}
+
+	session, err := h.conn.GetSessionByJTI(stored.SessionJTI)
+	if errors.Is(err, db.ErrSessionNotFound) {
+		return inactive, nil
+	}
+	if err != nil {
+		return inactive, err
+	}
+	if session.RevokedAt != nil {
+		return inactive, nil
+	}
+
+	user, err := h.conn.Retrieve(int(stored.UserId))
+	if errors.Is(err, db.ErrUsernameNotFound) {
+		return inactive, nil
+	}
+	if err != nil {
+		return inactive, err
+	}
+	if account.CheckActive(user.Status) != nil {
+		return inactive, nil
+	}
+
+	return models.IntrospectionResponse{
+		Active:      true,
+		Scope:       stored.Scope,
+		ClientID:    stored.ClientId,
+		Username:    user.Username,
+		TokenType:   "refresh_token",
+		ExpiresAt:   stored.ExpiresAt.Unix(),
+		IssuedAt:    stored.CreatedAt.Unix(),
+		Subject:     user.Username,
+		Issuer:      h.oidc.Issuer(),
+		SubjectType: models.SubjectUser,
+	}, nil
+}
+
+// Revoke lets a client revoke an access or refresh token issued to it,
+// RFC 7009. Either one ends the whole OAuth session, so the tokens issued
+// alongside stop working as well.
+func (h *Handler) Revoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauth.WriteError(w, oauth.NewError(oauth.ErrInvalidRequest, "malformed request body"))
+		return
+	}
+
+	client, err := h.authenticateClient(r)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	tokenString := r.PostForm.Get("token")
+	if tokenString == "" {
+		oauth.WriteError(w, oauth.NewError(oauth.ErrInvalidRequest, "token is required"))
+		return
+	}
+
+	if err := h.revoke(r, client, tokenString); err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) revoke(r *http.Request, client *entity.OAuthClient, tokenString string) error {
+	var sessionJTI string
+	var userId int64
+	tokenType := "refresh_token"
+
+	if isJWT(tokenString) {
+		// Tokens of the client credentials grant are not backed by a session
+		// and simply run out
+		if token.IsServiceToken(tokenString) {
+			return oauth.NewError(oauth.ErrUnsupportedTokenType, "client credentials tokens cannot be revoked")
+		}
+
+		// Invalid, expired and already revoked tokens need no revoking
+		claims, err := h.tokenManager.VerifyClientToken(tokenString)
+		if err != nil {
+			return nil
+		}
+		if claims.ClientID != client.ClientId {
+			return oauth.NewError(oauth.ErrUnauthorizedClient, "the token was issued to another client")
+		}
+
+		user, err := h.conn.GetUser(claims.Username)
+		if err != nil {
+			return err
+		}
+		sessionJTI, userId, tokenType = claims.ID, user.Id, "access_token"
+	} else {
+		stored, err := h.conn.GetRefreshToken(oauth.HashToken(tokenString))
+		if errors.Is(err, db.ErrRefreshTokenNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if stored.ClientId != client.ClientId {
+			return oauth.NewError(oauth.ErrUnauthorizedClient, "the token was issued to another client")
+		}
+		if stored.RevokedAt != nil {
+			return nil
+		}
+		sessionJTI, userId = stored.SessionJTI, stored.UserId
+	}
+
+	if err := h.conn.RevokeOAuthSession(sessionJTI, time.Now()); err != nil {
+		return err
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventOAuthTokenRevoked,
+		Outcome:    audit.Success,
+		Actor:      "client:" + client.ClientId,
+		TargetType: audit.TargetClient,
+		TargetId:   client.ClientId,
+		Details:    map[string]any{"tokenType": tokenType, "userId": userId},
+	})
+	return nil
+}
+
+// isJWT tells access tokens, which are JWTs, from opaque refresh tokens
+func isJWT(tokenString string) bool {
+	return strings.Count(tokenString, ".") == 2
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/auth/oauth"
+	"github.com/joeariasc/go-auth/internal/auth/oidc"
+	"github.com/joeariasc/go-auth/internal/auth/token"
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/test_utils"
+	"github.com/joeariasc/go-auth/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testClient is a confidential client registered for a test along with the
+// secret it authenticates with
+type testClient struct {
+	*entity.OAuthClient
+	secret string
+}
+
+func newOAuthTestHandler(t *testing.T, conn *db.Connection) *Handler {
+	key, err := oidc.GenerateSigningKey()
+	require.NoError(t, err)
+
+	return NewHandler(HandlerConfig{
+		Conn:         conn,
+		TokenManager: token.NewManager(token.ManagerConfig{Conn: conn, TokenDuration: time.Hour}),
+		OIDC:         oidc.NewProvider(oidc.ProviderConfig{Issuer: "https://auth.example.com", Key: key, IDTokenTTL: time.Hour}),
+	})
+}
+
+func insertConfidentialClient(t *testing.T, conn *db.Connection) *testClient {
+	suffix, err := utils.GenerateRandomID()
+	require.NoError(t, err)
+	secret, hash, err := oauth.GenerateClientSecret()
+	require.NoError(t, err)
+
+	client := &entity.OAuthClient{
+		ClientId:                "gateway-" + suffix[:12],
+		Name:                    "API gateway",
+		RedirectURIs:            []string{},
+		Scopes:                  []string{"profile"},
+		TokenEndpointAuthMethod: oauth.AuthMethodSecretBasic,
+		SecretHash:              hash,
+		CreatedAt:               time.Now(),
+	}
+	require.NoError(t, conn.CreateClient(client))
+	return &testClient{OAuthClient: client, secret: secret}
+}
+
+// insertRefreshToken issues a refresh token to client for a new session of user
+func insertRefreshToken(t *testing.T, conn *db.Connection, client *testClient, user *entity.User) string {
+	session := test_utils.InsertSession(t, conn, user.Id, time.Now(), time.Hour)
+	tokenString, hash, err := oauth.NewOpaqueToken()
+	require.NoError(t, err)
+
+	now := time.Now()
+	require.NoError(t, conn.CreateRefreshToken(&entity.RefreshToken{
+		TokenHash:  hash,
+		ClientId:   client.ClientId,
+		UserId:     user.Id,
+		SessionJTI: session.JTI,
+		Scope:      "profile",
+		AuthTime:   now,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(time.Hour),
+	}))
+	return tokenString
+}
+
+func clientRequest(target string, client *testClient, tokenString string) *http.Request {
+	form := url.Values{"token": {tokenString}}
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth(client.ClientId, client.secret)
+	return r
+}
+
+func introspect(t *testing.T, h *Handler, client *testClient, tokenString string) models.IntrospectionResponse {
+	w := httptest.NewRecorder()
+	h.Introspect(w, clientRequest("/oauth/introspect", client, tokenString))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response models.IntrospectionResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	return response
+}
+
+func TestIntrospect(t *testing.T) {
+	conn := test_utils.OpenDatabase(t)
+	h := newOAuthTestHandler(t, conn)
+	client := insertConfidentialClient(t, conn)
+	user := test_utils.InsertUser(t, conn, "introspect")
+
+	response := introspect(t, h, client, insertRefreshToken(t, conn, client, user))
+	assert.True(t, response.Active)
+	assert.Equal(t, user.Username, response.Username)
+	assert.Equal(t, client.ClientId, response.ClientID)
+	assert.Equal(t, "refresh_token", response.TokenType)
+
+	personalToken, hash, hint, err := token.NewPersonalToken()
+	require.NoError(t, err)
+	expiresAt := time.Now().Add(time.Hour)
+	require.NoError(t, conn.CreatePersonalToken(&entity.PersonalToken{
+		UserId: user.Id, Name: "CI", TokenHash: hash, Hint: hint, Scope: "account",
+		CreatedAt: time.Now(), ExpiresAt: &expiresAt,
+	}))
+
+	response = introspect(t, h, client, personalToken)
+	assert.True(t, response.Active, "personal access tokens are looked up, not taken for refresh tokens")
+	assert.Equal(t, user.Username, response.Username)
+	assert.Equal(t, "account", response.Scope)
+
+	assert.False(t, introspect(t, h, client, "unknown-token").Active)
+	assert.False(t, introspect(t, h, client, token.PersonalTokenPrefix+"unknown").Active)
+}
+
+func TestIntrospectAuthenticatesClient(t *testing.T) {
+	conn := test_utils.OpenDatabase(t)
+	h := newOAuthTestHandler(t, conn)
+	client := insertConfidentialClient(t, conn)
+
+	w := httptest.NewRecorder()
+	h.Introspect(w, clientRequest("/oauth/introspect", &testClient{OAuthClient: client.OAuthClient, secret: "wrong"}, "token"))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestRevoke(t *testing.T) {
+	conn := test_utils.OpenDatabase(t)
+	h := newOAuthTestHandler(t, conn)
+	client := insertConfidentialClient(t, conn)
+	other := insertConfidentialClient(t, conn)
+	user := test_utils.InsertUser(t, conn, "revoke")
+
+	refreshToken := insertRefreshToken(t, conn, client, user)
+
+	// Clients can only revoke the tokens issued to them
+	w := httptest.NewRecorder()
+	h.Revoke(w, clientRequest("/oauth/revoke", other, refreshToken))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.True(t, introspect(t, h, client, refreshToken).Active)
+
+	w = httptest.NewRecorder()
+	h.Revoke(w, clientRequest("/oauth/revoke", client, refreshToken))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, introspect(t, h, client, refreshToken).Active)
+
+	// Revoking again, or revoking unknown tokens, is not an error
+	w = httptest.NewRecorder()
+	h.Revoke(w, clientRequest("/oauth/revoke", client, refreshToken))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	h.Revoke(w, clientRequest("/oauth/revoke", client, "unknown-token"))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/audit"
+	"github.com/joeariasc/go-auth/internal/auth/oauth"
+	"github.com/joeariasc/go-auth/internal/auth/oidc"
+	"github.com/joeariasc/go-auth/internal/auth/scope"
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/utils"
+)
+
+// UserInfo returns the claims about the token's user that its scopes release
+func (h *Handler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(utils.ClaimsKey).(*models.UserClaims)
+
+	user, err := h.conn.GetUser(claims.Username)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(oidc.NewUserInfo(user, scope.Parse(claims.Scope)))
+}
+
+// EndSession is the RP-initiated logout endpoint. The ID token hint names the
+// OAuth session to end; the user is sent back to the client only when it
+// registered the post-logout redirect URI.
+func (h *Handler) EndSession(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	hint := query.Get("id_token_hint")
+	if hint == "" {
+		http.Error(w, "id_token_hint is required", http.StatusBadRequest)
+		return
+	}
+
+	idToken, err := h.oidc.ParseIDTokenHint(hint)
+	if err != nil {
+		http.Error(w, "Invalid id_token_hint", http.StatusBadRequest)
+		return
+	}
+
+	clientId := query.Get("client_id")
+	if clientId == "" {
+		clientId = idToken.Audience[0]
+	} else if !slices.Contains(idToken.Audience, clientId) {
+		http.Error(w, "client_id does not match the id_token_hint", http.StatusBadRequest)
+		return
+	}
+
+	redirectURI := query.Get("post_logout_redirect_uri")
+	if redirectURI != "" {
+		client, err := h.conn.GetClient(clientId)
+		if err != nil && !errors.Is(err, db.ErrClientNotFound) {
+			writeClientError(w, err)
+			return
+		}
+		if client == nil || !slices.Contains(client.PostLogoutRedirectURIs, redirectURI) {
+			http.Error(w, "Unregistered post_logout_redirect_uri", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if idToken.SID != "" {
+		if err := h.conn.RevokeOAuthSession(idToken.SID, time.Now()); err != nil {
+			log.Printf("Failed to end OAuth session: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	actorId, _ := strconv.ParseInt(idToken.Subject, 10, 64)
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventLogout,
+		Outcome:    audit.Success,
+		ActorId:    actorId,
+		TargetType: audit.TargetClient,
+		TargetId:   clientId,
+	})
+
+	// Sign the browser out of the provider as well
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session",
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+		MaxAge:   -1,
+	})
+
+	if redirectURI == "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("You have been signed out."))
+		return
+	}
+
+	if state := query.Get("state"); state != "" {
+		redirectURI = oauth.WithQuery(redirectURI, url.Values{"state": {state}})
+	}
+	http.Redirect(w, r, redirectURI, http.StatusFound)
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/audit"
+	"github.com/joeariasc/go-auth/internal/auth/scope"
+	"github.com/joeariasc/go-auth/internal/auth/token"
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/utils"
+)
+
+func (h *Handler) ListPersonalTokens(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(utils.ClaimsKey).(*models.UserClaims)
+
+	user, err := h.conn.GetUser(claims.Username)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	tokens, err := h.conn.ListPersonalTokens(user.Id)
+	if err != nil {
+		writePersonalTokenError(w, err)
+		return
+	}
+
+	response := make([]models.PersonalTokenResponse, 0, len(tokens))
+	for _, personalToken := range tokens {
+		response = append(response, personalTokenResponse(personalToken))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// CreatePersonalToken creates a personal access token for the caller. The
+// token can carry at most the scopes of the request creating it, and is only
+// shown in the response. As with deleting the account, the caller must have
+// signed in recently, so a stolen session cannot be turned into a credential
+// that outlives it.
+func (h *Handler) CreatePersonalToken(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(utils.ClaimsKey).(*models.UserClaims)
+
+	// Tokens must not be able to outlive their origin by minting more tokens
+	if claims.ClientID != "" || claims.IsPersonalToken() {
+		writeErrorResponse(w, http.StatusForbidden, "Personal access tokens can only be created from a session")
+		return
+	}
+
+	now := time.Now()
+	if !h.recentlyAuthenticated(claims, now) {
+		h.recordAudit(r, audit.Event{
+			Type:    audit.EventPersonalTokenCreated,
+			Outcome: audit.Denied,
+			Details: map[string]any{"reason": "reauthentication required"},
+		})
+		writeErrorCode(w, http.StatusUnauthorized, "reauthentication_required",
+			"Sign in again to create a personal access token")
+		return
+	}
+
+	var req models.CreatePersonalTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !h.knownScopes(req.Scopes) {
+		http.Error(w, "Unknown scope", http.StatusBadRequest)
+		return
+	}
+	if !scope.Contains(claims.Scope, req.Scopes...) {
+		writeErrorResponse(w, http.StatusForbidden, "Scopes exceed those of the current session")
+		return
+	}
+
+	user, err := h.conn.GetUser(claims.Username)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	tokenString, hash, hint, err := token.NewPersonalToken()
+	if err != nil {
+		writePersonalTokenError(w, err)
+		return
+	}
+
+	expiresAt := now.AddDate(0, 0, req.ExpiresInDays)
+	personalToken := entity.PersonalToken{
+		UserId:    user.Id,
+		Name:      req.Name,
+		TokenHash: hash,
+		Hint:      hint,
+		Scope:     scope.Format(req.Scopes),
+		CreatedAt: now,
+		ExpiresAt: &expiresAt,
+	}
+
+	if err := h.conn.CreatePersonalToken(&personalToken); err != nil {
+		writePersonalTokenError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventPersonalTokenCreated,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetPersonalToken,
+		TargetId:   strconv.FormatInt(personalToken.Id, 10),
+		Details:    map[string]any{"name": personalToken.Name, "scope": personalToken.Scope},
+	})
+
+	response := personalTokenResponse(&personalToken)
+	response.Token = tokenString
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// RevokePersonalToken revokes one of the caller's personal access tokens. A
+// token may revoke itself.
+func (h *Handler) RevokePersonalToken(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(utils.ClaimsKey).(*models.UserClaims)
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid token id", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.conn.GetUser(claims.Username)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	if err := h.conn.RevokePersonalToken(user.Id, id, time.Now()); err != nil {
+		writePersonalTokenError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventPersonalTokenRevoked,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetPersonalToken,
+		TargetId:   strconv.FormatInt(id, 10),
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func personalTokenResponse(personalToken *entity.PersonalToken) models.PersonalTokenResponse {
+	return models.PersonalTokenResponse{
+		ID:         personalToken.Id,
+		Name:       personalToken.Name,
+		Hint:       personalToken.Hint,
+		Scopes:     scope.Parse(personalToken.Scope),
+		CreatedAt:  personalToken.CreatedAt,
+		ExpiresAt:  personalToken.ExpiresAt,
+		LastUsedAt: personalToken.LastUsedAt,
+	}
+}
+
+func writePersonalTokenError(w http.ResponseWriter, err error) {
+	if errors.Is(err, db.ErrPersonalTokenNotFound) {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("Error managing personal access tokens: %v", err)
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/joeariasc/go-auth/internal/audit"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/utils"
+)
+
+func (h *Handler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(utils.ClaimsKey).(*models.UserClaims)
+
+	user, err := h.conn.GetUser(claims.Username)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profileResponse(user))
+}
+
+// UpdateProfile changes the caller's description and email. A new email
+// address has to be verified again.
+func (h *Handler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(utils.ClaimsKey).(*models.UserClaims)
+
+	var req models.UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.conn.GetUser(claims.Username)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	changed := []string{}
+	if req.Description != nil && *req.Description != user.Description {
+		user.Description = *req.Description
+		changed = append(changed, "description")
+	}
+
+	if req.Email != nil && *req.Email != user.Email {
+		user.Email = *req.Email
+		user.EmailVerified = false
+		changed = append(changed, "email")
+	}
+
+	if err := h.conn.UpdateUser(user); err != nil {
+		log.Printf("Error updating profile: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventProfileUpdated,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetUser,
+		TargetId:   userTargetId(user),
+		Details:    map[string]any{"fields": changed},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profileResponse(user))
+}
+
+func profileResponse(user *entity.User) models.ProfileResponse {
+	return models.ProfileResponse{
+		Username:      user.Username,
+		Description:   user.Description,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		MFAEnabled:    user.MFAEnabled,
+		CreatedAt:     user.CreatedAt,
+	}
+}
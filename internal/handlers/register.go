@@ -1,11 +1,13 @@
 package handlers
 
 import (
-	"crypto/md5"
 	"encoding/json"
-	"fmt"
+	"github.com/joeariasc/go-auth/internal/audit"
+	"github.com/joeariasc/go-auth/internal/auth/token"
+	"github.com/joeariasc/go-auth/internal/db"
 	"github.com/joeariasc/go-auth/internal/db/entity"
 	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/webhook"
 	"log"
 	"net/http"
 	"time"
@@ -30,20 +32,50 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	secret, err := token.NewUserSecret()
+	if err != nil {
+		log.Printf("Error while registering user: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
 	user := entity.User{
 		Username:    req.Username,
 		CreatedAt:   time.Now(),
 		Description: req.Description,
+		Email:       req.Email,
 		Fingerprint: "",
-		Secret:      fmt.Sprintf("%x", md5.Sum([]byte(req.Username))),
+		Secret:      secret,
 	}
 
-	id, err := h.conn.Insert(&user)
+	var id int
+	err = h.conn.InTx(func(tx *db.Connection) error {
+		var err error
+		if id, err = tx.Insert(&user); err != nil {
+			return err
+		}
+		user.Id = int64(id)
+
+		return publish(tx, webhook.EventUserRegistered, webhook.UserEvent{
+			UserID:   user.Id,
+			Username: user.Username,
+		})
+	})
 	if err != nil {
 		log.Printf("Error while inserting user: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
 
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventUserRegistered,
+		Outcome:    audit.Success,
+		ActorId:    user.Id,
+		Actor:      user.Username,
+		TargetType: audit.TargetUser,
+		TargetId:   userTargetId(&user),
+	})
+
 	response := models.RegisterResponse{
 		Username: req.Username,
 		ID:       id,
@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/joeariasc/go-auth/internal/audit"
+	"github.com/joeariasc/go-auth/internal/auth/rbac"
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/utils"
+)
+
+func (h *Handler) ListPermissions(w http.ResponseWriter, r *http.Request) {
+	permissions, err := h.conn.ListPermissions()
+	if err != nil {
+		writeRBACError(w, err)
+		return
+	}
+
+	response := make([]models.PermissionResponse, 0, len(permissions))
+	for _, permission := range permissions {
+		response = append(response, models.PermissionResponse{
+			Name:        permission.Name,
+			Description: permission.Description,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *Handler) CreatePermission(w http.ResponseWriter, r *http.Request) {
+	var req models.CreatePermissionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Validate(); err != nil || !rbac.ValidPermissionName(req.Name) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	permission := entity.Permission{Name: req.Name, Description: req.Description}
+	if err := h.conn.CreatePermission(&permission); err != nil {
+		writeRBACError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventPermissionCreated,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetPermission,
+		TargetId:   permission.Name,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.PermissionResponse{
+		Name:        permission.Name,
+		Description: permission.Description,
+	})
+}
+
+func (h *Handler) ListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.conn.ListRoles()
+	if err != nil {
+		writeRBACError(w, err)
+		return
+	}
+
+	response := make([]models.RoleResponse, 0, len(roles))
+	for _, role := range roles {
+		response = append(response, roleResponse(role))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *Handler) CreateRole(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Validate(); err != nil || !rbac.ValidRoleName(req.Name) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	role := entity.Role{
+		Name:          req.Name,
+		Description:   req.Description,
+		Permissions:   req.Permissions,
+		Provisionable: req.Provisionable,
+	}
+
+	if !provisionableAllowed(w, &role) || !h.callerHolds(w, r, role.Permissions) {
+		return
+	}
+
+	if err := h.conn.CreateRole(&role); err != nil {
+		writeRBACError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventRoleCreated,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetRole,
+		TargetId:   role.Name,
+		Details:    map[string]any{"permissions": role.Permissions, "provisionable": role.Provisionable},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(roleResponse(&role))
+}
+
+func (h *Handler) UpdateRole(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	role, err := h.conn.GetRole(r.PathValue("name"))
+	if err != nil {
+		writeRBACError(w, err)
+		return
+	}
+
+	if req.Description != nil {
+		role.Description = *req.Description
+	}
+	if req.Permissions != nil {
+		if role.Name == rbac.AdminRole {
+			http.Error(w, "The admin role permissions cannot be changed", http.StatusBadRequest)
+			return
+		}
+		role.Permissions = *req.Permissions
+	}
+	if req.Provisionable != nil {
+		role.Provisionable = *req.Provisionable
+	}
+
+	if !provisionableAllowed(w, role) || !h.callerHolds(w, r, role.Permissions) {
+		return
+	}
+
+	if err := h.conn.UpdateRole(role); err != nil {
+		writeRBACError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventRoleUpdated,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetRole,
+		TargetId:   role.Name,
+		Details:    map[string]any{"permissions": role.Permissions, "provisionable": role.Provisionable},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(roleResponse(role))
+}
+
+func (h *Handler) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name == rbac.AdminRole {
+		http.Error(w, "The admin role cannot be deleted", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.conn.DeleteRole(name); err != nil {
+		writeRBACError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventRoleDeleted,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetRole,
+		TargetId:   name,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) GetUserRoles(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	h.writeUserRoles(w, user)
+}
+
+// AssignUserRole grants a role to a user. It is reflected in tokens issued
+// from the user's next login. Callers can only grant roles whose permissions
+// they hold themselves and never give themselves a privileged one.
+func (h *Handler) AssignUserRole(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	role, err := h.conn.GetRole(r.PathValue("role"))
+	if err != nil {
+		writeRBACError(w, err)
+		return
+	}
+
+	if !h.callerHolds(w, r, role.Permissions) {
+		return
+	}
+
+	claims := r.Context().Value(utils.ClaimsKey).(*models.UserClaims)
+	if !claims.IsClient() && claims.Username == user.Username && slices.ContainsFunc(role.Permissions, rbac.Privileged) {
+		http.Error(w, "Privileged roles cannot be assigned to yourself", http.StatusForbidden)
+		return
+	}
+
+	if err := h.conn.AssignRole(user.Id, role.Name); err != nil {
+		writeRBACError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventRoleAssigned,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetUser,
+		TargetId:   userTargetId(user),
+		Details:    map[string]any{"role": r.PathValue("role")},
+	})
+
+	h.writeUserRoles(w, user)
+}
+
+// RemoveUserRole takes a role away from a user. Like assigning it, this needs
+// every permission the role grants.
+func (h *Handler) RemoveUserRole(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	role, err := h.conn.GetRole(r.PathValue("role"))
+	if err != nil {
+		writeRBACError(w, err)
+		return
+	}
+
+	if !h.callerHolds(w, r, role.Permissions) {
+		return
+	}
+
+	if err := h.conn.RemoveRole(user.Id, role.Name); err != nil {
+		writeRBACError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventRoleRemoved,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetUser,
+		TargetId:   userTargetId(user),
+		Details:    map[string]any{"role": r.PathValue("role")},
+	})
+
+	h.writeUserRoles(w, user)
+}
+
+func (h *Handler) writeUserRoles(w http.ResponseWriter, user *entity.User) {
+	roles, err := h.conn.GetUserRoles(user.Id)
+	if err != nil {
+		writeRBACError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.UserRolesResponse{
+		ID:       user.Id,
+		Username: user.Username,
+		Roles:    roles,
+	})
+}
+
+// userFromPath loads the user referenced by the {id} path parameter, writing
+// an error response when it cannot
+func (h *Handler) userFromPath(w http.ResponseWriter, r *http.Request) (*entity.User, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		return nil, false
+	}
+
+	user, err := h.conn.Retrieve(id)
+	if err != nil {
+		if errors.Is(err, db.ErrUsernameNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return nil, false
+		}
+		log.Printf("Error retrieving user: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return user, true
+}
+
+func roleResponse(role *entity.Role) models.RoleResponse {
+	permissions := role.Permissions
+	if permissions == nil {
+		permissions = []string{}
+	}
+
+	return models.RoleResponse{
+		Name:          role.Name,
+		Description:   role.Description,
+		Permissions:   permissions,
+		Provisionable: role.Provisionable,
+		CreatedAt:     role.CreatedAt,
+	}
+}
+
+// callerHolds refuses to go on unless the roles of the caller grant every
+// one of permissions, so that nobody hands out more access than they have
+func (h *Handler) callerHolds(w http.ResponseWriter, r *http.Request, permissions []string) bool {
+	claims := r.Context().Value(utils.ClaimsKey).(*models.UserClaims)
+
+	granted, err := h.conn.PermissionsForRoles(claims.Roles)
+	if err != nil {
+		writeRBACError(w, err)
+		return false
+	}
+
+	if !rbac.AllowsAll(granted, permissions) {
+		http.Error(w, "You can only grant permissions you hold", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// provisionableAllowed refuses roles that are open to SCIM clients while
+// granting privileged permissions
+func provisionableAllowed(w http.ResponseWriter, role *entity.Role) bool {
+	if role.Provisionable && !rbac.Provisionable(role) {
+		http.Error(w, "Provisionable roles cannot grant administrative permissions", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeRBACError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, db.ErrRoleNotFound):
+		http.Error(w, "Role not found", http.StatusNotFound)
+	case errors.Is(err, db.ErrPermissionNotFound):
+		http.Error(w, "Unknown permission", http.StatusBadRequest)
+	case errors.Is(err, db.ErrRoleExists):
+		http.Error(w, "Role already exists", http.StatusConflict)
+	case errors.Is(err, db.ErrPermissionExists):
+		http.Error(w, "Permission already exists", http.StatusConflict)
+	default:
+		log.Printf("Error managing roles: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
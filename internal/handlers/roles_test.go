@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/joeariasc/go-auth/internal/auth/rbac"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/test_utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssignUserRoleLimitsWhatCallersGrant(t *testing.T) {
+	conn := test_utils.OpenDatabase(t)
+	h := NewHandler(HandlerConfig{Conn: conn})
+	require.NoError(t, rbac.Seed(conn, nil))
+
+	operators := &entity.Role{Name: "roles-test-operators", Description: "Operators", Permissions: []string{rbac.PermUsersWrite}}
+	readers := &entity.Role{Name: "roles-test-readers", Description: "Readers"}
+	require.NoError(t, conn.EnsureRole(operators))
+	require.NoError(t, conn.EnsureRole(readers))
+
+	operator := test_utils.InsertUser(t, conn, "roles")
+	admin := test_utils.InsertUser(t, conn, "roles")
+	other := test_utils.InsertUser(t, conn, "roles")
+
+	assign := func(caller *entity.User, roles []string, target *entity.User, role string) int {
+		r := requestAs(http.MethodPut, "/api/admin/users/"+strconv.FormatInt(target.Id, 10)+"/roles/"+role,
+			&models.UserClaims{Username: caller.Username, Roles: roles})
+		r.SetPathValue("id", strconv.FormatInt(target.Id, 10))
+		r.SetPathValue("role", role)
+		w := httptest.NewRecorder()
+		h.AssignUserRole(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, assign(operator, []string{operators.Name}, other, rbac.AdminRole), "users:write alone does not grant everything")
+	assert.Equal(t, http.StatusForbidden, assign(operator, []string{operators.Name}, operator, rbac.AdminRole))
+	assert.Equal(t, http.StatusOK, assign(operator, []string{operators.Name}, operator, readers.Name), "unprivileged roles can be taken")
+
+	assert.Equal(t, http.StatusForbidden, assign(admin, []string{rbac.AdminRole}, admin, operators.Name), "privileged roles are not self-assigned")
+	assert.Equal(t, http.StatusOK, assign(admin, []string{rbac.AdminRole}, other, rbac.AdminRole))
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/joeariasc/go-auth/internal/auth/oauth"
+	"github.com/joeariasc/go-auth/internal/auth/saml"
+)
+
+// maxSAMLFormSize bounds the form identity providers post responses in
+const maxSAMLFormSize = 512 << 10
+
+// SAMLMetadata publishes the service provider metadata to register at a SAML
+// identity provider. Its address is the entity ID of the service provider.
+func (h *Handler) SAMLMetadata(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.saml.Get(r.PathValue("provider"))
+	if !ok {
+		http.Error(w, "Unknown identity provider", http.StatusNotFound)
+		return
+	}
+
+	metadata, err := provider.Metadata()
+	if err != nil {
+		log.Printf("Failed to render SAML metadata: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.Write(metadata)
+}
+
+// SAMLAssertionConsumer is where SAML identity providers post their responses
+// to. Like FederatedCallback it forwards to the web client with a completion
+// code, or with an error when the sign-in failed.
+func (h *Handler) SAMLAssertionConsumer(w http.ResponseWriter, r *http.Request) {
+	if h.federatedLoginURL == "" {
+		log.Printf("SAML response received but FEDERATED_LOGIN_URL is not configured")
+		http.Error(w, "Federated sign-in is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	provider, ok := h.saml.Get(r.PathValue("provider"))
+	if !ok {
+		http.Error(w, "Unknown identity provider", http.StatusNotFound)
+		return
+	}
+
+	// The browser arrives with a form post, it is sent on with a GET
+	fail := func(code string) {
+		h.redirectFederatedLogin(w, r, provider.Name(), http.StatusSeeOther, url.Values{"error": {code}})
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxSAMLFormSize)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	login, code := h.pendingFederatedLogin(r.PostForm.Get("RelayState"), provider.Name())
+	if code != "" {
+		fail(code)
+		return
+	}
+
+	identity, err := provider.ParseResponse(r.PostForm.Get("SAMLResponse"), login.Nonce)
+	if err != nil {
+		var statusErr *saml.StatusError
+		if errors.As(err, &statusErr) && statusErr.Denied() {
+			fail(oauth.ErrAccessDenied)
+			return
+		}
+
+		log.Printf("SAML sign-in with %s failed: %v", provider.Name(), err)
+		h.auditRejectedResponse(r, provider.Name())
+		fail("provider_error")
+		return
+	}
+
+	login.Subject = identity.Subject
+	login.Email = identity.Email
+	login.PreferredUsername = identity.PreferredUsername
+
+	completion, code := h.completeFederatedCallback(login)
+	if code != "" {
+		fail(code)
+		return
+	}
+
+	h.redirectFederatedLogin(w, r, provider.Name(), http.StatusSeeOther, url.Values{"code": {completion}})
+}
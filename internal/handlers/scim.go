@@ -0,0 +1,754 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/audit"
+	"github.com/joeariasc/go-auth/internal/auth/account"
+	"github.com/joeariasc/go-auth/internal/auth/rbac"
+	"github.com/joeariasc/go-auth/internal/auth/token"
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/scim"
+	"github.com/joeariasc/go-auth/internal/utils"
+	"github.com/joeariasc/go-auth/internal/webhook"
+)
+
+const (
+	defaultSCIMPageSize = 100
+	maxSCIMPageSize     = 200
+)
+
+// scimSource names SCIM provisioning in audit records
+const scimSource = "scim"
+
+// SCIMListUsers pages through the accounts provisioning clients see as SCIM
+// users: userName is the username, displayName the description and active
+// tells whether the account is active or suspended. Only accounts created
+// through SCIM are visible, so a client cannot suspend or delete anyone else.
+// Deleted accounts no longer exist as far as SCIM is concerned.
+func (h *Handler) SCIMListUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	page, err := scim.ParsePage(query, defaultSCIMPageSize, maxSCIMPageSize)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	filter := db.UserFilter{
+		Source:        entity.UserSourceSCIM,
+		ExcludeStatus: entity.UserStatusDeleted,
+		Limit:         page.Count,
+		Offset:        page.Offset(),
+	}
+
+	if expr := query.Get("filter"); expr != "" {
+		parsed, err := scim.ParseFilter(expr, "userName", "externalId")
+		if err != nil {
+			writeSCIMError(w, err)
+			return
+		}
+
+		// Empty values would disable the condition rather than match nothing
+		if parsed.Value == "" {
+			writeSCIMList(w, []scim.User{}, 0, 0, page)
+			return
+		}
+
+		switch parsed.Attribute {
+		case "userName":
+			filter.Username = parsed.Value
+		case "externalId":
+			filter.ExternalID = parsed.Value
+		}
+	}
+
+	users, total, err := h.conn.ListUsers(filter)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	groups, err := provisionableRoles(h.conn)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	resources := make([]scim.User, 0, len(users))
+	for _, user := range users {
+		roles, err := userGroups(h.conn, user, groups)
+		if err != nil {
+			writeSCIMError(w, err)
+			return
+		}
+		resources = append(resources, h.scimUserResource(user, roles))
+	}
+
+	writeSCIMList(w, resources, len(resources), total, page)
+}
+
+func (h *Handler) SCIMGetUser(w http.ResponseWriter, r *http.Request) {
+	user, err := scimUser(h.conn, r.PathValue("id"))
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	h.writeSCIMUser(w, http.StatusOK, user)
+}
+
+// SCIMCreateUser provisions a SCIM account. It gets a random secret and no
+// local password; its users sign in at an identity provider.
+func (h *Handler) SCIMCreateUser(w http.ResponseWriter, r *http.Request) {
+	var req scim.User
+	if err := decodeSCIM(r, &req); err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		writeSCIMError(w, scim.BadRequest(scim.ErrInvalidValue, err.Error()))
+		return
+	}
+
+	_, err := h.conn.GetUser(req.UserName)
+	if err == nil {
+		writeSCIMError(w, scim.NewError(http.StatusConflict, scim.ErrUniqueness, "userName is already taken"))
+		return
+	}
+	if !errors.Is(err, db.ErrUsernameNotFound) {
+		writeSCIMError(w, err)
+		return
+	}
+
+	secret, err := token.NewUserSecret()
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	user := entity.User{
+		Username:    req.UserName,
+		CreatedAt:   time.Now(),
+		Description: req.DisplayName,
+		Email:       req.PrimaryEmail(),
+		ExternalID:  req.ExternalID,
+		Secret:      secret,
+		Status:      entity.UserStatusActive,
+		Source:      entity.UserSourceSCIM,
+	}
+	// Accounts provisioned inactive wait to be activated
+	if req.Active != nil && !*req.Active {
+		user.Status = entity.UserStatusPending
+	}
+
+	err = h.conn.InTx(func(tx *db.Connection) error {
+		id, err := tx.Insert(&user)
+		if err != nil {
+			return err
+		}
+		user.Id = int64(id)
+
+		return publish(tx, webhook.EventUserRegistered, webhook.UserEvent{
+			UserID:   user.Id,
+			Username: user.Username,
+			Status:   string(user.Status),
+		})
+	})
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventUserRegistered,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetUser,
+		TargetId:   userTargetId(&user),
+		Details:    map[string]any{"source": scimSource},
+	})
+
+	w.Header().Set("Location", h.scimURL("Users", userTargetId(&user)))
+	h.writeSCIMUser(w, http.StatusCreated, &user)
+}
+
+func (h *Handler) SCIMReplaceUser(w http.ResponseWriter, r *http.Request) {
+	user, err := scimUser(h.conn, r.PathValue("id"))
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	var req scim.User
+	if err := decodeSCIM(r, &req); err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	if err := h.updateSCIMUser(r, user, req); err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	h.writeSCIMUser(w, http.StatusOK, user)
+}
+
+func (h *Handler) SCIMPatchUser(w http.ResponseWriter, r *http.Request) {
+	user, err := scimUser(h.conn, r.PathValue("id"))
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	var patch scim.PatchRequest
+	if err := decodeSCIM(r, &patch); err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	resource := h.scimUserResource(user, nil)
+	if err := scim.ApplyUserPatch(&resource, patch); err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	if err := h.updateSCIMUser(r, user, resource); err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	h.writeSCIMUser(w, http.StatusOK, user)
+}
+
+// SCIMDeleteUser marks the user as deleted like DeleteUser does
+func (h *Handler) SCIMDeleteUser(w http.ResponseWriter, r *http.Request) {
+	user, err := scimUser(h.conn, r.PathValue("id"))
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	if err := h.transitionUser(r, user, entity.UserStatusDeleted, "Deleted through SCIM", scimActor(r)); err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// updateSCIMUser brings a user in line with the resource a provisioning
+// client sent. The username cannot be changed, it is what users sign in with.
+func (h *Handler) updateSCIMUser(r *http.Request, user *entity.User, resource scim.User) error {
+	if err := resource.Validate(); err != nil {
+		return scim.BadRequest(scim.ErrInvalidValue, err.Error())
+	}
+
+	if resource.UserName != user.Username {
+		return scim.BadRequest(scim.ErrMutability, "userName cannot be changed")
+	}
+
+	email := resource.PrimaryEmail()
+	if user.Description != resource.DisplayName || user.Email != email || user.ExternalID != resource.ExternalID {
+		if user.Email != email {
+			user.Email = email
+			user.EmailVerified = false
+		}
+		user.Description = resource.DisplayName
+		user.ExternalID = resource.ExternalID
+
+		if err := h.conn.UpdateUser(user); err != nil {
+			return err
+		}
+
+		h.recordAudit(r, audit.Event{
+			Type:       audit.EventUserUpdated,
+			Outcome:    audit.Success,
+			TargetType: audit.TargetUser,
+			TargetId:   userTargetId(user),
+			Details:    map[string]any{"description": user.Description, "source": scimSource},
+		})
+	}
+
+	// Accounts that are not active, such as pending ones, are left alone when
+	// the client deactivates them
+	switch {
+	case resource.Active == nil:
+		return nil
+	case *resource.Active && user.Status != entity.UserStatusActive:
+		return h.transitionUser(r, user, entity.UserStatusActive, "Activated through SCIM", scimActor(r))
+	case !*resource.Active && user.Status == entity.UserStatusActive:
+		return h.transitionUser(r, user, entity.UserStatusSuspended, "Deactivated through SCIM", scimActor(r))
+	}
+	return nil
+}
+
+func (h *Handler) writeSCIMUser(w http.ResponseWriter, status int, user *entity.User) {
+	groups, err := provisionableRoles(h.conn)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	roles, err := userGroups(h.conn, user, groups)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	scim.Write(w, status, h.scimUserResource(user, roles))
+}
+
+func (h *Handler) scimUserResource(user *entity.User, roles []string) scim.User {
+	id := userTargetId(user)
+	active := user.Status == entity.UserStatusActive
+
+	resource := scim.User{
+		Schemas:     []string{scim.SchemaUser},
+		ID:          id,
+		ExternalID:  user.ExternalID,
+		UserName:    user.Username,
+		DisplayName: user.Description,
+		Active:      &active,
+		Meta: &scim.Meta{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			Location:     h.scimURL("Users", id),
+		},
+	}
+
+	if user.Email != "" {
+		resource.Emails = []scim.Email{{Value: user.Email, Primary: true}}
+	}
+
+	for _, role := range roles {
+		resource.Groups = append(resource.Groups, scim.Member{
+			Value:   role,
+			Ref:     h.scimURL("Groups", role),
+			Display: role,
+		})
+	}
+
+	return resource
+}
+
+// SCIMListGroups pages through the provisionable roles, which are SCIM groups
+// identified by their name. The display name of a new group is turned into its
+// role name, so it cannot be renamed later. Other roles are left out so that
+// provisioning cannot grant access to this service itself.
+func (h *Handler) SCIMListGroups(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	page, err := scim.ParsePage(query, defaultSCIMPageSize, maxSCIMPageSize)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	name := ""
+	if expr := query.Get("filter"); expr != "" {
+		filter, err := scim.ParseFilter(expr, "displayName", "id")
+		if err != nil {
+			writeSCIMError(w, err)
+			return
+		}
+
+		name = filter.Value
+		if filter.Attribute == "displayName" {
+			name = rbac.RoleNameFor(filter.Value)
+		}
+		if name == "" {
+			writeSCIMList(w, []scim.Group{}, 0, 0, page)
+			return
+		}
+	}
+
+	roles, err := h.conn.ListRoles()
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	roles = slices.DeleteFunc(roles, func(role *entity.Role) bool {
+		return !rbac.Provisionable(role) || (name != "" && role.Name != name)
+	})
+
+	total := len(roles)
+	roles = roles[min(page.Offset(), total):min(page.Offset()+page.Count, total)]
+
+	// Identity providers skip the members when they only look for a group
+	withMembers := !slices.ContainsFunc(strings.Split(query.Get("excludedAttributes"), ","), func(attribute string) bool {
+		return strings.EqualFold(strings.TrimSpace(attribute), "members")
+	})
+
+	resources := make([]scim.Group, 0, len(roles))
+	for _, role := range roles {
+		var members []*entity.User
+		if withMembers {
+			if members, err = groupMembers(h.conn, role); err != nil {
+				writeSCIMError(w, err)
+				return
+			}
+		}
+		resources = append(resources, h.scimGroupResource(role, members))
+	}
+
+	writeSCIMList(w, resources, len(resources), total, page)
+}
+
+func (h *Handler) SCIMGetGroup(w http.ResponseWriter, r *http.Request) {
+	role, err := scimGroup(h.conn, r.PathValue("id"))
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	h.writeSCIMGroup(w, http.StatusOK, role)
+}
+
+func (h *Handler) SCIMCreateGroup(w http.ResponseWriter, r *http.Request) {
+	var req scim.Group
+	if err := decodeSCIM(r, &req); err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		writeSCIMError(w, scim.BadRequest(scim.ErrInvalidValue, err.Error()))
+		return
+	}
+
+	role := entity.Role{
+		Name:          rbac.RoleNameFor(req.DisplayName),
+		Description:   req.DisplayName,
+		Provisionable: true,
+	}
+	if role.Name == "" {
+		writeSCIMError(w, scim.BadRequest(scim.ErrInvalidValue, "displayName must contain letters or digits"))
+		return
+	}
+
+	err := h.conn.InTx(func(tx *db.Connection) error {
+		if err := tx.CreateRole(&role); err != nil {
+			return err
+		}
+		return h.setGroupMembers(r, tx, &role, req.Members)
+	})
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventRoleCreated,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetRole,
+		TargetId:   role.Name,
+		Details:    map[string]any{"source": scimSource},
+	})
+
+	w.Header().Set("Location", h.scimURL("Groups", role.Name))
+	h.writeSCIMGroup(w, http.StatusCreated, &role)
+}
+
+func (h *Handler) SCIMReplaceGroup(w http.ResponseWriter, r *http.Request) {
+	var req scim.Group
+	if err := decodeSCIM(r, &req); err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	h.updateSCIMGroup(w, r, func(group *scim.Group) error {
+		*group = req
+		return nil
+	})
+}
+
+func (h *Handler) SCIMPatchGroup(w http.ResponseWriter, r *http.Request) {
+	var patch scim.PatchRequest
+	if err := decodeSCIM(r, &patch); err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	h.updateSCIMGroup(w, r, func(group *scim.Group) error {
+		return scim.ApplyGroupPatch(group, patch)
+	})
+}
+
+func (h *Handler) SCIMDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	role, err := scimGroup(h.conn, r.PathValue("id"))
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	if err := h.conn.DeleteRole(role.Name); err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventRoleDeleted,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetRole,
+		TargetId:   role.Name,
+		Details:    map[string]any{"source": scimSource},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// updateSCIMGroup loads a group, lets change modify its resource and applies
+// the new membership in one transaction
+func (h *Handler) updateSCIMGroup(w http.ResponseWriter, r *http.Request, change func(group *scim.Group) error) {
+	var role *entity.Role
+	err := h.conn.InTx(func(tx *db.Connection) error {
+		var err error
+		if role, err = scimGroup(tx, r.PathValue("id")); err != nil {
+			return err
+		}
+
+		members, err := groupMembers(tx, role)
+		if err != nil {
+			return err
+		}
+
+		resource := h.scimGroupResource(role, members)
+		if err := change(&resource); err != nil {
+			return err
+		}
+
+		if err := resource.Validate(); err != nil {
+			return scim.BadRequest(scim.ErrInvalidValue, err.Error())
+		}
+		if rbac.RoleNameFor(resource.DisplayName) != role.Name {
+			return scim.BadRequest(scim.ErrMutability, "displayName cannot be changed")
+		}
+
+		return h.setGroupMembers(r, tx, role, resource.Members)
+	})
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	h.writeSCIMGroup(w, http.StatusOK, role)
+}
+
+// setGroupMembers assigns the role to the members and removes it from every
+// other SCIM account holding it
+func (h *Handler) setGroupMembers(r *http.Request, conn *db.Connection, role *entity.Role, members []scim.Member) error {
+	current, err := groupMembers(conn, role)
+	if err != nil {
+		return err
+	}
+
+	wanted := make([]int64, 0, len(members))
+	for _, member := range members {
+		user, err := scimUser(conn, member.Value)
+		if errors.Is(err, db.ErrIDNotFound) || errors.Is(err, db.ErrUsernameNotFound) {
+			return scim.BadRequest(scim.ErrInvalidValue, fmt.Sprintf("unknown member %q", member.Value))
+		}
+		if err != nil {
+			return err
+		}
+		wanted = append(wanted, user.Id)
+	}
+
+	record := func(eventType string, userId int64) {
+		h.recordAudit(r, audit.Event{
+			Type:       eventType,
+			Outcome:    audit.Success,
+			TargetType: audit.TargetUser,
+			TargetId:   strconv.FormatInt(userId, 10),
+			Details:    map[string]any{"role": role.Name, "source": scimSource},
+		})
+	}
+
+	for _, user := range current {
+		if slices.Contains(wanted, user.Id) {
+			continue
+		}
+		if err := conn.RemoveRole(user.Id, role.Name); err != nil {
+			return err
+		}
+		record(audit.EventRoleRemoved, user.Id)
+	}
+
+	for _, userId := range wanted {
+		if slices.ContainsFunc(current, func(user *entity.User) bool { return user.Id == userId }) {
+			continue
+		}
+		if err := conn.AssignRole(userId, role.Name); err != nil {
+			return err
+		}
+		record(audit.EventRoleAssigned, userId)
+	}
+
+	return nil
+}
+
+func (h *Handler) writeSCIMGroup(w http.ResponseWriter, status int, role *entity.Role) {
+	members, err := groupMembers(h.conn, role)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+
+	scim.Write(w, status, h.scimGroupResource(role, members))
+}
+
+func (h *Handler) scimGroupResource(role *entity.Role, members []*entity.User) scim.Group {
+	resource := scim.Group{
+		Schemas:     []string{scim.SchemaGroup},
+		ID:          role.Name,
+		DisplayName: role.Name,
+		Meta: &scim.Meta{
+			ResourceType: "Group",
+			Created:      role.CreatedAt,
+			Location:     h.scimURL("Groups", role.Name),
+		},
+	}
+
+	for _, user := range members {
+		resource.Members = append(resource.Members, scim.Member{
+			Value:   userTargetId(user),
+			Ref:     h.scimURL("Users", userTargetId(user)),
+			Display: user.Username,
+		})
+	}
+
+	return resource
+}
+
+// scimGroup loads the role behind a group, which has to be provisionable
+func scimGroup(conn *db.Connection, id string) (*entity.Role, error) {
+	role, err := conn.GetRole(id)
+	if err != nil {
+		return nil, err
+	}
+	if !rbac.Provisionable(role) {
+		return nil, db.ErrRoleNotFound
+	}
+	return role, nil
+}
+
+// provisionableRoles returns the names of the roles SCIM clients see as groups
+func provisionableRoles(conn *db.Connection) (map[string]bool, error) {
+	roles, err := conn.ListRoles()
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for _, role := range roles {
+		if rbac.Provisionable(role) {
+			names[role.Name] = true
+		}
+	}
+	return names, nil
+}
+
+// userGroups returns the roles of a user that are among groups
+func userGroups(conn *db.Connection, user *entity.User, groups map[string]bool) ([]string, error) {
+	roles, err := conn.GetUserRoles(user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(roles, func(role string) bool {
+		return !groups[role]
+	}), nil
+}
+
+// groupMembers returns the SCIM accounts holding a role, except deleted ones.
+// Assignments to other users are managed by administrators and left alone.
+func groupMembers(conn *db.Connection, role *entity.Role) ([]*entity.User, error) {
+	users, err := conn.ListRoleMembers(role.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(users, func(user *entity.User) bool {
+		return user.Source != entity.UserSourceSCIM || user.Status == entity.UserStatusDeleted
+	}), nil
+}
+
+// scimUser loads a SCIM account by the id of its resource. Other accounts are
+// reported as not found.
+func scimUser(conn *db.Connection, id string) (*entity.User, error) {
+	userId, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, db.ErrIDNotFound
+	}
+
+	user, err := conn.Retrieve(userId)
+	if err != nil {
+		return nil, err
+	}
+	if user.Source != entity.UserSourceSCIM || user.Status == entity.UserStatusDeleted {
+		return nil, db.ErrIDNotFound
+	}
+	return user, nil
+}
+
+func (h *Handler) scimURL(resourceType string, id string) string {
+	return h.scimBaseURL + "/" + resourceType + "/" + id
+}
+
+// scimActor names the provisioning client in status changes
+func scimActor(r *http.Request) string {
+	if claims, ok := r.Context().Value(utils.ClaimsKey).(*models.UserClaims); ok {
+		return claims.Actor()
+	}
+	return scimSource
+}
+
+func decodeSCIM(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return scim.BadRequest(scim.ErrInvalidSyntax, "Invalid request body")
+	}
+	return nil
+}
+
+func writeSCIMList(w http.ResponseWriter, resources any, itemsPerPage int, total int, page scim.Page) {
+	scim.Write(w, http.StatusOK, scim.ListResponse{
+		Schemas:      []string{scim.SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   page.StartIndex,
+		ItemsPerPage: itemsPerPage,
+		Resources:    resources,
+	})
+}
+
+func writeSCIMError(w http.ResponseWriter, err error) {
+	var scimErr *scim.Error
+	switch {
+	case errors.As(err, &scimErr):
+	case errors.Is(err, db.ErrIDNotFound), errors.Is(err, db.ErrUsernameNotFound):
+		scimErr = scim.NewError(http.StatusNotFound, "", "User not found")
+	case errors.Is(err, db.ErrRoleNotFound):
+		scimErr = scim.NewError(http.StatusNotFound, "", "Group not found")
+	case errors.Is(err, db.ErrRoleExists):
+		scimErr = scim.NewError(http.StatusConflict, scim.ErrUniqueness, "A group with that name exists")
+	case errors.Is(err, account.ErrInvalidTransition):
+		scimErr = scim.BadRequest(scim.ErrInvalidValue, err.Error())
+	case errors.Is(err, db.ErrStatusConflict):
+		scimErr = scim.NewError(http.StatusConflict, "", "The user's status was changed concurrently")
+	default:
+		log.Printf("SCIM request failed: %v", err)
+		scimErr = scim.NewError(http.StatusInternalServerError, "", "Internal server error")
+	}
+	scim.WriteError(w, scimErr)
+}
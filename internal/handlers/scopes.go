@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/joeariasc/go-auth/internal/models"
+)
+
+// ListScopes describes the scopes that can be requested at login
+func (h *Handler) ListScopes(w http.ResponseWriter, r *http.Request) {
+	all := h.scopes.All()
+
+	response := make([]models.ScopeResponse, 0, len(all))
+	for _, s := range all {
+		response = append(response, models.ScopeResponse{
+			Name:        s.Name,
+			Description: s.Description,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/audit"
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/notify"
+	"github.com/joeariasc/go-auth/internal/utils"
+	"github.com/joeariasc/go-auth/internal/webhook"
+)
+
+func (h *Handler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(utils.ClaimsKey).(*models.UserClaims)
+
+	user, err := h.conn.GetUser(claims.Username)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	sessions, err := h.conn.ListActiveSessions(user.Id)
+	if err != nil {
+		log.Printf("Error listing sessions: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]models.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, sessionResponse(session, claims.ID))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListUserSessions lets support staff see where the user with the path id is
+// signed in
+func (h *Handler) ListUserSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.conn.ListActiveSessions(user.Id)
+	if err != nil {
+		log.Printf("Error listing sessions: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]models.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, sessionResponse(session, ""))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *Handler) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(utils.ClaimsKey).(*models.UserClaims)
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid session id", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.conn.GetUser(claims.Username)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.conn.RevokeSession(user.Id, id); err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventSessionRevoked,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetSession,
+		TargetId:   strconv.FormatInt(id, 10),
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Logout terminates the session the request was authenticated with
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(utils.ClaimsKey).(*models.UserClaims)
+
+	session, err := h.conn.GetSessionByJTI(claims.ID)
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	err = h.conn.InTx(func(tx *db.Connection) error {
+		if err := tx.RevokeSession(session.UserId, session.Id); err != nil {
+			return err
+		}
+
+		return publish(tx, webhook.EventUserLoggedOut, webhook.UserEvent{
+			UserID:     session.UserId,
+			Username:   claims.Username,
+			ClientType: session.ClientType,
+		})
+	})
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventLogout,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetSession,
+		TargetId:   strconv.FormatInt(session.Id, 10),
+	})
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session",
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+		MaxAge:   -1,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func sessionResponse(session *entity.Session, currentID string) models.SessionResponse {
+	return models.SessionResponse{
+		ID:         session.Id,
+		ClientType: session.ClientType,
+		IP:         session.IP,
+		UserAgent:  session.UserAgent,
+		Current:    session.JTI == currentID,
+		CreatedAt:  session.CreatedAt,
+		LastUsedAt: session.LastUsedAt,
+		ExpiresAt:  session.ExpiresAt,
+		RevokedAt:  session.RevokedAt,
+	}
+}
+
+func writeSessionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, db.ErrSessionNotFound) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("Error revoking session: %v", err)
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+}
+
+// revocationPage asks for confirmation before a session is signed out from a
+// notification link. Mail scanners and browsers prefetch links, so following
+// one must not change anything.
+var revocationPage = template.Must(template.New("revocation").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Sign out session</title>
+</head>
+<body>
+<p>A {{.ClientType}} client signed in to your account on {{.SignedInAt}} from {{.IP}}.</p>
+<p>If this wasn't you, sign that session out and review your devices and active sessions.</p>
+<form method="post">
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit">Sign out the session</button>
+</form>
+</body>
+</html>
+`))
+
+// ConfirmSessionRevocation shows the session referenced by a revocation
+// token, as linked from new device notifications, and a form to sign it out
+func (h *Handler) ConfirmSessionRevocation(w http.ResponseWriter, r *http.Request) {
+	revokeToken := r.URL.Query().Get("token")
+
+	session, ok := h.sessionFromLink(w, revokeToken)
+	if !ok {
+		return
+	}
+
+	if session.RevokedAt != nil {
+		writeLinkResponse(w, "The session has already been signed out.\n")
+		return
+	}
+
+	// The token is in the address, keep it out of caches and referrers
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; form-action 'self'; frame-ancestors 'none'")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	err := revocationPage.Execute(w, map[string]string{
+		"ClientType": session.ClientType,
+		"SignedInAt": session.CreatedAt.UTC().Format(time.RFC1123),
+		"IP":         session.IP,
+		"Token":      revokeToken,
+	})
+	if err != nil {
+		log.Printf("Failed to render revocation page: %v", err)
+	}
+}
+
+// RevokeSessionFromLink signs out the session referenced by a revocation
+// token once the user confirmed it on the page of ConfirmSessionRevocation
+func (h *Handler) RevokeSessionFromLink(w http.ResponseWriter, r *http.Request) {
+	session, ok := h.sessionFromLink(w, r.PostFormValue("token"))
+	if !ok {
+		return
+	}
+
+	if session.RevokedAt == nil {
+		if err := h.conn.RevokeSession(session.UserId, session.Id); err != nil && !errors.Is(err, db.ErrSessionNotFound) {
+			writeSessionError(w, err)
+			return
+		}
+		log.Printf("Session %d of user %d revoked from notification link", session.Id, session.UserId)
+		h.recordAudit(r, audit.Event{
+			Type:       audit.EventSessionRevoked,
+			Outcome:    audit.Success,
+			ActorId:    session.UserId,
+			TargetType: audit.TargetSession,
+			TargetId:   strconv.FormatInt(session.Id, 10),
+			Details:    map[string]any{"via": "notification link"},
+		})
+	}
+
+	writeLinkResponse(w, "The session has been signed out. We recommend reviewing your devices and active sessions.\n")
+}
+
+// sessionFromLink looks up the session a revocation token references,
+// answering the request when that fails
+func (h *Handler) sessionFromLink(w http.ResponseWriter, revokeToken string) (*entity.Session, bool) {
+	sessionID, err := h.tokenManager.VerifyRevocationToken(revokeToken)
+	if err != nil {
+		http.Error(w, "Invalid or expired link", http.StatusBadRequest)
+		return nil, false
+	}
+
+	session, err := h.conn.GetSessionByJTI(sessionID)
+	if err != nil {
+		writeSessionError(w, err)
+		return nil, false
+	}
+	return session, true
+}
+
+func writeLinkResponse(w http.ResponseWriter, message string) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(message))
+}
+
+func (h *Handler) notifyBlockedLogin(user *entity.User, login notify.BlockedLogin) {
+	if h.notifier == nil {
+		return
+	}
+
+	login.Username, login.Email = user.Username, user.Email
+	if err := h.notifier.NotifyBlockedLogin(login); err != nil {
+		log.Printf("Failed to send blocked login notification: %v", err)
+	}
+}
+
+// notifyNewDevice tells the user by email, and webhook subscribers through
+// the outbox, about a sign-in from a new device. Both carry the location and
+// a link that signs the session out.
+func (h *Handler) notifyNewDevice(user *entity.User, session *entity.Session) {
+	if h.notifier == nil {
+		return
+	}
+
+	revokeToken, err := h.tokenManager.GenerateRevocationToken(session.JTI, session.ExpiresAt)
+	if err != nil {
+		log.Printf("Failed to create revocation link: %v", err)
+		return
+	}
+
+	login := notify.NewDeviceLogin{
+		UserID:      user.Id,
+		Username:    user.Username,
+		Email:       user.Email,
+		ClientType:  models.ClientType(session.ClientType),
+		IP:          session.IP,
+		UserAgent:   session.UserAgent,
+		SignedInAt:  session.CreatedAt,
+		RevokeToken: revokeToken,
+	}
+
+	if err := publish(h.conn, webhook.EventUserNewDevice, h.notifier.NewDeviceEvent(login)); err != nil {
+		log.Printf("Failed to publish new device event: %v", err)
+	}
+
+	if err := h.notifier.NotifyNewDevice(login); err != nil {
+		log.Printf("Failed to send new device notification: %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/auth/token"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/test_utils"
+	"github.com/joeariasc/go-auth/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func requestAs(method string, target string, claims *models.UserClaims) *http.Request {
+	r := httptest.NewRequest(method, target, nil)
+	return r.WithContext(context.WithValue(r.Context(), utils.ClaimsKey, claims))
+}
+
+func TestListSessions(t *testing.T) {
+	conn := test_utils.OpenDatabase(t)
+	h := NewHandler(HandlerConfig{Conn: conn})
+
+	user := test_utils.InsertUser(t, conn, "sessions")
+	current := test_utils.InsertSession(t, conn, user.Id, time.Now(), time.Hour)
+	other := test_utils.InsertSession(t, conn, user.Id, time.Now(), time.Hour)
+	test_utils.InsertSession(t, conn, user.Id, time.Now().Add(-2*time.Hour), time.Hour)
+
+	claims := &models.UserClaims{Username: user.Username}
+	claims.ID = current.JTI
+	w := httptest.NewRecorder()
+	h.ListSessions(w, requestAs(http.MethodGet, "/api/me/sessions", claims))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var sessions []models.SessionResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&sessions))
+
+	// The expired session is left out, the one making the request is marked
+	listed := map[int64]bool{}
+	for _, session := range sessions {
+		listed[session.ID] = session.Current
+	}
+	assert.Equal(t, map[int64]bool{current.Id: true, other.Id: false}, listed)
+}
+
+func TestListUserSessions(t *testing.T) {
+	conn := test_utils.OpenDatabase(t)
+	h := NewHandler(HandlerConfig{Conn: conn})
+
+	user := test_utils.InsertUser(t, conn, "sessions")
+	session := test_utils.InsertSession(t, conn, user.Id, time.Now(), time.Hour)
+	test_utils.InsertSession(t, conn, test_utils.InsertUser(t, conn, "sessions").Id, time.Now(), time.Hour)
+
+	r := requestAs(http.MethodGet, "/api/admin/users/"+strconv.FormatInt(user.Id, 10)+"/sessions", &models.UserClaims{Username: "support"})
+	r.SetPathValue("id", strconv.FormatInt(user.Id, 10))
+	w := httptest.NewRecorder()
+	h.ListUserSessions(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var sessions []models.SessionResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&sessions))
+	require.Len(t, sessions, 1, "only the sessions of the user in the path are listed")
+	assert.Equal(t, session.Id, sessions[0].ID)
+	assert.False(t, sessions[0].Current)
+}
+
+func TestDeleteSession(t *testing.T) {
+	conn := test_utils.OpenDatabase(t)
+	h := NewHandler(HandlerConfig{Conn: conn})
+
+	user := test_utils.InsertUser(t, conn, "sessions")
+	stranger := test_utils.InsertUser(t, conn, "sessions")
+	session := test_utils.InsertSession(t, conn, user.Id, time.Now(), time.Hour)
+
+	deleteAs := func(username string) int {
+		r := requestAs(http.MethodDelete, "/api/me/sessions/"+strconv.FormatInt(session.Id, 10), &models.UserClaims{Username: username})
+		r.SetPathValue("id", strconv.FormatInt(session.Id, 10))
+		w := httptest.NewRecorder()
+		h.DeleteSession(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusNotFound, deleteAs(stranger.Username), "sessions of other users are not found")
+	assert.Equal(t, http.StatusNoContent, deleteAs(user.Username))
+	assert.Equal(t, http.StatusNotFound, deleteAs(user.Username), "a session is only signed out once")
+
+	revoked, err := conn.GetSessionByJTI(session.JTI)
+	require.NoError(t, err)
+	assert.NotNil(t, revoked.RevokedAt)
+}
+
+func TestDeleteSessionRejectsInvalidID(t *testing.T) {
+	h := NewHandler(HandlerConfig{})
+
+	r := requestAs(http.MethodDelete, "/api/me/sessions/abc", &models.UserClaims{Username: "joe"})
+	r.SetPathValue("id", "abc")
+	w := httptest.NewRecorder()
+	h.DeleteSession(w, r)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestSessionResponse(t *testing.T) {
+	session := &entity.Session{Id: 7, JTI: "jti-1", ClientType: "web", IP: "203.0.113.7"}
+
+	assert.True(t, sessionResponse(session, "jti-1").Current)
+	assert.False(t, sessionResponse(session, "jti-2").Current)
+	assert.Equal(t, int64(7), sessionResponse(session, "").ID)
+}
+
+func TestRevokeSessionFromLinkNeedsConfirmation(t *testing.T) {
+	conn := test_utils.OpenDatabase(t)
+	tokenManager := token.NewManager(token.ManagerConfig{Conn: conn, TokenDuration: time.Hour, SecretKey: []byte("server-secret")})
+	h := NewHandler(HandlerConfig{Conn: conn, TokenManager: tokenManager})
+
+	user := test_utils.InsertUser(t, conn, "sessions")
+	session := test_utils.InsertSession(t, conn, user.Id, time.Now(), time.Hour)
+	revokeToken, err := tokenManager.GenerateRevocationToken(session.JTI, session.ExpiresAt)
+	require.NoError(t, err)
+
+	// Following the link only shows the confirmation form
+	w := httptest.NewRecorder()
+	h.ConfirmSessionRevocation(w, httptest.NewRequest(http.MethodGet, "/api/auth/sessions/revoke?token="+url.QueryEscape(revokeToken), nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<form method="post">`)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	stored, err := conn.GetSessionByJTI(session.JTI)
+	require.NoError(t, err)
+	assert.Nil(t, stored.RevokedAt)
+
+	// Submitting it signs the session out
+	r := httptest.NewRequest(http.MethodPost, "/api/auth/sessions/revoke", strings.NewReader(url.Values{"token": {revokeToken}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	h.RevokeSessionFromLink(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	stored, err = conn.GetSessionByJTI(session.JTI)
+	require.NoError(t, err)
+	assert.NotNil(t, stored.RevokedAt)
+}
+
+func TestRevokeSessionFromLinkRejectsInvalidTokens(t *testing.T) {
+	h := NewHandler(HandlerConfig{TokenManager: token.NewManager(token.ManagerConfig{SecretKey: []byte("server-secret")})})
+
+	w := httptest.NewRecorder()
+	h.ConfirmSessionRevocation(w, httptest.NewRequest(http.MethodGet, "/api/auth/sessions/revoke?token=forged", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	r := httptest.NewRequest(http.MethodPost, "/api/auth/sessions/revoke?token=forged", nil)
+	w = httptest.NewRecorder()
+	h.RevokeSessionFromLink(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "the token must be submitted with the form")
+}
@@ -16,6 +16,7 @@ func (h *Handler) Verify(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"username":   claims.Username,
 		"clientType": claims.ClientType,
+		"scope":      claims.Scope,
 		"valid":      true,
 	})
 }
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/audit"
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/webhook"
+)
+
+const (
+	defaultDeliveryPageSize = 50
+	maxDeliveryPageSize     = 500
+)
+
+func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	subscriptions, err := h.conn.ListSubscriptions()
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	response := make([]models.WebhookResponse, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		response = append(response, webhookResponse(subscription))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// CreateWebhook subscribes a URL to events. The signing secret is generated
+// here and only ever returned in this response.
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := webhook.CheckEventTypes(req.Events); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	secret, err := webhook.GenerateSecret()
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	subscription := entity.WebhookSubscription{
+		URL:         req.URL,
+		Events:      req.Events,
+		Secret:      secret,
+		Description: req.Description,
+		Active:      true,
+		CreatedAt:   time.Now(),
+	}
+	if subscription.Events == nil {
+		subscription.Events = []string{}
+	}
+
+	if err := h.conn.CreateSubscription(&subscription); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventWebhookCreated,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetWebhook,
+		TargetId:   strconv.FormatInt(subscription.Id, 10),
+		Details:    map[string]any{"url": subscription.URL, "events": subscription.Events},
+	})
+
+	response := webhookResponse(&subscription)
+	response.Secret = subscription.Secret
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *Handler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid webhook id", http.StatusBadRequest)
+		return
+	}
+
+	var req models.UpdateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Events != nil {
+		if err := webhook.CheckEventTypes(*req.Events); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	subscription, err := h.conn.GetSubscription(id)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	if req.URL != nil {
+		subscription.URL = *req.URL
+	}
+	if req.Events != nil {
+		subscription.Events = *req.Events
+	}
+	if req.Description != nil {
+		subscription.Description = *req.Description
+	}
+	if req.Active != nil {
+		subscription.Active = *req.Active
+	}
+
+	if err := h.conn.UpdateSubscription(subscription); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventWebhookUpdated,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetWebhook,
+		TargetId:   strconv.FormatInt(subscription.Id, 10),
+		Details:    map[string]any{"url": subscription.URL, "events": subscription.Events, "active": subscription.Active},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhookResponse(subscription))
+}
+
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid webhook id", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.conn.DeleteSubscription(id); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventWebhookDeleted,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetWebhook,
+		TargetId:   strconv.FormatInt(id, 10),
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListWebhookDeliveries returns the most recent deliveries, optionally
+// filtered by status. ?status=dead is the dead-letter queue.
+func (h *Handler) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	status := entity.DeliveryStatus(query.Get("status"))
+	switch status {
+	case "", entity.DeliveryPending, entity.DeliveryDelivered, entity.DeliveryDead:
+	default:
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultDeliveryPageSize
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxDeliveryPageSize)
+	}
+
+	deliveries, err := h.conn.ListDeliveries(status, limit)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	response := make([]models.WebhookDeliveryResponse, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		response = append(response, deliveryResponse(delivery))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// RetryWebhookDelivery requeues a dead-lettered delivery for immediate
+// sending with a fresh set of attempts
+func (h *Handler) RetryWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid delivery id", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.conn.RetryDelivery(id, time.Now()); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	delivery, err := h.conn.GetDelivery(id)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	h.recordAudit(r, audit.Event{
+		Type:       audit.EventWebhookRetried,
+		Outcome:    audit.Success,
+		TargetType: audit.TargetWebhook,
+		TargetId:   strconv.FormatInt(delivery.SubscriptionId, 10),
+		Details:    map[string]any{"delivery": delivery.Id, "event": delivery.EventId},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveryResponse(delivery))
+}
+
+// publish writes an event to the outbox. conn should be the transaction that
+// makes the change the event reports so that neither is committed without
+// the other.
+func publish(conn *db.Connection, eventType string, data any) error {
+	event, err := webhook.NewOutboxEvent(eventType, data, time.Now())
+	if err != nil {
+		return err
+	}
+	return conn.InsertOutboxEvent(event)
+}
+
+func webhookResponse(subscription *entity.WebhookSubscription) models.WebhookResponse {
+	return models.WebhookResponse{
+		ID:          subscription.Id,
+		URL:         subscription.URL,
+		Events:      subscription.Events,
+		Description: subscription.Description,
+		Active:      subscription.Active,
+		CreatedAt:   subscription.CreatedAt,
+	}
+}
+
+func deliveryResponse(delivery *entity.WebhookDelivery) models.WebhookDeliveryResponse {
+	return models.WebhookDeliveryResponse{
+		ID:             delivery.Id,
+		SubscriptionID: delivery.SubscriptionId,
+		URL:            delivery.URL,
+		EventID:        delivery.EventId,
+		EventType:      delivery.EventType,
+		Status:         string(delivery.Status),
+		Attempts:       delivery.Attempts,
+		NextAttemptAt:  delivery.NextAttemptAt,
+		LastError:      delivery.LastError,
+		LastStatusCode: delivery.LastStatusCode,
+		CreatedAt:      delivery.CreatedAt,
+		DeliveredAt:    delivery.DeliveredAt,
+	}
+}
+
+func writeWebhookError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, db.ErrSubscriptionNotFound):
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+	case errors.Is(err, db.ErrDeliveryNotFound):
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+	default:
+		log.Printf("Error managing webhooks: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
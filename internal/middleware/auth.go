@@ -2,10 +2,15 @@ package middleware
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
+	"strings"
 
+	"github.com/joeariasc/go-auth/internal/audit"
+	"github.com/joeariasc/go-auth/internal/auth/account"
 	"github.com/joeariasc/go-auth/internal/auth/fingerprint"
+	"github.com/joeariasc/go-auth/internal/auth/risk"
 	"github.com/joeariasc/go-auth/internal/auth/token"
 	"github.com/joeariasc/go-auth/internal/models"
 	"github.com/joeariasc/go-auth/internal/utils"
@@ -13,14 +18,33 @@ import (
 
 func (m *Middleware) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Extract token from cookie
-		cookie, err := r.Cookie("session")
-		if err != nil {
-			if errors.Is(err, http.ErrNoCookie) {
-				w.WriteHeader(http.StatusUnauthorized)
+		// Extract token from the Authorization header or the session cookie
+		tokenString, ok := bearerToken(r)
+		if !ok {
+			cookie, err := r.Cookie("session")
+			if err != nil {
+				if errors.Is(err, http.ErrNoCookie) {
+					w.Header().Set("WWW-Authenticate", `Bearer realm="go-auth"`)
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				w.WriteHeader(http.StatusBadRequest)
 				return
 			}
-			w.WriteHeader(http.StatusBadRequest)
+			tokenString = cookie.Value
+		}
+
+		// Access tokens of OAuth clients are not bound to a device
+		if token.IsServiceToken(tokenString) {
+			m.authenticateServiceToken(w, r, tokenString, next)
+			return
+		}
+		if token.IsClientToken(tokenString) {
+			m.authenticateBearerToken(w, r, tokenString, m.tokenManager.VerifyClientToken, next)
+			return
+		}
+		if token.IsPersonalToken(tokenString) {
+			m.authenticateBearerToken(w, r, tokenString, m.tokenManager.VerifyPersonalToken, next)
 			return
 		}
 
@@ -36,9 +60,6 @@ func (m *Middleware) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		//get token from cookie
-		tokenString := cookie.Value
-
 		clientFingerprint := utils.SanitizeHeader(r.Header.Get("X-Fingerprint"))
 		if clientFingerprint == "" {
 			http.Error(w, "Missing Fingerprint", http.StatusUnauthorized)
@@ -62,19 +83,157 @@ func (m *Middleware) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		// Verify token
 		claims, err := m.tokenManager.VerifyToken(tokenString, newFingerprint)
 		if err != nil {
+			m.auditLog.Record(audit.Event{
+				Type:       audit.EventTokenRejected,
+				Outcome:    audit.Failure,
+				IP:         ip,
+				ClientType: string(clientType),
+				Details:    map[string]any{"reason": err.Error(), "path": r.URL.Path},
+			})
+
 			switch {
 			case errors.Is(err, token.ErrTokenExpired):
 				http.Error(w, "Token expired", http.StatusUnauthorized)
 			case errors.Is(err, token.ErrInvalidFingerprint):
 				http.Error(w, "Invalid fingerprint", http.StatusUnauthorized)
+			case errors.Is(err, token.ErrDeviceRevoked):
+				http.Error(w, "Device removed", http.StatusUnauthorized)
+			case errors.Is(err, token.ErrSessionRevoked):
+				http.Error(w, "Session terminated", http.StatusUnauthorized)
+			case isAccountError(err):
+				writeAccountError(w, err)
 			default:
 				http.Error(w, "Invalid token", http.StatusUnauthorized)
 			}
 			return
 		}
 
+		if !m.allowedByRisk(w, r, claims, clientType, ip, fingerprintParams.UserAgent) {
+			return
+		}
+
 		// Add validated claims to request context
 		ctx := context.WithValue(r.Context(), utils.ClaimsKey, claims)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
+
+// authenticateBearerToken authenticates a request made with the access token
+// of an OAuth client or a personal access token. These are plain bearer
+// tokens, not bound to a device.
+func (m *Middleware) authenticateBearerToken(w http.ResponseWriter, r *http.Request, tokenString string, verify func(string) (*models.UserClaims, error), next http.HandlerFunc) {
+	ip, err := utils.GetIP(r)
+	if err != nil {
+		http.Error(w, "Failed to get IP", http.StatusInternalServerError)
+		return
+	}
+
+	claims, err := verify(tokenString)
+	if err != nil {
+		m.auditLog.Record(audit.Event{
+			Type:    audit.EventTokenRejected,
+			Outcome: audit.Failure,
+			IP:      ip,
+			Details: map[string]any{"reason": err.Error(), "path": r.URL.Path},
+		})
+
+		if isAccountError(err) {
+			writeAccountError(w, err)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="go-auth", error="invalid_token"`)
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	if !m.allowedByRisk(w, r, claims, "", ip, utils.SanitizeHeader(r.UserAgent())) {
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), utils.ClaimsKey, claims)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// authenticateServiceToken authenticates a request an OAuth client makes for
+// itself. There is no user whose risk could be assessed.
+func (m *Middleware) authenticateServiceToken(w http.ResponseWriter, r *http.Request, tokenString string, next http.HandlerFunc) {
+	claims, err := m.tokenManager.VerifyServiceToken(tokenString)
+	if err != nil {
+		ip, _ := utils.GetIP(r)
+		m.auditLog.Record(audit.Event{
+			Type:    audit.EventTokenRejected,
+			Outcome: audit.Failure,
+			IP:      ip,
+			Details: map[string]any{"reason": err.Error(), "path": r.URL.Path},
+		})
+
+		w.Header().Set("WWW-Authenticate", `Bearer realm="go-auth", error="invalid_token"`)
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), utils.ClaimsKey, claims)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// allowedByRisk assesses an authenticated request, answering it and returning
+// false unless the risk engine allows it. The device the token is bound to
+// was registered at sign-in, so it is never new here, and whether it is
+// trusted counts as it did at sign-in.
+func (m *Middleware) allowedByRisk(w http.ResponseWriter, r *http.Request, claims *models.UserClaims, clientType models.ClientType, ip string, userAgent string) bool {
+	assessment := m.riskEngine.Assess(&risk.Input{
+		Stage:         risk.StageVerify,
+		UserId:        claims.UserID,
+		Username:      claims.Username,
+		ClientType:    clientType,
+		IP:            ip,
+		UserAgent:     userAgent,
+		TrustedDevice: claims.TrustedDevice,
+	})
+
+	if assessment.Decision == risk.Allow {
+		return true
+	}
+
+	m.auditLog.Record(audit.Event{
+		Type:       audit.EventTokenRejected,
+		Outcome:    audit.Denied,
+		Actor:      claims.Username,
+		IP:         ip,
+		ClientType: string(clientType),
+		Details:    map[string]any{"reason": "risk", "decision": assessment.Decision, "path": r.URL.Path},
+	})
+
+	if assessment.Decision == risk.RequireMFA {
+		http.Error(w, "Additional verification required", http.StatusUnauthorized)
+		return false
+	}
+	http.Error(w, "Access denied", http.StatusForbidden)
+	return false
+}
+
+func isAccountError(err error) bool {
+	return errors.Is(err, account.ErrAccountPending) ||
+		errors.Is(err, account.ErrAccountSuspended) ||
+		errors.Is(err, account.ErrAccountDeleted)
+}
+
+func writeAccountError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             account.ErrorCode(err),
+		"error_description": err.Error(),
+	})
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
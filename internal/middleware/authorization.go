@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/joeariasc/go-auth/internal/auth/rbac"
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/utils"
+)
+
+// RequirePermission only lets requests through whose roles grant permission.
+// It must run after AuthMiddleware, e.g.
+//
+//	m.AuthMiddleware(m.RequirePermission("users:write")(handler))
+//
+// Roles are loaded when the token is verified and their permissions on every
+// request, so that changes to roles and their assignments apply immediately.
+func (m *Middleware) RequirePermission(permission string) func(next http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(utils.ClaimsKey).(*models.UserClaims)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			granted, err := m.conn.PermissionsForRoles(claims.Roles)
+			if err != nil {
+				log.Printf("Failed to resolve permissions: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			if !rbac.Allows(granted, permission) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+	}
+}
@@ -17,7 +17,7 @@ func (m *Middleware) CORSMiddleware(allowedOrigins []string) func(next http.Hand
 			}
 
 			// Set other CORS headers
-			w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+			w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
 			w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, Authorization, X-Fingerprint, X-Client-Type")
 			w.Header().Set("Access-Control-Allow-Credentials", "true")
 
@@ -1,18 +1,35 @@
 package middleware
 
 import (
+	"github.com/joeariasc/go-auth/internal/audit"
 	"github.com/joeariasc/go-auth/internal/auth/fingerprint"
+	"github.com/joeariasc/go-auth/internal/auth/risk"
 	"github.com/joeariasc/go-auth/internal/auth/token"
+	"github.com/joeariasc/go-auth/internal/db"
 )
 
 type Middleware struct {
 	fingerprintManager *fingerprint.Manager
 	tokenManager       *token.Manager
+	riskEngine         *risk.Engine
+	auditLog           *audit.Logger
+	conn               *db.Connection
 }
 
-func NewMiddleware(fm *fingerprint.Manager, tm *token.Manager) *Middleware {
+type MiddlewareConfig struct {
+	FingerprintManager *fingerprint.Manager
+	TokenManager       *token.Manager
+	RiskEngine         *risk.Engine
+	AuditLog           *audit.Logger
+	Conn               *db.Connection
+}
+
+func NewMiddleware(config MiddlewareConfig) *Middleware {
 	return &Middleware{
-		fingerprintManager: fm,
-		tokenManager:       tm,
+		fingerprintManager: config.FingerprintManager,
+		tokenManager:       config.TokenManager,
+		riskEngine:         config.RiskEngine,
+		auditLog:           config.AuditLog,
+		conn:               config.Conn,
 	}
 }
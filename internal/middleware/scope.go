@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/joeariasc/go-auth/internal/auth/scope"
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/utils"
+)
+
+// RequireScope only lets requests through whose token carries every given
+// scope. Otherwise it answers with insufficient_scope as defined by RFC 6750.
+// Like RequirePermission it must run after AuthMiddleware.
+func (m *Middleware) RequireScope(scopes ...string) func(next http.HandlerFunc) http.HandlerFunc {
+	required := scope.Format(scopes)
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(utils.ClaimsKey).(*models.UserClaims)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			if !scope.Contains(claims.Scope, scopes...) {
+				description := "The access token does not grant the required scope"
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+					`Bearer realm="go-auth", error="insufficient_scope", error_description=%q, scope=%q`,
+					description, required))
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]string{
+					"error":             "insufficient_scope",
+					"error_description": description,
+					"scope":             required,
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/joeariasc/go-auth/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireScope(t *testing.T) {
+	m := NewMiddleware(MiddlewareConfig{})
+	handler := m.RequireScope("devices", "sessions")(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	serve := func(claims *models.UserClaims) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/me/devices", nil)
+		if claims != nil {
+			r = r.WithContext(context.WithValue(r.Context(), utils.ClaimsKey, claims))
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	w := serve(&models.UserClaims{Scope: "profile devices sessions"})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = serve(&models.UserClaims{Scope: "profile devices"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), `error="insufficient_scope"`)
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), `scope="devices sessions"`)
+	assert.JSONEq(t, `{"error":"insufficient_scope","error_description":"The access token does not grant the required scope","scope":"devices sessions"}`, w.Body.String())
+
+	w = serve(nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestBearerToken(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	_, ok := bearerToken(r)
+	assert.False(t, ok)
+
+	r.Header.Set("Authorization", "Bearer abc.def.ghi")
+	token, ok := bearerToken(r)
+	assert.True(t, ok)
+	assert.Equal(t, "abc.def.ghi", token)
+
+	r.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	_, ok = bearerToken(r)
+	assert.False(t, ok)
+}
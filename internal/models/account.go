@@ -0,0 +1,52 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type AccountDeletionResponse struct {
+	Message    string    `json:"message"`
+	PurgeAfter time.Time `json:"purgeAfter"`
+}
+
+// DataExport is everything stored about a user, returned by GET /api/me/export
+type DataExport struct {
+	ExportedAt     time.Time               `json:"exportedAt"`
+	Profile        ProfileResponse         `json:"profile"`
+	Status         string                  `json:"status"`
+	Roles          []string                `json:"roles"`
+	Identities     []IdentityResponse      `json:"identities"`
+	Devices        []DeviceResponse        `json:"devices"`
+	Sessions       []SessionResponse       `json:"sessions"`
+	LoginLocations []ExportedLoginLocation `json:"loginLocations"`
+	LoginAttempts  []ExportedLoginAttempt  `json:"loginAttempts"`
+	RiskDecisions  []ExportedRiskDecision  `json:"riskDecisions"`
+	StatusHistory  []StatusChangeResponse  `json:"statusHistory"`
+	AuditEvents    []AuditEventResponse    `json:"auditEvents"`
+}
+
+type ExportedLoginLocation struct {
+	IP          string    `json:"ip"`
+	City        string    `json:"city"`
+	CountryCode string    `json:"countryCode"`
+	Latitude    float64   `json:"latitude"`
+	Longitude   float64   `json:"longitude"`
+	LoggedInAt  time.Time `json:"loggedInAt"`
+}
+
+type ExportedLoginAttempt struct {
+	IP          string    `json:"ip"`
+	Succeeded   bool      `json:"succeeded"`
+	AttemptedAt time.Time `json:"attemptedAt"`
+}
+
+type ExportedRiskDecision struct {
+	Stage      string          `json:"stage"`
+	IP         string          `json:"ip"`
+	ClientType string          `json:"clientType"`
+	Score      int             `json:"score"`
+	Decision   string          `json:"decision"`
+	Reasons    json.RawMessage `json:"reasons"`
+	CreatedAt  time.Time       `json:"createdAt"`
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type AdminUserResponse struct {
+	ID              int64      `json:"id"`
+	Username        string     `json:"username"`
+	Email           string     `json:"email,omitempty"`
+	Description     string     `json:"description"`
+	Status          string     `json:"status"`
+	StatusReason    string     `json:"statusReason,omitempty"`
+	StatusChangedAt *time.Time `json:"statusChangedAt,omitempty"`
+	Roles           []string   `json:"roles,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt"`
+}
+
+type UserListResponse struct {
+	Users  []AdminUserResponse `json:"users"`
+	Total  int                 `json:"total"`
+	Limit  int                 `json:"limit"`
+	Offset int                 `json:"offset"`
+}
+
+// UpdateUserRequest changes a user's editable fields. Omitted fields are
+// left untouched.
+type UpdateUserRequest struct {
+	Description *string `json:"description" validate:"omitempty,max=256"`
+}
+
+func (req UpdateUserRequest) Validate() error {
+	return validator.New().Struct(req)
+}
+
+type ChangeStatusRequest struct {
+	Status string `json:"status" validate:"required,oneof=pending active suspended deleted"`
+	Reason string `json:"reason" validate:"max=256"`
+}
+
+func (req ChangeStatusRequest) Validate() error {
+	return validator.New().Struct(req)
+}
+
+type StatusChangeResponse struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Reason    string    `json:"reason"`
+	ChangedBy string    `json:"changedBy"`
+	ChangedAt time.Time `json:"changedAt"`
+}
+
+type ForceLogoutResponse struct {
+	RevokedSessions       int64 `json:"revokedSessions"`
+	RevokedPersonalTokens int64 `json:"revokedPersonalTokens"`
+}
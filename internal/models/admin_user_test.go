@@ -0,0 +1,24 @@
+package models_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateUserRequestValidation(t *testing.T) {
+	description := "Support"
+	longDescription := strings.Repeat("x", 257)
+
+	assert.NoError(t, models.UpdateUserRequest{}.Validate())
+	assert.NoError(t, models.UpdateUserRequest{Description: &description}.Validate())
+	assert.Error(t, models.UpdateUserRequest{Description: &longDescription}.Validate())
+}
+
+func TestChangeStatusRequestValidation(t *testing.T) {
+	assert.NoError(t, models.ChangeStatusRequest{Status: "suspended", Reason: "Abuse report"}.Validate())
+	assert.Error(t, models.ChangeStatusRequest{}.Validate())
+	assert.Error(t, models.ChangeStatusRequest{Status: "disabled"}.Validate())
+}
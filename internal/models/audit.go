@@ -0,0 +1,26 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type AuditEventResponse struct {
+	ID         int64           `json:"id"`
+	Type       string          `json:"type"`
+	Outcome    string          `json:"outcome"`
+	ActorID    int64           `json:"actorId,omitempty"`
+	Actor      string          `json:"actor,omitempty"`
+	TargetType string          `json:"targetType,omitempty"`
+	TargetID   string          `json:"targetId,omitempty"`
+	IP         string          `json:"ip,omitempty"`
+	ClientType string          `json:"clientType,omitempty"`
+	Details    json.RawMessage `json:"details"`
+	CreatedAt  time.Time       `json:"createdAt"`
+}
+
+type AuditEventListResponse struct {
+	Events []AuditEventResponse `json:"events"`
+	// NextCursor fetches the next (older) page, empty on the last page
+	NextCursor string `json:"nextCursor,omitempty"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type DeviceResponse struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	ClientType  string    `json:"clientType"`
+	Trusted     bool      `json:"trusted"`
+	Current     bool      `json:"current"`
+	FirstSeenAt time.Time `json:"firstSeenAt"`
+	LastSeenAt  time.Time `json:"lastSeenAt"`
+}
+
+// UpdateDeviceRequest holds the fields a user may change on one of their
+// devices. Omitted fields are left untouched.
+type UpdateDeviceRequest struct {
+	Name    *string `json:"name" validate:"omitempty,max=64"`
+	Trusted *bool   `json:"trusted"`
+}
+
+func (req UpdateDeviceRequest) Validate() error {
+	return validator.New().Struct(req)
+}
@@ -0,0 +1,19 @@
+package models_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateDeviceRequestValidation(t *testing.T) {
+	name := "Work laptop"
+	longName := strings.Repeat("x", 65)
+	trusted := true
+
+	assert.NoError(t, models.UpdateDeviceRequest{}.Validate())
+	assert.NoError(t, models.UpdateDeviceRequest{Name: &name, Trusted: &trusted}.Validate())
+	assert.Error(t, models.UpdateDeviceRequest{Name: &longName}.Validate())
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// FederatedProviderResponse is an identity provider users can sign in with
+type FederatedProviderResponse struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// FederatedLoginResponse holds the address of the provider the browser is
+// sent to
+type FederatedLoginResponse struct {
+	AuthorizationURL string `json:"authorizationUrl"`
+}
+
+// CompleteFederatedLoginRequest collects the result of a sign-in at a
+// provider with the code the web client received
+type CompleteFederatedLoginRequest struct {
+	Code       string      `json:"code" validate:"required"`
+	ClientData *ClientData `json:"clientData"`
+	// Space-delimited scopes the token should carry, all allowed when empty
+	Scope string `json:"scope"`
+}
+
+func (req CompleteFederatedLoginRequest) Validate() error {
+	return validator.New().Struct(req)
+}
+
+// IdentityResponse is an identity at a provider linked to the user's account
+type IdentityResponse struct {
+	Provider    string     `json:"provider"`
+	Email       string     `json:"email,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	LastLoginAt *time.Time `json:"lastLoginAt,omitempty"`
+}
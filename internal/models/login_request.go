@@ -1,18 +1,63 @@
 package models
 
 import (
+	"strconv"
+
 	"github.com/go-playground/validator/v10"
 )
 
 type LoginRequest struct {
-	Username string `json:"username" validate:"required"`
-	Password string `json:"password" validate:"required"`
+	Username   string      `json:"username" validate:"required"`
+	Password   string      `json:"password" validate:"required"`
+	ClientData *ClientData `json:"clientData"`
+	// Space-delimited scopes the token should carry, all allowed when empty
+	Scope string `json:"scope"`
+}
+
+// ClientData carries device details reported by the client at login
+type ClientData struct {
+	ClientType       ClientType `json:"clientType"`
+	ScreenResolution string     `json:"screenResolution,omitempty"`
+	ColorDepth       string     `json:"colorDepth,omitempty"`
+	TimeZone         string     `json:"timeZone,omitempty"`
+	Language         string     `json:"language,omitempty"`
+	DeviceModel      string     `json:"deviceModel,omitempty"`
+	OSVersion        string     `json:"osVersion,omitempty"`
+	ScreenDensity    string     `json:"screenDensity,omitempty"`
+	IsEmulator       string     `json:"isEmulator,omitempty"`
+}
+
+// MobileFingerprint returns the mobile details of the client data, or nil
+// for non-mobile clients
+func (d *ClientData) MobileFingerprint(base BaseFingerprint) *MobileFingerprint {
+	if d == nil || d.ClientType != MobileClient {
+		return nil
+	}
+
+	isEmulator, _ := strconv.ParseBool(d.IsEmulator)
+
+	return &MobileFingerprint{
+		BaseFingerprint: base,
+		DeviceModel:     d.DeviceModel,
+		OSVersion:       d.OSVersion,
+		ScreenDensity:   d.ScreenDensity,
+		IsEmulator:      isEmulator,
+	}
 }
 
 type LoginResponse struct {
 	Success         bool   `json:"success"`
 	Message         string `json:"message"`
 	SessionDuration int    `json:"sessionDuration"`
+	MFARequired     bool   `json:"mfaRequired,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+	// DeletionCancelled is set when signing in withdrew a pending account deletion
+	DeletionCancelled bool `json:"deletionCancelled,omitempty"`
+}
+
+type ScopeResponse struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
 }
 
 // ValidateLoginRequest validates a login request
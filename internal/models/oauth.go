@@ -0,0 +1,148 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type CreateClientRequest struct {
+	Name         string   `json:"name" validate:"required,max=128"`
+	RedirectURIs []string `json:"redirectUris" validate:"dive,url,excludes=#"`
+	Scopes       []string `json:"scopes" validate:"required,min=1"`
+	// PostLogoutRedirectURIs are where the client may send users back to
+	// after an RP-initiated logout
+	PostLogoutRedirectURIs []string `json:"postLogoutRedirectUris" validate:"dive,url,excludes=#"`
+	// TokenEndpointAuthMethod makes the client confidential unless it is
+	// empty or "none". client_secret_* clients get a generated secret,
+	// private_key_jwt clients register their public keys as JWKS.
+	TokenEndpointAuthMethod string          `json:"tokenEndpointAuthMethod" validate:"omitempty,oneof=none client_secret_basic client_secret_post private_key_jwt"`
+	JWKS                    json.RawMessage `json:"jwks" validate:"required_if=TokenEndpointAuthMethod private_key_jwt,excluded_unless=TokenEndpointAuthMethod private_key_jwt"`
+	// Roles grant permissions to the tokens the client obtains for itself
+	Roles []string `json:"roles" validate:"dive,required"`
+}
+
+func (req CreateClientRequest) Validate() error {
+	validate := validator.New()
+	if err := validate.Struct(req); err != nil {
+		return err
+	}
+
+	// Public clients can only use the authorization code flow, which needs
+	// somewhere to redirect to
+	if req.TokenEndpointAuthMethod == "" || req.TokenEndpointAuthMethod == "none" {
+		return validate.Var(req.RedirectURIs, "min=1")
+	}
+	return nil
+}
+
+// UpdateClientRequest changes a client. Omitted fields are left untouched,
+// given lists replace the current ones.
+type UpdateClientRequest struct {
+	Name                   *string   `json:"name" validate:"omitnil,min=1,max=128"`
+	RedirectURIs           *[]string `json:"redirectUris" validate:"omitnil,min=1,dive,url,excludes=#"`
+	Scopes                 *[]string `json:"scopes" validate:"omitnil,min=1"`
+	PostLogoutRedirectURIs *[]string `json:"postLogoutRedirectUris" validate:"omitnil,dive,url,excludes=#"`
+	// JWKS replaces the keys of a private_key_jwt client
+	JWKS  json.RawMessage `json:"jwks"`
+	Roles *[]string       `json:"roles" validate:"omitnil,dive,required"`
+}
+
+func (req UpdateClientRequest) Validate() error {
+	return validator.New().Struct(req)
+}
+
+type ClientResponse struct {
+	ClientID                string          `json:"clientId"`
+	Name                    string          `json:"name"`
+	RedirectURIs            []string        `json:"redirectUris"`
+	Scopes                  []string        `json:"scopes"`
+	PostLogoutRedirectURIs  []string        `json:"postLogoutRedirectUris"`
+	TokenEndpointAuthMethod string          `json:"tokenEndpointAuthMethod"`
+	JWKS                    json.RawMessage `json:"jwks,omitempty"`
+	Roles                   []string        `json:"roles"`
+	// ClientSecret is only returned when it is generated
+	ClientSecret string    `json:"clientSecret,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// ApproveAuthorizationRequest is sent by the web client's sign-in page once
+// the signed in user decided on an authorization request. The parameters are
+// those the page received from /oauth/authorize.
+type ApproveAuthorizationRequest struct {
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	ResponseType        string `json:"response_type"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Nonce               string `json:"nonce"`
+	Approved            bool   `json:"approved"`
+}
+
+// AuthorizationResponse tells the sign-in page where to send the browser
+type AuthorizationResponse struct {
+	RedirectTo string `json:"redirectTo"`
+}
+
+// TokenResponse is the successful response of the OAuth token endpoint
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	// IDToken is issued when the openid scope was granted
+	IDToken string `json:"id_token,omitempty"`
+}
+
+// DeviceAuthorizationResponse answers a device authorization request,
+// RFC 8628 section 3.2
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// DeviceGrantResponse shows the signed in user what a device asks for
+type DeviceGrantResponse struct {
+	UserCode   string    `json:"userCode"`
+	ClientID   string    `json:"clientId"`
+	ClientName string    `json:"clientName"`
+	Scopes     []string  `json:"scopes"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// DecideDeviceGrantRequest approves or denies the request of a device
+type DecideDeviceGrantRequest struct {
+	UserCode string `json:"userCode" validate:"required"`
+	Approved bool   `json:"approved"`
+}
+
+func (req DecideDeviceGrantRequest) Validate() error {
+	return validator.New().Struct(req)
+}
+
+// IntrospectionResponse describes a token, RFC 7662 section 2.2. Inactive
+// tokens are described by Active alone.
+type IntrospectionResponse struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	JTI       string   `json:"jti,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	// SubjectType is "client" for tokens a client obtained for itself
+	SubjectType string `json:"sub_type,omitempty"`
+}
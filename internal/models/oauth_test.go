@@ -0,0 +1,82 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateClientRequestValidation(t *testing.T) {
+	valid := models.CreateClientRequest{
+		Name:         "Dashboard",
+		RedirectURIs: []string{"https://app.example.com/callback", "http://localhost:3000/callback"},
+		Scopes:       []string{"profile"},
+	}
+	assert.NoError(t, valid.Validate())
+
+	noRedirects := valid
+	noRedirects.RedirectURIs = nil
+	assert.Error(t, noRedirects.Validate())
+
+	fragment := valid
+	fragment.RedirectURIs = []string{"https://app.example.com/callback#token"}
+	assert.Error(t, fragment.Validate())
+
+	relative := valid
+	relative.RedirectURIs = []string{"/callback"}
+	assert.Error(t, relative.Validate())
+
+	assert.Error(t, models.CreateClientRequest{RedirectURIs: valid.RedirectURIs, Scopes: valid.Scopes}.Validate())
+}
+
+func TestUpdateClientRequestValidation(t *testing.T) {
+	empty := []string{}
+	redirects := []string{"https://app.example.com/callback"}
+
+	assert.NoError(t, models.UpdateClientRequest{}.Validate())
+	assert.NoError(t, models.UpdateClientRequest{RedirectURIs: &redirects}.Validate())
+	assert.Error(t, models.UpdateClientRequest{RedirectURIs: &empty}.Validate())
+	assert.Error(t, models.UpdateClientRequest{Scopes: &empty}.Validate())
+}
+
+func TestClientPostLogoutRedirectValidation(t *testing.T) {
+	req := models.CreateClientRequest{
+		Name:                   "Dashboard",
+		RedirectURIs:           []string{"https://app.example.com/callback"},
+		Scopes:                 []string{"openid"},
+		PostLogoutRedirectURIs: []string{"https://app.example.com/"},
+	}
+	assert.NoError(t, req.Validate())
+
+	req.PostLogoutRedirectURIs = []string{"logged-out"}
+	assert.Error(t, req.Validate())
+}
+
+func TestConfidentialClientValidation(t *testing.T) {
+	service := models.CreateClientRequest{
+		Name:                    "Billing job",
+		Scopes:                  []string{"users:read"},
+		TokenEndpointAuthMethod: "client_secret_basic",
+		Roles:                   []string{"auditor"},
+	}
+	assert.NoError(t, service.Validate(), "confidential clients need no redirect URI")
+
+	public := service
+	public.TokenEndpointAuthMethod = "none"
+	assert.Error(t, public.Validate())
+
+	unknown := service
+	unknown.TokenEndpointAuthMethod = "client_secret_jwt"
+	assert.Error(t, unknown.Validate())
+
+	keys := service
+	keys.TokenEndpointAuthMethod = "private_key_jwt"
+	assert.Error(t, keys.Validate(), "private_key_jwt clients must register keys")
+	keys.JWKS = []byte(`{"keys":[]}`)
+	assert.NoError(t, keys.Validate())
+
+	secretWithKeys := service
+	secretWithKeys.JWKS = []byte(`{"keys":[]}`)
+	assert.Error(t, secretWithKeys.Validate())
+}
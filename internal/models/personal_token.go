@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// CreatePersonalTokenRequest creates a personal access token. A token expires
+// after ExpiresInDays, at most a year.
+type CreatePersonalTokenRequest struct {
+	Name          string   `json:"name" validate:"required,max=128"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,required"`
+	ExpiresInDays int      `json:"expiresInDays" validate:"required,min=1,max=365"`
+}
+
+func (req CreatePersonalTokenRequest) Validate() error {
+	return validator.New().Struct(req)
+}
+
+type PersonalTokenResponse struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	// Hint is the start of the token, to tell tokens apart
+	Hint       string     `json:"hint"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	// Token is only returned when the token is created
+	Token string `json:"token,omitempty"`
+}
@@ -0,0 +1,20 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreatePersonalTokenRequestValidation(t *testing.T) {
+	assert.NoError(t, models.CreatePersonalTokenRequest{Name: "CI", Scopes: []string{"profile"}, ExpiresInDays: 1}.Validate())
+	assert.NoError(t, models.CreatePersonalTokenRequest{Name: "CI", Scopes: []string{"profile", "devices"}, ExpiresInDays: 365}.Validate())
+
+	assert.Error(t, models.CreatePersonalTokenRequest{}.Validate())
+	assert.Error(t, models.CreatePersonalTokenRequest{Name: "CI"}.Validate())
+	assert.Error(t, models.CreatePersonalTokenRequest{Name: "CI", Scopes: []string{""}}.Validate())
+	assert.Error(t, models.CreatePersonalTokenRequest{Name: "CI", Scopes: []string{"profile"}, ExpiresInDays: 366}.Validate())
+	assert.Error(t, models.CreatePersonalTokenRequest{Name: "CI", Scopes: []string{"profile"}}.Validate(), "tokens must expire")
+	assert.Error(t, models.CreatePersonalTokenRequest{Name: "CI", Scopes: []string{"profile"}, ExpiresInDays: -1}.Validate())
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type ProfileResponse struct {
+	Username      string    `json:"username"`
+	Description   string    `json:"description"`
+	Email         string    `json:"email,omitempty"`
+	EmailVerified bool      `json:"emailVerified"`
+	MFAEnabled    bool      `json:"mfaEnabled"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// UpdateProfileRequest changes the caller's own profile. Omitted fields are
+// left untouched, an empty email removes it.
+type UpdateProfileRequest struct {
+	Description *string `json:"description" validate:"omitempty,min=1,max=256"`
+	Email       *string `json:"email" validate:"omitnil,max=254"`
+}
+
+func (req UpdateProfileRequest) Validate() error {
+	validate := validator.New()
+	if err := validate.Struct(req); err != nil {
+		return err
+	}
+	if req.Email != nil && *req.Email != "" {
+		return validate.Var(*req.Email, "email")
+	}
+	return nil
+}
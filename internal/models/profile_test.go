@@ -0,0 +1,20 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateProfileRequestValidation(t *testing.T) {
+	description := "Backend developer"
+	email := "joe@example.com"
+	noEmail := ""
+	badEmail := "not-an-email"
+
+	assert.NoError(t, models.UpdateProfileRequest{}.Validate())
+	assert.NoError(t, models.UpdateProfileRequest{Description: &description, Email: &email}.Validate())
+	assert.NoError(t, models.UpdateProfileRequest{Email: &noEmail}.Validate())
+	assert.Error(t, models.UpdateProfileRequest{Email: &badEmail}.Validate())
+}
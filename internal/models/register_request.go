@@ -5,6 +5,7 @@ import "github.com/go-playground/validator/v10"
 type RegisterRequest struct {
 	Username    string `json:"username" validate:"required"`
 	Description string `json:"description" validate:"required"`
+	Email       string `json:"email" validate:"omitempty,email"`
 }
 
 func (req RegisterRequest) Validate() error {
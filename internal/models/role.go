@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type CreateRoleRequest struct {
+	Name        string   `json:"name" validate:"required"`
+	Description string   `json:"description" validate:"max=256"`
+	Permissions []string `json:"permissions"`
+	// Provisionable lets SCIM clients manage the role as a group
+	Provisionable bool `json:"provisionable"`
+}
+
+func (req CreateRoleRequest) Validate() error {
+	return validator.New().Struct(req)
+}
+
+// UpdateRoleRequest changes a role. Omitted fields are left untouched, a
+// given permission list replaces the current one.
+type UpdateRoleRequest struct {
+	Description   *string   `json:"description" validate:"omitempty,max=256"`
+	Permissions   *[]string `json:"permissions"`
+	Provisionable *bool     `json:"provisionable"`
+}
+
+func (req UpdateRoleRequest) Validate() error {
+	return validator.New().Struct(req)
+}
+
+type CreatePermissionRequest struct {
+	Name        string `json:"name" validate:"required"`
+	Description string `json:"description" validate:"required,max=256"`
+}
+
+func (req CreatePermissionRequest) Validate() error {
+	return validator.New().Struct(req)
+}
+
+type RoleResponse struct {
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	Permissions   []string  `json:"permissions"`
+	Provisionable bool      `json:"provisionable"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+type PermissionResponse struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type UserRolesResponse struct {
+	ID       int64    `json:"id"`
+	Username string   `json:"username"`
+	Roles    []string `json:"roles"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type SessionResponse struct {
+	ID         int64      `json:"id"`
+	ClientType string     `json:"clientType"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"userAgent"`
+	Current    bool       `json:"current"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt time.Time  `json:"lastUsedAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
@@ -2,9 +2,49 @@ package models
 
 import "github.com/golang-jwt/jwt/v5"
 
+// Subject types of access tokens. Tokens without one are user tokens.
+const (
+	SubjectUser   = "user"
+	SubjectClient = "client"
+)
+
 type UserClaims struct {
 	jwt.RegisteredClaims
-	Username    string `json:"username"`
-	Fingerprint string `json:"fingerprint"`
-	ClientType  string `json:"client_type"`
+	Username    string   `json:"username"`
+	Fingerprint string   `json:"fingerprint"`
+	ClientType  string   `json:"client_type"`
+	Roles       []string `json:"roles,omitempty"`
+	Scope       string   `json:"scope,omitempty"`
+	// ClientID is set on access tokens issued to OAuth clients
+	ClientID string `json:"client_id,omitempty"`
+	// SubjectType tells whether the token acts for a user or, for tokens of
+	// the client credentials grant, for the client itself
+	SubjectType string `json:"sub_type,omitempty"`
+	// PersonalTokenID is set when the request was made with a personal access
+	// token. Those are opaque, so these claims are never signed.
+	PersonalTokenID int64 `json:"-"`
+	// UserID and TrustedDevice are filled in when the token is verified, for
+	// the risk assessment of the request. They are never signed either.
+	UserID        int64 `json:"-"`
+	TrustedDevice bool  `json:"-"`
+}
+
+// IsClient reports whether the token's subject is an OAuth client rather than
+// a user. Such tokens have no Username.
+func (c *UserClaims) IsClient() bool {
+	return c.SubjectType == SubjectClient
+}
+
+// Actor names who a token acts for in audit records
+func (c *UserClaims) Actor() string {
+	if c.IsClient() {
+		return "client:" + c.ClientID
+	}
+	return c.Username
+}
+
+// IsPersonalToken reports whether the claims are those of a personal access
+// token rather than of a session
+func (c *UserClaims) IsPersonalToken() bool {
+	return c.PersonalTokenID != 0
 }
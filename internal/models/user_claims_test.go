@@ -3,9 +3,16 @@ package models_test
 import (
 	"testing"
 
+	"github.com/joeariasc/go-auth/internal/models"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestUserClaims(t *testing.T) {
-	assert.True(t, true)
+	user := &models.UserClaims{Username: "joe", ClientID: "spa"}
+	assert.False(t, user.IsClient())
+	assert.Equal(t, "joe", user.Actor())
+
+	client := &models.UserClaims{ClientID: "billing-job", SubjectType: models.SubjectClient}
+	assert.True(t, client.IsClient())
+	assert.Equal(t, "client:billing-job", client.Actor())
 }
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// CreateWebhookRequest subscribes a URL to events. An empty event list
+// subscribes to every event. Events are checked against webhook.EventTypes
+// by the handler.
+type CreateWebhookRequest struct {
+	URL         string   `json:"url" validate:"required,http_url,max=2048"`
+	Events      []string `json:"events"`
+	Description string   `json:"description" validate:"max=256"`
+}
+
+func (req CreateWebhookRequest) Validate() error {
+	return validator.New().Struct(req)
+}
+
+// UpdateWebhookRequest changes a subscription. Omitted fields are left
+// untouched, a given event list replaces the current one.
+type UpdateWebhookRequest struct {
+	URL         *string   `json:"url" validate:"omitnil,http_url,max=2048"`
+	Events      *[]string `json:"events"`
+	Description *string   `json:"description" validate:"omitnil,max=256"`
+	Active      *bool     `json:"active"`
+}
+
+func (req UpdateWebhookRequest) Validate() error {
+	return validator.New().Struct(req)
+}
+
+type WebhookResponse struct {
+	ID          int64     `json:"id"`
+	URL         string    `json:"url"`
+	Events      []string  `json:"events"`
+	Description string    `json:"description"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// Secret is only returned when the subscription is created
+	Secret string `json:"secret,omitempty"`
+}
+
+type WebhookDeliveryResponse struct {
+	ID             int64      `json:"id"`
+	SubscriptionID int64      `json:"subscriptionId"`
+	URL            string     `json:"url"`
+	EventID        string     `json:"eventId"`
+	EventType      string     `json:"eventType"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"nextAttemptAt"`
+	LastError      string     `json:"lastError,omitempty"`
+	LastStatusCode int        `json:"lastStatusCode,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	DeliveredAt    *time.Time `json:"deliveredAt,omitempty"`
+}
@@ -0,0 +1,29 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateWebhookRequestValidation(t *testing.T) {
+	assert.NoError(t, models.CreateWebhookRequest{URL: "https://example.com/hooks"}.Validate())
+	assert.NoError(t, models.CreateWebhookRequest{
+		URL:    "http://localhost:9000/hooks",
+		Events: []string{"user.registered", "user.locked_out", "user.password_changed"},
+	}.Validate())
+
+	assert.Error(t, models.CreateWebhookRequest{}.Validate())
+	assert.Error(t, models.CreateWebhookRequest{URL: "ftp://example.com"}.Validate())
+}
+
+func TestUpdateWebhookRequestValidation(t *testing.T) {
+	url := "https://example.com/hooks"
+	badURL := "not a url"
+	events := []string{"user.logged_in"}
+
+	assert.NoError(t, models.UpdateWebhookRequest{}.Validate())
+	assert.NoError(t, models.UpdateWebhookRequest{URL: &url, Events: &events}.Validate())
+	assert.Error(t, models.UpdateWebhookRequest{URL: &badURL}.Validate())
+}
@@ -0,0 +1,176 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/geoip"
+	"github.com/joeariasc/go-auth/internal/models"
+)
+
+// NewDeviceLogin describes a sign-in from a fingerprint never seen before
+type NewDeviceLogin struct {
+	UserID      int64
+	Username    string
+	Email       string
+	ClientType  models.ClientType
+	IP          string
+	UserAgent   string
+	SignedInAt  time.Time
+	RevokeToken string
+}
+
+// NewDeviceEvent is the data of the user.new_device webhook event. Like the
+// email, it tells where the sign-in came from and links to signing it out.
+type NewDeviceEvent struct {
+	UserID     int64           `json:"userId"`
+	Username   string          `json:"username"`
+	ClientType string          `json:"clientType"`
+	IP         string          `json:"ip"`
+	UserAgent  string          `json:"userAgent"`
+	Location   *geoip.Location `json:"location,omitempty"`
+	RevokeURL  string          `json:"revokeUrl"`
+}
+
+// BlockedLogin describes a sign-in refused by the risk engine even though the
+// credentials were correct
+type BlockedLogin struct {
+	Username   string
+	Email      string
+	ClientType models.ClientType
+	IP         string
+	UserAgent  string
+	AttemptAt  time.Time
+}
+
+// Notifier sends security notifications to users by email. Other systems
+// learn about the same events through webhook subscriptions.
+type Notifier struct {
+	mailer  Mailer
+	locator geoip.Locator
+	baseURL string
+}
+
+type NotifierConfig struct {
+	Mailer  Mailer
+	Locator geoip.Locator // optional
+	BaseURL string        // public URL used to build links in messages
+}
+
+func NewNotifier(config NotifierConfig) *Notifier {
+	mailer := config.Mailer
+	if mailer == nil {
+		mailer = LogMailer{}
+	}
+
+	return &Notifier{
+		mailer:  mailer,
+		locator: config.Locator,
+		baseURL: strings.TrimRight(config.BaseURL, "/"),
+	}
+}
+
+// NotifyNewDevice emails the user when they have an address on file
+func (n *Notifier) NotifyNewDevice(login NewDeviceLogin) error {
+	if login.Email == "" {
+		return nil
+	}
+
+	location := n.locate(login.IP)
+	revokeURL := n.revokeURL(login.RevokeToken)
+
+	err := n.mailer.Send(Message{
+		To:      login.Email,
+		Subject: "New sign-in to your account",
+		Body: fmt.Sprintf(`Hi %s,
+
+Your account was just signed in to from a new device.
+
+  Time:       %s
+  Client:     %s
+  Location:   %s (%s)
+  User agent: %s
+
+If this was you, you can ignore this message. If it wasn't, open the link
+below to sign out that session:
+
+%s
+`, login.Username, login.SignedInAt.UTC().Format(time.RFC1123), login.ClientType,
+			location, login.IP, login.UserAgent, revokeURL),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send new device email: %w", err)
+	}
+	return nil
+}
+
+// NewDeviceEvent describes a sign-in from a new device for webhook receivers
+func (n *Notifier) NewDeviceEvent(login NewDeviceLogin) NewDeviceEvent {
+	return NewDeviceEvent{
+		UserID:     login.UserID,
+		Username:   login.Username,
+		ClientType: string(login.ClientType),
+		IP:         login.IP,
+		UserAgent:  login.UserAgent,
+		Location:   n.locate(login.IP),
+		RevokeURL:  n.revokeURL(login.RevokeToken),
+	}
+}
+
+// revokeURL links to the page that signs out the session of a revocation token
+func (n *Notifier) revokeURL(revokeToken string) string {
+	return n.baseURL + "/api/auth/sessions/revoke?token=" + url.QueryEscape(revokeToken)
+}
+
+// NotifyBlockedLogin emails the user when they have an address on file. The
+// correct password was used, so the message asks them to change it if the
+// attempt was not theirs.
+func (n *Notifier) NotifyBlockedLogin(login BlockedLogin) error {
+	if login.Email == "" {
+		return nil
+	}
+
+	location := n.locate(login.IP)
+
+	err := n.mailer.Send(Message{
+		To:      login.Email,
+		Subject: "Sign-in to your account was blocked",
+		Body: fmt.Sprintf(`Hi %s,
+
+We blocked a sign-in to your account that used your correct password but
+looked unusual.
+
+  Time:       %s
+  Client:     %s
+  Location:   %s (%s)
+  User agent: %s
+
+If this was you, try again later. If it wasn't, someone knows your password
+and you should change it.
+`, login.Username, login.AttemptAt.UTC().Format(time.RFC1123), login.ClientType,
+			location, login.IP, login.UserAgent),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send blocked login email: %w", err)
+	}
+	return nil
+}
+
+func (n *Notifier) locate(ip string) *geoip.Location {
+	if n.locator == nil {
+		return nil
+	}
+
+	location, err := n.locator.Locate(ip)
+	if err != nil {
+		if !errors.Is(err, geoip.ErrNotFound) {
+			log.Printf("GeoIP lookup failed for %s: %v", ip, err)
+		}
+		return nil
+	}
+	return location
+}
@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/geoip"
+	"github.com/joeariasc/go-auth/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingMailer struct {
+	sent []Message
+	err  error
+}
+
+func (m *recordingMailer) Send(msg Message) error {
+	m.sent = append(m.sent, msg)
+	return m.err
+}
+
+type staticLocator struct{}
+
+func (staticLocator) Locate(ip string) (*geoip.Location, error) {
+	return &geoip.Location{City: "Berlin", Country: "Germany", CountryCode: "DE"}, nil
+}
+
+func newDeviceLogin() NewDeviceLogin {
+	return NewDeviceLogin{
+		Username:    "joe",
+		Email:       "joe@example.com",
+		ClientType:  models.MobileClient,
+		IP:          "203.0.113.7",
+		UserAgent:   "okhttp/4.12",
+		SignedInAt:  time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		RevokeToken: "abc.def",
+	}
+}
+
+func TestNotifyNewDevice(t *testing.T) {
+	mailer := &recordingMailer{}
+	notifier := NewNotifier(NotifierConfig{
+		Mailer:  mailer,
+		Locator: staticLocator{},
+		BaseURL: "https://auth.example.com/",
+	})
+
+	require.NoError(t, notifier.NotifyNewDevice(newDeviceLogin()))
+
+	require.Len(t, mailer.sent, 1)
+	assert.Equal(t, "joe@example.com", mailer.sent[0].To)
+	assert.Contains(t, mailer.sent[0].Body, "Berlin, Germany")
+	assert.Contains(t, mailer.sent[0].Body, "okhttp/4.12")
+	assert.Contains(t, mailer.sent[0].Body, "https://auth.example.com/api/auth/sessions/revoke?token=abc.def")
+}
+
+func TestNotifyNewDeviceWithoutEmail(t *testing.T) {
+	mailer := &recordingMailer{}
+	notifier := NewNotifier(NotifierConfig{Mailer: mailer})
+
+	login := newDeviceLogin()
+	login.Email = ""
+
+	require.NoError(t, notifier.NotifyNewDevice(login))
+	assert.Empty(t, mailer.sent)
+}
+
+func TestNotifyNewDeviceReportsFailures(t *testing.T) {
+	mailer := &recordingMailer{err: errors.New("relay down")}
+	notifier := NewNotifier(NotifierConfig{Mailer: mailer})
+
+	err := notifier.NotifyNewDevice(newDeviceLogin())
+	assert.ErrorContains(t, err, "relay down")
+}
+
+func TestNewDeviceEvent(t *testing.T) {
+	notifier := NewNotifier(NotifierConfig{Locator: staticLocator{}, BaseURL: "https://auth.example.com"})
+
+	login := newDeviceLogin()
+	login.UserID = 42
+	event := notifier.NewDeviceEvent(login)
+
+	assert.Equal(t, int64(42), event.UserID)
+	assert.Equal(t, "okhttp/4.12", event.UserAgent)
+	require.NotNil(t, event.Location)
+	assert.Equal(t, "DE", event.Location.CountryCode)
+	assert.Equal(t, "https://auth.example.com/api/auth/sessions/revoke?token=abc.def", event.RevokeURL)
+}
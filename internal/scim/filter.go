@@ -0,0 +1,140 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var attributePattern = regexp.MustCompile(`^[A-Za-z$][A-Za-z0-9_$-]*$`)
+
+// Filter is an equality filter such as `userName eq "bjensen"`. Identity
+// providers use those to look up resources before creating them, the other
+// operators and logical expressions of RFC 7644 are not supported.
+type Filter struct {
+	Attribute string
+	// Value is the compared string, or the JSON text of other literals
+	Value string
+}
+
+// ParseFilter parses the filter parameter of a query. The attribute must be
+// one of attributes, compared case-insensitively, and is returned as listed.
+func ParseFilter(expr string, attributes ...string) (*Filter, error) {
+	filter, err := parseFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, attribute := range attributes {
+		if strings.EqualFold(filter.Attribute, attribute) {
+			filter.Attribute = attribute
+			return filter, nil
+		}
+	}
+	return nil, BadRequest(ErrInvalidFilter, fmt.Sprintf("filtering on %s is not supported", filter.Attribute))
+}
+
+func parseFilter(expr string) (*Filter, error) {
+	invalid := BadRequest(ErrInvalidFilter, "only filters of the form `attribute eq \"value\"` are supported")
+
+	attribute, rest, _ := strings.Cut(strings.TrimSpace(expr), " ")
+	operator, value, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	if !strings.EqualFold(operator, "eq") {
+		return nil, invalid
+	}
+
+	attribute = trimSchema(attribute)
+	if !validAttributePath(attribute) {
+		return nil, invalid
+	}
+
+	var literal any
+	value = strings.TrimSpace(value)
+	if err := json.Unmarshal([]byte(value), &literal); err != nil {
+		return nil, invalid
+	}
+
+	switch literal := literal.(type) {
+	case string:
+		return &Filter{Attribute: attribute, Value: literal}, nil
+	case bool, float64:
+		return &Filter{Attribute: attribute, Value: value}, nil
+	default:
+		return nil, invalid
+	}
+}
+
+// Path is the target of a PATCH operation, such as `displayName`,
+// `name.givenName` or `members[value eq "2819c223"]`
+type Path struct {
+	Attribute string
+	// Filter selects values of a multi-valued attribute
+	Filter       *Filter
+	SubAttribute string
+}
+
+// ParsePath parses the path of a PATCH operation. Attributes of the core
+// schemas may carry their schema URN. Attributes of extension schemas are
+// returned whole, so they are not mistaken for core attributes.
+func ParsePath(path string) (Path, error) {
+	if !strings.HasPrefix(strings.ToLower(path), "urn:") {
+		return parsePath(path)
+	}
+
+	trimmed := trimSchema(path)
+	if trimmed == path {
+		return Path{Attribute: path}, nil
+	}
+	return parsePath(trimmed)
+}
+
+func parsePath(path string) (Path, error) {
+	invalid := BadRequest(ErrInvalidPath, fmt.Sprintf("invalid path %q", path))
+
+	var parsed Path
+	if open := strings.IndexByte(path, '['); open >= 0 {
+		end := strings.LastIndexByte(path, ']')
+		if end < open {
+			return Path{}, invalid
+		}
+
+		filter, err := parseFilter(path[open+1 : end])
+		if err != nil {
+			return Path{}, err
+		}
+
+		parsed.Attribute, parsed.Filter = path[:open], filter
+		if rest := path[end+1:]; rest != "" {
+			if rest[0] != '.' {
+				return Path{}, invalid
+			}
+			parsed.SubAttribute = rest[1:]
+		}
+	} else {
+		parsed.Attribute, parsed.SubAttribute, _ = strings.Cut(path, ".")
+	}
+
+	if strings.HasSuffix(path, ".") || !attributePattern.MatchString(parsed.Attribute) {
+		return Path{}, invalid
+	}
+	if parsed.SubAttribute != "" && !attributePattern.MatchString(parsed.SubAttribute) {
+		return Path{}, invalid
+	}
+	return parsed, nil
+}
+
+// trimSchema removes the URN of a core schema from an attribute name
+func trimSchema(attribute string) string {
+	for _, schema := range []string{SchemaUser, SchemaGroup} {
+		if len(attribute) > len(schema) && strings.EqualFold(attribute[:len(schema)], schema) && attribute[len(schema)] == ':' {
+			return attribute[len(schema)+1:]
+		}
+	}
+	return attribute
+}
+
+func validAttributePath(attribute string) bool {
+	name, sub, found := strings.Cut(attribute, ".")
+	return attributePattern.MatchString(name) && (!found || attributePattern.MatchString(sub))
+}
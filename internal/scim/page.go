@@ -0,0 +1,43 @@
+package scim
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// Page is the part of a query result a client asks for, RFC 7644 section
+// 3.4.2.4. StartIndex counts from 1.
+type Page struct {
+	StartIndex int
+	Count      int
+}
+
+// ParsePage reads the startIndex and count parameters of a query. Values out
+// of range are clamped as the RFC requires, count is at most maxCount.
+func ParsePage(query url.Values, defaultCount int, maxCount int) (Page, error) {
+	page := Page{StartIndex: 1, Count: defaultCount}
+
+	if value := query.Get("startIndex"); value != "" {
+		startIndex, err := strconv.Atoi(value)
+		if err != nil {
+			return Page{}, BadRequest(ErrInvalidValue, "invalid startIndex")
+		}
+		page.StartIndex = max(startIndex, 1)
+	}
+
+	if value := query.Get("count"); value != "" {
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			return Page{}, BadRequest(ErrInvalidValue, "invalid count")
+		}
+		page.Count = max(count, 0)
+	}
+
+	page.Count = min(page.Count, maxCount)
+	return page, nil
+}
+
+// Offset is the number of results skipped before the page
+func (p Page) Offset() int {
+	return p.StartIndex - 1
+}
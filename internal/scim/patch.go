@@ -0,0 +1,253 @@
+package scim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	opAdd     = "add"
+	opRemove  = "remove"
+	opReplace = "replace"
+)
+
+// PatchRequest is the body of a PATCH request, RFC 7644 section 3.5.2
+type PatchRequest struct {
+	Schemas    []string    `json:"schemas"`
+	Operations []Operation `json:"Operations"`
+}
+
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ApplyUserPatch applies the operations to a user. Changes to attributes
+// users do not have are ignored.
+func ApplyUserPatch(user *User, patch PatchRequest) error {
+	return applyPatch(patch, user.apply)
+}
+
+// ApplyGroupPatch applies the operations to a group
+func ApplyGroupPatch(group *Group, patch PatchRequest) error {
+	return applyPatch(patch, group.apply)
+}
+
+type applyFunc func(op string, path Path, value json.RawMessage) error
+
+func applyPatch(patch PatchRequest, apply applyFunc) error {
+	if len(patch.Operations) == 0 {
+		return BadRequest(ErrInvalidSyntax, "no operations given")
+	}
+
+	for _, operation := range patch.Operations {
+		op := strings.ToLower(operation.Op)
+		if op != opAdd && op != opRemove && op != opReplace {
+			return BadRequest(ErrInvalidSyntax, fmt.Sprintf("unsupported operation %q", operation.Op))
+		}
+
+		if operation.Path != "" {
+			path, err := ParsePath(operation.Path)
+			if err != nil {
+				return err
+			}
+			if err := apply(op, path, operation.Value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Without a path the value holds the attributes to change
+		if op == opRemove {
+			return BadRequest(ErrNoTarget, "remove operations need a path")
+		}
+
+		var attributes map[string]json.RawMessage
+		if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+			return BadRequest(ErrInvalidValue, "the value of an operation without a path must be an object")
+		}
+
+		// Apply in a fixed order so results do not depend on map iteration
+		names := make([]string, 0, len(attributes))
+		for name := range attributes {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		for _, name := range names {
+			path, err := ParsePath(name)
+			if err != nil {
+				return err
+			}
+			if err := apply(op, path, attributes[name]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (u *User) apply(op string, path Path, value json.RawMessage) error {
+	switch strings.ToLower(path.Attribute) {
+	case "username":
+		if op == opRemove {
+			return BadRequest(ErrMutability, "userName is required")
+		}
+		return decodeValue(value, &u.UserName)
+	case "displayname":
+		return setString(op, value, &u.DisplayName)
+	case "externalid":
+		return setString(op, value, &u.ExternalID)
+	case "active":
+		if op == opRemove {
+			u.Active = nil
+			return nil
+		}
+		active, err := ParseBool(value)
+		if err != nil {
+			return err
+		}
+		u.Active = &active
+	case "emails":
+		return u.applyEmails(op, path, value)
+	}
+	return nil
+}
+
+// applyEmails changes the addresses of a user. Accounts have a single
+// address, so the value of a selected address replaces the primary one.
+func (u *User) applyEmails(op string, path Path, value json.RawMessage) error {
+	switch {
+	case op == opRemove:
+		u.Emails = nil
+	case path.SubAttribute != "":
+		if !strings.EqualFold(path.SubAttribute, "value") {
+			return nil
+		}
+
+		var address string
+		if err := decodeValue(value, &address); err != nil {
+			return err
+		}
+		u.Emails = []Email{{Value: address, Primary: true}}
+	default:
+		var emails []Email
+		if err := decodeValue(value, &emails); err != nil {
+			return err
+		}
+		if op == opAdd {
+			emails = append(emails, u.Emails...)
+		}
+		u.Emails = emails
+	}
+	return nil
+}
+
+func (g *Group) apply(op string, path Path, value json.RawMessage) error {
+	switch strings.ToLower(path.Attribute) {
+	case "displayname":
+		if op == opRemove {
+			return BadRequest(ErrMutability, "displayName is required")
+		}
+		return decodeValue(value, &g.DisplayName)
+	case "members":
+		return g.applyMembers(op, path, value)
+	}
+	return nil
+}
+
+func (g *Group) applyMembers(op string, path Path, value json.RawMessage) error {
+	if path.Filter != nil && !strings.EqualFold(path.Filter.Attribute, "value") {
+		return BadRequest(ErrInvalidFilter, "members can only be selected by value")
+	}
+
+	if op == opRemove {
+		switch {
+		case path.Filter != nil:
+			g.removeMembers(path.Filter.Value)
+		case isEmpty(value):
+			g.Members = nil
+		default:
+			// Some providers name the members to remove in the value
+			var members []Member
+			if err := decodeValue(value, &members); err != nil {
+				return err
+			}
+			for _, member := range members {
+				g.removeMembers(member.Value)
+			}
+		}
+		return nil
+	}
+
+	var members []Member
+	if err := decodeValue(value, &members); err != nil {
+		return err
+	}
+
+	if op == opReplace {
+		if path.Filter != nil {
+			g.removeMembers(path.Filter.Value)
+		} else {
+			g.Members = nil
+		}
+	}
+
+	for _, member := range members {
+		if !slices.ContainsFunc(g.Members, func(m Member) bool { return m.Value == member.Value }) {
+			g.Members = append(g.Members, member)
+		}
+	}
+	return nil
+}
+
+func (g *Group) removeMembers(value string) {
+	g.Members = slices.DeleteFunc(g.Members, func(m Member) bool { return m.Value == value })
+}
+
+// ParseBool reads a boolean value. Some identity providers send booleans as
+// the strings "True" and "False".
+func ParseBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil && !isEmpty(value) {
+		return b, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		switch strings.ToLower(s) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return false, BadRequest(ErrInvalidValue, fmt.Sprintf("%s is not a boolean", value))
+}
+
+func setString(op string, value json.RawMessage, s *string) error {
+	if op == opRemove {
+		*s = ""
+		return nil
+	}
+	return decodeValue(value, s)
+}
+
+func decodeValue(value json.RawMessage, v any) error {
+	if isEmpty(value) {
+		return BadRequest(ErrInvalidValue, "a value is required")
+	}
+	if err := json.Unmarshal(value, v); err != nil {
+		return BadRequest(ErrInvalidValue, fmt.Sprintf("invalid value %s", value))
+	}
+	return nil
+}
+
+func isEmpty(value json.RawMessage) bool {
+	value = bytes.TrimSpace(value)
+	return len(value) == 0 || bytes.Equal(value, []byte("null"))
+}
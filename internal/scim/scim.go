@@ -0,0 +1,156 @@
+// Package scim implements the parts of SCIM 2.0 (RFC 7643 and RFC 7644) that
+// identity providers use to provision users and groups: the core resources,
+// equality filters, paging and PATCH operations.
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// ContentType is the media type of SCIM requests and responses
+const ContentType = "application/scim+json"
+
+const (
+	SchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// Error types of RFC 7644 section 3.12
+const (
+	ErrInvalidFilter = "invalidFilter"
+	ErrInvalidSyntax = "invalidSyntax"
+	ErrInvalidPath   = "invalidPath"
+	ErrInvalidValue  = "invalidValue"
+	ErrNoTarget      = "noTarget"
+	ErrUniqueness    = "uniqueness"
+	ErrMutability    = "mutability"
+)
+
+// Error is a SCIM error response. Type is empty for errors that have none,
+// such as a missing resource.
+type Error struct {
+	Status int
+	Type   string
+	Detail string
+}
+
+func NewError(status int, scimType string, detail string) *Error {
+	return &Error{Status: status, Type: scimType, Detail: detail}
+}
+
+// BadRequest is an error with status 400, the status of every error type
+// except uniqueness
+func BadRequest(scimType string, detail string) *Error {
+	return NewError(http.StatusBadRequest, scimType, detail)
+}
+
+func (e *Error) Error() string {
+	if e.Type == "" {
+		return e.Detail
+	}
+	return e.Type + ": " + e.Detail
+}
+
+func (e *Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Schemas []string `json:"schemas"`
+		Type    string   `json:"scimType,omitempty"`
+		Detail  string   `json:"detail,omitempty"`
+		Status  string   `json:"status"`
+	}{[]string{SchemaError}, e.Type, e.Detail, strconv.Itoa(e.Status)})
+}
+
+// Write sends v as a SCIM response
+func Write(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// WriteError sends err as a SCIM error response
+func WriteError(w http.ResponseWriter, err *Error) {
+	Write(w, err.Status, err)
+}
+
+// Meta describes a resource, RFC 7643 section 3.1
+type Meta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	Location     string    `json:"location"`
+}
+
+type Email struct {
+	Value   string `json:"value" validate:"required,email"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// Member refers to a member of a group, or to a group of a user
+type Member struct {
+	Value   string `json:"value" validate:"required"`
+	Ref     string `json:"$ref,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+// User is the User resource of RFC 7643 section 4.1. Attributes without a
+// counterpart on accounts, such as name, are accepted and ignored.
+type User struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	ExternalID  string   `json:"externalId,omitempty" validate:"max=256"`
+	UserName    string   `json:"userName" validate:"required,max=256"`
+	DisplayName string   `json:"displayName,omitempty" validate:"max=256"`
+	// Active is nil when a request leaves it out
+	Active *bool   `json:"active,omitempty"`
+	Emails []Email `json:"emails,omitempty" validate:"dive"`
+	// Groups are read only, they are changed through the groups
+	Groups []Member `json:"groups,omitempty"`
+	Meta   *Meta    `json:"meta,omitempty"`
+}
+
+func (u User) Validate() error {
+	return validator.New().Struct(u)
+}
+
+// PrimaryEmail returns the address marked primary, or the first one
+func (u User) PrimaryEmail() string {
+	for _, email := range u.Emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+	if len(u.Emails) > 0 {
+		return u.Emails[0].Value
+	}
+	return ""
+}
+
+// Group is the Group resource of RFC 7643 section 4.2
+type Group struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	DisplayName string   `json:"displayName" validate:"required,max=256"`
+	Members     []Member `json:"members,omitempty" validate:"dive"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+func (g Group) Validate() error {
+	return validator.New().Struct(g)
+}
+
+// ListResponse is the result of a query, RFC 7644 section 3.4.2
+type ListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    any      `json:"Resources"`
+}
@@ -0,0 +1,238 @@
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFilter(t *testing.T) {
+	filter, err := ParseFilter(`userName eq "bjensen@example.com"`, "userName", "externalId")
+	require.NoError(t, err)
+	assert.Equal(t, &Filter{Attribute: "userName", Value: "bjensen@example.com"}, filter)
+
+	filter, err = ParseFilter(`  USERNAME EQ "say \"hi\"" `, "userName")
+	require.NoError(t, err)
+	assert.Equal(t, &Filter{Attribute: "userName", Value: `say "hi"`}, filter)
+
+	filter, err = ParseFilter(`urn:ietf:params:scim:schemas:core:2.0:User:externalId eq "00u1"`, "userName", "externalId")
+	require.NoError(t, err)
+	assert.Equal(t, &Filter{Attribute: "externalId", Value: "00u1"}, filter)
+
+	for _, expr := range []string{
+		``,
+		`userName`,
+		`userName sw "b"`,
+		`userName eq bjensen`,
+		`userName eq "a" and externalId eq "b"`,
+		`userName eq null`,
+		`userName pr`,
+		`displayName eq "Barbara"`,
+	} {
+		_, err := ParseFilter(expr, "userName", "externalId")
+		var scimErr *Error
+		require.ErrorAs(t, err, &scimErr, expr)
+		assert.Equal(t, ErrInvalidFilter, scimErr.Type, expr)
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected Path
+	}{
+		{"displayName", Path{Attribute: "displayName"}},
+		{"name.givenName", Path{Attribute: "name", SubAttribute: "givenName"}},
+		{`members[value eq "2819c223"]`, Path{Attribute: "members", Filter: &Filter{Attribute: "value", Value: "2819c223"}}},
+		{`emails[type eq "work"].value`, Path{Attribute: "emails", Filter: &Filter{Attribute: "type", Value: "work"}, SubAttribute: "value"}},
+		{`emails[primary eq true].value`, Path{Attribute: "emails", Filter: &Filter{Attribute: "primary", Value: "true"}, SubAttribute: "value"}},
+		{"urn:ietf:params:scim:schemas:core:2.0:User:active", Path{Attribute: "active"}},
+		{
+			"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager",
+			Path{Attribute: "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager"},
+		},
+	}
+
+	for _, test := range tests {
+		path, err := ParsePath(test.path)
+		require.NoError(t, err, test.path)
+		assert.Equal(t, test.expected, path, test.path)
+	}
+
+	for _, path := range []string{"", "1st", "members[", `members[value eq "x"]value`, "name.", `members[value gt "x"]`} {
+		_, err := ParsePath(path)
+		assert.Error(t, err, path)
+	}
+}
+
+func TestParsePage(t *testing.T) {
+	page, err := ParsePage(url.Values{}, 50, 100)
+	require.NoError(t, err)
+	assert.Equal(t, Page{StartIndex: 1, Count: 50}, page)
+	assert.Equal(t, 0, page.Offset())
+
+	page, err = ParsePage(url.Values{"startIndex": {"21"}, "count": {"10"}}, 50, 100)
+	require.NoError(t, err)
+	assert.Equal(t, Page{StartIndex: 21, Count: 10}, page)
+	assert.Equal(t, 20, page.Offset())
+
+	// Out of range values are clamped rather than rejected
+	page, err = ParsePage(url.Values{"startIndex": {"-3"}, "count": {"1000"}}, 50, 100)
+	require.NoError(t, err)
+	assert.Equal(t, Page{StartIndex: 1, Count: 100}, page)
+
+	page, err = ParsePage(url.Values{"count": {"-1"}}, 50, 100)
+	require.NoError(t, err)
+	assert.Equal(t, 0, page.Count)
+
+	_, err = ParsePage(url.Values{"count": {"ten"}}, 50, 100)
+	assert.Error(t, err)
+}
+
+func TestApplyUserPatch(t *testing.T) {
+	active := true
+	user := User{
+		UserName: "bjensen",
+		Active:   &active,
+		Emails:   []Email{{Value: "bjensen@example.com", Primary: true}},
+	}
+
+	// As sent by Microsoft Entra ID
+	var patch PatchRequest
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [
+			{"op": "Replace", "path": "displayName", "value": "Barbara Jensen"},
+			{"op": "Replace", "path": "emails[type eq \"work\"].value", "value": "barbara@example.com"},
+			{"op": "Add", "path": "name.givenName", "value": "Barbara"},
+			{"op": "Replace", "path": "active", "value": "False"},
+			{"op": "Add", "path": "externalId", "value": "00u1"}
+		]
+	}`), &patch))
+
+	require.NoError(t, ApplyUserPatch(&user, patch))
+	assert.Equal(t, "Barbara Jensen", user.DisplayName)
+	assert.Equal(t, "barbara@example.com", user.PrimaryEmail())
+	assert.Equal(t, "00u1", user.ExternalID)
+	require.NotNil(t, user.Active)
+	assert.False(t, *user.Active)
+
+	// As sent by Okta, without a path
+	patch = PatchRequest{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "replace", "value": {"active": true, "userName": "barbara"}}]
+	}`), &patch))
+
+	require.NoError(t, ApplyUserPatch(&user, patch))
+	assert.Equal(t, "barbara", user.UserName)
+	assert.True(t, *user.Active)
+
+	patch = PatchRequest{Operations: []Operation{{Op: "remove", Path: "emails"}, {Op: "remove", Path: "externalId"}}}
+	require.NoError(t, ApplyUserPatch(&user, patch))
+	assert.Empty(t, user.PrimaryEmail())
+	assert.Empty(t, user.ExternalID)
+}
+
+func TestApplyUserPatchRejectsInvalidOperations(t *testing.T) {
+	tests := []struct {
+		name       string
+		operations []Operation
+		scimType   string
+	}{
+		{"no operations", nil, ErrInvalidSyntax},
+		{"unknown operation", []Operation{{Op: "move", Path: "displayName", Value: json.RawMessage(`"x"`)}}, ErrInvalidSyntax},
+		{"remove without path", []Operation{{Op: "remove"}}, ErrNoTarget},
+		{"remove user name", []Operation{{Op: "remove", Path: "userName"}}, ErrMutability},
+		{"value not an object", []Operation{{Op: "replace", Value: json.RawMessage(`"x"`)}}, ErrInvalidValue},
+		{"missing value", []Operation{{Op: "replace", Path: "displayName"}}, ErrInvalidValue},
+		{"wrong type", []Operation{{Op: "replace", Path: "displayName", Value: json.RawMessage(`42`)}}, ErrInvalidValue},
+		{"not a boolean", []Operation{{Op: "replace", Path: "active", Value: json.RawMessage(`"yes"`)}}, ErrInvalidValue},
+		{"invalid path", []Operation{{Op: "replace", Path: "display name", Value: json.RawMessage(`"x"`)}}, ErrInvalidPath},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ApplyUserPatch(&User{UserName: "bjensen"}, PatchRequest{Operations: test.operations})
+
+			var scimErr *Error
+			require.ErrorAs(t, err, &scimErr)
+			assert.Equal(t, test.scimType, scimErr.Type)
+			assert.Equal(t, http.StatusBadRequest, scimErr.Status)
+		})
+	}
+}
+
+func TestApplyGroupPatch(t *testing.T) {
+	group := Group{DisplayName: "Engineering", Members: []Member{{Value: "1"}, {Value: "2"}}}
+
+	apply := func(operations ...Operation) {
+		t.Helper()
+		require.NoError(t, ApplyGroupPatch(&group, PatchRequest{Operations: operations}))
+	}
+	values := func() []string {
+		var values []string
+		for _, member := range group.Members {
+			values = append(values, member.Value)
+		}
+		return values
+	}
+
+	apply(Operation{Op: "add", Path: "members", Value: json.RawMessage(`[{"value": "2"}, {"value": "3"}]`)})
+	assert.Equal(t, []string{"1", "2", "3"}, values())
+
+	apply(Operation{Op: "remove", Path: `members[value eq "1"]`})
+	assert.Equal(t, []string{"2", "3"}, values())
+
+	// Microsoft Entra ID names the removed members in the value
+	apply(Operation{Op: "Remove", Path: "members", Value: json.RawMessage(`[{"value": "3"}]`)})
+	assert.Equal(t, []string{"2"}, values())
+
+	apply(Operation{Op: "replace", Value: json.RawMessage(`{"displayName": "Platform", "members": [{"value": "4"}, {"value": "5"}]}`)})
+	assert.Equal(t, "Platform", group.DisplayName)
+	assert.Equal(t, []string{"4", "5"}, values())
+
+	apply(Operation{Op: "remove", Path: "members"})
+	assert.Empty(t, group.Members)
+
+	err := ApplyGroupPatch(&group, PatchRequest{Operations: []Operation{{Op: "remove", Path: `members[display eq "x"]`}}})
+	assert.Error(t, err)
+}
+
+func TestParseBool(t *testing.T) {
+	for value, expected := range map[string]bool{`true`: true, `false`: false, `"True"`: true, `"false"`: false} {
+		b, err := ParseBool(json.RawMessage(value))
+		require.NoError(t, err, value)
+		assert.Equal(t, expected, b, value)
+	}
+
+	for _, value := range []string{`1`, `"yes"`, `null`, ``} {
+		_, err := ParseBool(json.RawMessage(value))
+		assert.Error(t, err, value)
+	}
+}
+
+func TestPrimaryEmail(t *testing.T) {
+	assert.Empty(t, User{}.PrimaryEmail())
+	assert.Equal(t, "a@example.com", User{Emails: []Email{{Value: "a@example.com"}, {Value: "b@example.com"}}}.PrimaryEmail())
+	assert.Equal(t, "b@example.com", User{Emails: []Email{{Value: "a@example.com"}, {Value: "b@example.com", Primary: true}}}.PrimaryEmail())
+}
+
+func TestWriteError(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	WriteError(recorder, NewError(http.StatusConflict, ErrUniqueness, "userName is already taken"))
+
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Equal(t, ContentType, recorder.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:Error"],
+		"scimType": "uniqueness",
+		"detail": "userName is already taken",
+		"status": "409"
+	}`, recorder.Body.String())
+}
@@ -0,0 +1,80 @@
+package test_utils
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db"
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/utils"
+)
+
+// OpenDatabase connects to the PostgreSQL database named by TEST_DATABASE_URL
+// and creates the schema. Tests that need a database are skipped when the
+// variable is not set.
+func OpenDatabase(t *testing.T) *db.Connection {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	conn, err := db.NewConnection(url)
+	if err != nil {
+		t.Fatalf("failed to open the test database: %v", err)
+	}
+	t.Cleanup(func() { conn.DB.Close() })
+	return conn
+}
+
+// InsertUser stores a user with a unique name starting with prefix. Tests
+// share the database, so each works on users of its own.
+func InsertUser(t *testing.T, conn *db.Connection, prefix string) *entity.User {
+	t.Helper()
+
+	suffix, err := utils.GenerateRandomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &entity.User{
+		Username:    prefix + "-" + suffix[:12],
+		CreatedAt:   time.Now(),
+		Description: "Test User",
+		Secret:      "mocksecret",
+	}
+	id, err := conn.Insert(user)
+	if err != nil {
+		t.Fatalf("failed to insert user: %v", err)
+	}
+	user.Id = int64(id)
+	return user
+}
+
+// InsertSession stores a web session of the user created at createdAt and
+// expiring ttl later
+func InsertSession(t *testing.T, conn *db.Connection, userId int64, createdAt time.Time, ttl time.Duration) *entity.Session {
+	t.Helper()
+
+	jti, err := utils.GenerateRandomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session := &entity.Session{
+		JTI:        jti,
+		UserId:     userId,
+		ClientType: "web",
+		IP:         "203.0.113.7",
+		UserAgent:  "test",
+		Scope:      "profile sessions",
+		CreatedAt:  createdAt,
+		ExpiresAt:  createdAt.Add(ttl),
+	}
+	if session.Id, err = conn.CreateSession(session); err != nil {
+		t.Fatalf("failed to insert session: %v", err)
+	}
+	return session
+}
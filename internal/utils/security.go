@@ -23,3 +23,12 @@ func GenerateRandomSalt() string {
 	}
 	return hex.EncodeToString(salt)
 }
+
+// GenerateRandomID returns a random 128-bit identifier encoded as hex
+func GenerateRandomID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
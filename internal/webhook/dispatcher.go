@@ -0,0 +1,166 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+)
+
+// Store is implemented by db.Connection
+type Store interface {
+	FanOutOutbox(limit int, now time.Time) (int, error)
+	ClaimDueDeliveries(now time.Time, lease time.Duration, limit int) ([]*entity.WebhookDelivery, error)
+	UpdateDelivery(delivery *entity.WebhookDelivery) error
+}
+
+// Dispatcher moves events from the outbox to subscriptions and posts them,
+// retrying failed deliveries with exponential backoff until they succeed or
+// run out of attempts and are dead-lettered
+type Dispatcher struct {
+	store       Store
+	client      *http.Client
+	interval    time.Duration
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	batchSize   int
+	now         func() time.Time
+}
+
+type DispatcherConfig struct {
+	Store       Store
+	Client      *http.Client // optional
+	Interval    time.Duration
+	MaxAttempts int
+	BaseBackoff time.Duration // delay after the first failure, doubled for each further one
+	MaxBackoff  time.Duration
+}
+
+func NewDispatcher(config DispatcherConfig) *Dispatcher {
+	client := config.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &Dispatcher{
+		store:       config.Store,
+		client:      client,
+		interval:    config.Interval,
+		maxAttempts: config.MaxAttempts,
+		baseBackoff: config.BaseBackoff,
+		maxBackoff:  config.MaxBackoff,
+		batchSize:   100,
+		now:         time.Now,
+	}
+}
+
+// Run dispatches every interval until the context is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.DispatchOnce(); err != nil {
+			log.Printf("Webhook dispatch failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchOnce fans out new outbox events and attempts every due delivery
+func (d *Dispatcher) DispatchOnce() error {
+	for {
+		n, err := d.store.FanOutOutbox(d.batchSize, d.now())
+		if err != nil {
+			return err
+		}
+		if n < d.batchSize {
+			break
+		}
+	}
+
+	// Deliveries stay claimed for longer than a request may take
+	lease := d.client.Timeout + time.Minute
+
+	deliveries, err := d.store.ClaimDueDeliveries(d.now(), lease, d.batchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		d.attempt(delivery)
+		if err := d.store.UpdateDelivery(delivery); err != nil {
+			log.Printf("Failed to record webhook delivery %d: %v", delivery.Id, err)
+		}
+	}
+	return nil
+}
+
+// attempt posts a delivery and updates it with the outcome
+func (d *Dispatcher) attempt(delivery *entity.WebhookDelivery) {
+	now := d.now()
+	delivery.Attempts++
+
+	statusCode, err := d.post(delivery, now)
+	delivery.LastStatusCode = statusCode
+
+	if err == nil {
+		delivery.Status = entity.DeliveryDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= d.maxAttempts {
+		delivery.Status = entity.DeliveryDead
+		log.Printf("Webhook delivery %d of %s to %s dead-lettered after %d attempts: %v",
+			delivery.Id, delivery.EventType, delivery.URL, delivery.Attempts, err)
+		return
+	}
+	delivery.NextAttemptAt = now.Add(d.Backoff(delivery.Attempts))
+}
+
+func (d *Dispatcher) post(delivery *entity.WebhookDelivery, now time.Time) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-auth-webhooks")
+	req.Header.Set(EventIDHeader, delivery.EventId)
+	req.Header.Set(EventTypeHeader, delivery.EventType)
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, now, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Backoff is the delay before retrying a delivery that failed attempts times
+func (d *Dispatcher) Backoff(attempts int) time.Duration {
+	delay := d.baseBackoff
+	for i := 1; i < attempts && delay < d.maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, d.maxBackoff)
+}
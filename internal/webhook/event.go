@@ -0,0 +1,88 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/joeariasc/go-auth/internal/utils"
+)
+
+// Event types published to subscriptions
+const (
+	EventUserRegistered    = "user.registered"
+	EventUserLoggedIn      = "user.logged_in"
+	EventUserNewDevice     = "user.new_device"
+	EventUserLoggedOut     = "user.logged_out"
+	EventUserLockedOut     = "user.locked_out"
+	EventUserStatusChanged = "user.status_changed"
+	EventPasswordChanged   = "user.password_changed"
+)
+
+// EventTypes lists the events subscriptions can filter on
+var EventTypes = []string{
+	EventUserRegistered,
+	EventUserLoggedIn,
+	EventUserNewDevice,
+	EventUserLoggedOut,
+	EventUserLockedOut,
+	EventUserStatusChanged,
+	EventPasswordChanged,
+}
+
+// CheckEventTypes returns an error naming the first event that is not one of
+// EventTypes
+func CheckEventTypes(events []string) error {
+	for _, event := range events {
+		if !slices.Contains(EventTypes, event) {
+			return fmt.Errorf("unknown event type %q", event)
+		}
+	}
+	return nil
+}
+
+// Envelope is the JSON body posted to receivers
+type Envelope struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurredAt"`
+	Data       any       `json:"data"`
+}
+
+// UserEvent is the data of the user.* events
+type UserEvent struct {
+	UserID     int64  `json:"userId"`
+	Username   string `json:"username"`
+	ClientType string `json:"clientType,omitempty"`
+	IP         string `json:"ip,omitempty"`
+	Status     string `json:"status,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// NewOutboxEvent wraps data in an envelope ready to be written to the outbox
+func NewOutboxEvent(eventType string, data any, occurredAt time.Time) (*entity.OutboxEvent, error) {
+	id, err := utils.GenerateRandomID()
+	if err != nil {
+		return nil, err
+	}
+
+	occurredAt = occurredAt.UTC()
+	payload, err := json.Marshal(Envelope{
+		ID:         id,
+		Type:       eventType,
+		OccurredAt: occurredAt,
+		Data:       data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.OutboxEvent{
+		EventId:    id,
+		Type:       eventType,
+		Payload:    payload,
+		OccurredAt: occurredAt,
+	}, nil
+}
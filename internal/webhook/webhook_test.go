@@ -0,0 +1,220 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/joeariasc/go-auth/internal/db/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore mimics the outbox and delivery tables
+type memoryStore struct {
+	subscriptions []*entity.WebhookSubscription
+	outbox        []*entity.OutboxEvent
+	deliveries    []*entity.WebhookDelivery
+}
+
+func (s *memoryStore) FanOutOutbox(limit int, now time.Time) (int, error) {
+	n := 0
+	for _, event := range s.outbox {
+		if event.DispatchedAt != nil || n == limit {
+			continue
+		}
+		for _, subscription := range s.subscriptions {
+			if !subscription.Active || (len(subscription.Events) > 0 && !slices.Contains(subscription.Events, event.Type)) {
+				continue
+			}
+			s.deliveries = append(s.deliveries, &entity.WebhookDelivery{
+				Id:             int64(len(s.deliveries) + 1),
+				SubscriptionId: subscription.Id,
+				OutboxEventId:  event.Id,
+				Status:         entity.DeliveryPending,
+				NextAttemptAt:  now,
+				URL:            subscription.URL,
+				Secret:         subscription.Secret,
+				EventId:        event.EventId,
+				EventType:      event.Type,
+				Payload:        event.Payload,
+			})
+		}
+		event.DispatchedAt = &now
+		n++
+	}
+	return n, nil
+}
+
+func (s *memoryStore) ClaimDueDeliveries(now time.Time, lease time.Duration, limit int) ([]*entity.WebhookDelivery, error) {
+	due := []*entity.WebhookDelivery{}
+	for _, delivery := range s.deliveries {
+		if delivery.Status == entity.DeliveryPending && !delivery.NextAttemptAt.After(now) && len(due) < limit {
+			delivery.NextAttemptAt = now.Add(lease)
+			copy := *delivery
+			due = append(due, &copy)
+		}
+	}
+	return due, nil
+}
+
+func (s *memoryStore) UpdateDelivery(delivery *entity.WebhookDelivery) error {
+	*s.deliveries[delivery.Id-1] = *delivery
+	return nil
+}
+
+func (s *memoryStore) publish(t *testing.T, eventType string, data any) {
+	event, err := NewOutboxEvent(eventType, data, time.Now())
+	require.NoError(t, err)
+	event.Id = int64(len(s.outbox) + 1)
+	s.outbox = append(s.outbox, event)
+}
+
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+func newTestDispatcher(store Store, c *clock, maxAttempts int) *Dispatcher {
+	d := NewDispatcher(DispatcherConfig{
+		Store:       store,
+		Interval:    time.Second,
+		MaxAttempts: maxAttempts,
+		BaseBackoff: 30 * time.Second,
+		MaxBackoff:  time.Hour,
+	})
+	d.now = c.Now
+	return d
+}
+
+func TestDeliverSignedEvent(t *testing.T) {
+	var received Envelope
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		err := VerifySignature("s3cret", r.Header.Get(SignatureHeader), body, 5*time.Minute, time.Now())
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, EventUserRegistered, r.Header.Get(EventTypeHeader))
+		require.NoError(t, json.Unmarshal(body, &received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	store := &memoryStore{subscriptions: []*entity.WebhookSubscription{
+		{Id: 1, URL: receiver.URL, Secret: "s3cret", Active: true, Events: []string{EventUserRegistered}},
+		{Id: 2, URL: receiver.URL, Secret: "other", Active: true, Events: []string{EventUserLoggedIn}},
+	}}
+	store.publish(t, EventUserRegistered, UserEvent{UserID: 7, Username: "joe"})
+
+	c := &clock{now: time.Now()}
+	require.NoError(t, newTestDispatcher(store, c, 5).DispatchOnce())
+
+	require.Len(t, store.deliveries, 1, "only the matching subscription gets a delivery")
+	delivery := store.deliveries[0]
+	assert.Equal(t, entity.DeliveryDelivered, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, http.StatusNoContent, delivery.LastStatusCode)
+
+	assert.Equal(t, EventUserRegistered, received.Type)
+	assert.Equal(t, "joe", received.Data.(map[string]any)["username"])
+}
+
+func TestRetryWithBackoffThenSucceed(t *testing.T) {
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	store := &memoryStore{subscriptions: []*entity.WebhookSubscription{
+		{Id: 1, URL: receiver.URL, Secret: "s3cret", Active: true},
+	}}
+	store.publish(t, EventUserLoggedIn, UserEvent{UserID: 7, Username: "joe"})
+
+	start := time.Now()
+	c := &clock{now: start}
+	d := newTestDispatcher(store, c, 5)
+
+	require.NoError(t, d.DispatchOnce())
+	delivery := store.deliveries[0]
+	assert.Equal(t, entity.DeliveryPending, delivery.Status)
+	assert.Equal(t, start.Add(30*time.Second), delivery.NextAttemptAt)
+	assert.Equal(t, http.StatusServiceUnavailable, delivery.LastStatusCode)
+
+	// Not due yet
+	c.now = start.Add(10 * time.Second)
+	require.NoError(t, d.DispatchOnce())
+	assert.Equal(t, int32(1), calls.Load())
+
+	c.now = start.Add(30 * time.Second)
+	require.NoError(t, d.DispatchOnce())
+	assert.Equal(t, c.now.Add(time.Minute), store.deliveries[0].NextAttemptAt)
+
+	c.now = c.now.Add(time.Minute)
+	require.NoError(t, d.DispatchOnce())
+	assert.Equal(t, entity.DeliveryDelivered, store.deliveries[0].Status)
+	assert.Equal(t, 3, store.deliveries[0].Attempts)
+	assert.Empty(t, store.deliveries[0].LastError)
+}
+
+func TestDeadLetterAfterMaxAttempts(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	store := &memoryStore{subscriptions: []*entity.WebhookSubscription{
+		{Id: 1, URL: receiver.URL, Secret: "s3cret", Active: true},
+	}}
+	store.publish(t, EventUserLockedOut, UserEvent{UserID: 7, Username: "joe"})
+
+	c := &clock{now: time.Now()}
+	d := newTestDispatcher(store, c, 2)
+
+	require.NoError(t, d.DispatchOnce())
+	c.now = c.now.Add(time.Hour)
+	require.NoError(t, d.DispatchOnce())
+
+	delivery := store.deliveries[0]
+	assert.Equal(t, entity.DeliveryDead, delivery.Status)
+	assert.Equal(t, 2, delivery.Attempts)
+	assert.Contains(t, delivery.LastError, "500")
+}
+
+func TestBackoff(t *testing.T) {
+	d := NewDispatcher(DispatcherConfig{BaseBackoff: 30 * time.Second, MaxBackoff: 10 * time.Minute})
+
+	assert.Equal(t, 30*time.Second, d.Backoff(1))
+	assert.Equal(t, time.Minute, d.Backoff(2))
+	assert.Equal(t, 8*time.Minute, d.Backoff(5))
+	assert.Equal(t, 10*time.Minute, d.Backoff(6))
+	assert.Equal(t, 10*time.Minute, d.Backoff(50))
+}
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	now := time.Unix(1700000000, 0)
+	header := Sign("s3cret", now, body)
+
+	assert.NoError(t, VerifySignature("s3cret", header, body, time.Minute, now.Add(30*time.Second)))
+	assert.ErrorIs(t, VerifySignature("wrong", header, body, time.Minute, now), ErrInvalidSignature)
+	assert.ErrorIs(t, VerifySignature("s3cret", header, []byte(`{"id":"2"}`), time.Minute, now), ErrInvalidSignature)
+	assert.ErrorIs(t, VerifySignature("s3cret", header, body, time.Minute, now.Add(2*time.Minute)), ErrInvalidSignature)
+	assert.ErrorIs(t, VerifySignature("s3cret", "garbage", body, time.Minute, now), ErrInvalidSignature)
+}
+
+func TestCheckEventTypes(t *testing.T) {
+	assert.NoError(t, CheckEventTypes(nil))
+	assert.NoError(t, CheckEventTypes([]string{EventUserRegistered, EventPasswordChanged}))
+	assert.ErrorContains(t, CheckEventTypes([]string{EventUserLoggedIn, "user.deleted"}), `"user.deleted"`)
+}